@@ -6,6 +6,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"time"
 
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -50,6 +51,13 @@ func main() {
 	go responseInClient(client, clientName, done)
 	go responseModClient(client, clientName, done)
 	go responseOutClient(client, clientName, done)
+	go flowOutClient(client, clientName, done)
+
+	// print the hook order once the clients are registered
+	go func() {
+		time.Sleep(time.Second)
+		printHooks(client)
+	}()
 
 	// Keep the client running until interrupted
 	select {
@@ -258,6 +266,43 @@ func responseOutClient(client pb.ProxyServiceClient, clientName string, done cha
 	}
 }
 
+func flowOutClient(client pb.ProxyServiceClient, clientName string, done chan<- struct{}) {
+	// only the heads of the messages are printed, so there is no need to
+	// receive the bodies, and missing a flow when the client is slow is
+	// better than being disconnected
+	stream, err := client.FlowOut(context.TODO(), &pb.Register{
+		Name:     clientName,
+		Filter:   &pb.HookFilter{OmitBodies: true},
+		Overflow: "drop",
+	})
+	if err != nil {
+		log.Fatalf("Failed to start stream: %v", err)
+	}
+	fmt.Printf("Registered client: %s", clientName)
+
+	// Goroutine to receive server messages
+	for {
+		f, err := stream.Recv()
+		if err == io.EOF {
+			log.Println("Server closed stream")
+			close(done)
+			return
+		}
+		if err != nil {
+			log.Printf("Stream error: %v", err)
+			close(done)
+			return
+		}
+
+		status := int32(0)
+		if f.Response != nil {
+			status = f.Response.StatusCode
+		}
+		fmt.Printf("Received Flow:\n  FlowID: %s\n  URL: %s\n  Status: %d\n  Total: %.1fms\n  Error: %s\n",
+			f.Id, f.Request.GetUrl(), status, f.Meta.GetTotalMs(), f.Error)
+	}
+}
+
 func printConfig(client pb.ProxyServiceClient) {
 	config, err := client.GetConfig(context.TODO(), &pb.Null{})
 	if err != nil {
@@ -270,6 +315,34 @@ func printConfig(client pb.ProxyServiceClient) {
 	fmt.Printf("ScopeExcludedExtensions: %+v\n", config.ScopeExcludedExtensions)
 }
 
+func printHooks(client pb.ProxyServiceClient) {
+	chains, err := client.ListHooks(context.TODO(), &pb.Null{})
+	if err != nil {
+		log.Fatalf("Failed to list hooks: %v", err)
+	}
+	for _, chain := range []struct {
+		name  string
+		hooks []*pb.HookInfo
+	}{
+		{"RequestIn", chains.RequestIn},
+		{"RequestMod", chains.RequestMod},
+		{"RequestOut", chains.RequestOut},
+		{"ResponseIn", chains.ResponseIn},
+		{"ResponseMod", chains.ResponseMod},
+		{"ResponseOut", chains.ResponseOut},
+		{"FlowOut", chains.FlowOut},
+		{"ResponseLog", chains.ResponseLog},
+	} {
+		fmt.Printf("%s hooks:\n", chain.name)
+		for _, h := range chain.hooks {
+			fmt.Printf("  %s (priority %d)\n", h.Name, h.Priority)
+		}
+	}
+	for _, p := range chains.Pipelines {
+		fmt.Printf("%s pipeline: %d dropped, %d spooled\n", p.Name, p.Dropped, p.Spooled)
+	}
+}
+
 func setProxyPrintConfig(client pb.ProxyServiceClient, value bool) {
 	config, err := client.GetConfig(context.TODO(), &pb.Null{})
 	if err != nil {
@@ -3,8 +3,10 @@ module github.com/artilugio0/efin-proxy
 go 1.25.5
 
 require (
+	github.com/andybalholm/brotli v1.2.6
 	github.com/google/uuid v1.6.0
 	github.com/gorilla/websocket v1.5.3
+	github.com/klauspost/compress v1.20.1
 	github.com/spf13/cobra v1.9.1
 	google.golang.org/grpc v1.71.1
 	google.golang.org/protobuf v1.36.4
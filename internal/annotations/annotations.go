@@ -0,0 +1,196 @@
+package annotations
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Colors are the colours flows can be highlighted with
+var Colors = []string{"red", "orange", "yellow", "green", "cyan", "blue", "purple", "pink", "gray"}
+
+// Annotations are the information attached to a flow by hooks, plugins and
+// users: tags, a highlight colour, a comment and custom key/value pairs.
+type Annotations struct {
+	Tags    []string          `json:"tags,omitempty"`
+	Color   string            `json:"color,omitempty"`
+	Comment string            `json:"comment,omitempty"`
+	Values  map[string]string `json:"values,omitempty"`
+}
+
+// IsZero reports whether a flow has no annotations
+func (a Annotations) IsZero() bool {
+	return len(a.Tags) == 0 && a.Color == "" && a.Comment == "" && len(a.Values) == 0
+}
+
+// HasTag reports whether the annotations have a tag
+func (a Annotations) HasTag(tag string) bool {
+	return slices.Contains(a.Tags, tag)
+}
+
+// Clone returns a copy of the annotations that shares no memory with a
+func (a Annotations) Clone() Annotations {
+	c := a
+	c.Tags = slices.Clone(a.Tags)
+	c.Values = maps.Clone(a.Values)
+	return c
+}
+
+// Validate checks that the colour is one of Colors and that tags and keys
+// are not empty and have no spaces
+func (a Annotations) Validate() error {
+	if a.Color != "" && !slices.Contains(Colors, a.Color) {
+		return fmt.Errorf("invalid color '%s', valid colors are %s", a.Color, strings.Join(Colors, ", "))
+	}
+	for _, t := range a.Tags {
+		if t == "" || strings.ContainsAny(t, " \t\r\n") {
+			return fmt.Errorf("invalid tag '%s'", t)
+		}
+	}
+	for k := range a.Values {
+		if k == "" || strings.ContainsAny(k, " \t\r\n=") {
+			return fmt.Errorf("invalid key '%s'", k)
+		}
+	}
+	return nil
+}
+
+// Edit is a change to the annotations of a flow. Nil Color and Comment are
+// left unchanged, and empty ones are removed.
+type Edit struct {
+	AddTags    []string
+	RemoveTags []string
+
+	Color   *string
+	Comment *string
+
+	SetValues    map[string]string
+	DeleteValues []string
+}
+
+// Apply applies the edit to a. Removals are applied after additions.
+func (e Edit) Apply(a *Annotations) {
+	for _, t := range e.AddTags {
+		if !a.HasTag(t) {
+			a.Tags = append(a.Tags, t)
+		}
+	}
+	a.Tags = slices.DeleteFunc(a.Tags, func(t string) bool {
+		return slices.Contains(e.RemoveTags, t)
+	})
+	if len(a.Tags) == 0 {
+		a.Tags = nil
+	}
+
+	if e.Color != nil {
+		a.Color = *e.Color
+	}
+	if e.Comment != nil {
+		a.Comment = *e.Comment
+	}
+
+	for k, v := range e.SetValues {
+		if a.Values == nil {
+			a.Values = map[string]string{}
+		}
+		a.Values[k] = v
+	}
+	for _, k := range e.DeleteValues {
+		delete(a.Values, k)
+	}
+	if len(a.Values) == 0 {
+		a.Values = nil
+	}
+}
+
+// Bag holds the annotations of a flow while it goes through the proxy. It is
+// shared by the copies of its request and response, so the annotations
+// written by a hook are seen by the hooks that run after it and saved with
+// the flow. The methods of a nil Bag do nothing.
+type Bag struct {
+	mutex       sync.Mutex
+	annotations Annotations
+}
+
+// NewBag returns a bag with a copy of the annotations
+func NewBag(a Annotations) *Bag {
+	return &Bag{annotations: a.Clone()}
+}
+
+// Get returns a copy of the annotations in the bag
+func (b *Bag) Get() Annotations {
+	if b == nil {
+		return Annotations{}
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.annotations.Clone()
+}
+
+// Replace replaces the annotations in the bag with a copy of a
+func (b *Bag) Replace(a Annotations) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.annotations = a.Clone()
+}
+
+// Edit applies an edit to the annotations in the bag
+func (b *Bag) Edit(e Edit) {
+	if b == nil {
+		return
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	e.Apply(&b.annotations)
+}
+
+// Tag adds tags to the flow
+func (b *Bag) Tag(tags ...string) {
+	b.Edit(Edit{AddTags: tags})
+}
+
+// Highlight sets the colour of the flow, one of Colors
+func (b *Bag) Highlight(color string) {
+	b.Edit(Edit{Color: &color})
+}
+
+// SetComment sets the comment of the flow
+func (b *Bag) SetComment(comment string) {
+	b.Edit(Edit{Comment: &comment})
+}
+
+// SetValue sets a custom value of the flow
+func (b *Bag) SetValue(key, value string) {
+	b.Edit(Edit{SetValues: map[string]string{key: value}})
+}
+
+type bagKeyType struct{}
+
+var bagKey = bagKeyType{}
+
+// Set returns a copy of req that carries the annotations bag
+func Set(req *http.Request, b *Bag) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), bagKey, b))
+}
+
+// Get returns the annotations bag of a request, or nil if it has none
+func Get(req *http.Request) *Bag {
+	b, _ := req.Context().Value(bagKey).(*Bag)
+	return b
+}
+
+// GetResponse returns the annotations bag of a response, which is kept in
+// the context of its request, or nil if it has none
+func GetResponse(resp *http.Response) *Bag {
+	if resp.Request == nil {
+		return nil
+	}
+	return Get(resp.Request)
+}
@@ -0,0 +1,131 @@
+// Package authz tests access control by replaying requests with the
+// credentials of other sessions and comparing the responses
+package authz
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// UnauthenticatedSession is the name of the session that replays requests
+// without credentials
+const UnauthenticatedSession = "unauthenticated"
+
+// DefaultMethods are the methods of the requests replayed when the config
+// lists none. Requests that may change state, like POST and DELETE, are only
+// replayed when their methods are listed.
+var DefaultMethods = []string{"GET", "HEAD"}
+
+// Session is an alternate identity. Its headers and cookies replace the
+// ones of the original requests.
+type Session struct {
+	Name    string            `json:"name"`
+	Headers map[string]string `json:"headers"`
+	Cookies map[string]string `json:"cookies"`
+}
+
+// Config lists the sessions used to replay requests
+type Config struct {
+	Sessions []Session `json:"sessions"`
+
+	// Unauthenticated replays requests without the Authorization and
+	// Cookie headers and the headers set by the sessions
+	Unauthenticated bool `json:"unauthenticated"`
+
+	// Methods of the requests replayed, DefaultMethods if empty
+	Methods []string `json:"methods"`
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read authz config file: %v", err)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid authz config file %s: %v", file, err)
+	}
+
+	for i, s := range config.Sessions {
+		if s.Name == "" {
+			return nil, fmt.Errorf("invalid authz config file %s: session %d has no name", file, i+1)
+		}
+		if s.Name == UnauthenticatedSession {
+			return nil, fmt.Errorf("invalid authz config file %s: session name '%s' is reserved", file, s.Name)
+		}
+		if len(s.Headers) == 0 && len(s.Cookies) == 0 {
+			return nil, fmt.Errorf("invalid authz config file %s: session '%s' has no headers nor cookies", file, s.Name)
+		}
+	}
+
+	return config, nil
+}
+
+// Apply returns a copy of the request with the credentials of the session.
+// It returns false if the request carries none of the headers and cookies
+// of the session, since replaying it would not test anything. The copy is
+// not canceled with the request, as replays run after it finishes.
+func (s Session) Apply(req *http.Request) (*http.Request, bool) {
+	applies := false
+	r := req.Clone(context.WithoutCancel(req.Context()))
+
+	for name, value := range s.Headers {
+		if r.Header.Get(name) != "" {
+			applies = true
+		}
+		r.Header.Set(name, value)
+	}
+
+	if len(s.Cookies) > 0 {
+		replaced := map[string]bool{}
+		cookies := []string{}
+		for _, c := range r.Cookies() {
+			if value, ok := s.Cookies[c.Name]; ok {
+				c.Value = value
+				replaced[c.Name] = true
+				applies = true
+			}
+			cookies = append(cookies, c.Name+"="+c.Value)
+		}
+		for name, value := range s.Cookies {
+			if !replaced[name] {
+				cookies = append(cookies, name+"="+value)
+			}
+		}
+		r.Header.Set("Cookie", strings.Join(cookies, "; "))
+	}
+
+	return r, applies
+}
+
+// credentialHeaders returns the headers removed from unauthenticated
+// requests
+func (c *Config) credentialHeaders() []string {
+	headers := []string{"Authorization", "Cookie"}
+	for _, s := range c.Sessions {
+		for name := range s.Headers {
+			headers = append(headers, name)
+		}
+	}
+	return headers
+}
+
+// unauthenticated returns a copy of the request without credentials. It
+// returns false if the request has no credentials.
+func (c *Config) unauthenticated(req *http.Request) (*http.Request, bool) {
+	applies := false
+	r := req.Clone(context.WithoutCancel(req.Context()))
+	for _, name := range c.credentialHeaders() {
+		if r.Header.Get(name) != "" {
+			applies = true
+		}
+		r.Header.Del(name)
+	}
+	return r, applies
+}
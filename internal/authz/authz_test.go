@@ -0,0 +1,264 @@
+package authz
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+// newApp returns a server where /admin is only allowed to the admin,
+// /orders/1 is returned to any user and /news to anyone
+func newApp() *httptest.Server {
+	users := map[string]string{"Bearer admin-token": "admin", "Bearer user-token": "user"}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := users[r.Header.Get("Authorization")]
+		if r.URL.Path == "/news" {
+			fmt.Fprint(w, "today's news")
+			return
+		}
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/admin":
+			if user != "admin" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, "forbidden")
+				return
+			}
+			fmt.Fprint(w, "admin panel with the list of all the users of the application")
+		case "/orders/1":
+			fmt.Fprintf(w, `{"id":1,"owner":"admin","total":100,"viewer":"%s"}`, user)
+		}
+	}))
+}
+
+func newFlow(t *testing.T, id, url string) *flow.Flow {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer admin-token")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	resp.Request = req
+
+	return &flow.Flow{ID: id, Request: req, Response: resp}
+}
+
+func TestTester(t *testing.T) {
+	app := newApp()
+	defer app.Close()
+
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+
+	config := &Config{
+		Sessions:        []Session{{Name: "user", Headers: map[string]string{"Authorization": "Bearer user-token"}}},
+		Unauthenticated: true,
+	}
+	reported := []findings.Finding{}
+	tester := NewTester(config, dbFile, func(f findings.Finding) { reported = append(reported, f) })
+
+	tests := []struct {
+		path string
+		want map[string]string
+	}{
+		{"/admin", map[string]string{"user": VerdictEnforced, UnauthenticatedSession: VerdictEnforced}},
+		{"/orders/1", map[string]string{"user": VerdictSimilar, UnauthenticatedSession: VerdictEnforced}},
+		{"/news", map[string]string{"user": VerdictBypassed, UnauthenticatedSession: VerdictBypassed}},
+	}
+
+	for _, tt := range tests {
+		f := newFlow(t, "", app.URL+tt.path)
+		id, err := hooks.SaveFlow(dbFile, f)
+		if err != nil {
+			t.Fatalf("SaveFlow() error = %v", err)
+		}
+		f.ID = id
+
+		results := tester.Test(f)
+		got := map[string]string{}
+		for _, r := range results {
+			got[r.Session] = r.Verdict
+			if r.FlowID == "" {
+				t.Errorf("replay of %s as %s not stored", tt.path, r.Session)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("verdicts for %s = %v, want %v", tt.path, got, tt.want)
+		}
+
+		links, err := hooks.LoadFlowLinks(dbFile, f.ID)
+		if err != nil {
+			t.Fatalf("LoadFlowLinks() error = %v", err)
+		}
+		if len(links) != len(results) || links[0].Kind != hooks.LinkAuthz {
+			t.Errorf("links of %s = %+v", tt.path, links)
+		}
+	}
+
+	summary := []string{}
+	for _, f := range reported {
+		summary = append(summary, fmt.Sprintf("%s %s %s %s", f.Path, f.Evidence, f.Severity, f.Source))
+	}
+	want := "/orders/1 user medium authz, /news user high authz, /news unauthenticated high authz"
+	if strings.Join(summary, ", ") != want {
+		t.Errorf("findings = %s, want %s", strings.Join(summary, ", "), want)
+	}
+}
+
+func TestTesterSkipsFlows(t *testing.T) {
+	app := newApp()
+	defer app.Close()
+
+	config := &Config{
+		Sessions: []Session{{Name: "user", Cookies: map[string]string{"session": "user"}}},
+		Methods:  []string{"GET"},
+	}
+	tester := NewTester(config, "", nil)
+
+	// the request has no session cookie
+	if results := tester.Test(newFlow(t, "1", app.URL+"/news")); len(results) != 0 {
+		t.Errorf("flow without the session cookie was replayed: %+v", results)
+	}
+
+	// unsuccessful responses are not replayed
+	f := newFlow(t, "2", app.URL+"/missing")
+	f.Request.Header.Set("Cookie", "session=admin")
+	f.Response.StatusCode = http.StatusNotFound
+	if results := tester.Test(f); len(results) != 0 {
+		t.Errorf("unsuccessful flow was replayed: %+v", results)
+	}
+
+	f = newFlow(t, "3", app.URL+"/news")
+	f.Request.Header.Set("Cookie", "session=admin")
+	f.Request.Method = "POST"
+	if results := tester.Test(f); len(results) != 0 {
+		t.Errorf("flow with other method was replayed: %+v", results)
+	}
+
+	// requests that may change state are only replayed when listed
+	tester = NewTester(&Config{Sessions: config.Sessions}, "", nil)
+	if results := tester.Test(f); len(results) != 0 {
+		t.Errorf("POST flow was replayed by default: %+v", results)
+	}
+}
+
+func TestHook(t *testing.T) {
+	app := newApp()
+	defer app.Close()
+
+	config := &Config{Sessions: []Session{{Name: "user", Headers: map[string]string{"Authorization": "Bearer user-token"}}}}
+
+	mutex := sync.Mutex{}
+	reported := []findings.Finding{}
+	tester := NewTester(config, "", func(f findings.Finding) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported = append(reported, f)
+	})
+
+	f := newFlow(t, "", app.URL+"/orders/1")
+	f.Request = ids.SetRequestID(f.Request, "7")
+	f.Response.Request = f.Request
+	f.Response = httpbytes.CloneResponse(f.Response)
+	if err := NewHook(tester)(f.Response); err != nil {
+		t.Fatalf("hook error = %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		mutex.Lock()
+		n := len(reported)
+		mutex.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if len(reported) != 1 || reported[0].FlowID != "7" || reported[0].Evidence != "user" {
+		t.Errorf("findings = %+v", reported)
+	}
+}
+
+func TestSessionApply(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://test.host.com/", nil)
+	req.Header.Set("Cookie", "session=admin; lang=en")
+	req.Header.Set("X-Api-Key", "admin-key")
+
+	s := Session{
+		Name:    "user",
+		Headers: map[string]string{"X-Api-Key": "user-key"},
+		Cookies: map[string]string{"session": "user", "csrf": "abc"},
+	}
+	r, ok := s.Apply(req)
+	if !ok {
+		t.Errorf("Apply() = false, want true")
+	}
+	if c := r.Header.Get("Cookie"); c != "session=user; lang=en; csrf=abc" {
+		t.Errorf("Cookie = %s", c)
+	}
+	if k := r.Header.Get("X-Api-Key"); k != "user-key" {
+		t.Errorf("X-Api-Key = %s", k)
+	}
+	if req.Header.Get("X-Api-Key") != "admin-key" {
+		t.Errorf("original request modified")
+	}
+
+	config := &Config{Sessions: []Session{s}}
+	r, ok = config.unauthenticated(req)
+	if !ok || r.Header.Get("Cookie") != "" || r.Header.Get("X-Api-Key") != "" {
+		t.Errorf("unauthenticated() = %v, %v", r.Header, ok)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		content string
+		wantErr bool
+	}{
+		{"valid", `{"sessions": [{"name": "bob", "headers": {"Authorization": "Bearer x"}}], "unauthenticated": true}`, false},
+		{"no name", `{"sessions": [{"headers": {"Authorization": "Bearer x"}}]}`, true},
+		{"reserved name", `{"sessions": [{"name": "unauthenticated", "cookies": {"s": "1"}}]}`, true},
+		{"no credentials", `{"sessions": [{"name": "bob"}]}`, true},
+		{"invalid json", `{`, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, tt.name+".json")
+			os.WriteFile(file, []byte(tt.content), 0644)
+
+			config, err := LoadConfig(file)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LoadConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && (len(config.Sessions) != 1 || !config.Unauthenticated) {
+				t.Errorf("config = %+v", config)
+			}
+		})
+	}
+}
@@ -0,0 +1,331 @@
+package authz
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/diff"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+const (
+	// SourceAuthz is the source of the findings reported by the tester
+	SourceAuthz = "authz"
+
+	TypeBrokenAccessControl = "broken-access-control"
+
+	DefaultConcurrency = 5
+	DefaultTimeout     = 30 * time.Second
+
+	// MaxPending is the number of flows waiting to be tested above which
+	// new flows are dropped
+	MaxPending = 1000
+
+	maxReplayBodySize = 10 * 1024 * 1024
+)
+
+// Verdicts of a replay
+const (
+	// VerdictEnforced means the replay got a different response
+	VerdictEnforced = "enforced"
+
+	// VerdictBypassed means the replay got the same status and body
+	VerdictBypassed = "bypassed"
+
+	// VerdictSimilar means the replay got the same status and a body of
+	// similar size, which may contain the same data
+	VerdictSimilar = "similar"
+)
+
+// Result is the outcome of replaying a flow with a session
+type Result struct {
+	Session string
+	FlowID  string
+	Verdict string
+	Diff    *diff.Result
+}
+
+// Tester replays flows with the sessions of its config and reports the ones
+// whose responses do not change
+type Tester struct {
+	Config *Config
+	Client *http.Client
+
+	// DBFile stores the replayed flows, linked to the original ones
+	DBFile string
+	Sink   findings.Sink
+
+	sem     chan struct{}
+	pending atomic.Int64
+}
+
+// NewTester returns a tester that reports findings to sink
+func NewTester(config *Config, dbFile string, sink findings.Sink) *Tester {
+	return &Tester{
+		Config: config,
+		Client: &http.Client{
+			Timeout: DefaultTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		DBFile: dbFile,
+		Sink:   sink,
+		sem:    make(chan struct{}, DefaultConcurrency),
+	}
+}
+
+// NewHook returns a hook that tests each response in the background, so
+// that replays do not delay the proxy
+func NewHook(t *Tester) pipeline.ReadOnlyHook[*http.Response] {
+	return func(resp *http.Response) error {
+		if resp.Request == nil || !t.shouldTest(resp.Request, resp) {
+			return nil
+		}
+
+		req := httpbytes.CloneRequest(resp.Request)
+		reqBody, err := httpbytes.ReadAndRestore(&req.Body)
+		if err != nil {
+			return err
+		}
+		respBody, err := httpbytes.ReadAndRestore(&resp.Body)
+		if err != nil {
+			return err
+		}
+
+		if t.pending.Add(1) > MaxPending {
+			t.pending.Add(-1)
+			log.Printf("Too many flows waiting for authorization tests, skipping flow %s", ids.GetResponseID(resp))
+			return nil
+		}
+
+		go func() {
+			defer t.pending.Add(-1)
+
+			t.sem <- struct{}{}
+			defer func() { <-t.sem }()
+
+			req.Body = httpbytes.NewBodyWrapper(reqBody)
+			resp.Body = httpbytes.NewBodyWrapper(respBody)
+			resp.Request = req
+			t.Test(&flow.Flow{ID: ids.GetResponseID(resp), Request: req, Response: resp})
+		}()
+
+		return nil
+	}
+}
+
+// shouldTest reports whether the flow is replayed. Only successful responses
+// are, as there is no access to bypass otherwise.
+func (t *Tester) shouldTest(req *http.Request, resp *http.Response) bool {
+	methods := t.Config.Methods
+	if len(methods) == 0 {
+		methods = DefaultMethods
+	}
+	if !slices.Contains(methods, strings.ToUpper(req.Method)) {
+		return false
+	}
+	return resp.StatusCode >= 200 && resp.StatusCode < 300
+}
+
+// Test replays a flow with each session, reports the findings and returns
+// the results. Sessions whose credentials are not in the request are
+// skipped.
+func (t *Tester) Test(f *flow.Flow) []Result {
+	if f.Request == nil || f.Response == nil || !t.shouldTest(f.Request, f.Response) {
+		return nil
+	}
+
+	reqBody, err := httpbytes.ReadAndRestore(&f.Request.Body)
+	if err != nil {
+		log.Printf("Failed to read request body of flow %s: %v", f.ID, err)
+		return nil
+	}
+
+	type variant struct {
+		session string
+		req     *http.Request
+	}
+	variants := []variant{}
+	for _, s := range t.Config.Sessions {
+		if r, ok := s.Apply(f.Request); ok {
+			variants = append(variants, variant{s.Name, r})
+		}
+	}
+	if t.Config.Unauthenticated {
+		if r, ok := t.Config.unauthenticated(f.Request); ok {
+			variants = append(variants, variant{UnauthenticatedSession, r})
+		}
+	}
+
+	results := []Result{}
+	for _, v := range variants {
+		replay, err := t.send(v.req, reqBody)
+		if err != nil {
+			log.Printf("Failed to replay flow %s as %s: %v", f.ID, v.session, err)
+			continue
+		}
+
+		d, err := diff.Compare(f, replay, diff.Options{})
+		if err != nil {
+			log.Printf("Failed to compare flow %s with its replay as %s: %v", f.ID, v.session, err)
+			continue
+		}
+
+		result := Result{
+			Session: v.session,
+			FlowID:  t.store(f.ID, replay),
+			Verdict: verdict(d),
+			Diff:    d,
+		}
+		results = append(results, result)
+
+		if result.Verdict != VerdictEnforced && t.Sink != nil {
+			t.Sink(newFinding(f, result))
+		}
+	}
+
+	return results
+}
+
+// send replays a request and returns the new flow
+func (t *Tester) send(req *http.Request, body []byte) (*flow.Flow, error) {
+	// the context of the request is canceled once the response is sent to
+	// the client, which is usually before the replay
+	r := req.Clone(context.WithoutCancel(req.Context()))
+	r.RequestURI = ""
+	if r.URL.Scheme == "" {
+		// requests read from CONNECT tunnels have no scheme
+		r.URL.Scheme = "https"
+	}
+	if r.URL.Host == "" {
+		r.URL.Host = r.Host
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	timestamp := time.Now()
+	resp, err := t.Client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := httpbytes.DecodeResponse(resp); err != nil {
+		log.Printf("Failed to decode response body: %v", err)
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxReplayBodySize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	r.Body = httpbytes.NewBodyWrapper(body)
+	resp.Body = httpbytes.NewBodyWrapper(respBody)
+	resp.Request = r
+
+	return &flow.Flow{Timestamp: timestamp, Request: r, Response: resp}, nil
+}
+
+// store saves a replayed flow linked to the original one and returns its
+// ID, or an empty string if it could not be stored
+func (t *Tester) store(originalID string, f *flow.Flow) string {
+	if t.DBFile == "" {
+		return ""
+	}
+
+	reqBody, _ := httpbytes.ReadAndRestore(&f.Request.Body)
+	respBody, _ := httpbytes.ReadAndRestore(&f.Response.Body)
+
+	id, err := hooks.SaveFlow(t.DBFile, f)
+	if err != nil {
+		log.Printf("Failed to store replay of flow %s: %v", originalID, err)
+		return ""
+	}
+	f.Request.Body = httpbytes.NewBodyWrapper(reqBody)
+	f.Response.Body = httpbytes.NewBodyWrapper(respBody)
+
+	if originalID != "" {
+		err := hooks.LinkFlow(t.DBFile, hooks.FlowLink{ID: id, OriginalID: originalID, Kind: hooks.LinkAuthz})
+		if err != nil {
+			log.Printf("Failed to link flow %s to %s: %v", id, originalID, err)
+		}
+	}
+
+	return id
+}
+
+// verdict decides whether access control was enforced from the difference
+// between the original response and the replayed one
+func verdict(d *diff.Result) string {
+	if d.OldStatus != d.NewStatus {
+		return VerdictEnforced
+	}
+	if !d.Body.Changed {
+		return VerdictBypassed
+	}
+
+	sizeDiff := max(d.Body.OldSize-d.Body.NewSize, d.Body.NewSize-d.Body.OldSize)
+	if sizeDiff <= max(10, d.Body.OldSize/20) {
+		return VerdictSimilar
+	}
+
+	return VerdictEnforced
+}
+
+func newFinding(f *flow.Flow, r Result) findings.Finding {
+	req := f.Request
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	severity := findings.SeverityHigh
+	similarity := "the same response"
+	if r.Verdict == VerdictSimilar {
+		severity = findings.SeverityMedium
+		similarity = "a similar response"
+	}
+
+	title := fmt.Sprintf("Session %s gets %s as the original request", r.Session, similarity)
+	if r.Session == UnauthenticatedSession {
+		title = fmt.Sprintf("Request without credentials gets %s as the original request", similarity)
+	}
+
+	replay := "it"
+	if r.FlowID != "" {
+		replay = "flow " + r.FlowID
+	}
+
+	return findings.Finding{
+		FlowID:   f.ID,
+		Source:   SourceAuthz,
+		Type:     TypeBrokenAccessControl,
+		Severity: severity,
+		Host:     host,
+		Path:     req.URL.Path,
+		Title:    title,
+		Detail: fmt.Sprintf(
+			"%s %s was replayed as %s (%s) and got status %d with a %d bytes body, compared to %d bytes in the original response. Access control may not be enforced.",
+			req.Method, req.URL.Path, r.Session, replay, r.Diff.NewStatus, r.Diff.Body.NewSize, r.Diff.Body.OldSize,
+		),
+		Evidence:  r.Session,
+		Timestamp: time.Now(),
+	}
+}
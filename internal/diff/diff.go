@@ -0,0 +1,233 @@
+// Package diff compares the responses of two flows
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// Kinds of changes
+const (
+	OpAdded   = "added"
+	OpRemoved = "removed"
+	OpChanged = "changed"
+)
+
+// Kinds of bodies, which determine how they are compared
+const (
+	KindText   = "text"
+	KindJSON   = "json"
+	KindBinary = "binary"
+)
+
+// Options configures a comparison
+type Options struct {
+	// IgnoreHeaders are not compared, e.g. Date
+	IgnoreHeaders []string
+}
+
+// Result is the difference between two responses
+type Result struct {
+	OldID string `json:"old_id"`
+	NewID string `json:"new_id"`
+
+	OldStatus int `json:"old_status"`
+	NewStatus int `json:"new_status"`
+
+	Headers []HeaderChange `json:"headers"`
+	Body    BodyDiff       `json:"body"`
+}
+
+// Equal reports whether no difference was found
+func (r *Result) Equal() bool {
+	return r.OldStatus == r.NewStatus && len(r.Headers) == 0 && !r.Body.Changed
+}
+
+// HeaderChange is a header added, removed or whose values changed
+type HeaderChange struct {
+	Name string   `json:"name"`
+	Op   string   `json:"op"`
+	Old  []string `json:"old,omitempty"`
+	New  []string `json:"new,omitempty"`
+}
+
+// BodyDiff is the difference between two bodies. Text bodies are compared
+// line by line, JSON bodies by key path and binary bodies only by content.
+type BodyDiff struct {
+	Kind    string `json:"kind"`
+	Changed bool   `json:"changed"`
+	OldSize int    `json:"old_size"`
+	NewSize int    `json:"new_size"`
+
+	Lines []LineChange `json:"lines,omitempty"`
+	JSON  []JSONChange `json:"json,omitempty"`
+}
+
+// Compare returns the difference between the responses of two flows
+func Compare(oldFlow, newFlow *flow.Flow, opts Options) (*Result, error) {
+	result, err := CompareResponses(oldFlow.Response, newFlow.Response, opts)
+	if err != nil {
+		return nil, err
+	}
+	result.OldID = oldFlow.ID
+	result.NewID = newFlow.ID
+	return result, nil
+}
+
+// CompareResponses returns the difference between two responses. A nil
+// response is compared as one without status, headers or body.
+func CompareResponses(oldResp, newResp *http.Response, opts Options) (*Result, error) {
+	result := &Result{}
+
+	var oldHeader, newHeader http.Header
+	var oldBody, newBody []byte
+	var err error
+	if oldResp != nil {
+		result.OldStatus = oldResp.StatusCode
+		oldHeader = oldResp.Header
+		if oldBody, err = httpbytes.ReadAndRestore(&oldResp.Body); err != nil {
+			return nil, err
+		}
+	}
+	if newResp != nil {
+		result.NewStatus = newResp.StatusCode
+		newHeader = newResp.Header
+		if newBody, err = httpbytes.ReadAndRestore(&newResp.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	result.Headers = Headers(oldHeader, newHeader, opts.IgnoreHeaders)
+	result.Body = Bodies(oldBody, newBody, oldHeader.Get("Content-Type"), newHeader.Get("Content-Type"))
+
+	return result, nil
+}
+
+// Headers returns the headers that were added, removed or changed, sorted
+// by name
+func Headers(oldHeader, newHeader http.Header, ignore []string) []HeaderChange {
+	ignored := map[string]bool{}
+	for _, name := range ignore {
+		ignored[http.CanonicalHeaderKey(name)] = true
+	}
+
+	names := []string{}
+	for name := range oldHeader {
+		names = append(names, name)
+	}
+	for name := range newHeader {
+		if _, ok := oldHeader[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	changes := []HeaderChange{}
+	for _, name := range names {
+		if ignored[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+
+		oldValues, inOld := oldHeader[name]
+		newValues, inNew := newHeader[name]
+		switch {
+		case !inOld:
+			changes = append(changes, HeaderChange{Name: name, Op: OpAdded, New: newValues})
+		case !inNew:
+			changes = append(changes, HeaderChange{Name: name, Op: OpRemoved, Old: oldValues})
+		case !slices.Equal(oldValues, newValues):
+			changes = append(changes, HeaderChange{Name: name, Op: OpChanged, Old: oldValues, New: newValues})
+		}
+	}
+
+	return changes
+}
+
+// Bodies returns the difference between two bodies given their content
+// types
+func Bodies(oldBody, newBody []byte, oldContentType, newContentType string) BodyDiff {
+	d := BodyDiff{
+		Kind:    bodyKind(oldBody, newBody, oldContentType, newContentType),
+		OldSize: len(oldBody),
+		NewSize: len(newBody),
+	}
+
+	switch d.Kind {
+	case KindJSON:
+		var oldValue, newValue any
+		if decodeJSON(oldBody, &oldValue) == nil && decodeJSON(newBody, &newValue) == nil {
+			d.JSON = JSONValues(oldValue, newValue)
+			d.Changed = len(d.JSON) > 0
+			return d
+		}
+		d.Kind = KindText
+		fallthrough
+
+	case KindText:
+		d.Lines = Lines(splitLines(string(oldBody)), splitLines(string(newBody)))
+		d.Changed = len(d.Lines) > 0
+
+	default:
+		d.Changed = !bytes.Equal(oldBody, newBody)
+	}
+
+	return d
+}
+
+func bodyKind(oldBody, newBody []byte, oldContentType, newContentType string) string {
+	if isBinary(oldBody) || isBinary(newBody) {
+		return KindBinary
+	}
+
+	if isJSONType(oldContentType) || isJSONType(newContentType) {
+		return KindJSON
+	}
+
+	// bodies sent without a JSON content type are compared as JSON only if
+	// both are objects or arrays
+	if looksLikeJSON(oldBody) && looksLikeJSON(newBody) {
+		return KindJSON
+	}
+
+	return KindText
+}
+
+func isJSONType(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mt == "application/json" || strings.HasSuffix(mt, "+json"))
+}
+
+func looksLikeJSON(body []byte) bool {
+	body = bytes.TrimSpace(body)
+	return len(body) > 0 && (body[0] == '{' || body[0] == '[') && json.Valid(body)
+}
+
+func isBinary(body []byte) bool {
+	return bytes.IndexByte(body, 0) != -1 || !utf8.Valid(body)
+}
+
+func decodeJSON(body []byte, v *any) error {
+	if len(bytes.TrimSpace(body)) == 0 {
+		*v = nil
+		return nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,219 @@
+package diff
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+)
+
+func newResponse(status int, header http.Header, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     header,
+		Body:       io.NopCloser(strings.NewReader(body)),
+	}
+}
+
+func TestLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a    string
+		b    string
+		want string
+	}{
+		{"equal", "a b c", "a b c", ""},
+		{"added", "a c", "a b c", "+2:b"},
+		{"removed", "a b c", "a c", "-2:b"},
+		{"replaced", "a b c", "a x c", "-2:b +2:x"},
+		{"empty old", "", "a b", "+1:a +2:b"},
+		{"moved", "a b c d", "b c d a", "-1:a +4:a"},
+		{"interleaved", "a b c a b b a", "c b a b a c", "-1:a -2:b +2:b -6:b +6:c"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, c := range Lines(strings.Fields(tt.a), strings.Fields(tt.b)) {
+				if c.Op == OpAdded {
+					got = append(got, fmt.Sprintf("+%d:%s", c.NewLine, c.Text))
+				} else {
+					got = append(got, fmt.Sprintf("-%d:%s", c.OldLine, c.Text))
+				}
+			}
+			if strings.Join(got, " ") != tt.want {
+				t.Errorf("Lines() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// apply rebuilds b from a and the changes returned by Lines
+func apply(a []string, changes []LineChange) []string {
+	removed := map[int]bool{}
+	added := map[int]string{}
+	for _, c := range changes {
+		if c.Op == OpRemoved {
+			removed[c.OldLine] = true
+		} else {
+			added[c.NewLine] = c.Text
+		}
+	}
+
+	kept := []string{}
+	for i, line := range a {
+		if !removed[i+1] {
+			kept = append(kept, line)
+		}
+	}
+
+	b := []string{}
+	for len(kept) > 0 || len(added) > 0 {
+		if line, ok := added[len(b)+1]; ok {
+			b = append(b, line)
+			delete(added, len(b))
+			continue
+		}
+		b = append(b, kept[0])
+		kept = kept[1:]
+	}
+	return b
+}
+
+func TestLinesApply(t *testing.T) {
+	a := strings.Split("x y z x x y z y y x z z x y", " ")
+	b := strings.Split("y y z x z x y x z y z z", " ")
+
+	got := apply(a, Lines(a, b))
+	if strings.Join(got, " ") != strings.Join(b, " ") {
+		t.Errorf("applying the changes gives %v, want %v", got, b)
+	}
+}
+
+func TestJSONValues(t *testing.T) {
+	var oldValue, newValue any
+	decodeJSON([]byte(`{"user":{"name":"alice","role":"admin","id":1},"items":[1,2,3],"v":1.0}`), &oldValue)
+	decodeJSON([]byte(`{"user":{"name":"alice","role":"user","email":"a@x"},"items":[1,5],"v":"1"}`), &newValue)
+
+	got := []string{}
+	for _, c := range JSONValues(oldValue, newValue) {
+		old, _ := json.Marshal(c.Old)
+		new, _ := json.Marshal(c.New)
+		got = append(got, fmt.Sprintf("%s %s %s %s", c.Op, c.Path, old, new))
+	}
+
+	want := []string{
+		`changed $.items[1] 2 5`,
+		`removed $.items[2] 3 null`,
+		`added $.user.email null "a@x"`,
+		`removed $.user.id 1 null`,
+		`changed $.user.role "admin" "user"`,
+		`changed $.v 1.0 "1"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("JSONValues() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestCompare(t *testing.T) {
+	oldFlow := &flow.Flow{ID: "1", Response: newResponse(200, http.Header{
+		"Content-Type": {"application/json"},
+		"Date":         {"Mon, 01 Jan 2024 00:00:00 GMT"},
+		"X-Old":        {"1"},
+		"Set-Cookie":   {"a=1", "b=2"},
+	}, `{"role": "admin", "id": 1}`)}
+	newFlow := &flow.Flow{ID: "2", Response: newResponse(403, http.Header{
+		"Content-Type": {"application/json"},
+		"Date":         {"Mon, 01 Jan 2024 00:00:05 GMT"},
+		"X-New":        {"2"},
+		"Set-Cookie":   {"a=1"},
+	}, `{"id":1,"role":"user"}`)}
+
+	result, err := Compare(oldFlow, newFlow, Options{IgnoreHeaders: []string{"date"}})
+	if err != nil {
+		t.Fatalf("Compare() error = %v", err)
+	}
+
+	if result.OldID != "1" || result.NewID != "2" || result.OldStatus != 200 || result.NewStatus != 403 {
+		t.Errorf("result = %+v", result)
+	}
+
+	headers := []string{}
+	for _, h := range result.Headers {
+		headers = append(headers, h.Op+" "+h.Name)
+	}
+	if got := strings.Join(headers, ", "); got != "changed Set-Cookie, added X-New, removed X-Old" {
+		t.Errorf("header changes = %s", got)
+	}
+
+	if result.Body.Kind != KindJSON || !result.Body.Changed || len(result.Body.JSON) != 1 || result.Body.JSON[0].Path != "$.role" {
+		t.Errorf("body diff = %+v", result.Body)
+	}
+	if result.Equal() {
+		t.Errorf("Equal() = true, want false")
+	}
+
+	// bodies can be read again after the comparison
+	body, _ := io.ReadAll(oldFlow.Response.Body)
+	if string(body) != `{"role": "admin", "id": 1}` {
+		t.Errorf("old body not restored: %s", body)
+	}
+}
+
+func TestBodies(t *testing.T) {
+	tests := []struct {
+		name        string
+		old         string
+		new         string
+		contentType string
+		wantKind    string
+		wantChanged bool
+	}{
+		{"same json with different formatting", `{"a": 1}`, "{\"a\":1}\n", "application/json", KindJSON, false},
+		{"json without content type", `[1, 2]`, `[1, 3]`, "", KindJSON, true},
+		{"invalid json compared as text", `{"a": 1}`, `<html>`, "application/json", KindText, true},
+		{"text", "line 1\nline 2\n", "line 1\nline 2", "text/html", KindText, false},
+		{"binary", "\x00\x01", "\x00\x02", "image/png", KindBinary, true},
+		{"empty", "", "", "", KindText, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Bodies([]byte(tt.old), []byte(tt.new), tt.contentType, tt.contentType)
+			if d.Kind != tt.wantKind || d.Changed != tt.wantChanged {
+				t.Errorf("Bodies() = %+v, want kind %s and changed %v", d, tt.wantKind, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestCompareMissingResponse(t *testing.T) {
+	result, err := CompareResponses(nil, newResponse(200, http.Header{"A": {"1"}}, "ok"), Options{})
+	if err != nil {
+		t.Fatalf("CompareResponses() error = %v", err)
+	}
+	if result.OldStatus != 0 || len(result.Headers) != 1 || len(result.Body.Lines) != 1 {
+		t.Errorf("result = %+v", result)
+	}
+}
+
+func TestLinesLimit(t *testing.T) {
+	a, b := []string{"same"}, []string{"same"}
+	for i := 0; i < MaxLineEdits; i++ {
+		a = append(a, fmt.Sprintf("a%d", i))
+		b = append(b, fmt.Sprintf("b%d", i))
+	}
+
+	changes := Lines(a, b)
+	if len(changes) != 2*MaxLineEdits || changes[0].OldLine != 2 {
+		t.Errorf("Lines() returned %d changes starting at %+v", len(changes), changes[0])
+	}
+	if !bytes.Equal([]byte(strings.Join(apply(a, changes), " ")), []byte(strings.Join(b, " "))) {
+		t.Errorf("applying the changes does not give b")
+	}
+}
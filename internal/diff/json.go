@@ -0,0 +1,83 @@
+package diff
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// JSONChange is a value added, removed or changed at a key path such as
+// $.user.roles[0]
+type JSONChange struct {
+	Path string `json:"path"`
+	Op   string `json:"op"`
+	Old  any    `json:"old,omitempty"`
+	New  any    `json:"new,omitempty"`
+}
+
+// JSONValues returns the differences between two decoded JSON values.
+// Objects are compared by key and arrays by index.
+func JSONValues(oldValue, newValue any) []JSONChange {
+	changes := []JSONChange{}
+	diffJSON("$", oldValue, newValue, &changes)
+	return changes
+}
+
+func diffJSON(path string, oldValue, newValue any, changes *[]JSONChange) {
+	switch o := oldValue.(type) {
+	case map[string]any:
+		n, ok := newValue.(map[string]any)
+		if !ok {
+			break
+		}
+
+		keys := []string{}
+		for k := range o {
+			keys = append(keys, k)
+		}
+		for k := range n {
+			if _, ok := o[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		slices.Sort(keys)
+
+		for _, k := range keys {
+			oldChild, inOld := o[k]
+			newChild, inNew := n[k]
+			childPath := path + "." + k
+			switch {
+			case !inOld:
+				*changes = append(*changes, JSONChange{Path: childPath, Op: OpAdded, New: newChild})
+			case !inNew:
+				*changes = append(*changes, JSONChange{Path: childPath, Op: OpRemoved, Old: oldChild})
+			default:
+				diffJSON(childPath, oldChild, newChild, changes)
+			}
+		}
+		return
+
+	case []any:
+		n, ok := newValue.([]any)
+		if !ok {
+			break
+		}
+
+		for i := 0; i < max(len(o), len(n)); i++ {
+			childPath := path + "[" + strconv.Itoa(i) + "]"
+			switch {
+			case i >= len(o):
+				*changes = append(*changes, JSONChange{Path: childPath, Op: OpAdded, New: n[i]})
+			case i >= len(n):
+				*changes = append(*changes, JSONChange{Path: childPath, Op: OpRemoved, Old: o[i]})
+			default:
+				diffJSON(childPath, o[i], n[i], changes)
+			}
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*changes = append(*changes, JSONChange{Path: path, Op: OpChanged, Old: oldValue, New: newValue})
+	}
+}
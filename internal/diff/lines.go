@@ -0,0 +1,139 @@
+package diff
+
+// MaxLineEdits is the maximum number of line edits searched for. Bodies
+// with more differences are reported as fully replaced after the common
+// prefix and suffix.
+const MaxLineEdits = 2000
+
+// LineChange is a line added or removed. Line numbers start at 1; OldLine
+// is 0 for added lines and NewLine is 0 for removed lines.
+type LineChange struct {
+	Op      string `json:"op"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Lines returns the shortest list of line additions and removals that turns
+// a into b
+func Lines(a, b []string) []LineChange {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	changes := []LineChange{}
+	for _, e := range editScript(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		c := LineChange{Op: e.op}
+		if e.op == OpRemoved {
+			c.OldLine = prefix + e.index + 1
+			c.Text = a[prefix+e.index]
+		} else {
+			c.NewLine = prefix + e.index + 1
+			c.Text = b[prefix+e.index]
+		}
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// edit is a removal of a[index] or an addition of b[index]
+type edit struct {
+	op    string
+	index int
+}
+
+// editScript implements the Myers diff algorithm
+func editScript(a, b []string) []edit {
+	n, m := len(a), len(b)
+	if n == 0 && m == 0 {
+		return nil
+	}
+
+	offset := n + m
+	v := make([]int, 2*offset+2)
+
+	// trace[d] holds v[-d..d] before step d, used to walk back the path
+	trace := [][]int{}
+
+	for d := 0; d <= n+m; d++ {
+		if d > MaxLineEdits {
+			return replaceAll(n, m)
+		}
+
+		trace = append(trace, append([]int{}, v[offset-d:offset+d+1]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+
+			if x >= n && y >= m {
+				return backtrack(trace, n, m)
+			}
+		}
+	}
+
+	return replaceAll(n, m)
+}
+
+func backtrack(trace [][]int, n, m int) []edit {
+	edits := []edit{}
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		get := func(k int) int { return v[k+d] }
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := get(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+		}
+		if x == prevX {
+			edits = append(edits, edit{op: OpAdded, index: prevY})
+		} else {
+			edits = append(edits, edit{op: OpRemoved, index: prevX})
+		}
+		x, y = prevX, prevY
+	}
+
+	// edits were collected from the end
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+	return edits
+}
+
+func replaceAll(n, m int) []edit {
+	edits := []edit{}
+	for i := 0; i < n; i++ {
+		edits = append(edits, edit{op: OpRemoved, index: i})
+	}
+	for i := 0; i < m; i++ {
+		edits = append(edits, edit{op: OpAdded, index: i})
+	}
+	return edits
+}
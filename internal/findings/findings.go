@@ -0,0 +1,118 @@
+package findings
+
+import (
+	"sync"
+	"time"
+)
+
+// Severity of a finding
+type Severity string
+
+// Severities, from lowest to highest
+const (
+	SeverityInfo   Severity = "info"
+	SeverityLow    Severity = "low"
+	SeverityMedium Severity = "medium"
+	SeverityHigh   Severity = "high"
+)
+
+// Rank returns a number that orders severities, or 0 for unknown ones
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityInfo:
+		return 1
+	case SeverityLow:
+		return 2
+	case SeverityMedium:
+		return 3
+	case SeverityHigh:
+		return 4
+	}
+	return 0
+}
+
+// Finding is an issue detected in a flow
+type Finding struct {
+	ID     string
+	FlowID string
+
+	// Source is the component that reported the finding, e.g. "passive"
+	Source string
+
+	// Type identifies the check that reported the finding
+	Type     string
+	Severity Severity
+
+	// Host and Path locate the finding. An empty Path means the finding
+	// applies to the whole host.
+	Host string
+	Path string
+
+	Title  string
+	Detail string
+
+	// Evidence distinguishes findings of the same type in the same location,
+	// e.g. the name of an insecure cookie. It must not contain values that
+	// change between requests, so that repeated findings are de-duplicated.
+	Evidence string
+
+	Timestamp time.Time
+}
+
+// Key identifies the findings that are duplicates of each other
+func (f Finding) Key() string {
+	return f.Type + "\x00" + f.Host + "\x00" + f.Path + "\x00" + f.Evidence
+}
+
+// Sink receives the findings reported by detectors
+type Sink func(Finding)
+
+// Broker distributes findings to subscribers, e.g. gRPC clients
+type Broker struct {
+	subscribersMutex sync.RWMutex
+	subscribers      map[chan Finding]struct{}
+}
+
+// NewBroker returns a broker without subscribers
+func NewBroker() *Broker {
+	return &Broker{
+		subscribersMutex: sync.RWMutex{},
+		subscribers:      map[chan Finding]struct{}{},
+	}
+}
+
+// Subscribe returns a channel that receives the published findings.
+// Findings are dropped for subscribers that do not keep up.
+func (b *Broker) Subscribe() chan Finding {
+	c := make(chan Finding, 1000)
+
+	b.subscribersMutex.Lock()
+	b.subscribers[c] = struct{}{}
+	b.subscribersMutex.Unlock()
+
+	return c
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (b *Broker) Unsubscribe(c chan Finding) {
+	b.subscribersMutex.Lock()
+	defer b.subscribersMutex.Unlock()
+
+	if _, ok := b.subscribers[c]; ok {
+		delete(b.subscribers, c)
+		close(c)
+	}
+}
+
+// Publish sends a finding to all subscribers
+func (b *Broker) Publish(f Finding) {
+	b.subscribersMutex.RLock()
+	defer b.subscribersMutex.RUnlock()
+
+	for c := range b.subscribers {
+		select {
+		case c <- f:
+		default:
+		}
+	}
+}
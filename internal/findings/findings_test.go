@@ -0,0 +1,30 @@
+package findings
+
+import "testing"
+
+func TestBroker(t *testing.T) {
+	b := NewBroker()
+	c1 := b.Subscribe()
+	c2 := b.Subscribe()
+
+	b.Publish(Finding{Type: "a"})
+	b.Unsubscribe(c2)
+	b.Publish(Finding{Type: "b"})
+
+	if len(c1) != 2 {
+		t.Errorf("first subscriber received %d findings, want 2", len(c1))
+	}
+	if f, ok := <-c2; !ok || f.Type != "a" {
+		t.Errorf("second subscriber received %+v", f)
+	}
+	if _, ok := <-c2; ok {
+		t.Errorf("channel of removed subscriber is not closed")
+	}
+}
+
+func TestSeverityRank(t *testing.T) {
+	if !(SeverityHigh.Rank() > SeverityMedium.Rank() && SeverityMedium.Rank() > SeverityLow.Rank() &&
+		SeverityLow.Rank() > SeverityInfo.Rank() && SeverityInfo.Rank() > Severity("unknown").Rank()) {
+		t.Errorf("severities are not ordered")
+	}
+}
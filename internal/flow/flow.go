@@ -0,0 +1,64 @@
+package flow
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// Flow is a request together with the response it received.
+type Flow struct {
+	ID        string
+	Timestamp time.Time
+
+	Request  *http.Request
+	Response *http.Response
+
+	// OriginalRequest and OriginalResponse are the messages as received by
+	// the proxy, before the mod hooks ran. They are only set in the flows
+	// of the flow pipeline, where Request and Response are the messages
+	// after the mod hooks ran.
+	OriginalRequest  *http.Request
+	OriginalResponse *http.Response
+
+	// Error is the error that ended the exchange, if any. The response is
+	// nil if it was not received.
+	Error error
+}
+
+// Clone creates a copy of a flow and of its messages
+func (f *Flow) Clone() *Flow {
+	c := *f
+	if f.Request != nil {
+		c.Request = httpbytes.CloneRequest(f.Request)
+	}
+	if f.Response != nil {
+		c.Response = httpbytes.CloneResponse(f.Response)
+	}
+	if f.OriginalRequest != nil {
+		c.OriginalRequest = httpbytes.CloneRequest(f.OriginalRequest)
+	}
+	if f.OriginalResponse != nil {
+		c.OriginalResponse = httpbytes.CloneResponse(f.OriginalResponse)
+	}
+	return &c
+}
+
+// CloneHeads creates a copy of a flow with its messages without their bodies
+func (f *Flow) CloneHeads() *Flow {
+	c := *f
+	if f.Request != nil {
+		c.Request = httpbytes.CloneRequestHead(f.Request)
+	}
+	if f.Response != nil {
+		c.Response = httpbytes.CloneResponseHead(f.Response)
+	}
+	if f.OriginalRequest != nil {
+		c.OriginalRequest = httpbytes.CloneRequestHead(f.OriginalRequest)
+	}
+	if f.OriginalResponse != nil {
+		c.OriginalResponse = httpbytes.CloneResponseHead(f.OriginalResponse)
+	}
+	return &c
+}
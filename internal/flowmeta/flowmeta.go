@@ -0,0 +1,76 @@
+package flowmeta
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Meta holds the timings and connection details of a flow. Connection
+// timings are zero when the connection to the destination was reused.
+type Meta struct {
+	// Start is the time the request started to be sent to the destination
+	Start time.Time
+
+	// Received is the time the proxy received the request, when the flow
+	// started, and InScope whether it was in scope then
+	Received time.Time
+	InScope  bool
+
+	DNS             time.Duration
+	Connect         time.Duration
+	TLSHandshake    time.Duration
+	TimeToFirstByte time.Duration
+	Total           time.Duration
+
+	ClientAddr string
+	UpstreamIP string
+	TLSVersion string
+	TLSCipher  string
+	ALPN       string
+}
+
+type metaKeyType struct{}
+
+var metaKey = metaKeyType{}
+
+// Set returns a copy of req that carries the flow metadata
+func Set(req *http.Request, m *Meta) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), metaKey, m))
+}
+
+// Get returns the metadata of a request, or nil if unknown. Requests only
+// know the client address until they are sent.
+func Get(req *http.Request) *Meta {
+	m, _ := req.Context().Value(metaKey).(*Meta)
+	return m
+}
+
+// SetResponse sets the metadata of a flow in its response. It is kept in
+// the context of its request, as the request ID is.
+func SetResponse(resp *http.Response, m *Meta) {
+	req := resp.Request
+	if req == nil {
+		req = new(http.Request)
+	}
+	resp.Request = Set(req, m)
+}
+
+// GetResponse returns the metadata of a response, or nil if unknown
+func GetResponse(resp *http.Response) *Meta {
+	if resp.Request == nil {
+		return nil
+	}
+	return Get(resp.Request)
+}
+
+// Milliseconds returns a duration in milliseconds, as stored and sent to
+// plugins
+func Milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// FromMilliseconds returns the duration of a number of milliseconds
+func FromMilliseconds(ms float64) time.Duration {
+	return time.Duration(ms * float64(time.Millisecond))
+}
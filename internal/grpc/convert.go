@@ -3,30 +3,35 @@ package grpc
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/diff"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+	"github.com/artilugio0/efin-proxy/internal/sitemap"
 	pb "github.com/artilugio0/efin-proxy/pkg/grpc/proto"
 )
 
 // ToProtoRequest converts an http.Request to a proto HttpRequest.
 func ToProtoRequest(req *http.Request) *pb.HttpRequest {
-	hostAdded := false
 	headers := []*pb.Header{}
-	for k, vs := range req.Header {
-		for _, v := range vs {
-			headers = append(headers, &pb.Header{Name: k, Value: v})
-			if strings.ToLower(k) == "host" {
-				hostAdded = true
-			}
-		}
-	}
-	if !hostAdded {
-		headers = append(headers, &pb.Header{Name: "Host", Value: req.Host})
+	for _, h := range httpbytes.RequestHeaders(req) {
+		headers = append(headers, &pb.Header{Name: h.Name, Value: h.Value})
 	}
 
 	var body []byte
@@ -35,11 +40,15 @@ func ToProtoRequest(req *http.Request) *pb.HttpRequest {
 		req.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
 	return &pb.HttpRequest{
-		Id:      ids.GetRequestID(req),
-		Method:  req.Method,
-		Url:     req.URL.String(),
-		Headers: headers,
-		Body:    body,
+		Id:          ids.GetRequestID(req),
+		Method:      req.Method,
+		Url:         req.URL.String(),
+		Headers:     headers,
+		Body:        body,
+		Proto:       req.Proto,
+		RequestLine: httpbytes.RequestLine(req),
+		Meta:        ToProtoFlowMeta(flowmeta.Get(req)),
+		Annotations: toProtoBag(annotations.Get(req)),
 	}
 }
 
@@ -107,19 +116,45 @@ func FromProtoRequest(protoReq *pb.HttpRequest, sourceReq *http.Request) (*http.
 		req.Close = false
 	}
 
+	if major, minor, ok := http.ParseHTTPVersion(protoReq.Proto); ok {
+		req.Proto, req.ProtoMajor, req.ProtoMinor = protoReq.Proto, major, minor
+	}
+
+	// the headers are kept in the order they were sent
+	wire := &httpbytes.Wire{FirstLine: protoReq.RequestLine, Proto: req.Proto}
+	if wire.FirstLine == "" && sourceReq != nil {
+		if w := httpbytes.RequestWire(sourceReq); w != nil {
+			wire.FirstLine = w.FirstLine
+		}
+	}
+	for _, h := range protoReq.Headers {
+		wire.Headers = append(wire.Headers, httpbytes.Header{Name: h.Name, Value: h.Value})
+	}
+	req = httpbytes.SetRequestWire(req, wire)
+
 	// Set request ID
 	req = ids.SetRequestID(req, protoReq.Id)
 
+	if protoReq.Annotations != nil {
+		a := FromProtoAnnotations(protoReq.Annotations)
+		if err := a.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid annotations: %v", err)
+		}
+		if bag := annotations.Get(req); bag != nil {
+			bag.Replace(a)
+		} else {
+			req = annotations.Set(req, annotations.NewBag(a))
+		}
+	}
+
 	return req, nil
 }
 
 // ToProtoResponse converts an http.Response to a proto HttpResponse.
 func ToProtoResponse(resp *http.Response) *pb.HttpResponse {
 	headers := []*pb.Header{}
-	for k, vs := range resp.Header {
-		for _, v := range vs {
-			headers = append(headers, &pb.Header{Name: k, Value: v})
-		}
+	for _, h := range httpbytes.ResponseHeaders(resp) {
+		headers = append(headers, &pb.Header{Name: h.Name, Value: h.Value})
 	}
 	var body []byte
 	if resp.Body != nil {
@@ -127,10 +162,152 @@ func ToProtoResponse(resp *http.Response) *pb.HttpResponse {
 		resp.Body = io.NopCloser(bytes.NewBuffer(body))
 	}
 	return &pb.HttpResponse{
-		Id:         ids.GetResponseID(resp),
-		StatusCode: int32(resp.StatusCode),
-		Headers:    headers,
-		Body:       body,
+		Id:          ids.GetResponseID(resp),
+		StatusCode:  int32(resp.StatusCode),
+		Headers:     headers,
+		Body:        body,
+		Proto:       resp.Proto,
+		StatusLine:  httpbytes.StatusLine(resp),
+		Meta:        ToProtoFlowMeta(flowmeta.GetResponse(resp)),
+		Annotations: toProtoBag(annotations.GetResponse(resp)),
+	}
+}
+
+// ToProtoFlow converts a completed flow to a proto Flow
+func ToProtoFlow(f *flow.Flow) *pb.Flow {
+	protoFlow := &pb.Flow{
+		Id:          f.ID,
+		TimestampMs: f.Timestamp.UnixMilli(),
+	}
+	if f.OriginalRequest != nil {
+		protoFlow.OriginalRequest = ToProtoRequest(f.OriginalRequest)
+	}
+	if f.Request != nil {
+		protoFlow.Request = ToProtoRequest(f.Request)
+	}
+	if f.OriginalResponse != nil {
+		protoFlow.OriginalResponse = ToProtoResponse(f.OriginalResponse)
+	}
+	if f.Response != nil {
+		protoFlow.Response = ToProtoResponse(f.Response)
+	}
+	if f.Error != nil {
+		protoFlow.Error = f.Error.Error()
+	}
+
+	if f.Response != nil {
+		protoFlow.Meta = ToProtoFlowMeta(flowmeta.GetResponse(f.Response))
+		protoFlow.Annotations = toProtoBag(annotations.GetResponse(f.Response))
+	} else if f.Request != nil {
+		protoFlow.Meta = ToProtoFlowMeta(flowmeta.Get(f.Request))
+		protoFlow.Annotations = toProtoBag(annotations.Get(f.Request))
+	}
+	return protoFlow
+}
+
+// ToProtoAnnotations converts the annotations of a flow to their protobuf
+// representation
+func ToProtoAnnotations(a annotations.Annotations) *pb.Annotations {
+	return &pb.Annotations{
+		Tags:    a.Tags,
+		Color:   a.Color,
+		Comment: a.Comment,
+		Values:  a.Values,
+	}
+}
+
+// toProtoBag converts the annotations in a bag. It returns nil if b is nil.
+func toProtoBag(b *annotations.Bag) *pb.Annotations {
+	if b == nil {
+		return nil
+	}
+	return ToProtoAnnotations(b.Get())
+}
+
+// FromProtoAnnotations converts protobuf annotations
+func FromProtoAnnotations(protoAnnotations *pb.Annotations) annotations.Annotations {
+	a := annotations.Annotations{
+		Tags:    protoAnnotations.Tags,
+		Color:   protoAnnotations.Color,
+		Comment: protoAnnotations.Comment,
+		Values:  protoAnnotations.Values,
+	}
+	if len(a.Tags) == 0 {
+		a.Tags = nil
+	}
+	if len(a.Values) == 0 {
+		a.Values = nil
+	}
+	return a
+}
+
+// FromProtoAnnotateRequest converts an annotate request to an edit of the
+// annotations of a flow
+func FromProtoAnnotateRequest(req *pb.AnnotateRequest) annotations.Edit {
+	edit := annotations.Edit{
+		AddTags:      req.AddTags,
+		RemoveTags:   req.RemoveTags,
+		SetValues:    req.SetValues,
+		DeleteValues: req.DeleteValues,
+	}
+	if req.SetColor {
+		edit.Color = &req.Color
+	}
+	if req.SetComment {
+		edit.Comment = &req.Comment
+	}
+	return edit
+}
+
+// FromProtoFlowQuery converts a flow query to a filter of the stored flows
+func FromProtoFlowQuery(q *pb.FlowQuery) (hooks.FlowFilter, error) {
+	filter := hooks.FlowFilter{
+		FromID:     q.FromId,
+		ToID:       q.ToId,
+		Method:     q.Method,
+		StatusCode: int(q.StatusCode),
+		Tags:       q.Tags,
+		Color:      q.Color,
+		Comment:    q.Comment,
+		Values:     q.Values,
+		Limit:      int(q.Limit),
+	}
+
+	if q.HostRe != "" {
+		re, err := regexp.Compile(q.HostRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid host regex: %v", err)
+		}
+		filter.HostRe = re
+	}
+	if q.UrlRe != "" {
+		re, err := regexp.Compile(q.UrlRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid url regex: %v", err)
+		}
+		filter.URLRe = re
+	}
+
+	return filter, nil
+}
+
+// ToProtoFlowMeta converts the metadata of a flow to its protobuf
+// representation. It returns nil if m is nil.
+func ToProtoFlowMeta(m *flowmeta.Meta) *pb.FlowMeta {
+	if m == nil {
+		return nil
+	}
+	return &pb.FlowMeta{
+		ClientAddr:     m.ClientAddr,
+		DnsMs:          flowmeta.Milliseconds(m.DNS),
+		ConnectMs:      flowmeta.Milliseconds(m.Connect),
+		TlsHandshakeMs: flowmeta.Milliseconds(m.TLSHandshake),
+		TtfbMs:         flowmeta.Milliseconds(m.TimeToFirstByte),
+		TotalMs:        flowmeta.Milliseconds(m.Total),
+		UpstreamIp:     m.UpstreamIP,
+		TlsVersion:     m.TLSVersion,
+		TlsCipher:      m.TLSCipher,
+		Alpn:           m.ALPN,
 	}
 }
 
@@ -153,11 +330,261 @@ func FromProtoResponse(protoResp *pb.HttpResponse, req *http.Request) (*http.Res
 		resp.Header.Add(h.Name, h.Value)
 	}
 
+	if major, minor, ok := http.ParseHTTPVersion(protoResp.Proto); ok {
+		resp.Proto, resp.ProtoMajor, resp.ProtoMinor = protoResp.Proto, major, minor
+	}
+
 	// Set status text
 	resp.Status = http.StatusText(int(protoResp.StatusCode))
 	if resp.Status == "" {
 		resp.Status = strconv.Itoa(int(protoResp.StatusCode)) + " Unknown"
 	}
 
+	// the headers are kept in the order they were sent
+	wire := &httpbytes.Wire{FirstLine: protoResp.StatusLine, Proto: resp.Proto}
+	if w := httpbytes.ResponseWire(resp); wire.FirstLine == "" && w != nil {
+		wire.FirstLine = w.FirstLine
+	}
+	for _, h := range protoResp.Headers {
+		wire.Headers = append(wire.Headers, httpbytes.Header{Name: h.Name, Value: h.Value})
+	}
+	httpbytes.SetResponseWire(resp, wire)
+
+	if protoResp.Annotations != nil {
+		a := FromProtoAnnotations(protoResp.Annotations)
+		if err := a.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid annotations: %v", err)
+		}
+		if bag := annotations.GetResponse(resp); bag != nil {
+			bag.Replace(a)
+		} else if resp.Request != nil {
+			resp.Request = annotations.Set(resp.Request, annotations.NewBag(a))
+		}
+	}
+
 	return resp, nil
 }
+
+// ToProtoMatchReplaceRules converts match and replace rules to their protobuf representation
+func ToProtoMatchReplaceRules(rules []hooks.MatchReplaceRule) []*pb.MatchReplaceRule {
+	protoRules := make([]*pb.MatchReplaceRule, 0, len(rules))
+	for _, r := range rules {
+		protoRules = append(protoRules, &pb.MatchReplaceRule{
+			Target:  r.Target,
+			Match:   r.Match,
+			Replace: r.Replace,
+			Comment: r.Comment,
+			Enabled: r.Enabled,
+		})
+	}
+	return protoRules
+}
+
+// FromProtoMatchReplaceRules converts protobuf match and replace rules
+func FromProtoMatchReplaceRules(protoRules []*pb.MatchReplaceRule) []hooks.MatchReplaceRule {
+	rules := make([]hooks.MatchReplaceRule, 0, len(protoRules))
+	for _, r := range protoRules {
+		rules = append(rules, hooks.MatchReplaceRule{
+			Target:  r.Target,
+			Match:   r.Match,
+			Replace: r.Replace,
+			Comment: r.Comment,
+			Enabled: r.Enabled,
+		})
+	}
+	return rules
+}
+
+// ToProtoHookPriorities converts hook priorities to their protobuf
+// representation, sorted by name
+func ToProtoHookPriorities(priorities map[string]int) []*pb.HookInfo {
+	names := make([]string, 0, len(priorities))
+	for name := range priorities {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	protoPriorities := make([]*pb.HookInfo, 0, len(names))
+	for _, name := range names {
+		protoPriorities = append(protoPriorities, &pb.HookInfo{Name: name, Priority: int32(priorities[name])})
+	}
+	return protoPriorities
+}
+
+// FromProtoHookPriorities converts protobuf hook priorities
+func FromProtoHookPriorities(protoPriorities []*pb.HookInfo) map[string]int {
+	if len(protoPriorities) == 0 {
+		return nil
+	}
+	priorities := map[string]int{}
+	for _, p := range protoPriorities {
+		priorities[p.Name] = int(p.Priority)
+	}
+	return priorities
+}
+
+// FromProtoHookFilter converts a protobuf hook filter, compiling its regular
+// expressions
+func FromProtoHookFilter(protoFilter *pb.HookFilter) (pipeline.Filter, error) {
+	filter := pipeline.Filter{}
+	if protoFilter == nil {
+		return filter, nil
+	}
+
+	if protoFilter.HostRe != "" {
+		re, err := regexp.Compile(protoFilter.HostRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid host regex: %v", err)
+		}
+		filter.HostRe = re
+	}
+	if protoFilter.PathRe != "" {
+		re, err := regexp.Compile(protoFilter.PathRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid path regex: %v", err)
+		}
+		filter.PathRe = re
+	}
+	filter.Methods = protoFilter.Methods
+	filter.ContentTypes = protoFilter.ContentTypes
+	filter.MaxBodySize = protoFilter.MaxBodySize
+	filter.OmitBodies = protoFilter.OmitBodies
+
+	return filter, nil
+}
+
+// ToProtoHookChains converts the hook chains of the proxy to their protobuf
+// representation
+func ToProtoHookChains(chains proxy.HookChains) *pb.HookChains {
+	return &pb.HookChains{
+		RequestIn:   toProtoHookInfos(chains.RequestIn),
+		RequestMod:  toProtoHookInfos(chains.RequestMod),
+		RequestOut:  toProtoHookInfos(chains.RequestOut),
+		ResponseIn:  toProtoHookInfos(chains.ResponseIn),
+		ResponseMod: toProtoHookInfos(chains.ResponseMod),
+		ResponseOut: toProtoHookInfos(chains.ResponseOut),
+		FlowOut:     toProtoHookInfos(chains.FlowOut),
+		ResponseLog: toProtoHookInfos(chains.ResponseLog),
+	}
+}
+
+func toProtoHookInfos(hooks []pipeline.HookInfo) []*pb.HookInfo {
+	protoHooks := make([]*pb.HookInfo, 0, len(hooks))
+	for _, h := range hooks {
+		protoHooks = append(protoHooks, &pb.HookInfo{
+			Name:     h.Name,
+			Priority: int32(h.Priority),
+			Disabled: h.Disabled,
+			Failures: int32(h.Failures),
+		})
+	}
+	return protoHooks
+}
+
+// ToProtoPipelineStats converts the counters of the read-only pipelines to
+// their protobuf representation
+func ToProtoPipelineStats(stats []proxy.PipelineStats) []*pb.PipelineStats {
+	protoStats := make([]*pb.PipelineStats, 0, len(stats))
+	for _, st := range stats {
+		protoStats = append(protoStats, &pb.PipelineStats{
+			Name:    st.Name,
+			Dropped: st.Dropped,
+			Spooled: int64(st.Spooled),
+		})
+	}
+	return protoStats
+}
+
+// ToProtoFinding converts a finding to its protobuf representation
+func ToProtoFinding(f findings.Finding) *pb.Finding {
+	return &pb.Finding{
+		Id:          f.ID,
+		FlowId:      f.FlowID,
+		Source:      f.Source,
+		Type:        f.Type,
+		Severity:    string(f.Severity),
+		Host:        f.Host,
+		Path:        f.Path,
+		Title:       f.Title,
+		Detail:      f.Detail,
+		Evidence:    f.Evidence,
+		TimestampMs: f.Timestamp.UnixMilli(),
+	}
+}
+
+// ToProtoSiteMapNode converts a site map node and its children to their
+// protobuf representation
+func ToProtoSiteMapNode(n *sitemap.Node) *pb.SiteMapNode {
+	node := &pb.SiteMapNode{
+		Name:    n.Name,
+		Path:    n.Path,
+		Schemes: n.Schemes,
+	}
+
+	for _, e := range n.SortedMethods() {
+		statusCodes := map[int32]int64{}
+		for code, count := range e.StatusCodes {
+			statusCodes[int32(code)] = int64(count)
+		}
+
+		node.Endpoints = append(node.Endpoints, &pb.SiteMapEndpoint{
+			Method:       e.Method,
+			Count:        int64(e.Count),
+			StatusCodes:  statusCodes,
+			QueryParams:  e.QueryParams,
+			BodyParams:   e.BodyParams,
+			ContentTypes: e.ContentTypes,
+			FirstFlowId:  e.FirstFlowID,
+			LastFlowId:   e.LastFlowID,
+		})
+	}
+
+	for _, c := range n.SortedChildren() {
+		node.Children = append(node.Children, ToProtoSiteMapNode(c))
+	}
+
+	return node
+}
+
+// ToProtoFlowDiff converts the difference between two responses to its
+// protobuf representation
+func ToProtoFlowDiff(r *diff.Result) *pb.FlowDiff {
+	d := &pb.FlowDiff{
+		OldId:       r.OldID,
+		NewId:       r.NewID,
+		OldStatus:   int32(r.OldStatus),
+		NewStatus:   int32(r.NewStatus),
+		BodyKind:    r.Body.Kind,
+		BodyChanged: r.Body.Changed,
+		OldSize:     int64(r.Body.OldSize),
+		NewSize:     int64(r.Body.NewSize),
+	}
+
+	for _, h := range r.Headers {
+		d.Headers = append(d.Headers, &pb.HeaderDiff{Name: h.Name, Op: h.Op, Old: h.Old, New: h.New})
+	}
+
+	for _, l := range r.Body.Lines {
+		d.Lines = append(d.Lines, &pb.LineDiff{
+			Op:      l.Op,
+			OldLine: int32(l.OldLine),
+			NewLine: int32(l.NewLine),
+			Text:    l.Text,
+		})
+	}
+
+	for _, c := range r.Body.JSON {
+		change := &pb.JSONDiff{Path: c.Path, Op: c.Op}
+		if c.Op != diff.OpAdded {
+			old, _ := json.Marshal(c.Old)
+			change.Old = string(old)
+		}
+		if c.Op != diff.OpRemoved {
+			new, _ := json.Marshal(c.New)
+			change.New = string(new)
+		}
+		d.JsonChanges = append(d.JsonChanges, change)
+	}
+
+	return d
+}
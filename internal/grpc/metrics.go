@@ -0,0 +1,48 @@
+package grpc
+
+import (
+	"sync"
+
+	"github.com/artilugio0/efin-proxy/internal/metrics"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// grpcDropped counts the items not sent to clients because their queue was
+// full
+var grpcDropped = metrics.NewCounterVec(
+	"efin_proxy_grpc_dropped_total",
+	"Items not sent to the gRPC clients because their queue was full, by hook and client.",
+	"hook", "client",
+)
+
+// RegisterMetrics registers the depth of the queues of the read-only clients
+// in a registry
+func (s *Server) RegisterMetrics(r *metrics.Registry) {
+	r.NewGaugeFunc(
+		"efin_proxy_grpc_queue_depth",
+		"Items waiting in memory in the queue of the read-only gRPC clients, by hook and client.",
+		[]string{"hook", "client"},
+		func() []metrics.Sample {
+			samples := []metrics.Sample{}
+			samples = appendQueueDepths(samples, "request-in", &s.requestInClientsMutex, s.requestInClients)
+			samples = appendQueueDepths(samples, "request-out", &s.requestOutClientsMutex, s.requestOutClients)
+			samples = appendQueueDepths(samples, "response-in", &s.responseInClientsMutex, s.responseInClients)
+			samples = appendQueueDepths(samples, "response-out", &s.responseOutClientsMutex, s.responseOutClients)
+			samples = appendQueueDepths(samples, "flow-out", &s.flowOutClientsMutex, s.flowOutClients)
+			return samples
+		},
+	)
+}
+
+func appendQueueDepths[I pipeline.PipelineItem](samples []metrics.Sample, hook string, mutex *sync.RWMutex, clients map[string]*readOnlyClient[I]) []metrics.Sample {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for name, client := range clients {
+		samples = append(samples, metrics.Sample{
+			LabelValues: []string{hook, name},
+			Value:       float64(client.queue.Len()),
+		})
+	}
+	return samples
+}
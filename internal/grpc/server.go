@@ -2,43 +2,79 @@ package grpc
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"regexp"
 	"sync"
 	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/diff"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
 	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+	"github.com/artilugio0/efin-proxy/internal/project"
 	"github.com/artilugio0/efin-proxy/internal/proxy"
+	"github.com/artilugio0/efin-proxy/internal/rawhttp"
+	"github.com/artilugio0/efin-proxy/internal/repeater"
+	"github.com/artilugio0/efin-proxy/internal/scanner"
+	"github.com/artilugio0/efin-proxy/internal/scope"
+	"github.com/artilugio0/efin-proxy/internal/sitemap"
 	"github.com/artilugio0/efin-proxy/pkg/grpc/proto"
 	"google.golang.org/grpc"
 )
 
-type requestsReadOnlyChannels struct {
-	name string
+// readOnlyClient is a client of a read-only pipeline. Its hook pushes the
+// items to the queue the handler of the client sends them from.
+type readOnlyClient[I pipeline.PipelineItem] struct {
+	name       string
+	removeHook func()
 
-	originalRequests chan<- *http.Request
-	ok               <-chan bool
+	queue *pipeline.Queue[I]
+	// disconnect is set if the client is removed when its queue is full
+	disconnect bool
 }
 
-type responsesReadOnlyChannels struct {
-	name string
+type requestsChannels struct {
+	name       string
+	removeHook func()
 
-	originalResponses chan<- *http.Response
-	ok                <-chan bool
-}
+	// mutex makes a hook wait for the answer to a previous item, so that
+	// answers are not mixed up
+	mutex sync.Mutex
 
-type requestsChannels struct {
-	name string
+	// timeout is the time a hook waits for an answer before the client
+	// is removed
+	timeout time.Duration
+	// removed is closed when the client is removed
+	removed    chan struct{}
+	removeOnce sync.Once
 
 	originalRequests chan<- *http.Request
 	modifiedRequests <-chan *http.Request
 }
 
 type responsesChannels struct {
-	name string
+	name       string
+	removeHook func()
+
+	// mutex makes a hook wait for the answer to a previous item, so that
+	// answers are not mixed up
+	mutex sync.Mutex
+
+	// timeout is the time a hook waits for an answer before the client
+	// is removed
+	timeout time.Duration
+	// removed is closed when the client is removed
+	removed    chan struct{}
+	removeOnce sync.Once
 
 	originalResponses chan<- *http.Response
 	modifiedResponses <-chan *http.Response
@@ -53,24 +89,28 @@ type Server struct {
 	proxy       *proxy.Proxy
 	configMutex sync.RWMutex
 	config      *proxy.Config
+	project     *project.Project
 
 	requestInClientsMutex sync.RWMutex
-	requestInClients      map[string]*requestsReadOnlyChannels
+	requestInClients      map[string]*readOnlyClient[*http.Request]
 
 	requestModClientsMutex sync.RWMutex
 	requestModClients      map[string]*requestsChannels
 
 	requestOutClientsMutex sync.RWMutex
-	requestOutClients      map[string]*requestsReadOnlyChannels
+	requestOutClients      map[string]*readOnlyClient[*http.Request]
 
 	responseInClientsMutex sync.RWMutex
-	responseInClients      map[string]*responsesReadOnlyChannels
+	responseInClients      map[string]*readOnlyClient[*http.Response]
 
 	responseModClientsMutex sync.RWMutex
 	responseModClients      map[string]*responsesChannels
 
 	responseOutClientsMutex sync.RWMutex
-	responseOutClients      map[string]*responsesReadOnlyChannels
+	responseOutClients      map[string]*readOnlyClient[*http.Response]
+
+	flowOutClientsMutex sync.RWMutex
+	flowOutClients      map[string]*readOnlyClient[*flow.Flow]
 }
 
 func NewServer(addr string, p *proxy.Proxy, config *proxy.Config) *Server {
@@ -80,23 +120,35 @@ func NewServer(addr string, p *proxy.Proxy, config *proxy.Config) *Server {
 		config:      config,
 		configMutex: sync.RWMutex{},
 
-		requestInClients:      map[string]*requestsReadOnlyChannels{},
+		requestInClients:      map[string]*readOnlyClient[*http.Request]{},
 		requestInClientsMutex: sync.RWMutex{},
 
 		requestModClients:      map[string]*requestsChannels{},
 		requestModClientsMutex: sync.RWMutex{},
 
-		requestOutClients:      map[string]*requestsReadOnlyChannels{},
+		requestOutClients:      map[string]*readOnlyClient[*http.Request]{},
 		requestOutClientsMutex: sync.RWMutex{},
 
-		responseInClients:      map[string]*responsesReadOnlyChannels{},
+		responseInClients:      map[string]*readOnlyClient[*http.Response]{},
 		responseInClientsMutex: sync.RWMutex{},
 
 		responseModClients:      map[string]*responsesChannels{},
 		responseModClientsMutex: sync.RWMutex{},
 
-		responseOutClients:      map[string]*responsesReadOnlyChannels{},
+		responseOutClients:      map[string]*readOnlyClient[*http.Response]{},
 		responseOutClientsMutex: sync.RWMutex{},
+
+		flowOutClients:      map[string]*readOnlyClient[*flow.Flow]{},
+		flowOutClientsMutex: sync.RWMutex{},
+	}
+
+	if config.Project != "" {
+		proj, err := project.Open(config.Project, project.Settings{})
+		if err != nil {
+			log.Printf("Failed to open project %s: %v", config.Project, err)
+		} else {
+			server.project = proj
+		}
 	}
 
 	return server
@@ -148,8 +200,14 @@ func (s *Server) RequestMod(stream proto.ProxyService_RequestModServer) error {
 	modifiedRequests := make(chan *http.Request)
 
 	clientName := registerMsg.Register.Name
+	options, err := clientHookOptions(registerMsg.Register, defaultClientTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
+	}
 	rChans := &requestsChannels{
 		name:             clientName,
+		timeout:          options.Timeout,
+		removed:          make(chan struct{}),
 		originalRequests: originalRequests,
 		modifiedRequests: modifiedRequests,
 	}
@@ -160,6 +218,12 @@ func (s *Server) RequestMod(stream proto.ProxyService_RequestModServer) error {
 		return fmt.Errorf("client already registered")
 	}
 	s.requestModClients[clientName] = rChans
+	rChans.removeHook = s.proxy.AddRequestModHook(pipeline.NamedModHook[*http.Request]{
+		Name:     clientHookName(clientName),
+		Priority: int(registerMsg.Register.Priority),
+		Options:  options,
+		Hook:     s.requestModHook(rChans),
+	})
 	s.requestModClientsMutex.Unlock()
 
 	defer func() {
@@ -193,7 +257,13 @@ func (s *Server) RequestMod(stream proto.ProxyService_RequestModServer) error {
 			log.Printf("Request mod stream: client sent an invalid request: %v", err)
 			return nil
 		}
-		modifiedRequests <- modReq
+		// the answer is dropped if the client was removed while it was
+		// awaited
+		select {
+		case modifiedRequests <- modReq:
+		case <-rChans.removed:
+			return nil
+		}
 	}
 
 	return nil
@@ -202,14 +272,11 @@ func (s *Server) RequestMod(stream proto.ProxyService_RequestModServer) error {
 // RequestIn handles server to client streaming for HTTP request communication.
 func (s *Server) RequestIn(register *proto.Register, stream proto.ProxyService_RequestInServer) error {
 	log.Printf("RequestIn Client connected: %s", register.Name)
-	originalRequests := make(chan *http.Request, 1000)
-	ok := make(chan bool)
 
 	clientName := register.Name
-	rChans := &requestsReadOnlyChannels{
-		name:             clientName,
-		originalRequests: originalRequests,
-		ok:               ok,
+	options, err := clientHookOptions(register, 0)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
 	}
 
 	s.requestInClientsMutex.Lock()
@@ -217,35 +284,51 @@ func (s *Server) RequestIn(register *proto.Register, stream proto.ProxyService_R
 		s.requestInClientsMutex.Unlock()
 		return fmt.Errorf("client already registered")
 	}
-	s.requestInClients[clientName] = rChans
+	queue, disconnect, err := newClientQueue[*http.Request](register, s.clientSpoolDir("request-in", clientName))
+	if err != nil {
+		s.requestInClientsMutex.Unlock()
+		return fmt.Errorf("invalid register message: %v", err)
+	}
+	client := &readOnlyClient[*http.Request]{
+		name:       clientName,
+		queue:      queue,
+		disconnect: disconnect,
+	}
+	s.requestInClients[clientName] = client
+	client.removeHook = s.proxy.AddRequestInHook(pipeline.NamedReadOnlyHook[*http.Request]{
+		Name:     clientHookName(clientName),
+		Priority: int(register.Priority),
+		Options:  options,
+		Hook:     s.requestInHook(client),
+	})
 	s.requestInClientsMutex.Unlock()
 
-	defer func() {
-		close(ok)
-	}()
+	defer s.removeRequestInClient(client)
 
-	for r := range originalRequests {
-		if err := stream.Send(ToProtoRequest(httpbytes.CloneRequest(r))); err != nil {
-			log.Printf("Failed to send HttpRequest: %v", err)
-			return err
+	for {
+		select {
+		case r, ok := <-queue.Items():
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ToProtoRequest(httpbytes.CloneRequest(r))); err != nil {
+				log.Printf("Failed to send HttpRequest: %v", err)
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
 		}
-		ok <- true
 	}
-
-	return nil
 }
 
 // RequestOut handles server to client streaming for HTTP request communication.
 func (s *Server) RequestOut(register *proto.Register, stream proto.ProxyService_RequestOutServer) error {
 	log.Printf("RequestOut Client connected: %s", register.Name)
-	originalRequests := make(chan *http.Request, 1000)
-	ok := make(chan bool)
 
 	clientName := register.Name
-	rChans := &requestsReadOnlyChannels{
-		name:             clientName,
-		originalRequests: originalRequests,
-		ok:               ok,
+	options, err := clientHookOptions(register, 0)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
 	}
 
 	s.requestOutClientsMutex.Lock()
@@ -253,22 +336,41 @@ func (s *Server) RequestOut(register *proto.Register, stream proto.ProxyService_
 		s.requestOutClientsMutex.Unlock()
 		return fmt.Errorf("client already registered")
 	}
-	s.requestOutClients[clientName] = rChans
+	queue, disconnect, err := newClientQueue[*http.Request](register, s.clientSpoolDir("request-out", clientName))
+	if err != nil {
+		s.requestOutClientsMutex.Unlock()
+		return fmt.Errorf("invalid register message: %v", err)
+	}
+	client := &readOnlyClient[*http.Request]{
+		name:       clientName,
+		queue:      queue,
+		disconnect: disconnect,
+	}
+	s.requestOutClients[clientName] = client
+	client.removeHook = s.proxy.AddRequestOutHook(pipeline.NamedReadOnlyHook[*http.Request]{
+		Name:     clientHookName(clientName),
+		Priority: int(register.Priority),
+		Options:  options,
+		Hook:     s.requestOutHook(client),
+	})
 	s.requestOutClientsMutex.Unlock()
 
-	defer func() {
-		close(ok)
-	}()
+	defer s.removeRequestOutClient(client)
 
-	for r := range originalRequests {
-		if err := stream.Send(ToProtoRequest(httpbytes.CloneRequest(r))); err != nil {
-			log.Printf("Failed to send HttpRequest: %v", err)
-			return err
+	for {
+		select {
+		case r, ok := <-queue.Items():
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ToProtoRequest(httpbytes.CloneRequest(r))); err != nil {
+				log.Printf("Failed to send HttpRequest: %v", err)
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
 		}
-		ok <- true
 	}
-
-	return nil
 }
 
 // ResponseMod handles bidirectional streaming for HTTP response modification.
@@ -294,8 +396,14 @@ func (s *Server) ResponseMod(stream proto.ProxyService_ResponseModServer) error
 	modifiedResponses := make(chan *http.Response)
 
 	clientName := registerMsg.Register.Name
+	options, err := clientHookOptions(registerMsg.Register, defaultClientTimeout)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
+	}
 	rChans := &responsesChannels{
 		name:              clientName,
+		timeout:           options.Timeout,
+		removed:           make(chan struct{}),
 		originalResponses: originalResponses,
 		modifiedResponses: modifiedResponses,
 	}
@@ -306,6 +414,12 @@ func (s *Server) ResponseMod(stream proto.ProxyService_ResponseModServer) error
 		return fmt.Errorf("client already registered")
 	}
 	s.responseModClients[clientName] = rChans
+	rChans.removeHook = s.proxy.AddResponseModHook(pipeline.NamedModHook[*http.Response]{
+		Name:     clientHookName(clientName),
+		Priority: int(registerMsg.Register.Priority),
+		Options:  options,
+		Hook:     s.responseModHook(rChans),
+	})
 	s.responseModClientsMutex.Unlock()
 
 	defer func() {
@@ -339,7 +453,13 @@ func (s *Server) ResponseMod(stream proto.ProxyService_ResponseModServer) error
 			log.Printf("Response mod stream: client sent an invalid response: %v", err)
 			return nil
 		}
-		modifiedResponses <- modReq
+		// the answer is dropped if the client was removed while it was
+		// awaited
+		select {
+		case modifiedResponses <- modReq:
+		case <-rChans.removed:
+			return nil
+		}
 	}
 
 	return nil
@@ -348,14 +468,11 @@ func (s *Server) ResponseMod(stream proto.ProxyService_ResponseModServer) error
 // ResponseIn handles server to client streaming for HTTP response communication.
 func (s *Server) ResponseIn(register *proto.Register, stream proto.ProxyService_ResponseInServer) error {
 	log.Printf("ResponseIn Client connected: %s", register.Name)
-	originalResponses := make(chan *http.Response, 1000)
-	ok := make(chan bool)
 
 	clientName := register.Name
-	rChans := &responsesReadOnlyChannels{
-		name:              clientName,
-		originalResponses: originalResponses,
-		ok:                ok,
+	options, err := clientHookOptions(register, 0)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
 	}
 
 	s.responseInClientsMutex.Lock()
@@ -363,35 +480,51 @@ func (s *Server) ResponseIn(register *proto.Register, stream proto.ProxyService_
 		s.responseInClientsMutex.Unlock()
 		return fmt.Errorf("client already registered")
 	}
-	s.responseInClients[clientName] = rChans
+	queue, disconnect, err := newClientQueue[*http.Response](register, s.clientSpoolDir("response-in", clientName))
+	if err != nil {
+		s.responseInClientsMutex.Unlock()
+		return fmt.Errorf("invalid register message: %v", err)
+	}
+	client := &readOnlyClient[*http.Response]{
+		name:       clientName,
+		queue:      queue,
+		disconnect: disconnect,
+	}
+	s.responseInClients[clientName] = client
+	client.removeHook = s.proxy.AddResponseInHook(pipeline.NamedReadOnlyHook[*http.Response]{
+		Name:     clientHookName(clientName),
+		Priority: int(register.Priority),
+		Options:  options,
+		Hook:     s.responseInHook(client),
+	})
 	s.responseInClientsMutex.Unlock()
 
-	defer func() {
-		close(ok)
-	}()
+	defer s.removeResponseInClient(client)
 
-	for r := range originalResponses {
-		if err := stream.Send(ToProtoResponse(httpbytes.CloneResponse(r))); err != nil {
-			log.Printf("Failed to send HttpResponse: %v", err)
-			return err
+	for {
+		select {
+		case r, ok := <-queue.Items():
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ToProtoResponse(httpbytes.CloneResponse(r))); err != nil {
+				log.Printf("Failed to send HttpResponse: %v", err)
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
 		}
-		ok <- true
 	}
-
-	return nil
 }
 
 // ResponseOut handles server to client streaming for HTTP response communication.
 func (s *Server) ResponseOut(register *proto.Register, stream proto.ProxyService_ResponseOutServer) error {
 	log.Printf("ResponseOut Client connected: %s", register.Name)
-	originalResponses := make(chan *http.Response, 1000)
-	ok := make(chan bool)
 
 	clientName := register.Name
-	rChans := &responsesReadOnlyChannels{
-		name:              clientName,
-		originalResponses: originalResponses,
-		ok:                ok,
+	options, err := clientHookOptions(register, 0)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
 	}
 
 	s.responseOutClientsMutex.Lock()
@@ -399,256 +532,337 @@ func (s *Server) ResponseOut(register *proto.Register, stream proto.ProxyService
 		s.responseOutClientsMutex.Unlock()
 		return fmt.Errorf("client already registered")
 	}
-	s.responseOutClients[clientName] = rChans
+	queue, disconnect, err := newClientQueue[*http.Response](register, s.clientSpoolDir("response-out", clientName))
+	if err != nil {
+		s.responseOutClientsMutex.Unlock()
+		return fmt.Errorf("invalid register message: %v", err)
+	}
+	client := &readOnlyClient[*http.Response]{
+		name:       clientName,
+		queue:      queue,
+		disconnect: disconnect,
+	}
+	s.responseOutClients[clientName] = client
+	client.removeHook = s.proxy.AddResponseOutHook(pipeline.NamedReadOnlyHook[*http.Response]{
+		Name:     clientHookName(clientName),
+		Priority: int(register.Priority),
+		Options:  options,
+		Hook:     s.responseOutHook(client),
+	})
 	s.responseOutClientsMutex.Unlock()
 
-	defer func() {
-		close(ok)
-	}()
+	defer s.removeResponseOutClient(client)
 
-	for r := range originalResponses {
-		if err := stream.Send(ToProtoResponse(httpbytes.CloneResponse(r))); err != nil {
-			log.Printf("Failed to send HttpResponse: %v", err)
-			return err
+	for {
+		select {
+		case r, ok := <-queue.Items():
+			if !ok {
+				return nil
+			}
+			if err := stream.Send(ToProtoResponse(httpbytes.CloneResponse(r))); err != nil {
+				log.Printf("Failed to send HttpResponse: %v", err)
+				return err
+			}
+		case <-stream.Context().Done():
+			return nil
 		}
-		ok <- true
 	}
-
-	return nil
 }
 
-func (s *Server) RequestInHook(r *http.Request) error {
-	var clients []*requestsReadOnlyChannels
-	s.requestInClientsMutex.RLock()
-	for _, rc := range s.requestInClients {
-		clients = append(clients, rc)
-	}
-	// TODO: order by priority
-	s.requestInClientsMutex.RUnlock()
+// FlowOut handles server to client streaming of completed flows.
+func (s *Server) FlowOut(register *proto.Register, stream proto.ProxyService_FlowOutServer) error {
+	log.Printf("FlowOut Client connected: %s", register.Name)
 
-	for _, client := range clients {
-		go func(client *requestsReadOnlyChannels) {
-		SELECT:
-			select {
-			case client.originalRequests <- r:
-				break SELECT
-			default:
-				log.Printf("Queue full, client '%s' removed", client.name)
-				s.requestInClientsMutex.Lock()
-				delete(s.requestInClients, client.name)
-				s.requestInClientsMutex.Unlock()
+	clientName := register.Name
+	options, err := clientHookOptions(register, 0)
+	if err != nil {
+		return fmt.Errorf("invalid register message: %v", err)
+	}
 
-				asyncCloseChannel(client.originalRequests)
+	s.flowOutClientsMutex.Lock()
+	if _, exists := s.flowOutClients[clientName]; exists {
+		s.flowOutClientsMutex.Unlock()
+		return fmt.Errorf("client already registered")
+	}
+	queue, disconnect, err := newClientQueue[*flow.Flow](register, s.clientSpoolDir("flow-out", clientName))
+	if err != nil {
+		s.flowOutClientsMutex.Unlock()
+		return fmt.Errorf("invalid register message: %v", err)
+	}
+	client := &readOnlyClient[*flow.Flow]{
+		name:       clientName,
+		queue:      queue,
+		disconnect: disconnect,
+	}
+	s.flowOutClients[clientName] = client
+	client.removeHook = s.proxy.AddFlowOutHook(pipeline.NamedReadOnlyHook[*flow.Flow]{
+		Name:     clientHookName(clientName),
+		Priority: int(register.Priority),
+		Options:  options,
+		Hook:     s.flowOutHook(client),
+	})
+	s.flowOutClientsMutex.Unlock()
+
+	defer s.removeFlowOutClient(client)
+
+	for {
+		select {
+		case f, ok := <-queue.Items():
+			if !ok {
+				return nil
 			}
-
-			if !<-client.ok {
-				log.Printf("Empty response, client '%s' removed", client.name)
-				s.requestInClientsMutex.Lock()
-				delete(s.requestInClients, client.name)
-				s.requestInClientsMutex.Unlock()
-
-				asyncCloseChannel(client.originalRequests)
+			if err := stream.Send(ToProtoFlow(f.Clone())); err != nil {
+				log.Printf("Failed to send Flow: %v", err)
+				return err
 			}
-		}(client)
+		case <-stream.Context().Done():
+			return nil
+		}
 	}
+}
 
-	return nil
+// requestInHook returns the hook of a RequestIn client. The items that do not
+// fit in the queue of the client are not errors of the hook.
+func (s *Server) requestInHook(client *readOnlyClient[*http.Request]) pipeline.ReadOnlyHook[*http.Request] {
+	return func(r *http.Request) error {
+		if err := client.queue.Push(r); err != nil {
+			grpcDropped.Inc("request-in", client.name)
+			if client.disconnect {
+				log.Printf("Queue full, client '%s' removed", client.name)
+				s.removeRequestInClient(client)
+			}
+		}
+		return nil
+	}
 }
 
-func (s *Server) RequestOutHook(r *http.Request) error {
-	var clients []*requestsReadOnlyChannels
-	s.requestOutClientsMutex.RLock()
-	for _, rc := range s.requestOutClients {
-		clients = append(clients, rc)
+// removeRequestInClient removes a RequestIn client and its hook
+func (s *Server) removeRequestInClient(client *readOnlyClient[*http.Request]) {
+	s.requestInClientsMutex.Lock()
+	if s.requestInClients[client.name] == client {
+		delete(s.requestInClients, client.name)
 	}
-	// TODO: order by priority
-	s.requestOutClientsMutex.RUnlock()
+	s.requestInClientsMutex.Unlock()
 
-	for _, client := range clients {
-		go func(client *requestsReadOnlyChannels) {
-		SELECT:
-			select {
-			case client.originalRequests <- r:
-				break SELECT
-			default:
-				log.Printf("Queue full, client '%s' removed", client.name)
-				s.requestOutClientsMutex.Lock()
-				delete(s.requestOutClients, client.name)
-				s.requestOutClientsMutex.Unlock()
+	client.removeHook()
+	client.queue.Close()
+}
 
-				asyncCloseChannel(client.originalRequests)
+// requestOutHook returns the hook of a RequestOut client. The items that do not
+// fit in the queue of the client are not errors of the hook.
+func (s *Server) requestOutHook(client *readOnlyClient[*http.Request]) pipeline.ReadOnlyHook[*http.Request] {
+	return func(r *http.Request) error {
+		if err := client.queue.Push(r); err != nil {
+			grpcDropped.Inc("request-out", client.name)
+			if client.disconnect {
+				log.Printf("Queue full, client '%s' removed", client.name)
+				s.removeRequestOutClient(client)
 			}
+		}
+		return nil
+	}
+}
 
-			if !<-client.ok {
-				log.Printf("Empty response, client '%s' removed", client.name)
-				s.requestOutClientsMutex.Lock()
-				delete(s.requestOutClients, client.name)
-				s.requestOutClientsMutex.Unlock()
-
-				asyncCloseChannel(client.originalRequests)
-			}
-		}(client)
+// removeRequestOutClient removes a RequestOut client and its hook
+func (s *Server) removeRequestOutClient(client *readOnlyClient[*http.Request]) {
+	s.requestOutClientsMutex.Lock()
+	if s.requestOutClients[client.name] == client {
+		delete(s.requestOutClients, client.name)
 	}
+	s.requestOutClientsMutex.Unlock()
 
-	return nil
+	client.removeHook()
+	client.queue.Close()
 }
 
-func (s *Server) RequestModHook(r *http.Request) (*http.Request, error) {
-	var clients []*requestsChannels
-	s.requestModClientsMutex.RLock()
-	for _, rc := range s.requestModClients {
-		clients = append(clients, rc)
-	}
-	// TODO: order by priority
-	s.requestModClientsMutex.RUnlock()
+// requestModHook returns the hook of a RequestMod client. A client that
+// does not answer in time is removed, so that the items after it neither
+// wait for it nor leave goroutines blocked on it.
+func (s *Server) requestModHook(client *requestsChannels) pipeline.ModHook[*http.Request] {
+	return func(r *http.Request) (*http.Request, error) {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+
+		select {
+		case <-client.removed:
+			return r, nil
+		default:
+		}
 
-FOR:
-	for _, client := range clients {
-	SELECT:
 		select {
 		case client.originalRequests <- r:
-			break SELECT
 		default:
+			grpcDropped.Inc("request-mod", client.name)
 			log.Printf("Queue full, client '%s' removed", client.name)
-			s.requestModClientsMutex.Lock()
-			delete(s.requestModClients, client.name)
-			s.requestModClientsMutex.Unlock()
-			continue FOR
-
-			asyncCloseChannel(client.originalRequests)
+			s.removeRequestModClient(client)
+			return r, nil
 		}
 
-		modR := <-client.modifiedRequests
-		if modR == nil {
-			log.Printf("Empty response, client '%s' removed", client.name)
-			s.requestModClientsMutex.Lock()
-			delete(s.requestModClients, client.name)
-			s.requestModClientsMutex.Unlock()
+		timer := time.NewTimer(client.timeout)
+		defer timer.Stop()
 
-			asyncCloseChannel(client.originalRequests)
-			return r, nil
+		select {
+		case modR := <-client.modifiedRequests:
+			if modR == nil {
+				log.Printf("Empty response, client '%s' removed", client.name)
+				s.removeRequestModClient(client)
+				return r, nil
+			}
+			return modR, nil
+		case <-timer.C:
+			log.Printf("No answer in %s, client '%s' removed", client.timeout, client.name)
+			s.removeRequestModClient(client)
+			return r, fmt.Errorf("client '%s' did not answer in %s", client.name, client.timeout)
 		}
-		r = modR
 	}
-
-	return r, nil
 }
 
-func (s *Server) ResponseInHook(r *http.Response) error {
-	var clients []*responsesReadOnlyChannels
-	s.responseInClientsMutex.RLock()
-	for _, rc := range s.responseInClients {
-		clients = append(clients, rc)
+// removeRequestModClient removes a RequestMod client and its hook
+func (s *Server) removeRequestModClient(client *requestsChannels) {
+	s.requestModClientsMutex.Lock()
+	if s.requestModClients[client.name] == client {
+		delete(s.requestModClients, client.name)
 	}
-	// TODO: order by priority
-	s.responseInClientsMutex.RUnlock()
+	s.requestModClientsMutex.Unlock()
 
-	for _, client := range clients {
-		go func(client *responsesReadOnlyChannels) {
-		SELECT:
-			select {
-			case client.originalResponses <- r:
-				break SELECT
-			default:
-				log.Printf("Queue full, client '%s' removed", client.name)
-				s.responseInClientsMutex.Lock()
-				delete(s.responseInClients, client.name)
-				s.responseInClientsMutex.Unlock()
+	client.removeHook()
+	client.removeOnce.Do(func() { close(client.removed) })
+	asyncCloseChannel(client.originalRequests)
+}
 
-				asyncCloseChannel(client.originalResponses)
+// responseInHook returns the hook of a ResponseIn client. The items that do not
+// fit in the queue of the client are not errors of the hook.
+func (s *Server) responseInHook(client *readOnlyClient[*http.Response]) pipeline.ReadOnlyHook[*http.Response] {
+	return func(r *http.Response) error {
+		if err := client.queue.Push(r); err != nil {
+			grpcDropped.Inc("response-in", client.name)
+			if client.disconnect {
+				log.Printf("Queue full, client '%s' removed", client.name)
+				s.removeResponseInClient(client)
 			}
+		}
+		return nil
+	}
+}
 
-			if !<-client.ok {
-				log.Printf("Empty response, client '%s' removed", client.name)
-				s.responseInClientsMutex.Lock()
-				delete(s.responseInClients, client.name)
-				s.responseInClientsMutex.Unlock()
+// removeResponseInClient removes a ResponseIn client and its hook
+func (s *Server) removeResponseInClient(client *readOnlyClient[*http.Response]) {
+	s.responseInClientsMutex.Lock()
+	if s.responseInClients[client.name] == client {
+		delete(s.responseInClients, client.name)
+	}
+	s.responseInClientsMutex.Unlock()
 
-				asyncCloseChannel(client.originalResponses)
+	client.removeHook()
+	client.queue.Close()
+}
+
+// responseOutHook returns the hook of a ResponseOut client. The items that do not
+// fit in the queue of the client are not errors of the hook.
+func (s *Server) responseOutHook(client *readOnlyClient[*http.Response]) pipeline.ReadOnlyHook[*http.Response] {
+	return func(r *http.Response) error {
+		if err := client.queue.Push(r); err != nil {
+			grpcDropped.Inc("response-out", client.name)
+			if client.disconnect {
+				log.Printf("Queue full, client '%s' removed", client.name)
+				s.removeResponseOutClient(client)
 			}
-		}(client)
+		}
+		return nil
 	}
-
-	return nil
 }
 
-func (s *Server) ResponseOutHook(r *http.Response) error {
-	var clients []*responsesReadOnlyChannels
-	s.responseOutClientsMutex.RLock()
-	for _, rc := range s.responseOutClients {
-		clients = append(clients, rc)
+// removeResponseOutClient removes a ResponseOut client and its hook
+func (s *Server) removeResponseOutClient(client *readOnlyClient[*http.Response]) {
+	s.responseOutClientsMutex.Lock()
+	if s.responseOutClients[client.name] == client {
+		delete(s.responseOutClients, client.name)
 	}
-	// TODO: order by priority
-	s.responseOutClientsMutex.RUnlock()
+	s.responseOutClientsMutex.Unlock()
 
-	for _, client := range clients {
-		go func(client *responsesReadOnlyChannels) {
-		SELECT:
-			select {
-			case client.originalResponses <- r:
-				break SELECT
-			default:
-				log.Printf("Queue full, client '%s' removed", client.name)
-				s.responseOutClientsMutex.Lock()
-				delete(s.responseOutClients, client.name)
-				s.responseOutClientsMutex.Unlock()
+	client.removeHook()
+	client.queue.Close()
+}
 
-				asyncCloseChannel(client.originalResponses)
+// flowOutHook returns the hook of a FlowOut client. The items that do not
+// fit in the queue of the client are not errors of the hook.
+func (s *Server) flowOutHook(client *readOnlyClient[*flow.Flow]) pipeline.ReadOnlyHook[*flow.Flow] {
+	return func(f *flow.Flow) error {
+		if err := client.queue.Push(f); err != nil {
+			grpcDropped.Inc("flow-out", client.name)
+			if client.disconnect {
+				log.Printf("Queue full, client '%s' removed", client.name)
+				s.removeFlowOutClient(client)
 			}
+		}
+		return nil
+	}
+}
 
-			if !<-client.ok {
-				log.Printf("Empty response, client '%s' removed", client.name)
-				s.responseOutClientsMutex.Lock()
-				delete(s.responseOutClients, client.name)
-				s.responseOutClientsMutex.Unlock()
-
-				asyncCloseChannel(client.originalResponses)
-			}
-		}(client)
+// removeFlowOutClient removes a FlowOut client and its hook
+func (s *Server) removeFlowOutClient(client *readOnlyClient[*flow.Flow]) {
+	s.flowOutClientsMutex.Lock()
+	if s.flowOutClients[client.name] == client {
+		delete(s.flowOutClients, client.name)
 	}
+	s.flowOutClientsMutex.Unlock()
 
-	return nil
+	client.removeHook()
+	client.queue.Close()
 }
 
-func (s *Server) ResponseModHook(r *http.Response) (*http.Response, error) {
-	var clients []*responsesChannels
-	s.responseModClientsMutex.RLock()
-	for _, rc := range s.responseModClients {
-		clients = append(clients, rc)
-	}
-	// TODO: order by priority
-	s.responseModClientsMutex.RUnlock()
+// responseModHook returns the hook of a ResponseMod client. A client that
+// does not answer in time is removed, as in requestModHook.
+func (s *Server) responseModHook(client *responsesChannels) pipeline.ModHook[*http.Response] {
+	return func(r *http.Response) (*http.Response, error) {
+		client.mutex.Lock()
+		defer client.mutex.Unlock()
+
+		select {
+		case <-client.removed:
+			return r, nil
+		default:
+		}
 
-FOR:
-	for _, client := range clients {
-	SELECT:
 		select {
 		case client.originalResponses <- r:
-			break SELECT
 		default:
+			grpcDropped.Inc("response-mod", client.name)
 			log.Printf("Queue full, client '%s' removed", client.name)
-			s.responseModClientsMutex.Lock()
-			delete(s.responseModClients, client.name)
-			s.responseModClientsMutex.Unlock()
-
-			asyncCloseChannel(client.originalResponses)
-			continue FOR
+			s.removeResponseModClient(client)
+			return r, nil
 		}
 
-		modR := <-client.modifiedResponses
-		if modR == nil {
-			log.Printf("Empty response, client '%s' removed", client.name)
-			s.responseModClientsMutex.Lock()
-			delete(s.responseModClients, client.name)
-			s.responseModClientsMutex.Unlock()
+		timer := time.NewTimer(client.timeout)
+		defer timer.Stop()
 
-			asyncCloseChannel(client.originalResponses)
-			return r, nil
+		select {
+		case modR := <-client.modifiedResponses:
+			if modR == nil {
+				log.Printf("Empty response, client '%s' removed", client.name)
+				s.removeResponseModClient(client)
+				return r, nil
+			}
+			return modR, nil
+		case <-timer.C:
+			log.Printf("No answer in %s, client '%s' removed", client.timeout, client.name)
+			s.removeResponseModClient(client)
+			return r, fmt.Errorf("client '%s' did not answer in %s", client.name, client.timeout)
 		}
-		r = modR
 	}
+}
 
-	return r, nil
+// removeResponseModClient removes a ResponseMod client and its hook
+func (s *Server) removeResponseModClient(client *responsesChannels) {
+	s.responseModClientsMutex.Lock()
+	if s.responseModClients[client.name] == client {
+		delete(s.responseModClients, client.name)
+	}
+	s.responseModClientsMutex.Unlock()
+
+	client.removeHook()
+	client.removeOnce.Do(func() { close(client.removed) })
+	asyncCloseChannel(client.originalResponses)
 }
 
 // GetConfig returns the current proxy config
@@ -662,12 +876,24 @@ func (s *Server) GetConfig(ctx context.Context, _ *proto.Null) (*proto.Config, e
 		SaveDir:                 s.config.SaveDir,
 		ScopeDomainRe:           s.config.DomainRe,
 		ScopeExcludedExtensions: s.config.ExcludedExtensions,
+		Project:                 s.config.Project,
+		ProjectNotes:            s.config.ProjectNotes,
+		MatchReplaceRules:       ToProtoMatchReplaceRules(s.config.MatchReplaceRules),
+		PassiveScan:             s.config.PassiveScan,
+		DetectSecrets:           s.config.DetectSecrets,
+		RedactSecrets:           s.config.RedactSecrets,
+		SecretRulesFile:         s.config.SecretRulesFile,
+		AuthzConfigFile:         s.config.AuthzConfigFile,
+		SessionRulesFile:        s.config.SessionRulesFile,
+		HookPriorities:          ToProtoHookPriorities(s.config.HookPriorities),
 	}
 
 	return config, nil
 }
 
-// SetConfig returns the current proxy config
+// SetConfig sets the proxy config. When the project changes, the database,
+// scope, rules and CA of the new project are loaded; otherwise the scope,
+// rules and notes are also saved in the current project.
 func (s *Server) SetConfig(ctx context.Context, config *proto.Config) (*proto.Null, error) {
 	s.configMutex.Lock()
 	newConfig := *s.config
@@ -678,13 +904,578 @@ func (s *Server) SetConfig(ctx context.Context, config *proto.Config) (*proto.Nu
 	newConfig.SaveDir = config.SaveDir
 	newConfig.DomainRe = config.ScopeDomainRe
 	newConfig.ExcludedExtensions = config.ScopeExcludedExtensions
+	newConfig.ProjectNotes = config.ProjectNotes
+	newConfig.MatchReplaceRules = FromProtoMatchReplaceRules(config.MatchReplaceRules)
+	newConfig.PassiveScan = config.PassiveScan
+	newConfig.DetectSecrets = config.DetectSecrets
+	newConfig.RedactSecrets = config.RedactSecrets
+	newConfig.SecretRulesFile = config.SecretRulesFile
+	newConfig.AuthzConfigFile = config.AuthzConfigFile
+	newConfig.SessionRulesFile = config.SessionRulesFile
+	newConfig.HookPriorities = FromProtoHookPriorities(config.HookPriorities)
+
+	newProject := s.project
+	switch {
+	case config.Project == "":
+		newProject = nil
+		newConfig.Project = ""
+
+	case s.project == nil || config.Project != s.config.Project:
+		proj, err := project.Open(config.Project, project.Settings{
+			DomainRe:           newConfig.DomainRe,
+			ExcludedExtensions: newConfig.ExcludedExtensions,
+			MatchReplaceRules:  newConfig.MatchReplaceRules,
+			Notes:              newConfig.ProjectNotes,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to open project %s: %v", config.Project, err)
+		}
+		proj.Configure(&newConfig)
+		newProject = proj
+
+	default:
+		newConfig.DBFile = s.project.DBFile()
+	}
+
+	if err := newConfig.Apply(s.proxy); err != nil {
+		return nil, err
+	}
+
+	// Apply only manages the retention job of the new database, so the
+	// one of the previous database, e.g. of the previous project, is
+	// stopped here
+	if newConfig.DBFile != s.config.DBFile {
+		hooks.StopRetentionJob(s.config.DBFile)
+	}
+
+	if newProject != nil && newProject == s.project {
+		if err := newProject.Update(&newConfig); err != nil {
+			return nil, err
+		}
+	}
 
-	newConfig.Apply(s.proxy)
 	s.config = &newConfig
+	s.project = newProject
 
 	return &proto.Null{}, nil
 }
 
+// PruneHistory deletes flows from the database according to the requested
+// retention policy, or the configured one if the request is empty
+func (s *Server) PruneHistory(ctx context.Context, req *proto.PruneRequest) (*proto.PruneResult, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	policy := s.config.Retention
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	if req.MaxAgeSeconds != 0 || req.MaxRows != 0 || req.MaxSize != 0 || len(req.HostRules) > 0 {
+		policy = hooks.RetentionPolicy{
+			MaxAge:  time.Duration(req.MaxAgeSeconds) * time.Second,
+			MaxRows: int(req.MaxRows),
+			MaxSize: req.MaxSize,
+		}
+		for _, r := range req.HostRules {
+			re, err := regexp.Compile(r.HostRe)
+			if err != nil {
+				return nil, fmt.Errorf("invalid host regex '%s': %v", r.HostRe, err)
+			}
+			policy.HostRules = append(policy.HostRules, hooks.HostRetentionRule{
+				HostRe: re,
+				MaxAge: time.Duration(r.MaxAgeSeconds) * time.Second,
+			})
+		}
+	}
+
+	if policy.IsZero() {
+		return nil, fmt.Errorf("no retention policy specified or configured")
+	}
+
+	result, err := hooks.PruneHistory(dbFile, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.PruneResult{
+		DeletedFlows: int64(result.DeletedFlows),
+		SizeBefore:   result.SizeBefore,
+		SizeAfter:    result.SizeAfter,
+	}, nil
+}
+
+// VacuumHistory releases the space of deleted flows in the database file
+func (s *Server) VacuumHistory(ctx context.Context, _ *proto.Null) (*proto.Null, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	if err := hooks.VacuumHistory(dbFile); err != nil {
+		return nil, err
+	}
+
+	return &proto.Null{}, nil
+}
+
+// SendRequest sends a request again with the proxy transport and stores the
+// new flow linked to the original one
+func (s *Server) SendRequest(ctx context.Context, msg *proto.SendRequestMessage) (*proto.SendRequestResult, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	rep := repeater.New(s.proxy, dbFile)
+
+	var req *http.Request
+	var err error
+	if msg.Request != nil {
+		req, err = FromProtoRequest(msg.Request, nil)
+	} else if msg.OriginalId != "" {
+		req, err = rep.Load(msg.OriginalId)
+	} else {
+		err = fmt.Errorf("either a request or an original id must be given")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := rep.Send(msg.OriginalId, req, msg.RunPipelines)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.SendRequestResult{
+		Id:       f.ID,
+		Request:  ToProtoRequest(f.Request),
+		Response: ToProtoResponse(f.Response),
+	}, nil
+}
+
+// SendRawRequest writes the exact bytes of a request to a target and
+// stores both sides as they were sent and received
+func (s *Server) SendRawRequest(ctx context.Context, msg *proto.RawRequest) (*proto.RawResponse, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	opts := rawhttp.Options{
+		Addr:       msg.Addr,
+		TLS:        msg.Tls,
+		ServerName: msg.ServerName,
+		Timeout:    time.Duration(msg.TimeoutMs) * time.Millisecond,
+	}
+
+	data, err := rawhttp.Send(msg.Data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &proto.RawResponse{Data: data}
+	if dbFile == "" {
+		return result, nil
+	}
+
+	f, err := rawhttp.NewFlow(msg.Data, data, opts)
+	if err != nil {
+		log.Printf("Raw request was not stored, failed to parse flow: %v", err)
+		return result, nil
+	}
+	result.Id, err = hooks.SaveRawFlow(dbFile, f, msg.Data, data)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Findings streams the findings reported by the scanners, preceded by the
+// stored ones if requested
+func (s *Server) Findings(req *proto.FindingsRequest, stream proto.ProxyService_FindingsServer) error {
+	s.configMutex.RLock()
+	broker := s.config.Findings
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if broker == nil {
+		return fmt.Errorf("findings are not available")
+	}
+
+	minSeverity := findings.Severity(req.MinSeverity)
+	if req.MinSeverity != "" && minSeverity.Rank() == 0 {
+		return fmt.Errorf("invalid severity '%s'", req.MinSeverity)
+	}
+
+	// subscribe before loading the stored findings so that none is missed
+	c := broker.Subscribe()
+	defer broker.Unsubscribe(c)
+
+	if req.IncludeStored && dbFile != "" {
+		stored, err := hooks.LoadFindings(dbFile, hooks.FindingFilter{MinSeverity: minSeverity})
+		if err != nil {
+			return err
+		}
+		for _, f := range stored {
+			if err := stream.Send(ToProtoFinding(f)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case f := <-c:
+			if f.Severity.Rank() < minSeverity.Rank() {
+				continue
+			}
+			if err := stream.Send(ToProtoFinding(f)); err != nil {
+				log.Printf("Failed to send Finding: %v", err)
+				return err
+			}
+		}
+	}
+}
+
+// GetSiteMap builds the site map of the stored flows
+func (s *Server) GetSiteMap(ctx context.Context, req *proto.SiteMapRequest) (*proto.SiteMap, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	filter := hooks.FlowFilter{}
+	if req.HostRe != "" {
+		re, err := regexp.Compile(req.HostRe)
+		if err != nil {
+			return nil, fmt.Errorf("invalid host regex: %v", err)
+		}
+		filter.HostRe = re
+	}
+	if req.UrlRe != "" {
+		re, err := regexp.Compile(req.UrlRe)
+		if err != nil {
+			return nil, fmt.Errorf("invalid url regex: %v", err)
+		}
+		filter.URLRe = re
+	}
+
+	flows, err := hooks.LoadFlows(dbFile, filter)
+	if err != nil {
+		return nil, err
+	}
+	sm := sitemap.Build(flows)
+
+	result := &proto.SiteMap{}
+	for _, h := range sm.SortedHosts() {
+		result.Hosts = append(result.Hosts, ToProtoSiteMapNode(h))
+	}
+
+	switch req.Format {
+	case "":
+	case "json":
+		result.Export, err = json.Marshal(sm)
+	case "openapi":
+		if len(sm.Hosts) != 1 {
+			return nil, fmt.Errorf("OpenAPI export requires flows of exactly one host, got %d", len(sm.Hosts))
+		}
+		var doc map[string]any
+		doc, err = sm.OpenAPI(sm.SortedHosts()[0].Name)
+		if err == nil {
+			result.Export, err = json.Marshal(doc)
+		}
+	default:
+		return nil, fmt.Errorf("invalid format '%s': expected json or openapi", req.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ActiveScan scans the in scope stored flows and streams the findings until
+// the scan finishes or the client cancels it
+func (s *Server) ActiveScan(req *proto.ActiveScanRequest, stream proto.ProxyService_ActiveScanServer) error {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	domainRe := s.config.DomainRe
+	excludedExtensions := s.config.ExcludedExtensions
+	broker := s.config.Findings
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return fmt.Errorf("no database configured")
+	}
+
+	filter := hooks.FlowFilter{FromID: req.FromId, ToID: req.ToId}
+	if req.HostRe != "" {
+		re, err := regexp.Compile(req.HostRe)
+		if err != nil {
+			return fmt.Errorf("invalid host regex: %v", err)
+		}
+		filter.HostRe = re
+	}
+	if req.UrlRe != "" {
+		re, err := regexp.Compile(req.UrlRe)
+		if err != nil {
+			return fmt.Errorf("invalid url regex: %v", err)
+		}
+		filter.URLRe = re
+	}
+
+	var scopeRe *regexp.Regexp
+	if domainRe != "" {
+		re, err := regexp.Compile(domainRe)
+		if err != nil {
+			return fmt.Errorf("invalid scope regex: %v", err)
+		}
+		scopeRe = re
+	}
+
+	flows, err := hooks.LoadFlows(dbFile, filter)
+	if err != nil {
+		return err
+	}
+
+	sink := hooks.NewFindingSink(dbFile, broker)
+	sendMutex := sync.Mutex{}
+	activeScanner := scanner.NewActiveScanner(dbFile, func(f findings.Finding) {
+		sendMutex.Lock()
+		defer sendMutex.Unlock()
+		sink(f)
+		if err := stream.Send(ToProtoFinding(f)); err != nil {
+			log.Printf("Failed to send Finding: %v", err)
+		}
+	})
+	activeScanner.Scope = scope.New(scopeRe, excludedExtensions)
+	if len(req.Checks) > 0 {
+		activeScanner.Checks, err = scanner.SelectActiveChecks(req.Checks)
+		if err != nil {
+			return err
+		}
+	}
+	if req.Concurrency > 0 {
+		activeScanner.Concurrency = int(req.Concurrency)
+	}
+	if req.TimeDelayMs > 0 {
+		activeScanner.TimeDelay = time.Duration(req.TimeDelayMs) * time.Millisecond
+	}
+
+	_, err = activeScanner.Scan(stream.Context(), flows)
+	return err
+}
+
+// ListHooks returns the hooks of each pipeline in the order they run,
+// including the ones of the connected clients
+func (s *Server) ListHooks(ctx context.Context, _ *proto.Null) (*proto.HookChains, error) {
+	chains := ToProtoHookChains(s.proxy.HookChains())
+	chains.Pipelines = ToProtoPipelineStats(s.proxy.PipelineStats())
+
+	setClientQueueStats(chains.RequestIn, &s.requestInClientsMutex, s.requestInClients)
+	setClientQueueStats(chains.RequestOut, &s.requestOutClientsMutex, s.requestOutClients)
+	setClientQueueStats(chains.ResponseIn, &s.responseInClientsMutex, s.responseInClients)
+	setClientQueueStats(chains.ResponseOut, &s.responseOutClientsMutex, s.responseOutClients)
+	setClientQueueStats(chains.FlowOut, &s.flowOutClientsMutex, s.flowOutClients)
+
+	return chains, nil
+}
+
+// setClientQueueStats sets the counters of the queues of the read-only
+// clients in their hooks
+func setClientQueueStats[I pipeline.PipelineItem](hooks []*proto.HookInfo, mutex *sync.RWMutex, clients map[string]*readOnlyClient[I]) {
+	mutex.RLock()
+	defer mutex.RUnlock()
+
+	for name, client := range clients {
+		for _, h := range hooks {
+			if h.Name == clientHookName(name) {
+				h.Dropped = client.queue.Dropped()
+				h.Spooled = int64(client.queue.Spooled())
+			}
+		}
+	}
+}
+
+// DiffFlows compares the responses of two stored flows, or of a stored flow
+// and the result of sending its request again
+func (s *Server) DiffFlows(ctx context.Context, req *proto.DiffRequest) (*proto.FlowDiff, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	oldFlow, err := hooks.LoadFlow(dbFile, req.OldId)
+	if err != nil {
+		return nil, err
+	}
+
+	var newFlow *flow.Flow
+	if req.Replay {
+		rep := repeater.New(s.proxy, dbFile)
+		r, err := rep.Load(req.OldId)
+		if err != nil {
+			return nil, err
+		}
+		newFlow, err = rep.Send(req.OldId, r, false)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		newFlow, err = hooks.LoadFlow(dbFile, req.NewId)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	result, err := diff.Compare(oldFlow, newFlow, diff.Options{IgnoreHeaders: req.IgnoreHeaders})
+	if err != nil {
+		return nil, err
+	}
+
+	return ToProtoFlowDiff(result), nil
+}
+
+// Annotate edits the annotations of a stored flow and returns the result
+func (s *Server) Annotate(ctx context.Context, req *proto.AnnotateRequest) (*proto.Annotations, error) {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	a, err := hooks.EditAnnotations(dbFile, req.Id, FromProtoAnnotateRequest(req))
+	if err != nil {
+		return nil, err
+	}
+	return ToProtoAnnotations(a), nil
+}
+
+// SearchFlows streams the stored flows that match a query, including their
+// annotations
+func (s *Server) SearchFlows(query *proto.FlowQuery, stream proto.ProxyService_SearchFlowsServer) error {
+	s.configMutex.RLock()
+	dbFile := s.config.DBFile
+	s.configMutex.RUnlock()
+
+	if dbFile == "" {
+		return fmt.Errorf("no database configured")
+	}
+
+	filter, err := FromProtoFlowQuery(query)
+	if err != nil {
+		return err
+	}
+	flows, err := hooks.LoadFlows(dbFile, filter)
+	if err != nil {
+		return err
+	}
+
+	for _, f := range flows {
+		if err := stream.Send(ToProtoFlow(f)); err != nil {
+			log.Printf("Failed to send Flow: %v", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// defaultClientTimeout is the time the proxy waits for the answer of a mod
+// client that does not set a timeout
+const defaultClientTimeout = 10 * time.Second
+
+// defaultClientMaxFailures is the number of consecutive failures after which
+// a client that does not set it is skipped for a cooldown
+const defaultClientMaxFailures = 5
+
+// clientHookOptions returns the options of the hook of a client
+func clientHookOptions(register *proto.Register, defaultTimeout time.Duration) (pipeline.Options, error) {
+	filter, err := FromProtoHookFilter(register.Filter)
+	if err != nil {
+		return pipeline.Options{}, err
+	}
+
+	options := pipeline.Options{
+		Timeout:     time.Duration(register.TimeoutMs) * time.Millisecond,
+		MaxFailures: int(register.MaxFailures),
+		Cooldown:    time.Duration(register.CooldownMs) * time.Millisecond,
+		Filter:      filter,
+	}
+	if options.Timeout == 0 {
+		options.Timeout = defaultTimeout
+	}
+	switch {
+	case options.MaxFailures == 0:
+		options.MaxFailures = defaultClientMaxFailures
+	case options.MaxFailures < 0:
+		options.MaxFailures = 0
+	}
+	// clients fail open unless they ask otherwise, so that a slow or
+	// broken plugin does not reject the traffic
+	if register.FailOpen == nil || *register.FailOpen {
+		options.Policy = pipeline.FailOpen
+	}
+	return options, nil
+}
+
+// clientQueueSize is the number of items the queue of a read-only client
+// holds in memory
+const clientQueueSize = 1000
+
+// newClientQueue creates the queue of a read-only client with the overflow
+// policy of its register message. disconnect is set if the client is removed
+// when the queue is full, which is the default.
+func newClientQueue[I pipeline.PipelineItem](register *proto.Register, spoolDir string) (queue *pipeline.Queue[I], disconnect bool, err error) {
+	policy := pipeline.OverflowPolicy{
+		Wait:     time.Duration(register.OverflowWaitMs) * time.Millisecond,
+		SpoolDir: spoolDir,
+	}
+	if register.Overflow == "" || register.Overflow == "disconnect" {
+		disconnect = true
+	} else if policy.Overflow, err = pipeline.ParseOverflow(register.Overflow); err != nil {
+		return nil, false, err
+	}
+
+	queue, err = pipeline.NewQueue[I](clientQueueSize, policy)
+	if err != nil {
+		return nil, false, err
+	}
+	return queue, disconnect, nil
+}
+
+// clientSpoolDir is the spool directory of a read-only client, which is kept
+// between connections with the same name. It is empty if the proxy has no
+// spool directory.
+func (s *Server) clientSpoolDir(stage, name string) string {
+	s.configMutex.RLock()
+	spoolDir := s.config.SpoolDir
+	s.configMutex.RUnlock()
+
+	if spoolDir == "" {
+		return ""
+	}
+	return filepath.Join(spoolDir, "grpc", stage, "client-"+url.PathEscape(name))
+}
+
+// clientHookName is the name of the hook of a client in the hook chains
+func clientHookName(name string) string {
+	return "grpc:" + name
+}
+
 func asyncCloseChannel[I any](c chan<- I) {
 	go func() {
 		defer func() {
@@ -0,0 +1,372 @@
+package har
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+const creatorName = "efin-proxy"
+
+// FromFlows builds a HAR document from the given flows
+func FromFlows(flows []*flow.Flow) (*HAR, error) {
+	h := &HAR{
+		Log: Log{
+			Version: Version,
+			Creator: Creator{Name: creatorName, Version: Version},
+			Entries: []Entry{},
+		},
+	}
+
+	for _, f := range flows {
+		entry, err := toEntry(f)
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert flow %s: %v", f.ID, err)
+		}
+		h.Log.Entries = append(h.Log.Entries, entry)
+	}
+
+	return h, nil
+}
+
+// Flows converts the entries of the HAR document to flows. The flows do not
+// have an ID assigned.
+func (h *HAR) Flows() ([]*flow.Flow, error) {
+	flows := []*flow.Flow{}
+	for i, e := range h.Log.Entries {
+		f, err := fromEntry(e)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entry %d: %v", i, err)
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+func toEntry(f *flow.Flow) (Entry, error) {
+	req := f.Request
+
+	reqBody, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	u := *req.URL
+	if u.Host == "" {
+		u.Host = host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+
+	headers := toNameValues(httpbytes.RequestHeaders(req))
+	if req.Host == "" && req.Header.Get("Host") == "" && host != "" {
+		headers = append([]NameValue{{Name: "Host", Value: host}}, headers...)
+	}
+
+	query := []NameValue{}
+	for name, values := range u.Query() {
+		for _, v := range values {
+			query = append(query, NameValue{Name: name, Value: v})
+		}
+	}
+
+	cookies := []Cookie{}
+	for _, c := range req.Cookies() {
+		cookies = append(cookies, Cookie{Name: c.Name, Value: c.Value})
+	}
+
+	entry := Entry{
+		StartedDateTime: f.Timestamp.UTC().Format(time.RFC3339Nano),
+		Request: Request{
+			Method:      req.Method,
+			URL:         u.String(),
+			HTTPVersion: httpVersion(req.Proto),
+			Cookies:     cookies,
+			Headers:     headers,
+			QueryString: query,
+			HeadersSize: -1,
+			BodySize:    int64(len(reqBody)),
+		},
+		Cache: Cache{},
+		Timings: Timings{
+			Blocked: -1,
+			DNS:     -1,
+			Connect: -1,
+			SSL:     -1,
+		},
+		ID: f.ID,
+	}
+
+	if len(reqBody) > 0 {
+		postData := &PostData{MimeType: req.Header.Get("Content-Type")}
+		if utf8.Valid(reqBody) {
+			postData.Text = string(reqBody)
+			postData.Params = formParams(postData.MimeType, reqBody)
+		} else {
+			postData.Text = base64.StdEncoding.EncodeToString(reqBody)
+			postData.Encoding = "base64"
+		}
+		entry.Request.PostData = postData
+	}
+
+	if f.Response == nil {
+		entry.Response = Response{
+			HTTPVersion: entry.Request.HTTPVersion,
+			Cookies:     []Cookie{},
+			Headers:     []NameValue{},
+			Content:     Content{MimeType: "x-unknown"},
+			HeadersSize: -1,
+			BodySize:    -1,
+		}
+		return entry, nil
+	}
+
+	resp := f.Response
+	respBody, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return Entry{}, err
+	}
+
+	respCookies := []Cookie{}
+	for _, c := range resp.Cookies() {
+		hc := Cookie{
+			Name:     c.Name,
+			Value:    c.Value,
+			Path:     c.Path,
+			Domain:   c.Domain,
+			HTTPOnly: c.HttpOnly,
+			Secure:   c.Secure,
+		}
+		if !c.Expires.IsZero() {
+			hc.Expires = c.Expires.UTC().Format(time.RFC3339)
+		}
+		respCookies = append(respCookies, hc)
+	}
+
+	mimeType := resp.Header.Get("Content-Type")
+	if mimeType == "" {
+		mimeType = "x-unknown"
+	}
+
+	content := Content{
+		Size:     int64(len(respBody)),
+		MimeType: mimeType,
+	}
+	if utf8.Valid(respBody) {
+		content.Text = string(respBody)
+	} else {
+		content.Text = base64.StdEncoding.EncodeToString(respBody)
+		content.Encoding = "base64"
+	}
+
+	entry.Response = Response{
+		Status:      resp.StatusCode,
+		StatusText:  http.StatusText(resp.StatusCode),
+		HTTPVersion: httpVersion(resp.Proto),
+		Cookies:     respCookies,
+		Headers:     toNameValues(httpbytes.ResponseHeaders(resp)),
+		Content:     content,
+		RedirectURL: resp.Header.Get("Location"),
+		HeadersSize: -1,
+		BodySize:    int64(len(respBody)),
+	}
+
+	if m := flowmeta.GetResponse(resp); m != nil {
+		setTimings(&entry, m)
+	}
+
+	return entry, nil
+}
+
+// setTimings sets the timings of an entry from the metadata of its flow.
+// The connect phase of HAR includes the TLS handshake.
+func setTimings(entry *Entry, m *flowmeta.Meta) {
+	phase := func(d time.Duration) float64 {
+		if d <= 0 {
+			return -1
+		}
+		return flowmeta.Milliseconds(d)
+	}
+
+	entry.Time = flowmeta.Milliseconds(m.Total)
+	entry.ServerIPAddress = m.UpstreamIP
+	entry.Timings = Timings{
+		Blocked: -1,
+		DNS:     phase(m.DNS),
+		Connect: phase(m.Connect + m.TLSHandshake),
+		SSL:     phase(m.TLSHandshake),
+		Wait:    flowmeta.Milliseconds(max(0, m.TimeToFirstByte-m.DNS-m.Connect-m.TLSHandshake)),
+		Receive: flowmeta.Milliseconds(max(0, m.Total-m.TimeToFirstByte)),
+	}
+}
+
+func fromEntry(e Entry) (*flow.Flow, error) {
+	var reqBody []byte
+	if pd := e.Request.PostData; pd != nil {
+		switch {
+		case pd.Encoding == "base64":
+			b, err := base64.StdEncoding.DecodeString(pd.Text)
+			if err != nil {
+				return nil, fmt.Errorf("invalid base64 request body: %v", err)
+			}
+			reqBody = b
+		case pd.Text != "":
+			reqBody = []byte(pd.Text)
+		case len(pd.Params) > 0:
+			values := url.Values{}
+			for _, p := range pd.Params {
+				values.Add(p.Name, p.Value)
+			}
+			reqBody = []byte(values.Encode())
+		}
+	}
+
+	req, err := http.NewRequest(e.Request.Method, e.Request.URL, bytes.NewReader(reqBody))
+	if err != nil {
+		return nil, err
+	}
+	if len(reqBody) == 0 {
+		req.Body = http.NoBody
+	}
+	setProto(e.Request.HTTPVersion, &req.Proto, &req.ProtoMajor, &req.ProtoMinor)
+
+	// the header order and casing of the entry are kept
+	reqWire := &httpbytes.Wire{Proto: req.Proto}
+	for _, h := range e.Request.Headers {
+		// HTTP/2 pseudo headers exported by browsers are not real headers
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		if strings.EqualFold(h.Name, "Host") {
+			req.Host = h.Value
+		}
+		req.Header.Add(h.Name, h.Value)
+		reqWire.Headers = append(reqWire.Headers, httpbytes.Header{Name: h.Name, Value: h.Value})
+	}
+	req = httpbytes.SetRequestWire(req, reqWire)
+
+	// the bodies of entries are decoded, so they are stored as the proxy
+	// stores the decoded bodies of compressed messages
+	if req.Header.Get("Content-Encoding") != "" {
+		httpbytes.SetRequestContentLength(req, int64(len(reqBody)))
+		req.Header.Del("Content-Encoding")
+	}
+	if req.Header.Get("Cookie") == "" {
+		for _, c := range e.Request.Cookies {
+			req.AddCookie(&http.Cookie{Name: c.Name, Value: c.Value})
+		}
+	}
+
+	var timestamp time.Time
+	if e.StartedDateTime != "" {
+		timestamp, err = time.Parse(time.RFC3339Nano, e.StartedDateTime)
+		if err != nil {
+			return nil, fmt.Errorf("invalid startedDateTime: %v", err)
+		}
+	}
+
+	f := &flow.Flow{
+		Timestamp: timestamp,
+		Request:   req,
+	}
+
+	// Entries for requests that did not get a response use status 0
+	if e.Response.Status == 0 {
+		return f, nil
+	}
+
+	var respBody []byte
+	if e.Response.Content.Encoding == "base64" {
+		respBody, err = base64.StdEncoding.DecodeString(e.Response.Content.Text)
+		if err != nil {
+			return nil, fmt.Errorf("invalid base64 response body: %v", err)
+		}
+	} else {
+		respBody = []byte(e.Response.Content.Text)
+	}
+
+	resp := &http.Response{
+		StatusCode:    e.Response.Status,
+		Status:        fmt.Sprintf("%d %s", e.Response.Status, e.Response.StatusText),
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewReader(respBody)),
+		ContentLength: int64(len(respBody)),
+		Request:       req,
+	}
+	setProto(e.Response.HTTPVersion, &resp.Proto, &resp.ProtoMajor, &resp.ProtoMinor)
+	respWire := &httpbytes.Wire{Proto: resp.Proto}
+	for _, h := range e.Response.Headers {
+		if strings.HasPrefix(h.Name, ":") {
+			continue
+		}
+		resp.Header.Add(h.Name, h.Value)
+		respWire.Headers = append(respWire.Headers, httpbytes.Header{Name: h.Name, Value: h.Value})
+	}
+	httpbytes.SetResponseWire(resp, respWire)
+	if resp.Header.Get("Content-Encoding") != "" {
+		httpbytes.SetContentLength(resp, int64(len(respBody)))
+		resp.Header.Del("Content-Encoding")
+	}
+	f.Response = resp
+
+	return f, nil
+}
+
+func toNameValues(headers []httpbytes.Header) []NameValue {
+	nvs := []NameValue{}
+	for _, h := range headers {
+		nvs = append(nvs, NameValue{Name: h.Name, Value: h.Value})
+	}
+	return nvs
+}
+
+func formParams(contentType string, body []byte) []Param {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil || mediaType != "application/x-www-form-urlencoded" {
+		return nil
+	}
+
+	values, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil
+	}
+
+	params := []Param{}
+	for name, vs := range values {
+		for _, v := range vs {
+			params = append(params, Param{Name: name, Value: v})
+		}
+	}
+	return params
+}
+
+func httpVersion(proto string) string {
+	if proto == "" {
+		return "HTTP/1.1"
+	}
+	return proto
+}
+
+func setProto(version string, proto *string, major, minor *int) {
+	if maj, min, ok := http.ParseHTTPVersion(strings.ToUpper(version)); ok {
+		*proto, *major, *minor = strings.ToUpper(version), maj, min
+		return
+	}
+	*proto, *major, *minor = "HTTP/1.1", 1, 1
+}
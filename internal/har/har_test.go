@@ -0,0 +1,202 @@
+package har
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+)
+
+func TestFromFlowsAndBack(t *testing.T) {
+	binaryBody := []byte{0x89, 'P', 'N', 'G', 0xff, 0x00}
+
+	req := httptest.NewRequest("POST", "https://example.com/login?next=%2Fhome", strings.NewReader("user=admin&pass=secret"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Cookie", "session=abc123")
+
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header: http.Header{
+			"Content-Type": []string{"image/png"},
+			"Set-Cookie":   []string{"token=xyz; Path=/; HttpOnly; Secure"},
+		},
+		Body:    io.NopCloser(bytes.NewReader(binaryBody)),
+		Request: req,
+	}
+
+	timestamp := time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC)
+	h, err := FromFlows([]*flow.Flow{{ID: "7", Timestamp: timestamp, Request: req, Response: resp}})
+	if err != nil {
+		t.Fatalf("FromFlows() error = %v", err)
+	}
+
+	if len(h.Log.Entries) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(h.Log.Entries))
+	}
+	e := h.Log.Entries[0]
+
+	if e.ID != "7" {
+		t.Errorf("entry ID = %q, want %q", e.ID, "7")
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "user=admin&pass=secret" {
+		t.Errorf("unexpected postData: %+v", e.Request.PostData)
+	}
+	if len(e.Request.PostData.Params) != 2 {
+		t.Errorf("expected 2 post params, got %d", len(e.Request.PostData.Params))
+	}
+	if len(e.Request.QueryString) != 1 || e.Request.QueryString[0].Value != "/home" {
+		t.Errorf("unexpected query string: %+v", e.Request.QueryString)
+	}
+	if len(e.Request.Cookies) != 1 || e.Request.Cookies[0].Value != "abc123" {
+		t.Errorf("unexpected request cookies: %+v", e.Request.Cookies)
+	}
+	if len(e.Response.Cookies) != 1 || !e.Response.Cookies[0].HTTPOnly || !e.Response.Cookies[0].Secure {
+		t.Errorf("unexpected response cookies: %+v", e.Response.Cookies)
+	}
+	if e.Response.Content.Encoding != "base64" {
+		t.Errorf("expected base64 encoded binary body, got encoding %q", e.Response.Content.Encoding)
+	}
+
+	var buf bytes.Buffer
+	if err := Encode(&buf, h); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	decoded, err := Decode(&buf)
+	if err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+
+	flows, err := decoded.Flows()
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("expected 1 flow, got %d", len(flows))
+	}
+	f := flows[0]
+
+	if !f.Timestamp.Equal(timestamp) {
+		t.Errorf("timestamp = %v, want %v", f.Timestamp, timestamp)
+	}
+	if f.Request.Method != "POST" || f.Request.URL.String() != "https://example.com/login?next=%2Fhome" {
+		t.Errorf("unexpected request: %s %s", f.Request.Method, f.Request.URL)
+	}
+	reqBody, _ := io.ReadAll(f.Request.Body)
+	if string(reqBody) != "user=admin&pass=secret" {
+		t.Errorf("request body = %q", reqBody)
+	}
+	if f.Request.Header.Get("Cookie") != "session=abc123" {
+		t.Errorf("Cookie header = %q", f.Request.Header.Get("Cookie"))
+	}
+	respBody, _ := io.ReadAll(f.Response.Body)
+	if !bytes.Equal(respBody, binaryBody) {
+		t.Errorf("response body = %v, want %v", respBody, binaryBody)
+	}
+	if f.Response.StatusCode != 200 || f.Response.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("unexpected response: %d %v", f.Response.StatusCode, f.Response.Header)
+	}
+}
+
+func TestFlowsSkipsPseudoHeaders(t *testing.T) {
+	h := &HAR{Log: Log{Entries: []Entry{{
+		StartedDateTime: "2025-01-02T03:04:05.123Z",
+		Request: Request{
+			Method:      "GET",
+			URL:         "https://example.com/",
+			HTTPVersion: "h2",
+			Headers: []NameValue{
+				{Name: ":authority", Value: "example.com"},
+				{Name: "accept", Value: "*/*"},
+			},
+		},
+		Response: Response{
+			Status:  204,
+			Headers: []NameValue{{Name: ":status", Value: "204"}},
+		},
+	}}}}
+
+	flows, err := h.Flows()
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+
+	f := flows[0]
+	if len(f.Request.Header) != 1 || f.Request.Header.Get("Accept") != "*/*" {
+		t.Errorf("unexpected request headers: %v", f.Request.Header)
+	}
+	if len(f.Response.Header) != 0 {
+		t.Errorf("unexpected response headers: %v", f.Response.Header)
+	}
+	if f.Request.Proto != "HTTP/1.1" {
+		t.Errorf("proto = %q, want HTTP/1.1", f.Request.Proto)
+	}
+}
+
+func TestFlowsDecodedContent(t *testing.T) {
+	h := &HAR{Log: Log{Entries: []Entry{{
+		StartedDateTime: "2025-01-02T03:04:05.123Z",
+		Request: Request{
+			Method:   "POST",
+			URL:      "https://example.com/",
+			Headers:  []NameValue{{Name: "Content-Encoding", Value: "gzip"}, {Name: "Content-Length", Value: "23"}},
+			PostData: &PostData{MimeType: "text/plain", Text: "a=1"},
+		},
+		Response: Response{
+			Status:  200,
+			Headers: []NameValue{{Name: "Content-Encoding", Value: "br"}, {Name: "Content-Length", Value: "9"}},
+			Content: Content{MimeType: "text/plain", Text: "decoded body"},
+		},
+	}}}}
+
+	flows, err := h.Flows()
+	if err != nil {
+		t.Fatalf("Flows() error = %v", err)
+	}
+
+	f := flows[0]
+	if ce := f.Request.Header.Get("Content-Encoding"); ce != "" || f.Request.Header.Get("Content-Length") != "3" {
+		t.Errorf("request headers = %v, want no Content-Encoding and Content-Length 3", f.Request.Header)
+	}
+	if ce := f.Response.Header.Get("Content-Encoding"); ce != "" || f.Response.Header.Get("Content-Length") != "12" {
+		t.Errorf("response headers = %v, want no Content-Encoding and Content-Length 12", f.Response.Header)
+	}
+}
+
+func TestFromFlowsTimings(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://example.com/", nil)
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{},
+		Body:       io.NopCloser(strings.NewReader("ok")),
+		Request:    req,
+	}
+	flowmeta.SetResponse(resp, &flowmeta.Meta{
+		Connect:         10 * time.Millisecond,
+		TLSHandshake:    20 * time.Millisecond,
+		TimeToFirstByte: 50 * time.Millisecond,
+		Total:           60 * time.Millisecond,
+		UpstreamIP:      "192.0.2.10",
+	})
+
+	h, err := FromFlows([]*flow.Flow{{ID: "1", Request: req, Response: resp}})
+	if err != nil {
+		t.Fatalf("FromFlows() error = %v", err)
+	}
+
+	e := h.Log.Entries[0]
+	want := Timings{Blocked: -1, DNS: -1, Connect: 30, SSL: 20, Wait: 20, Receive: 10}
+	if e.Timings != want {
+		t.Errorf("timings = %+v, want %+v", e.Timings, want)
+	}
+	if e.Time != 60 || e.ServerIPAddress != "192.0.2.10" {
+		t.Errorf("time = %v, server IP = %q", e.Time, e.ServerIPAddress)
+	}
+}
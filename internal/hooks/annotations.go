@@ -0,0 +1,257 @@
+package hooks
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+)
+
+func initAnnotationTables(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS flow_annotations (
+            request_id INTEGER PRIMARY KEY,
+            color TEXT NOT NULL,
+            comment TEXT NOT NULL,
+            FOREIGN KEY (request_id) REFERENCES requests(request_id)
+        );
+        CREATE TABLE IF NOT EXISTS flow_tags (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            request_id INTEGER NOT NULL,
+            tag TEXT NOT NULL,
+            UNIQUE (request_id, tag),
+            FOREIGN KEY (request_id) REFERENCES requests(request_id)
+        );
+        CREATE TABLE IF NOT EXISTS flow_values (
+            request_id INTEGER NOT NULL,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL,
+            UNIQUE (request_id, name),
+            FOREIGN KEY (request_id) REFERENCES requests(request_id)
+        );
+        CREATE INDEX IF NOT EXISTS idx_flow_tags_tag ON flow_tags(tag);
+        CREATE INDEX IF NOT EXISTS idx_flow_values_name ON flow_values(name);
+    `)
+	return err
+}
+
+// annotationTables are the tables with the annotations of flows
+var annotationTables = []string{"flow_annotations", "flow_tags", "flow_values"}
+
+// execer is implemented by sql.DB and sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// querier is implemented by sql.DB and sql.Tx
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// saveAnnotations replaces the annotations of a flow
+func saveAnnotations(tx execer, id any, a annotations.Annotations) error {
+	for _, table := range annotationTables {
+		if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE request_id = ?", table), id); err != nil {
+			return err
+		}
+	}
+
+	if a.Color != "" || a.Comment != "" {
+		_, err := tx.Exec(
+			"INSERT INTO flow_annotations (request_id, color, comment) VALUES (?, ?, ?)",
+			id, a.Color, a.Comment,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	for _, tag := range a.Tags {
+		if _, err := tx.Exec("INSERT OR IGNORE INTO flow_tags (request_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return err
+		}
+	}
+	for name, value := range a.Values {
+		if _, err := tx.Exec("INSERT INTO flow_values (request_id, name, value) VALUES (?, ?, ?)", id, name, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadAnnotations returns the annotations of a flow
+func loadAnnotations(db querier, id any) (annotations.Annotations, error) {
+	a := annotations.Annotations{}
+
+	err := db.QueryRow("SELECT color, comment FROM flow_annotations WHERE request_id = ?", id).Scan(&a.Color, &a.Comment)
+	if err != nil && err != sql.ErrNoRows {
+		return a, err
+	}
+
+	rows, err := db.Query("SELECT tag FROM flow_tags WHERE request_id = ? ORDER BY id", id)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return a, err
+		}
+		a.Tags = append(a.Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return a, err
+	}
+	rows.Close()
+
+	rows, err = db.Query("SELECT name, value FROM flow_values WHERE request_id = ?", id)
+	if err != nil {
+		return a, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return a, err
+		}
+		if a.Values == nil {
+			a.Values = map[string]string{}
+		}
+		a.Values[name] = value
+	}
+
+	return a, rows.Err()
+}
+
+// setFlowAnnotations loads the annotations of a stored flow into a bag in
+// its request and response
+func setFlowAnnotations(db querier, f *flow.Flow) error {
+	a, err := loadAnnotations(db, f.ID)
+	if err != nil {
+		return err
+	}
+
+	bag := annotations.NewBag(a)
+	f.Request = annotations.Set(f.Request, bag)
+	if f.Response != nil && f.Response.Request != nil {
+		f.Response.Request = annotations.Set(f.Response.Request, bag)
+	}
+	return nil
+}
+
+// annotationConditions returns the SQL conditions and arguments that select
+// the flows with the annotations of the filter
+func annotationConditions(filter FlowFilter) (string, []any) {
+	query := ""
+	args := []any{}
+
+	for _, tag := range filter.Tags {
+		query += " AND r.request_id IN (SELECT request_id FROM flow_tags WHERE tag = ?)"
+		args = append(args, tag)
+	}
+	if filter.Color != "" {
+		query += " AND r.request_id IN (SELECT request_id FROM flow_annotations WHERE color = ?)"
+		args = append(args, filter.Color)
+	}
+	if filter.Comment != "" {
+		query += ` AND r.request_id IN (SELECT request_id FROM flow_annotations WHERE comment LIKE ? ESCAPE '\')`
+		args = append(args, "%"+likeEscaper.Replace(filter.Comment)+"%")
+	}
+	for name, value := range filter.Values {
+		query += " AND r.request_id IN (SELECT request_id FROM flow_values WHERE name = ? AND value = ?)"
+		args = append(args, name, value)
+	}
+
+	return query, args
+}
+
+// hasAnnotations reports whether the filter selects flows by their
+// annotations
+func (filter FlowFilter) hasAnnotations() bool {
+	return len(filter.Tags) > 0 || filter.Color != "" || filter.Comment != "" || len(filter.Values) > 0
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// LoadAnnotations returns the annotations of a stored flow
+func LoadAnnotations(dbFile string, id string) (annotations.Annotations, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return annotations.Annotations{}, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return annotations.Annotations{}, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	if err := checkFlowExists(db, id); err != nil {
+		return annotations.Annotations{}, err
+	}
+	return loadAnnotations(db, id)
+}
+
+// EditAnnotations applies an edit to the annotations of a stored flow and
+// returns the result
+func EditAnnotations(dbFile string, id string, edit annotations.Edit) (annotations.Annotations, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return annotations.Annotations{}, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return annotations.Annotations{}, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	if err := checkFlowExists(db, id); err != nil {
+		return annotations.Annotations{}, err
+	}
+
+	var result annotations.Annotations
+	err = retry(5, func() (bool, error) {
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			a, err := loadAnnotations(tx, id)
+			if err != nil {
+				return err
+			}
+			edit.Apply(&a)
+			if err := a.Validate(); err != nil {
+				return err
+			}
+			if err := saveAnnotations(tx, id, a); err != nil {
+				return err
+			}
+			result = a
+
+			return tx.Commit()
+		}()
+		return err != nil && isBusyError(err), err
+	})
+	if err != nil {
+		return annotations.Annotations{}, fmt.Errorf("failed to annotate flow %s: %v", id, err)
+	}
+
+	return result, nil
+}
+
+func checkFlowExists(db querier, id string) error {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM requests WHERE request_id = ?", id).Scan(&n); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("flow %s not found", id)
+	}
+	return nil
+}
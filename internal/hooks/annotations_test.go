@@ -0,0 +1,125 @@
+package hooks
+
+import (
+	"database/sql"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+)
+
+func TestFlowAnnotations(t *testing.T) {
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	defer os.Remove(dbF.Name())
+	dbFile := dbF.Name()
+
+	// the annotations written by hooks are saved with the flow
+	annotated := newTestFlow("GET", "http://example.com/a", "", 200)
+	bag := &annotations.Bag{}
+	bag.Tag("login", "interesting")
+	bag.SetValue("plugin", "x")
+	annotated.Request = annotations.Set(annotated.Request, bag)
+
+	for _, f := range []*flow.Flow{annotated, newTestFlow("GET", "http://example.com/b", "", 200)} {
+		if _, err := SaveFlow(dbFile, f); err != nil {
+			t.Fatalf("SaveFlow() error = %v", err)
+		}
+	}
+
+	flows, err := LoadFlows(dbFile, FlowFilter{Tags: []string{"login"}})
+	if err != nil {
+		t.Fatalf("LoadFlows() error = %v", err)
+	}
+	if len(flows) != 1 || flows[0].ID != "1" {
+		t.Fatalf("LoadFlows() by tag = %d flows, want flow 1", len(flows))
+	}
+	want := annotations.Annotations{Tags: []string{"login", "interesting"}, Values: map[string]string{"plugin": "x"}}
+	if got := annotations.Get(flows[0].Request).Get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded annotations = %+v, want %+v", got, want)
+	}
+	if got := annotations.GetResponse(flows[0].Response).Get(); !reflect.DeepEqual(got, want) {
+		t.Errorf("loaded response annotations = %+v, want %+v", got, want)
+	}
+
+	color, comment := "red", "100% broken_auth"
+	a, err := EditAnnotations(dbFile, "2", annotations.Edit{
+		AddTags: []string{"idor"},
+		Color:   &color,
+		Comment: &comment,
+	})
+	if err != nil {
+		t.Fatalf("EditAnnotations() error = %v", err)
+	}
+	want = annotations.Annotations{Tags: []string{"idor"}, Color: "red", Comment: comment}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("EditAnnotations() = %+v, want %+v", a, want)
+	}
+
+	empty := ""
+	a, err = EditAnnotations(dbFile, "1", annotations.Edit{
+		RemoveTags:   []string{"interesting"},
+		DeleteValues: []string{"plugin"},
+		Comment:      &empty,
+	})
+	if err != nil {
+		t.Fatalf("EditAnnotations() error = %v", err)
+	}
+	if want := (annotations.Annotations{Tags: []string{"login"}}); !reflect.DeepEqual(a, want) {
+		t.Errorf("EditAnnotations() = %+v, want %+v", a, want)
+	}
+
+	invalid := "ultraviolet"
+	if _, err := EditAnnotations(dbFile, "1", annotations.Edit{Color: &invalid}); err == nil {
+		t.Errorf("EditAnnotations() with an invalid color did not fail")
+	}
+	if _, err := EditAnnotations(dbFile, "3", annotations.Edit{AddTags: []string{"x"}}); err == nil {
+		t.Errorf("EditAnnotations() of a missing flow did not fail")
+	}
+
+	tests := []struct {
+		name   string
+		filter FlowFilter
+		want   []string
+	}{
+		{"color", FlowFilter{Color: "red"}, []string{"2"}},
+		{"comment", FlowFilter{Comment: "% broken_"}, []string{"2"}},
+		{"comment wildcard", FlowFilter{Comment: "0_"}, nil},
+		{"tags", FlowFilter{Tags: []string{"login", "idor"}}, nil},
+		{"value", FlowFilter{Values: map[string]string{"plugin": "x"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flows, err := LoadFlows(dbFile, tt.filter)
+			if err != nil {
+				t.Fatalf("LoadFlows() error = %v", err)
+			}
+			var got []string
+			for _, f := range flows {
+				got = append(got, f.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LoadFlows() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// pruned flows lose their annotations
+	if _, err := PruneHistory(dbFile, RetentionPolicy{MaxRows: 1}); err != nil {
+		t.Fatalf("PruneHistory() error = %v", err)
+	}
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	defer db.Close()
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM flow_tags WHERE request_id = 1").Scan(&n); err != nil || n != 0 {
+		t.Errorf("tags of pruned flow = %d, %v, want 0", n, err)
+	}
+}
@@ -0,0 +1,254 @@
+package hooks
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// AttackRecord describes an attack run by the intruder
+type AttackRecord struct {
+	ID            string
+	BaseRequestID string
+	Mode          string
+	Template      []byte
+	Started       time.Time
+}
+
+// AttackResult is the outcome of one request of an attack
+type AttackResult struct {
+	AttackID string
+	Index    int
+	Payloads []string
+
+	// RequestID is the ID of the flow stored for the request, if any
+	RequestID string
+
+	StatusCode int
+	Length     int
+	Duration   time.Duration
+	Error      string
+}
+
+// AttackResultFilter selects the results of an attack. Zero values disable
+// the corresponding criterion.
+type AttackResultFilter struct {
+	StatusCode int
+	MinLength  int
+	MaxLength  int
+
+	// OrderBy is one of "index", "status", "length" or "duration"
+	OrderBy    string
+	Descending bool
+}
+
+func initAttackTables(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS attacks (
+            attack_id INTEGER PRIMARY KEY AUTOINCREMENT,
+            base_request_id INTEGER,
+            mode TEXT NOT NULL,
+            template BLOB NOT NULL,
+            started DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE TABLE IF NOT EXISTS attack_results (
+            attack_id INTEGER NOT NULL,
+            idx INTEGER NOT NULL,
+            payloads TEXT NOT NULL,
+            request_id INTEGER,
+            status_code INTEGER,
+            length INTEGER,
+            duration_ms INTEGER,
+            error TEXT,
+            FOREIGN KEY (attack_id) REFERENCES attacks(attack_id)
+        );
+        CREATE INDEX IF NOT EXISTS idx_attack_results_attack_id ON attack_results(attack_id);
+    `)
+	return err
+}
+
+// SaveAttack stores a new attack and returns its ID
+func SaveAttack(dbFile string, attack AttackRecord) (string, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return "", fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	var baseRequestID any
+	if attack.BaseRequestID != "" {
+		baseRequestID = attack.BaseRequestID
+	}
+
+	var id int64
+	err = retry(5, func() (bool, error) {
+		result, err := db.Exec(
+			"INSERT INTO attacks (base_request_id, mode, template) VALUES (?, ?, ?)",
+			baseRequestID, attack.Mode, attack.Template,
+		)
+		if err != nil {
+			return isBusyError(err), err
+		}
+		id, err = result.LastInsertId()
+		return false, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save attack: %v", err)
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// SaveAttackResult stores the result of one request of an attack
+func SaveAttackResult(dbFile string, result AttackResult) error {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	payloads, err := json.Marshal(result.Payloads)
+	if err != nil {
+		return err
+	}
+
+	var requestID any
+	if result.RequestID != "" {
+		requestID = result.RequestID
+	}
+
+	err = retry(5, func() (bool, error) {
+		_, err := db.Exec(`
+			INSERT INTO attack_results (attack_id, idx, payloads, request_id, status_code, length, duration_ms, error)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, result.AttackID, result.Index, string(payloads), requestID,
+			result.StatusCode, result.Length, result.Duration.Milliseconds(), result.Error)
+		return err != nil && isBusyError(err), err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save attack result: %v", err)
+	}
+
+	return nil
+}
+
+// LoadAttacks returns the attacks stored in the database
+func LoadAttacks(dbFile string) ([]AttackRecord, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	rows, err := db.Query("SELECT attack_id, base_request_id, mode, template, started FROM attacks ORDER BY attack_id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attacks := []AttackRecord{}
+	for rows.Next() {
+		var id uint64
+		var baseRequestID sql.NullInt64
+		a := AttackRecord{}
+		if err := rows.Scan(&id, &baseRequestID, &a.Mode, &a.Template, &a.Started); err != nil {
+			return nil, err
+		}
+		a.ID = strconv.FormatUint(id, 10)
+		if baseRequestID.Valid {
+			a.BaseRequestID = strconv.FormatInt(baseRequestID.Int64, 10)
+		}
+		attacks = append(attacks, a)
+	}
+
+	return attacks, rows.Err()
+}
+
+// LoadAttackResults returns the results of an attack that match the filter
+func LoadAttackResults(dbFile string, attackID string, filter AttackResultFilter) ([]AttackResult, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	query := `
+		SELECT idx, payloads, request_id, status_code, length, duration_ms, error
+		FROM attack_results
+		WHERE attack_id = ?`
+	args := []any{attackID}
+
+	if filter.StatusCode != 0 {
+		query += " AND status_code = ?"
+		args = append(args, filter.StatusCode)
+	}
+	if filter.MinLength != 0 {
+		query += " AND length >= ?"
+		args = append(args, filter.MinLength)
+	}
+	if filter.MaxLength != 0 {
+		query += " AND length <= ?"
+		args = append(args, filter.MaxLength)
+	}
+
+	orderColumns := map[string]string{
+		"":         "idx",
+		"index":    "idx",
+		"status":   "status_code",
+		"length":   "length",
+		"duration": "duration_ms",
+	}
+	column, ok := orderColumns[filter.OrderBy]
+	if !ok {
+		return nil, fmt.Errorf("invalid order '%s': expected index, status, length or duration", filter.OrderBy)
+	}
+	query += " ORDER BY " + column
+	if filter.Descending {
+		query += " DESC"
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []AttackResult{}
+	for rows.Next() {
+		var (
+			payloads   string
+			requestID  sql.NullInt64
+			durationMS int64
+			errorMsg   sql.NullString
+		)
+		r := AttackResult{AttackID: attackID}
+		if err := rows.Scan(&r.Index, &payloads, &requestID, &r.StatusCode, &r.Length, &durationMS, &errorMsg); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(payloads), &r.Payloads); err != nil {
+			return nil, fmt.Errorf("invalid payloads stored for result %d: %v", r.Index, err)
+		}
+		if requestID.Valid {
+			r.RequestID = strconv.FormatInt(requestID.Int64, 10)
+		}
+		r.Duration = time.Duration(durationMS) * time.Millisecond
+		r.Error = errorMsg.String
+		results = append(results, r)
+	}
+
+	return results, rows.Err()
+}
@@ -7,18 +7,32 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/metrics"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
 	"modernc.org/sqlite" // Use the main package for error handling
 )
 
-// InitDatabase sets up the SQLite tables for requests, responses, headers, and cookies
+// InitDatabase sets up the SQLite tables for requests, responses, headers,
+// cookies, links between flows and annotations. It is retried if the
+// database is busy.
 func InitDatabase(db *sql.DB) error {
+	return retry(5, func() (bool, error) {
+		err := initDatabase(db)
+		return err != nil && isBusyError(err), err
+	})
+}
+
+func initDatabase(db *sql.DB) error {
 	_, err := db.Exec(`
         CREATE TABLE IF NOT EXISTS requests (
             request_id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -51,6 +65,13 @@ func InitDatabase(db *sql.DB) error {
             FOREIGN KEY (request_id) REFERENCES requests(request_id),
             FOREIGN KEY (response_id) REFERENCES responses(response_id)
         );
+        CREATE TABLE IF NOT EXISTS flow_links (
+            request_id INTEGER NOT NULL,
+            original_request_id INTEGER NOT NULL,
+            kind TEXT NOT NULL,
+            FOREIGN KEY (request_id) REFERENCES requests(request_id),
+            FOREIGN KEY (original_request_id) REFERENCES requests(request_id)
+        );
         CREATE INDEX IF NOT EXISTS idx_requests_url ON requests (url);
         CREATE INDEX IF NOT EXISTS idx_responses_status_code ON responses (status_code);
         CREATE INDEX IF NOT EXISTS idx_headers_name ON headers (name);
@@ -62,10 +83,179 @@ func InitDatabase(db *sql.DB) error {
         CREATE INDEX IF NOT EXISTS idx_cookies_response_id ON cookies(response_id);
         CREATE INDEX IF NOT EXISTS idx_headers_request_id ON headers(request_id);
         CREATE INDEX IF NOT EXISTS idx_headers_response_id ON headers(response_id);
+        CREATE INDEX IF NOT EXISTS idx_flow_links_request_id ON flow_links(request_id);
+        CREATE INDEX IF NOT EXISTS idx_flow_links_original_request_id ON flow_links(original_request_id);
     `)
+	if err != nil {
+		return err
+	}
+
+	if err := initAttackTables(db); err != nil {
+		return err
+	}
+	if err := initFindingsTable(db); err != nil {
+		return err
+	}
+	if err := initAnnotationTables(db); err != nil {
+		return err
+	}
+
+	// Columns added after the first release are added to existing databases
+	if err := addColumnIfMissing(db, "requests", "raw_request", "BLOB"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "responses", "raw_response", "BLOB"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "requests", "request_line", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "requests", "proto", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "responses", "status_line", "TEXT"); err != nil {
+		return err
+	}
+	if err := addColumnIfMissing(db, "responses", "proto", "TEXT"); err != nil {
+		return err
+	}
+	for _, c := range flowMetaColumns {
+		if err := addColumnIfMissing(db, c.table, c.name, c.columnType); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flowMetaColumns are the columns of the timings, in milliseconds, and the
+// connection details of flows
+var flowMetaColumns = []struct {
+	table, name, columnType string
+}{
+	{"requests", "client_addr", "TEXT"},
+	{"responses", "dns_ms", "REAL"},
+	{"responses", "connect_ms", "REAL"},
+	{"responses", "tls_handshake_ms", "REAL"},
+	{"responses", "ttfb_ms", "REAL"},
+	{"responses", "total_ms", "REAL"},
+	{"responses", "upstream_ip", "TEXT"},
+	{"responses", "tls_version", "TEXT"},
+	{"responses", "tls_cipher", "TEXT"},
+	{"responses", "alpn", "TEXT"},
+}
+
+// addColumnIfMissing adds a column to a table created by a previous version
+func addColumnIfMissing(db *sql.DB, table, column, columnType string) error {
+	rows, err := db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid          int
+			name, ctype  string
+			notNull, pk  int
+			defaultValue sql.NullString
+		)
+		if err := rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, columnType))
+	if err != nil && strings.Contains(err.Error(), "duplicate column") {
+		// added concurrently by another connection
+		return nil
+	}
 	return err
 }
 
+// openReadOnly opens a database that is only read, e.g. by the history
+// commands. It is not migrated, so the readers check its schema with
+// readSchema to support databases of previous versions.
+func openReadOnly(dbFile string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", dbFile+"?_pragma=query_only(1)")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	return db, nil
+}
+
+// schema holds the columns of each table of a database
+type schema map[string]map[string]bool
+
+func readSchema(db *sql.DB) (schema, error) {
+	tables, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table'")
+	if err != nil {
+		return nil, err
+	}
+	defer tables.Close()
+
+	s := schema{}
+	for tables.Next() {
+		var name string
+		if err := tables.Scan(&name); err != nil {
+			return nil, err
+		}
+		s[name] = map[string]bool{}
+	}
+	if err := tables.Err(); err != nil {
+		return nil, err
+	}
+	tables.Close()
+
+	for table, columns := range s {
+		rows, err := db.Query(fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			columns[name] = true
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s schema) hasTable(table string) bool {
+	_, ok := s[table]
+	return ok
+}
+
+// columns returns the columns of a table prefixed by alias and separated by
+// commas, with NULL in place of the ones the table does not have
+func (s schema) columns(table, alias string, names ...string) string {
+	selected := make([]string, 0, len(names))
+	for _, name := range names {
+		if s[table][name] {
+			selected = append(selected, alias+"."+name)
+		} else {
+			selected = append(selected, "NULL")
+		}
+	}
+	return strings.Join(selected, ", ")
+}
+
 // dbQueueItem represents an item in the database queue
 type dbQueueItem struct {
 	isRequest bool
@@ -73,6 +263,19 @@ type dbQueueItem struct {
 	resp      *http.Response
 }
 
+var (
+	dbQueueDepth = metrics.NewGaugeVec(
+		"efin_proxy_db_queue_depth",
+		"Requests and responses waiting in the queue of the database.",
+	)
+
+	dbQueueDropped = metrics.NewCounterVec(
+		"efin_proxy_db_queue_dropped_total",
+		"Requests and responses not saved in the database because its queue was full.",
+		"item",
+	)
+)
+
 // NewDBSaveHooks returns request and response hooks that send data to a queue for asynchronous processing
 func NewDBSaveHooks(dbFile string) (pipeline.ReadOnlyHook[*http.Request], pipeline.ReadOnlyHook[*http.Response]) {
 	db, err := sql.Open("sqlite", dbFile)
@@ -92,6 +295,7 @@ func NewDBSaveHooks(dbFile string) (pipeline.ReadOnlyHook[*http.Request], pipeli
 	// Start a goroutine to process the queue
 	go func() {
 		for item := range queue {
+			dbQueueDepth.Add(-1)
 			if item.isRequest {
 				err := saveRequestToDB(dbFile, item.req)
 				if err != nil {
@@ -115,11 +319,15 @@ func NewDBSaveHooks(dbFile string) (pipeline.ReadOnlyHook[*http.Request], pipeli
 			return fmt.Errorf("no request ID found")
 		}
 
-		// Send to queue (non-blocking unless queue is full)
+		// Send to queue (non-blocking unless queue is full). The depth is
+		// increased first so that it is never negative.
+		dbQueueDepth.Add(1)
 		select {
 		case queue <- dbQueueItem{isRequest: true, req: req}:
 			return nil
 		default:
+			dbQueueDepth.Add(-1)
+			dbQueueDropped.Inc("request")
 			log.Printf("Queue full, dropping request with ID %s", id)
 			return nil // Drop the request if queue is full to avoid blocking
 		}
@@ -132,11 +340,15 @@ func NewDBSaveHooks(dbFile string) (pipeline.ReadOnlyHook[*http.Request], pipeli
 			return fmt.Errorf("no response ID found")
 		}
 
-		// Send to queue (non-blocking unless queue is full)
+		// Send to queue (non-blocking unless queue is full). The depth is
+		// increased first so that it is never negative.
+		dbQueueDepth.Add(1)
 		select {
 		case queue <- dbQueueItem{isRequest: false, resp: resp}:
 			return nil
 		default:
+			dbQueueDepth.Add(-1)
+			dbQueueDropped.Inc("response")
 			log.Printf("Queue full, dropping response with ID %s", id)
 			return nil // Drop the response if queue is full to avoid blocking
 		}
@@ -164,6 +376,14 @@ func saveRequestToDB(dbFile string, req *http.Request) error {
 		req.Body = io.NopCloser(bytes.NewBuffer(body)) // Restore body
 	}
 
+	clientAddr := ""
+	if m := flowmeta.Get(req); m != nil {
+		clientAddr = m.ClientAddr
+	}
+
+	// flows without a bag, as the imported ones, keep their stored annotations
+	bag := annotations.Get(req)
+
 	const maxRetries = 5
 
 	err = retry(maxRetries, func() (bool, error) {
@@ -184,32 +404,19 @@ func saveRequestToDB(dbFile string, req *http.Request) error {
 
 			// Insert request
 			_, err = tx.Exec(`
-				INSERT INTO requests (request_id, method, url, body)
-				VALUES (?, ?, ?, ?)
-			`, id, req.Method, req.URL.String(), string(body))
+				INSERT INTO requests (request_id, method, url, body, request_line, proto, client_addr)
+				VALUES (?, ?, ?, ?, ?, ?, ?)
+			`, id, req.Method, req.URL.String(), string(body), httpbytes.RequestLine(req), req.Proto, clientAddr)
 			if err != nil {
 				return err
 			}
 
-			// Insert headers, including Host if present
-			for name, values := range req.Header {
-				for _, value := range values {
-					_, err = tx.Exec(`
-                        INSERT INTO headers (request_id, response_id, name, value)
-                        VALUES (?, NULL, ?, ?)
-                    `, id, name, value)
-					if err != nil {
-						return err
-					}
-				}
-			}
-
-			// Explicitly save the Host header if it’s set and not already in Header map
-			if req.Host != "" && req.Header.Get("Host") == "" {
+			// Insert headers, including Host, in the order they were received
+			for _, h := range httpbytes.RequestHeaders(req) {
 				_, err = tx.Exec(`
                     INSERT INTO headers (request_id, response_id, name, value)
                     VALUES (?, NULL, ?, ?)
-                `, id, "Host", req.Host)
+                `, id, h.Name, h.Value)
 				if err != nil {
 					return err
 				}
@@ -228,6 +435,12 @@ func saveRequestToDB(dbFile string, req *http.Request) error {
 				}
 			}
 
+			if bag != nil {
+				if err := saveAnnotations(tx, id, bag.Get()); err != nil {
+					return err
+				}
+			}
+
 			if err := tx.Commit(); err != nil {
 				log.Printf("commit error: %v", err)
 				return err
@@ -275,6 +488,15 @@ func saveResponseToDB(dbFile string, resp *http.Response) error {
 		resp.Body = io.NopCloser(bytes.NewBuffer(body)) // Restore body
 	}
 
+	meta := flowmeta.GetResponse(resp)
+	if meta == nil {
+		meta = &flowmeta.Meta{}
+	}
+
+	// the annotations are saved again, with the ones written by the
+	// response hooks
+	bag := annotations.GetResponse(resp)
+
 	const maxRetries = 5
 	err = retry(maxRetries, func() (bool, error) {
 		db, err := sql.Open("sqlite", dbFile)
@@ -299,23 +521,25 @@ func saveResponseToDB(dbFile string, resp *http.Response) error {
 
 			// Insert response
 			_, err = tx.Exec(`
-				INSERT INTO responses (response_id, status_code, body, content_length)
-				VALUES (?, ?, ?, ?)
-			`, id, resp.StatusCode, string(body), contentLength)
+				INSERT INTO responses (response_id, status_code, body, content_length, status_line, proto,
+					dns_ms, connect_ms, tls_handshake_ms, ttfb_ms, total_ms, upstream_ip, tls_version, tls_cipher, alpn)
+				VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+			`, id, resp.StatusCode, string(body), contentLength, httpbytes.StatusLine(resp), resp.Proto,
+				flowmeta.Milliseconds(meta.DNS), flowmeta.Milliseconds(meta.Connect), flowmeta.Milliseconds(meta.TLSHandshake),
+				flowmeta.Milliseconds(meta.TimeToFirstByte), flowmeta.Milliseconds(meta.Total),
+				meta.UpstreamIP, meta.TLSVersion, meta.TLSCipher, meta.ALPN)
 			if err != nil {
 				return err
 			}
 
-			// Insert headers
-			for name, values := range resp.Header {
-				for _, value := range values {
-					_, err = tx.Exec(`
-							INSERT INTO headers (request_id, response_id, name, value)
-							VALUES (NULL, ?, ?, ?)
-						`, id, name, value)
-					if err != nil {
-						return err
-					}
+			// Insert headers in the order they were received
+			for _, h := range httpbytes.ResponseHeaders(resp) {
+				_, err = tx.Exec(`
+						INSERT INTO headers (request_id, response_id, name, value)
+						VALUES (NULL, ?, ?, ?)
+					`, id, h.Name, h.Value)
+				if err != nil {
+					return err
 				}
 			}
 
@@ -340,6 +564,12 @@ func saveResponseToDB(dbFile string, resp *http.Response) error {
 				}
 			}
 
+			if bag != nil {
+				if err := saveAnnotations(tx, id, bag.Get()); err != nil {
+					return err
+				}
+			}
+
 			if err := tx.Commit(); err != nil {
 				log.Printf("commit error: %v", err)
 				return err
@@ -420,6 +650,38 @@ func NewDBIDProvider(dbFile string) (*DBIDProvider, error) {
 	return &prov, nil
 }
 
+// sharedIDProviders are the ID providers of the databases flows are saved
+// to, by absolute path
+var sharedIDProviders = struct {
+	sync.Mutex
+	providers map[string]*DBIDProvider
+}{providers: map[string]*DBIDProvider{}}
+
+// SharedDBIDProvider returns the ID provider of the database, shared by the
+// proxy and everything else saving flows to it in this process, so that
+// they are never assigned the same ID
+func SharedDBIDProvider(dbFile string) (*DBIDProvider, error) {
+	path, err := filepath.Abs(dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid database path '%s': %v", dbFile, err)
+	}
+
+	sharedIDProviders.Lock()
+	defer sharedIDProviders.Unlock()
+
+	if prov, ok := sharedIDProviders.providers[path]; ok {
+		return prov, nil
+	}
+
+	prov, err := NewDBIDProvider(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	sharedIDProviders.providers[path] = prov
+
+	return prov, nil
+}
+
 func (dip *DBIDProvider) NextID() string {
 	dip.lastUsedIDMutex.Lock()
 	dip.lastUsedID++
@@ -0,0 +1,528 @@
+package hooks
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// Placeholders supported in FileSaveOptions.Layout
+const (
+	LayoutSession = "{session}"
+	LayoutHost    = "{host}"
+	LayoutDate    = "{date}"
+	LayoutID      = "{id}"
+)
+
+// sessionNameFormat is the time layout used to name session directories
+const sessionNameFormat = "session-20060102-150405"
+
+// retentionCheckInterval is the number of saved responses between retention
+// checks
+const retentionCheckInterval = 100
+
+var sessionNameRe = regexp.MustCompile(`^session-\d{8}-\d{6}$`)
+
+// FileSaveOptions configures how the file save hooks store flows
+type FileSaveOptions struct {
+	// Dir is the base directory where files are saved
+	Dir string
+
+	// Layout is a slash separated path template relative to Dir built from
+	// the {session}, {host}, {date} and {id} placeholders, for example
+	// "{session}/{host}/{id}". Each flow is saved in its own directory with
+	// request.txt and response.txt files. If empty, the flat layout is used:
+	// request-<id>.txt and response-<id>.txt directly in Dir.
+	Layout string
+
+	// BodyFiles saves bodies to separate files with an extension derived from
+	// their Content-Type. The .txt files then only contain the headers.
+	BodyFiles bool
+
+	// Metadata saves a JSON sidecar file with information about the flow
+	Metadata bool
+
+	// MaxTotalSize is the maximum size in bytes of Dir. When exceeded, the
+	// oldest sessions are deleted. It requires a layout starting with
+	// {session}. 0 disables the limit.
+	MaxTotalSize int64
+
+	// GzipOldSessions compresses the directories of previous sessions into
+	// .tar.gz files. It requires a layout starting with {session}.
+	GzipOldSessions bool
+}
+
+// FileMetadata is the content of the metadata sidecar file of a flow
+type FileMetadata struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+
+	Method string `json:"method,omitempty"`
+	URL    string `json:"url,omitempty"`
+	Host   string `json:"host,omitempty"`
+
+	RequestContentType string `json:"request_content_type,omitempty"`
+	RequestBodySize    int    `json:"request_body_size"`
+	RequestBodyFile    string `json:"request_body_file,omitempty"`
+
+	StatusCode          int    `json:"status_code,omitempty"`
+	ResponseContentType string `json:"response_content_type,omitempty"`
+	ResponseBodySize    int    `json:"response_body_size"`
+	ResponseBodyFile    string `json:"response_body_file,omitempty"`
+}
+
+// fileSaver holds the state shared by the request and response file save hooks
+type fileSaver struct {
+	opts    FileSaveOptions
+	session string
+
+	metaMutex sync.Mutex
+
+	savedMutex sync.Mutex
+	saved      int
+}
+
+// NewFileSaveHooksWithOptions returns request and response hooks that save
+// flows to files according to the given options
+func NewFileSaveHooksWithOptions(opts FileSaveOptions) (pipeline.ReadOnlyHook[*http.Request], pipeline.ReadOnlyHook[*http.Response], error) {
+	if opts.Dir == "" {
+		opts.Dir = "." // Default to current directory
+	}
+
+	sessionBased := strings.HasPrefix(opts.Layout, LayoutSession)
+	if (opts.MaxTotalSize > 0 || opts.GzipOldSessions) && !sessionBased {
+		return nil, nil, fmt.Errorf("retention and session compression require a layout starting with %s", LayoutSession)
+	}
+
+	saver := &fileSaver{
+		opts:    opts,
+		session: time.Now().Format(sessionNameFormat),
+	}
+
+	if opts.GzipOldSessions {
+		if err := saver.gzipOldSessions(); err != nil {
+			return nil, nil, err
+		}
+	}
+	if opts.MaxTotalSize > 0 {
+		if err := saver.enforceRetention(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return saver.saveRequest, saver.saveResponse, nil
+}
+
+func (saver *fileSaver) saveRequest(req *http.Request) error {
+	id := ids.GetRequestID(req)
+	if id == "" {
+		id = "unknown"
+	}
+
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	body, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	dir, err := saver.flowDir(id, host)
+	if err != nil {
+		return err
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	bodyFile, err := saver.writeFlowFile(dir, id, "request", RawRequestHead(req), body, contentType)
+	if err != nil {
+		return err
+	}
+
+	if !saver.opts.Metadata {
+		return nil
+	}
+
+	return saver.updateMetadata(dir, id, func(m *FileMetadata) {
+		m.Method = req.Method
+		m.URL = req.URL.String()
+		m.Host = host
+		m.RequestContentType = contentType
+		m.RequestBodySize = len(body)
+		m.RequestBodyFile = bodyFile
+	})
+}
+
+func (saver *fileSaver) saveResponse(resp *http.Response) error {
+	id := ids.GetResponseID(resp)
+	if id == "" {
+		id = "unknown"
+	}
+
+	host := ""
+	if resp.Request != nil {
+		host = resp.Request.Host
+		if host == "" {
+			host = resp.Request.URL.Host
+		}
+	}
+
+	body, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	dir, err := saver.flowDir(id, host)
+	if err != nil {
+		return err
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	bodyFile, err := saver.writeFlowFile(dir, id, "response", RawResponseHead(resp), body, contentType)
+	if err != nil {
+		return err
+	}
+
+	if saver.opts.Metadata {
+		err := saver.updateMetadata(dir, id, func(m *FileMetadata) {
+			m.StatusCode = resp.StatusCode
+			m.ResponseContentType = contentType
+			m.ResponseBodySize = len(body)
+			m.ResponseBodyFile = bodyFile
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if saver.opts.MaxTotalSize > 0 {
+		saver.savedMutex.Lock()
+		saver.saved++
+		check := saver.saved%retentionCheckInterval == 0
+		saver.savedMutex.Unlock()
+
+		if check {
+			return saver.enforceRetention()
+		}
+	}
+
+	return nil
+}
+
+// flowDir returns the directory where the files of a flow are saved, creating
+// it if needed
+func (saver *fileSaver) flowDir(id, host string) (string, error) {
+	if saver.opts.Layout == "" {
+		return saver.opts.Dir, nil
+	}
+
+	replacer := strings.NewReplacer(
+		LayoutSession, saver.session,
+		LayoutHost, sanitizePathElement(host),
+		LayoutDate, time.Now().Format("2006-01-02"),
+		LayoutID, sanitizePathElement(id),
+	)
+	dir := filepath.Join(saver.opts.Dir, filepath.FromSlash(replacer.Replace(saver.opts.Layout)))
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", err
+	}
+
+	return dir, nil
+}
+
+// fileName returns the name of a flow file. In the flat layout the ID is part
+// of the name, otherwise each flow has its own directory.
+func (saver *fileSaver) fileName(id, name string) string {
+	if saver.opts.Layout == "" {
+		base, ext, _ := strings.Cut(name, ".")
+		return fmt.Sprintf("%s-%s.%s", base, sanitizePathElement(id), ext)
+	}
+	return name
+}
+
+// writeFlowFile saves the head and body of a request or response. It returns
+// the name of the body file if bodies are saved separately.
+func (saver *fileSaver) writeFlowFile(dir, id, kind string, head, body []byte, contentType string) (string, error) {
+	if !saver.opts.BodyFiles {
+		filename := filepath.Join(dir, saver.fileName(id, kind+".txt"))
+		return "", os.WriteFile(filename, append(head, body...), 0644)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, saver.fileName(id, kind+".txt")), head, 0644); err != nil {
+		return "", err
+	}
+
+	if len(body) == 0 {
+		return "", nil
+	}
+
+	bodyFile := saver.fileName(id, kind+".body"+bodyExtension(contentType, body))
+	if err := os.WriteFile(filepath.Join(dir, bodyFile), body, 0644); err != nil {
+		return "", err
+	}
+
+	return bodyFile, nil
+}
+
+// updateMetadata applies update to the metadata sidecar file of a flow
+func (saver *fileSaver) updateMetadata(dir, id string, update func(*FileMetadata)) error {
+	saver.metaMutex.Lock()
+	defer saver.metaMutex.Unlock()
+
+	filename := filepath.Join(dir, saver.fileName(id, "meta.json"))
+
+	meta := FileMetadata{ID: id, Timestamp: time.Now().UTC()}
+	if data, err := os.ReadFile(filename); err == nil {
+		if err := json.Unmarshal(data, &meta); err != nil {
+			return fmt.Errorf("invalid metadata file %s: %v", filename, err)
+		}
+	}
+
+	update(&meta)
+
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, data, 0644)
+}
+
+// oldSessions returns the entries of Dir that belong to previous sessions,
+// oldest first
+func (saver *fileSaver) oldSessions() ([]os.DirEntry, error) {
+	entries, err := os.ReadDir(saver.opts.Dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	sessions := []os.DirEntry{}
+	for _, e := range entries {
+		name := strings.TrimSuffix(e.Name(), ".tar.gz")
+		if name == saver.session || !sessionNameRe.MatchString(name) {
+			continue
+		}
+		sessions = append(sessions, e)
+	}
+
+	// session names sort chronologically
+	sort.Slice(sessions, func(i, j int) bool { return sessions[i].Name() < sessions[j].Name() })
+
+	return sessions, nil
+}
+
+// gzipOldSessions compresses each previous session directory into a .tar.gz
+// file and removes the directory
+func (saver *fileSaver) gzipOldSessions() error {
+	sessions, err := saver.oldSessions()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if !s.IsDir() {
+			continue
+		}
+
+		dir := filepath.Join(saver.opts.Dir, s.Name())
+		if err := tarGzDir(dir, dir+".tar.gz"); err != nil {
+			return fmt.Errorf("failed to compress session %s: %v", s.Name(), err)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+		log.Printf("Compressed session directory %s", dir)
+	}
+
+	return nil
+}
+
+// enforceRetention deletes the oldest sessions until the size of Dir is below
+// MaxTotalSize. The current session is never deleted.
+func (saver *fileSaver) enforceRetention() error {
+	total, err := dirSize(saver.opts.Dir)
+	if err != nil {
+		return err
+	}
+	if total <= saver.opts.MaxTotalSize {
+		return nil
+	}
+
+	sessions, err := saver.oldSessions()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range sessions {
+		if total <= saver.opts.MaxTotalSize {
+			break
+		}
+
+		path := filepath.Join(saver.opts.Dir, s.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		total -= size
+		log.Printf("Removed session %s to keep %s below %d bytes", s.Name(), saver.opts.Dir, saver.opts.MaxTotalSize)
+	}
+
+	return nil
+}
+
+// bodyExtension returns the file extension for a body with the given
+// Content-Type
+func bodyExtension(contentType string, body []byte) string {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err == nil {
+		if ext, ok := preferredExtensions[mediaType]; ok {
+			return ext
+		}
+		if exts, err := mime.ExtensionsByType(mediaType); err == nil && len(exts) > 0 {
+			return exts[0]
+		}
+		if strings.HasSuffix(mediaType, "+json") {
+			return ".json"
+		}
+		if strings.HasSuffix(mediaType, "+xml") {
+			return ".xml"
+		}
+	}
+
+	if utf8.Valid(body) {
+		return ".txt"
+	}
+	return ".bin"
+}
+
+// preferredExtensions overrides mime.ExtensionsByType for common types that
+// have several extensions registered
+var preferredExtensions = map[string]string{
+	"application/javascript":            ".js",
+	"application/json":                  ".json",
+	"application/octet-stream":          ".bin",
+	"application/x-www-form-urlencoded": ".txt",
+	"application/xml":                   ".xml",
+	"image/jpeg":                        ".jpg",
+	"multipart/form-data":               ".txt",
+	"text/css":                          ".css",
+	"text/html":                         ".html",
+	"text/javascript":                   ".js",
+	"text/plain":                        ".txt",
+	"text/xml":                          ".xml",
+}
+
+// sanitizePathElement makes s safe to be used as a single path element
+func sanitizePathElement(s string) string {
+	if s == "" {
+		return "unknown"
+	}
+	s = strings.NewReplacer("/", "_", "\\", "_", ":", "_", "..", "_").Replace(s)
+	return s
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	return size, err
+}
+
+// tarGzDir writes the contents of dir to a gzip compressed tar file
+func tarGzDir(dir, dest string) error {
+	f, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gw := gzip.NewWriter(f)
+	tw := tar.NewWriter(gw)
+
+	base := filepath.Dir(dir)
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		hdr, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(base, path)
+		if err != nil {
+			return err
+		}
+		hdr.Name = filepath.ToSlash(rel)
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+
+		_, err = io.Copy(tw, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gw.Close()
+}
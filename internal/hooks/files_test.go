@@ -0,0 +1,168 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+func TestFileSaveHooksWithLayout(t *testing.T) {
+	dir, err := os.MkdirTemp("", "efin-proxy-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	saveRequest, saveResponse, err := NewFileSaveHooksWithOptions(FileSaveOptions{
+		Dir:       dir,
+		Layout:    "{host}/{id}",
+		BodyFiles: true,
+		Metadata:  true,
+	})
+	if err != nil {
+		t.Fatalf("NewFileSaveHooksWithOptions() error = %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "https://test.host.com/api", strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req = ids.SetRequestID(req, "42")
+	if err := saveRequest(req); err != nil {
+		t.Fatalf("saveRequest() error = %v", err)
+	}
+
+	pngBody := []byte{0x89, 'P', 'N', 'G', 0x00, 0xff}
+	resp := &http.Response{
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": []string{"image/png"}},
+		Body:       io.NopCloser(bytes.NewReader(pngBody)),
+		Request:    req,
+	}
+	if err := saveResponse(resp); err != nil {
+		t.Fatalf("saveResponse() error = %v", err)
+	}
+
+	flowDir := filepath.Join(dir, "test.host.com", "42")
+
+	head, err := os.ReadFile(filepath.Join(flowDir, "request.txt"))
+	if err != nil {
+		t.Fatalf("Failed to read request head: %v", err)
+	}
+	if !strings.HasPrefix(string(head), "POST /api HTTP/1.1\r\n") || !strings.HasSuffix(string(head), "\r\n\r\n") {
+		t.Errorf("unexpected request head %q", head)
+	}
+
+	reqBody, err := os.ReadFile(filepath.Join(flowDir, "request.body.json"))
+	if err != nil || string(reqBody) != `{"a":1}` {
+		t.Errorf("unexpected request body file: %q, %v", reqBody, err)
+	}
+
+	respBody, err := os.ReadFile(filepath.Join(flowDir, "response.body.png"))
+	if err != nil || !bytes.Equal(respBody, pngBody) {
+		t.Errorf("unexpected response body file: %v, %v", respBody, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(flowDir, "meta.json"))
+	if err != nil {
+		t.Fatalf("Failed to read metadata: %v", err)
+	}
+	var meta FileMetadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatalf("invalid metadata: %v", err)
+	}
+	if meta.ID != "42" || meta.Method != "POST" || meta.StatusCode != 200 ||
+		meta.RequestBodyFile != "request.body.json" || meta.ResponseBodyFile != "response.body.png" ||
+		meta.ResponseBodySize != len(pngBody) {
+		t.Errorf("unexpected metadata: %+v", meta)
+	}
+}
+
+func TestFileSaveHooksSessions(t *testing.T) {
+	dir, err := os.MkdirTemp("", "efin-proxy-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, _, err := NewFileSaveHooksWithOptions(FileSaveOptions{Dir: dir, GzipOldSessions: true}); err == nil {
+		t.Errorf("expected error for session options without a session layout")
+	}
+
+	for _, session := range []string{"session-20240101-100000", "session-20240102-100000"} {
+		sessionDir := filepath.Join(dir, session, "1")
+		if err := os.MkdirAll(sessionDir, 0755); err != nil {
+			t.Fatalf("Failed to create session dir: %v", err)
+		}
+		content := bytes.Repeat([]byte("x"), 1000)
+		if err := os.WriteFile(filepath.Join(sessionDir, "request.txt"), content, 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	_, _, err = NewFileSaveHooksWithOptions(FileSaveOptions{
+		Dir:             dir,
+		Layout:          "{session}/{id}",
+		GzipOldSessions: true,
+	})
+	if err != nil {
+		t.Fatalf("NewFileSaveHooksWithOptions() error = %v", err)
+	}
+
+	for _, session := range []string{"session-20240101-100000", "session-20240102-100000"} {
+		if _, err := os.Stat(filepath.Join(dir, session+".tar.gz")); err != nil {
+			t.Errorf("expected compressed session %s: %v", session, err)
+		}
+		if _, err := os.Stat(filepath.Join(dir, session)); !os.IsNotExist(err) {
+			t.Errorf("expected session directory %s to be removed", session)
+		}
+	}
+
+	newest, err := os.Stat(filepath.Join(dir, "session-20240102-100000.tar.gz"))
+	if err != nil {
+		t.Fatalf("Failed to stat session: %v", err)
+	}
+
+	_, _, err = NewFileSaveHooksWithOptions(FileSaveOptions{
+		Dir:          dir,
+		Layout:       "{session}/{id}",
+		MaxTotalSize: newest.Size(),
+	})
+	if err != nil {
+		t.Fatalf("NewFileSaveHooksWithOptions() error = %v", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "session-20240101-100000.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("expected oldest session to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "session-20240102-100000.tar.gz")); err != nil {
+		t.Errorf("expected newest session to be kept: %v", err)
+	}
+}
+
+func TestBodyExtension(t *testing.T) {
+	tests := []struct {
+		contentType string
+		body        []byte
+		want        string
+	}{
+		{"application/json; charset=utf-8", nil, ".json"},
+		{"text/html", nil, ".html"},
+		{"application/vnd.api+json", nil, ".json"},
+		{"", []byte("plain text"), ".txt"},
+		{"", []byte{0xff, 0x00}, ".bin"},
+	}
+
+	for _, tt := range tests {
+		if got := bodyExtension(tt.contentType, tt.body); got != tt.want {
+			t.Errorf("bodyExtension(%q) = %q, want %q", tt.contentType, got, tt.want)
+		}
+	}
+}
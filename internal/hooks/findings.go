@@ -0,0 +1,213 @@
+package hooks
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+)
+
+// FindingFilter selects stored findings. Zero values disable the
+// corresponding criterion.
+type FindingFilter struct {
+	MinSeverity findings.Severity
+	Source      string
+	Type        string
+	Host        string
+	FlowID      string
+}
+
+func initFindingsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+        CREATE TABLE IF NOT EXISTS findings (
+            finding_id INTEGER PRIMARY KEY AUTOINCREMENT,
+            request_id INTEGER,
+            source TEXT NOT NULL,
+            type TEXT NOT NULL,
+            severity TEXT NOT NULL,
+            host TEXT NOT NULL,
+            path TEXT NOT NULL,
+            title TEXT NOT NULL,
+            detail TEXT,
+            evidence TEXT NOT NULL,
+            timestamp DATETIME NOT NULL,
+            UNIQUE (type, host, path, evidence)
+        );
+        CREATE INDEX IF NOT EXISTS idx_findings_request_id ON findings(request_id);
+        CREATE INDEX IF NOT EXISTS idx_findings_host ON findings(host);
+    `)
+	return err
+}
+
+// SaveFinding stores a finding and returns its ID. Findings that duplicate a
+// stored one are not saved, and an empty ID is returned for them.
+func SaveFinding(dbFile string, f findings.Finding) (string, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return "", fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	var requestID any
+	if f.FlowID != "" {
+		requestID = f.FlowID
+	}
+	if f.Timestamp.IsZero() {
+		f.Timestamp = time.Now()
+	}
+
+	var id int64
+	err = retry(5, func() (bool, error) {
+		result, err := db.Exec(`
+			INSERT OR IGNORE INTO findings (request_id, source, type, severity, host, path, title, detail, evidence, timestamp)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, requestID, f.Source, f.Type, string(f.Severity), f.Host, f.Path, f.Title, f.Detail, f.Evidence, f.Timestamp)
+		if err != nil {
+			return isBusyError(err), err
+		}
+
+		if n, err := result.RowsAffected(); err != nil || n == 0 {
+			id = 0
+			return false, err
+		}
+		id, err = result.LastInsertId()
+		return false, err
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to save finding: %v", err)
+	}
+	if id == 0 {
+		return "", nil
+	}
+
+	return strconv.FormatInt(id, 10), nil
+}
+
+// LoadFindings returns the stored findings that match the filter, from the
+// most to the least severe
+func LoadFindings(dbFile string, filter FindingFilter) ([]findings.Finding, error) {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return nil, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	query := `
+		SELECT finding_id, request_id, source, type, severity, host, path, title, detail, evidence, timestamp
+		FROM findings
+		WHERE 1 = 1`
+	args := []any{}
+
+	if filter.Source != "" {
+		query += " AND source = ?"
+		args = append(args, filter.Source)
+	}
+	if filter.Type != "" {
+		query += " AND type = ?"
+		args = append(args, filter.Type)
+	}
+	if filter.Host != "" {
+		query += " AND host = ?"
+		args = append(args, filter.Host)
+	}
+	if filter.FlowID != "" {
+		query += " AND request_id = ?"
+		args = append(args, filter.FlowID)
+	}
+	query += " ORDER BY finding_id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []findings.Finding{}
+	for rows.Next() {
+		var (
+			id        uint64
+			requestID sql.NullInt64
+			severity  string
+			detail    sql.NullString
+		)
+		f := findings.Finding{}
+		err := rows.Scan(&id, &requestID, &f.Source, &f.Type, &severity, &f.Host, &f.Path,
+			&f.Title, &detail, &f.Evidence, &f.Timestamp)
+		if err != nil {
+			return nil, err
+		}
+		f.ID = strconv.FormatUint(id, 10)
+		if requestID.Valid {
+			f.FlowID = strconv.FormatInt(requestID.Int64, 10)
+		}
+		f.Severity = findings.Severity(severity)
+		f.Detail = detail.String
+
+		if f.Severity.Rank() < filter.MinSeverity.Rank() {
+			continue
+		}
+		result = append(result, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// most severe first, keeping the order in which they were found
+	slices.SortStableFunc(result, func(a, b findings.Finding) int {
+		return b.Severity.Rank() - a.Severity.Rank()
+	})
+	return result, nil
+}
+
+// NewFindingSink returns a sink that de-duplicates findings, stores them in
+// dbFile if it is set and publishes the new ones to broker if it is not nil
+func NewFindingSink(dbFile string, broker *findings.Broker) findings.Sink {
+	seenMutex := sync.Mutex{}
+	seen := map[string]bool{}
+
+	return func(f findings.Finding) {
+		key := f.Key()
+
+		seenMutex.Lock()
+		if seen[key] {
+			seenMutex.Unlock()
+			return
+		}
+		seen[key] = true
+		seenMutex.Unlock()
+
+		if f.Timestamp.IsZero() {
+			f.Timestamp = time.Now()
+		}
+
+		if dbFile != "" {
+			id, err := SaveFinding(dbFile, f)
+			if err != nil {
+				log.Printf("Failed to store finding %s for %s%s: %v", f.Type, f.Host, f.Path, err)
+				return
+			}
+			if id == "" {
+				// already stored by a previous run
+				return
+			}
+			f.ID = id
+		}
+
+		if broker != nil {
+			broker.Publish(f)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package hooks
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+)
+
+func TestFindingSink(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	broker := findings.NewBroker()
+	published := broker.Subscribe()
+	defer broker.Unsubscribe(published)
+
+	low := findings.Finding{Source: "passive", Type: "missing-csp", Severity: findings.SeverityLow, Host: "a.com", Path: "/", Title: "t", FlowID: "1"}
+	high := findings.Finding{Source: "passive", Type: "exposed-secret", Severity: findings.SeverityHigh, Host: "a.com", Path: "/x", Title: "t", Evidence: "aws", FlowID: "2"}
+
+	sink := NewFindingSink(dbFile, broker)
+	sink(low)
+	sink(low)
+	sink(high)
+
+	// a new sink, e.g. after a restart, does not store duplicates either
+	NewFindingSink(dbFile, broker)(low)
+
+	if len(published) != 2 {
+		t.Fatalf("published %d findings, want 2", len(published))
+	}
+	if f := <-published; f.ID == "" || f.Type != low.Type {
+		t.Errorf("first published finding = %+v", f)
+	}
+
+	stored, err := LoadFindings(dbFile, FindingFilter{})
+	if err != nil {
+		t.Fatalf("LoadFindings() error = %v", err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("stored %d findings, want 2", len(stored))
+	}
+	if stored[0].Type != high.Type || stored[0].FlowID != "2" || stored[1].Type != low.Type {
+		t.Errorf("stored findings are not sorted by severity: %+v", stored)
+	}
+
+	filtered, err := LoadFindings(dbFile, FindingFilter{MinSeverity: findings.SeverityMedium})
+	if err != nil {
+		t.Fatalf("LoadFindings() error = %v", err)
+	}
+	if len(filtered) != 1 || filtered[0].Type != high.Type {
+		t.Errorf("findings of at least medium severity = %+v", filtered)
+	}
+}
@@ -0,0 +1,532 @@
+package hooks
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+// sqliteTimestampFormat is the layout used by SQLite's CURRENT_TIMESTAMP
+const sqliteTimestampFormat = "2006-01-02 15:04:05"
+
+// FlowFilter holds the search criteria used to select flows from the database.
+// Zero values disable the corresponding criterion.
+type FlowFilter struct {
+	FromID uint64
+	ToID   uint64
+
+	Method     string
+	StatusCode int
+
+	HostRe *regexp.Regexp
+	URLRe  *regexp.Regexp
+
+	Since time.Time
+	Until time.Time
+
+	// Tags, Color, Comment and Values select flows by their annotations.
+	// Flows must have all the tags and values, and a comment that contains
+	// Comment.
+	Tags    []string
+	Color   string
+	Comment string
+	Values  map[string]string
+
+	Limit int
+}
+
+// LoadFlows returns the flows stored in the database that match the filter,
+// ordered by request ID
+func LoadFlows(dbFile string, filter FlowFilter) ([]*flow.Flow, error) {
+	db, err := openReadOnly(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	// databases of previous versions lack the tables and columns added
+	// since, which are read as empty
+	sch, err := readSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	annotated := sch.hasTable("flow_annotations")
+	if !sch.hasTable("requests") || (!annotated && filter.hasAnnotations()) {
+		return []*flow.Flow{}, nil
+	}
+
+	query := fmt.Sprintf(`
+		SELECT r.request_id, r.method, r.url, r.body, r.timestamp, %s,
+			s.status_code, s.body, %s
+		FROM requests r
+		LEFT JOIN responses s ON s.response_id = r.request_id
+		WHERE 1 = 1`,
+		sch.columns("requests", "r", "request_line", "proto", "client_addr"),
+		sch.columns("responses", "s", "status_line", "proto",
+			"dns_ms", "connect_ms", "tls_handshake_ms", "ttfb_ms", "total_ms",
+			"upstream_ip", "tls_version", "tls_cipher", "alpn"),
+	)
+	args := []any{}
+
+	if filter.FromID != 0 {
+		query += " AND r.request_id >= ?"
+		args = append(args, filter.FromID)
+	}
+	if filter.ToID != 0 {
+		query += " AND r.request_id <= ?"
+		args = append(args, filter.ToID)
+	}
+	if filter.Method != "" {
+		query += " AND r.method = ?"
+		args = append(args, strings.ToUpper(filter.Method))
+	}
+	if filter.StatusCode != 0 {
+		query += " AND s.status_code = ?"
+		args = append(args, filter.StatusCode)
+	}
+	if !filter.Since.IsZero() {
+		query += " AND r.timestamp >= ?"
+		args = append(args, filter.Since.UTC().Format(sqliteTimestampFormat))
+	}
+	if !filter.Until.IsZero() {
+		query += " AND r.timestamp <= ?"
+		args = append(args, filter.Until.UTC().Format(sqliteTimestampFormat))
+	}
+	annotationQuery, annotationArgs := annotationConditions(filter)
+	query += annotationQuery
+	args = append(args, annotationArgs...)
+	query += " ORDER BY r.request_id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	flows := []*flow.Flow{}
+	for rows.Next() {
+		var (
+			id          uint64
+			method      string
+			rawURL      string
+			reqBody     sql.NullString
+			timestamp   time.Time
+			requestLine sql.NullString
+			reqProto    sql.NullString
+			clientAddr  sql.NullString
+			statusCode  sql.NullInt64
+			respBody    sql.NullString
+			statusLine  sql.NullString
+			respProto   sql.NullString
+			timings     [5]sql.NullFloat64
+			conn        [4]sql.NullString
+		)
+		err := rows.Scan(&id, &method, &rawURL, &reqBody, &timestamp,
+			&requestLine, &reqProto, &clientAddr, &statusCode, &respBody, &statusLine, &respProto,
+			&timings[0], &timings[1], &timings[2], &timings[3], &timings[4],
+			&conn[0], &conn[1], &conn[2], &conn[3])
+		if err != nil {
+			return nil, err
+		}
+
+		f, err := newStoredFlow(id, method, rawURL, reqBody.String, timestamp)
+		if err != nil {
+			return nil, err
+		}
+		setProto(&f.Request.Proto, &f.Request.ProtoMajor, &f.Request.ProtoMinor, reqProto.String)
+		f.Request = httpbytes.SetRequestWire(f.Request, &httpbytes.Wire{
+			FirstLine: requestLine.String,
+			Proto:     f.Request.Proto,
+		})
+		f.Request = flowmeta.Set(f.Request, &flowmeta.Meta{ClientAddr: clientAddr.String})
+
+		if filter.URLRe != nil && !filter.URLRe.MatchString(f.Request.URL.String()) {
+			continue
+		}
+		if filter.HostRe != nil && !filter.HostRe.MatchString(f.Request.URL.Host) {
+			continue
+		}
+
+		if statusCode.Valid {
+			f.Response = newStoredResponse(int(statusCode.Int64), respBody.String, f.Request)
+			setProto(&f.Response.Proto, &f.Response.ProtoMajor, &f.Response.ProtoMinor, respProto.String)
+			httpbytes.SetResponseWire(f.Response, &httpbytes.Wire{
+				FirstLine: statusLine.String,
+				Proto:     f.Response.Proto,
+			})
+			flowmeta.SetResponse(f.Response, &flowmeta.Meta{
+				DNS:             flowmeta.FromMilliseconds(timings[0].Float64),
+				Connect:         flowmeta.FromMilliseconds(timings[1].Float64),
+				TLSHandshake:    flowmeta.FromMilliseconds(timings[2].Float64),
+				TimeToFirstByte: flowmeta.FromMilliseconds(timings[3].Float64),
+				Total:           flowmeta.FromMilliseconds(timings[4].Float64),
+				ClientAddr:      clientAddr.String,
+				UpstreamIP:      conn[0].String,
+				TLSVersion:      conn[1].String,
+				TLSCipher:       conn[2].String,
+				ALPN:            conn[3].String,
+			})
+		}
+
+		flows = append(flows, f)
+		if filter.Limit > 0 && len(flows) >= filter.Limit {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	for _, f := range flows {
+		if err := loadFlowHeaders(db, f); err != nil {
+			return nil, err
+		}
+		if !annotated {
+			continue
+		}
+		if err := setFlowAnnotations(db, f); err != nil {
+			return nil, err
+		}
+	}
+
+	return flows, nil
+}
+
+// LoadFlow returns the flow stored in the database with the given ID
+func LoadFlow(dbFile string, id string) (*flow.Flow, error) {
+	numID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid non-numeric request id: %s", id)
+	}
+
+	flows, err := LoadFlows(dbFile, FlowFilter{FromID: numID, ToID: numID})
+	if err != nil {
+		return nil, err
+	}
+	if len(flows) == 0 {
+		return nil, fmt.Errorf("flow %s not found", id)
+	}
+
+	return flows[0], nil
+}
+
+// SaveFlow stores a flow in the database under a newly assigned ID. The
+// assigned ID is set in the flow and returned. IDs come from the provider
+// shared with the proxy, so flows saved while it runs do not collide with
+// the ones it captures.
+func SaveFlow(dbFile string, f *flow.Flow) (string, error) {
+	idProvider, err := SharedDBIDProvider(dbFile)
+	if err != nil {
+		return "", err
+	}
+
+	id := idProvider.NextID()
+	f.ID = id
+	f.Request = ids.SetRequestID(f.Request, id)
+
+	if err := saveRequestToDB(dbFile, f.Request); err != nil {
+		return "", err
+	}
+
+	if !f.Timestamp.IsZero() {
+		if err := setRequestTimestamp(dbFile, id, f.Timestamp); err != nil {
+			return "", err
+		}
+	}
+
+	if f.Response != nil {
+		setResponseRequest(f.Response, f.Request)
+		if err := saveResponseToDB(dbFile, f.Response); err != nil {
+			return "", err
+		}
+	}
+
+	return id, nil
+}
+
+// SaveRawFlow stores a flow together with the exact bytes sent and received,
+// which may differ from the parsed flow, e.g. in header order and casing or
+// in malformed syntax. The ID is assigned as in SaveFlow and returned.
+func SaveRawFlow(dbFile string, f *flow.Flow, rawRequest, rawResponse []byte) (string, error) {
+	id, err := SaveFlow(dbFile, f)
+	if err != nil {
+		return "", err
+	}
+
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return id, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	err = retry(5, func() (bool, error) {
+		err := func() error {
+			tx, err := db.Begin()
+			if err != nil {
+				return err
+			}
+			defer tx.Rollback()
+
+			if _, err := tx.Exec("UPDATE requests SET raw_request = ? WHERE request_id = ?", rawRequest, id); err != nil {
+				return err
+			}
+			if _, err := tx.Exec("UPDATE responses SET raw_response = ? WHERE response_id = ?", rawResponse, id); err != nil {
+				return err
+			}
+
+			return tx.Commit()
+		}()
+		if err != nil && isBusyError(err) {
+			return true, err
+		}
+		return false, err
+	})
+	if err != nil {
+		return id, fmt.Errorf("failed to save raw flow: %v", err)
+	}
+
+	return id, nil
+}
+
+// LoadRawFlow returns the exact bytes sent and received for a flow stored
+// with SaveRawFlow. Both are nil for flows stored from parsed messages.
+func LoadRawFlow(dbFile string, id string) ([]byte, []byte, error) {
+	db, err := openReadOnly(dbFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	sch, err := readSchema(db)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sch.hasTable("requests") {
+		return nil, nil, fmt.Errorf("flow %s not found", id)
+	}
+
+	var rawRequest, rawResponse []byte
+	err = db.QueryRow(fmt.Sprintf(`
+		SELECT %s, %s
+		FROM requests r LEFT JOIN responses s ON s.response_id = r.request_id
+		WHERE r.request_id = ?
+	`, sch.columns("requests", "r", "raw_request"), sch.columns("responses", "s", "raw_response")),
+		id).Scan(&rawRequest, &rawResponse)
+	if err == sql.ErrNoRows {
+		return nil, nil, fmt.Errorf("flow %s not found", id)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return rawRequest, rawResponse, nil
+}
+
+// Kinds of links between flows
+const (
+	LinkRepeater = "repeater"
+	LinkIntruder = "intruder"
+	LinkScanner  = "scanner"
+	LinkAuthz    = "authz"
+)
+
+// FlowLink records that a flow was derived from another one, e.g. a request
+// sent again from the repeater
+type FlowLink struct {
+	ID         string
+	OriginalID string
+	Kind       string
+}
+
+// LinkFlow stores a link from the flow id to the flow it was derived from.
+// The flow is saved first with SaveFlow, which initializes the database.
+func LinkFlow(dbFile string, link FlowLink) error {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	return retry(5, func() (bool, error) {
+		_, err := db.Exec(
+			"INSERT INTO flow_links (request_id, original_request_id, kind) VALUES (?, ?, ?)",
+			link.ID, link.OriginalID, link.Kind,
+		)
+		if err != nil && isBusyError(err) {
+			return true, err
+		}
+		return false, err
+	})
+}
+
+// LoadFlowLinks returns the links of the flows derived from the given flow
+func LoadFlowLinks(dbFile string, originalID string) ([]FlowLink, error) {
+	db, err := openReadOnly(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+
+	sch, err := readSchema(db)
+	if err != nil {
+		return nil, err
+	}
+	if !sch.hasTable("flow_links") {
+		return []FlowLink{}, nil
+	}
+
+	rows, err := db.Query(
+		"SELECT request_id, kind FROM flow_links WHERE original_request_id = ? ORDER BY request_id",
+		originalID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []FlowLink{}
+	for rows.Next() {
+		var id uint64
+		link := FlowLink{OriginalID: originalID}
+		if err := rows.Scan(&id, &link.Kind); err != nil {
+			return nil, err
+		}
+		link.ID = strconv.FormatUint(id, 10)
+		links = append(links, link)
+	}
+
+	return links, rows.Err()
+}
+
+func setRequestTimestamp(dbFile string, id string, timestamp time.Time) error {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	_, err = db.Exec(
+		"UPDATE requests SET timestamp = ? WHERE request_id = ?",
+		timestamp.UTC().Format(sqliteTimestampFormat),
+		id,
+	)
+	return err
+}
+
+func newStoredFlow(id uint64, method, rawURL, body string, timestamp time.Time) (*flow.Flow, error) {
+	strID := strconv.FormatUint(id, 10)
+
+	req, err := http.NewRequest(method, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request %s stored in database: %v", strID, err)
+	}
+	req.Body = io.NopCloser(bytes.NewBufferString(body))
+	req.ContentLength = int64(len(body))
+	req = ids.SetRequestID(req, strID)
+
+	return &flow.Flow{
+		ID:        strID,
+		Timestamp: timestamp,
+		Request:   req,
+	}, nil
+}
+
+func newStoredResponse(statusCode int, body string, req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
+
+// setProto sets the protocol version of a stored message if it is valid
+func setProto(proto *string, major, minor *int, value string) {
+	if m, n, ok := http.ParseHTTPVersion(value); ok {
+		*proto, *major, *minor = value, m, n
+	}
+}
+
+// loadFlowHeaders fills the request and response headers of a flow, and
+// their order and casing in the wire details
+func loadFlowHeaders(db *sql.DB, f *flow.Flow) error {
+	rows, err := db.Query(`
+		SELECT request_id IS NOT NULL, name, value
+		FROM headers
+		WHERE request_id = ? OR response_id = ?
+		ORDER BY id
+	`, f.ID, f.ID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var isRequest bool
+		var name, value string
+		if err := rows.Scan(&isRequest, &name, &value); err != nil {
+			return err
+		}
+
+		if !isRequest {
+			if f.Response != nil {
+				f.Response.Header.Add(name, value)
+				if w := httpbytes.ResponseWire(f.Response); w != nil {
+					w.Headers = append(w.Headers, httpbytes.Header{Name: name, Value: value})
+				}
+			}
+			continue
+		}
+
+		if strings.EqualFold(name, "Host") {
+			f.Request.Host = value
+		}
+		f.Request.Header.Add(name, value)
+		if w := httpbytes.RequestWire(f.Request); w != nil {
+			w.Headers = append(w.Headers, httpbytes.Header{Name: name, Value: value})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// the response details are kept in a copy of the request made before
+	// its Host was loaded
+	if f.Response != nil {
+		setResponseRequest(f.Response, f.Request)
+	}
+
+	return nil
+}
+
+// setResponseRequest sets the request of a response, keeping the wire
+// details and metadata of the response, which are kept in the context of
+// its previous request
+func setResponseRequest(resp *http.Response, req *http.Request) {
+	wire := httpbytes.ResponseWire(resp)
+	meta := flowmeta.GetResponse(resp)
+	resp.Request = req
+	if wire != nil {
+		httpbytes.SetResponseWire(resp, wire)
+	}
+	if meta != nil {
+		flowmeta.SetResponse(resp, meta)
+	}
+}
@@ -0,0 +1,379 @@
+package hooks
+
+import (
+	"database/sql"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+func newTestFlow(method, url, body string, status int) *flow.Flow {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	req.Header.Set("User-Agent", "test-agent")
+
+	resp := &http.Response{
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		Header:     http.Header{"Content-Type": []string{"text/plain"}},
+		Body:       io.NopCloser(strings.NewReader("response to " + url)),
+		Request:    req,
+	}
+
+	return &flow.Flow{Request: req, Response: resp}
+}
+
+func TestSaveAndLoadFlows(t *testing.T) {
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	defer os.Remove(dbF.Name())
+	dbFile := dbF.Name()
+
+	timestamp := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	flows := []*flow.Flow{
+		newTestFlow("GET", "http://example.com/a", "", 200),
+		newTestFlow("POST", "http://example.com/b", "data", 201),
+		newTestFlow("GET", "http://other.com/c", "", 404),
+	}
+	flows[0].Timestamp = timestamp
+
+	for i, f := range flows {
+		id, err := SaveFlow(dbFile, f)
+		if err != nil {
+			t.Fatalf("SaveFlow() error = %v", err)
+		}
+		if want := []string{"1", "2", "3"}[i]; id != want {
+			t.Errorf("SaveFlow() id = %s, want %s", id, want)
+		}
+	}
+
+	all, err := LoadFlows(dbFile, FlowFilter{})
+	if err != nil {
+		t.Fatalf("LoadFlows() error = %v", err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expected 3 flows, got %d", len(all))
+	}
+	if !all[0].Timestamp.Equal(timestamp) {
+		t.Errorf("timestamp = %v, want %v", all[0].Timestamp, timestamp)
+	}
+
+	f, err := LoadFlow(dbFile, "2")
+	if err != nil {
+		t.Fatalf("LoadFlow() error = %v", err)
+	}
+	body, _ := io.ReadAll(f.Request.Body)
+	if f.Request.Method != "POST" || string(body) != "data" {
+		t.Errorf("unexpected request: %s %q", f.Request.Method, body)
+	}
+	if f.Request.Host != "example.com" || f.Request.Header.Get("User-Agent") != "test-agent" {
+		t.Errorf("unexpected request headers: host=%s %v", f.Request.Host, f.Request.Header)
+	}
+	if f.Response == nil || f.Response.StatusCode != 201 || f.Response.Header.Get("Content-Type") != "text/plain" {
+		t.Errorf("unexpected response: %+v", f.Response)
+	}
+
+	tests := []struct {
+		name   string
+		filter FlowFilter
+		want   []string
+	}{
+		{"by method", FlowFilter{Method: "get"}, []string{"1", "3"}},
+		{"by status", FlowFilter{StatusCode: 404}, []string{"3"}},
+		{"by host", FlowFilter{HostRe: regexp.MustCompile(`^example\.com$`)}, []string{"1", "2"}},
+		{"by id range", FlowFilter{FromID: 2, ToID: 3}, []string{"2", "3"}},
+		{"with limit", FlowFilter{Limit: 1}, []string{"1"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := LoadFlows(dbFile, tt.filter)
+			if err != nil {
+				t.Fatalf("LoadFlows() error = %v", err)
+			}
+			gotIDs := []string{}
+			for _, f := range got {
+				gotIDs = append(gotIDs, f.ID)
+			}
+			if strings.Join(gotIDs, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("LoadFlows() ids = %v, want %v", gotIDs, tt.want)
+			}
+		})
+	}
+}
+
+func TestSaveAndLoadRawFlow(t *testing.T) {
+	dbFile := t.TempDir() + "/test.db"
+
+	rawRequest := []byte("GET / HTTP/1.1\r\nhost: test.host.com\r\nContent-Length: 0\r\nContent-Length: 5\r\n\r\n")
+	rawResponse := []byte("HTTP/1.1 400 Bad Request\r\n\r\n")
+
+	// raw requests sent while the proxy runs take IDs from its provider
+	idProvider, err := SharedDBIDProvider(dbFile)
+	if err != nil {
+		t.Fatalf("SharedDBIDProvider() error = %v", err)
+	}
+	proxyID := idProvider.NextID()
+
+	id, err := SaveRawFlow(dbFile, newTestFlow("GET", "https://test.host.com/", "", 400), rawRequest, rawResponse)
+	if err != nil {
+		t.Fatalf("SaveRawFlow() error = %v", err)
+	}
+	if id == proxyID {
+		t.Errorf("SaveRawFlow() id = %s, already assigned by the proxy", id)
+	}
+
+	gotRequest, gotResponse, err := LoadRawFlow(dbFile, id)
+	if err != nil {
+		t.Fatalf("LoadRawFlow() error = %v", err)
+	}
+	if string(gotRequest) != string(rawRequest) {
+		t.Errorf("raw request = %q, want %q", gotRequest, rawRequest)
+	}
+	if string(gotResponse) != string(rawResponse) {
+		t.Errorf("raw response = %q, want %q", gotResponse, rawResponse)
+	}
+
+	parsedID, err := SaveFlow(dbFile, newTestFlow("GET", "https://test.host.com/b", "", 200))
+	if err != nil {
+		t.Fatalf("SaveFlow() error = %v", err)
+	}
+	gotRequest, gotResponse, err = LoadRawFlow(dbFile, parsedID)
+	if err != nil {
+		t.Fatalf("LoadRawFlow() error = %v", err)
+	}
+	if gotRequest != nil || gotResponse != nil {
+		t.Errorf("expected no raw bytes for a parsed flow, got %q and %q", gotRequest, gotResponse)
+	}
+}
+
+func TestSaveAndLoadFlowWire(t *testing.T) {
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	defer os.Remove(dbF.Name())
+	dbFile := dbF.Name()
+
+	f := newTestFlow("GET", "http://example.com/a?b=%41", "", 200)
+	f.Request.Proto, f.Request.ProtoMajor, f.Request.ProtoMinor = "HTTP/1.0", 1, 0
+	f.Request.Header.Set("X-Zeta", "1")
+	f.Request = httpbytes.SetRequestWire(f.Request, &httpbytes.Wire{
+		FirstLine: "GET http://example.com/a?b=%41 HTTP/1.0",
+		Proto:     "HTTP/1.0",
+		Headers:   []httpbytes.Header{{Name: "x-zeta", Value: "1"}, {Name: "host", Value: "example.com"}},
+	})
+	f.Response.Header.Set("X-A", "1")
+	httpbytes.SetResponseWire(f.Response, &httpbytes.Wire{
+		FirstLine: "HTTP/1.1 200 Fine",
+		Proto:     "HTTP/1.1",
+		Headers:   []httpbytes.Header{{Name: "x-a", Value: "1"}, {Name: "content-type", Value: "text/plain"}},
+	})
+
+	id, err := SaveFlow(dbFile, f)
+	if err != nil {
+		t.Fatalf("SaveFlow() error = %v", err)
+	}
+
+	loaded, err := LoadFlow(dbFile, id)
+	if err != nil {
+		t.Fatalf("LoadFlow() error = %v", err)
+	}
+
+	if loaded.Request.Proto != "HTTP/1.0" {
+		t.Errorf("request proto = %s, want HTTP/1.0", loaded.Request.Proto)
+	}
+	if line := httpbytes.RequestLine(loaded.Request); line != "GET http://example.com/a?b=%41 HTTP/1.0" {
+		t.Errorf("request line = %q", line)
+	}
+	if line := httpbytes.StatusLine(loaded.Response); line != "HTTP/1.1 200 Fine" {
+		t.Errorf("status line = %q", line)
+	}
+
+	head := string(RawRequestHead(loaded.Request))
+	want := "GET http://example.com/a?b=%41 HTTP/1.0\r\nx-zeta: 1\r\nhost: example.com\r\nUser-Agent: test-agent\r\n\r\n"
+	if head != want {
+		t.Errorf("request head = %q, want %q", head, want)
+	}
+
+	head = string(RawResponseHead(loaded.Response))
+	want = "HTTP/1.1 200 Fine\r\nx-a: 1\r\ncontent-type: text/plain\r\n\r\n"
+	if head != want {
+		t.Errorf("response head = %q, want %q", head, want)
+	}
+}
+
+func TestSaveAndLoadFlowMeta(t *testing.T) {
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	defer os.Remove(dbF.Name())
+	dbFile := dbF.Name()
+
+	f := newTestFlow("GET", "https://example.com/", "", 200)
+	f.Request = flowmeta.Set(f.Request, &flowmeta.Meta{ClientAddr: "10.0.0.1:5000"})
+	meta := &flowmeta.Meta{
+		DNS:             2 * time.Millisecond,
+		Connect:         3 * time.Millisecond,
+		TLSHandshake:    5 * time.Millisecond,
+		TimeToFirstByte: 20 * time.Millisecond,
+		Total:           25 * time.Millisecond,
+		ClientAddr:      "10.0.0.1:5000",
+		UpstreamIP:      "93.184.216.34",
+		TLSVersion:      "TLS 1.3",
+		TLSCipher:       "TLS_AES_128_GCM_SHA256",
+		ALPN:            "http/1.1",
+	}
+	flowmeta.SetResponse(f.Response, meta)
+
+	id, err := SaveFlow(dbFile, f)
+	if err != nil {
+		t.Fatalf("SaveFlow() error = %v", err)
+	}
+
+	loaded, err := LoadFlow(dbFile, id)
+	if err != nil {
+		t.Fatalf("LoadFlow() error = %v", err)
+	}
+
+	if m := flowmeta.Get(loaded.Request); m == nil || m.ClientAddr != "10.0.0.1:5000" {
+		t.Errorf("request meta = %+v", m)
+	}
+	if m := flowmeta.GetResponse(loaded.Response); m == nil || *m != *meta {
+		t.Errorf("response meta = %+v, want %+v", m, meta)
+	}
+}
+
+func TestLoadFlowsBaselineSchema(t *testing.T) {
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	defer os.Remove(dbF.Name())
+	dbFile := dbF.Name()
+
+	// a database created by the first release, without the columns added
+	// since
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	_, err = db.Exec(`
+        CREATE TABLE requests (
+            request_id INTEGER PRIMARY KEY AUTOINCREMENT,
+            method TEXT NOT NULL,
+            url TEXT NOT NULL,
+            body TEXT,
+            timestamp DATETIME DEFAULT CURRENT_TIMESTAMP
+        );
+        CREATE TABLE responses (
+            response_id INTEGER PRIMARY KEY AUTOINCREMENT,
+            status_code INTEGER NOT NULL,
+            body TEXT,
+            content_length INTEGER
+        );
+        CREATE TABLE headers (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            request_id INTEGER,
+            response_id INTEGER,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL
+        );
+        CREATE TABLE cookies (
+            id INTEGER PRIMARY KEY AUTOINCREMENT,
+            request_id INTEGER,
+            response_id INTEGER,
+            name TEXT NOT NULL,
+            value TEXT NOT NULL
+        );
+        INSERT INTO requests (request_id, method, url, body) VALUES (1, 'GET', 'http://example.com/old', '');
+        INSERT INTO responses (response_id, status_code, body, content_length) VALUES (1, 200, 'ok', 2);
+        INSERT INTO headers (request_id, name, value) VALUES (1, 'Host', 'example.com');
+    `)
+	db.Close()
+	if err != nil {
+		t.Fatalf("could not create baseline schema: %v", err)
+	}
+
+	flows, err := LoadFlows(dbFile, FlowFilter{})
+	if err != nil {
+		t.Fatalf("LoadFlows() error = %v", err)
+	}
+	if len(flows) != 1 {
+		t.Fatalf("LoadFlows() = %d flows, want 1", len(flows))
+	}
+	if got := flows[0].Request.URL.String(); got != "http://example.com/old" {
+		t.Errorf("URL = %s, want http://example.com/old", got)
+	}
+	if flows[0].Response == nil || flows[0].Response.StatusCode != 200 {
+		t.Errorf("response = %v, want status 200", flows[0].Response)
+	}
+
+	tagged, err := LoadFlows(dbFile, FlowFilter{Tags: []string{"login"}})
+	if err != nil || len(tagged) != 0 {
+		t.Errorf("LoadFlows() by tag = %d flows, %v, want none", len(tagged), err)
+	}
+	rawRequest, rawResponse, err := LoadRawFlow(dbFile, "1")
+	if err != nil || rawRequest != nil || rawResponse != nil {
+		t.Errorf("LoadRawFlow() = %q, %q, %v, want no raw bytes", rawRequest, rawResponse, err)
+	}
+	links, err := LoadFlowLinks(dbFile, "1")
+	if err != nil || len(links) != 0 {
+		t.Errorf("LoadFlowLinks() = %v, %v, want no links", links, err)
+	}
+
+	// reading does not migrate the database
+	db, err = sql.Open("sqlite", dbFile)
+	if err != nil {
+		t.Fatalf("could not open db: %v", err)
+	}
+	defer db.Close()
+	sch, err := readSchema(db)
+	if err != nil {
+		t.Fatalf("readSchema() error = %v", err)
+	}
+	if sch.hasTable("flow_links") || sch["requests"]["client_addr"] {
+		t.Errorf("schema was migrated: %v", sch)
+	}
+}
+
+func TestSaveFlowSharedIDs(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "history.db")
+
+	// the proxy assigns an ID to a request it has not saved yet
+	idProvider, err := SharedDBIDProvider(dbFile)
+	if err != nil {
+		t.Fatalf("SharedDBIDProvider() error = %v", err)
+	}
+	proxyID := idProvider.NextID()
+
+	id, err := SaveFlow(dbFile, newTestFlow("GET", "http://example.com/repeated", "", 200))
+	if err != nil {
+		t.Fatalf("SaveFlow() error = %v", err)
+	}
+	if id == proxyID {
+		t.Fatalf("SaveFlow() id = %s, already assigned by the proxy", id)
+	}
+
+	req := ids.SetRequestID(httptest.NewRequest("GET", "http://example.com/captured", nil), proxyID)
+	if err := saveRequestToDB(dbFile, req); err != nil {
+		t.Errorf("saving the proxy flow failed: %v", err)
+	}
+}
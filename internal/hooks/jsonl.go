@@ -0,0 +1,168 @@
+package hooks
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// JSONLRecord is the object written for each completed flow by the JSONL
+// hook. Timestamp is the time the flow started, when the proxy received the
+// request.
+type JSONLRecord struct {
+	ID        string        `json:"id"`
+	Timestamp time.Time     `json:"timestamp"`
+	InScope   bool          `json:"in_scope"`
+	Request   JSONLRequest  `json:"request"`
+	Response  JSONLResponse `json:"response"`
+	Timings   *JSONLTimings `json:"timings,omitempty"`
+
+	Annotations *annotations.Annotations `json:"annotations,omitempty"`
+}
+
+// JSONLTimings are the timings, in milliseconds, and the connection details
+// of a JSONLRecord. Connection timings are 0 when a connection was reused.
+type JSONLTimings struct {
+	DNSMs          float64 `json:"dns_ms"`
+	ConnectMs      float64 `json:"connect_ms"`
+	TLSHandshakeMs float64 `json:"tls_handshake_ms"`
+	TTFBMs         float64 `json:"ttfb_ms"`
+	TotalMs        float64 `json:"total_ms"`
+
+	ClientAddr string `json:"client_addr,omitempty"`
+	UpstreamIP string `json:"upstream_ip,omitempty"`
+	TLSVersion string `json:"tls_version,omitempty"`
+	TLSCipher  string `json:"tls_cipher,omitempty"`
+	ALPN       string `json:"alpn,omitempty"`
+}
+
+// JSONLRequest is the request part of a JSONLRecord
+type JSONLRequest struct {
+	Method       string      `json:"method"`
+	URL          string      `json:"url"`
+	Host         string      `json:"host"`
+	Proto        string      `json:"proto"`
+	Headers      http.Header `json:"headers"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// JSONLResponse is the response part of a JSONLRecord
+type JSONLResponse struct {
+	StatusCode   int         `json:"status_code"`
+	Proto        string      `json:"proto"`
+	Headers      http.Header `json:"headers"`
+	Body         string      `json:"body,omitempty"`
+	BodyEncoding string      `json:"body_encoding,omitempty"`
+}
+
+// NewJSONLHook returns a response hook that writes one JSON object per line
+// to w for each completed flow. The request in the record is the one that was
+// sent to the destination, taken from the response.
+func NewJSONLHook(w io.Writer) pipeline.ReadOnlyHook[*http.Response] {
+	mutex := sync.Mutex{}
+
+	return func(resp *http.Response) error {
+		record, err := NewJSONLRecord(resp)
+		if err != nil {
+			return err
+		}
+
+		line, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		line = append(line, '\n')
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		_, err = w.Write(line)
+		return err
+	}
+}
+
+// NewJSONLRecord builds the JSONL record for a response and its request
+func NewJSONLRecord(resp *http.Response) (*JSONLRecord, error) {
+	record := &JSONLRecord{
+		ID:        ids.GetResponseID(resp),
+		Timestamp: time.Now().UTC(),
+	}
+
+	if m := flowmeta.GetResponse(resp); m != nil {
+		if !m.Received.IsZero() {
+			record.Timestamp = m.Received.UTC()
+		} else if !m.Start.IsZero() {
+			record.Timestamp = m.Start.UTC()
+		}
+		record.InScope = m.InScope
+		record.Timings = &JSONLTimings{
+			DNSMs:          flowmeta.Milliseconds(m.DNS),
+			ConnectMs:      flowmeta.Milliseconds(m.Connect),
+			TLSHandshakeMs: flowmeta.Milliseconds(m.TLSHandshake),
+			TTFBMs:         flowmeta.Milliseconds(m.TimeToFirstByte),
+			TotalMs:        flowmeta.Milliseconds(m.Total),
+			ClientAddr:     m.ClientAddr,
+			UpstreamIP:     m.UpstreamIP,
+			TLSVersion:     m.TLSVersion,
+			TLSCipher:      m.TLSCipher,
+			ALPN:           m.ALPN,
+		}
+	}
+
+	if req := resp.Request; req != nil {
+		body, err := httpbytes.ReadAndRestore(&req.Body)
+		if err != nil {
+			return nil, err
+		}
+
+		host := req.Host
+		if host == "" {
+			host = req.URL.Host
+		}
+
+		record.Request = JSONLRequest{
+			Method:  req.Method,
+			URL:     req.URL.String(),
+			Host:    host,
+			Proto:   req.Proto,
+			Headers: req.Header,
+		}
+		record.Request.Body, record.Request.BodyEncoding = encodeJSONLBody(body)
+	}
+
+	body, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	record.Response = JSONLResponse{
+		StatusCode: resp.StatusCode,
+		Proto:      resp.Proto,
+		Headers:    resp.Header,
+	}
+	record.Response.Body, record.Response.BodyEncoding = encodeJSONLBody(body)
+
+	if a := annotations.GetResponse(resp).Get(); !a.IsZero() {
+		record.Annotations = &a
+	}
+
+	return record, nil
+}
+
+func encodeJSONLBody(body []byte) (string, string) {
+	if utf8.Valid(body) {
+		return string(body), ""
+	}
+	return base64.StdEncoding.EncodeToString(body), "base64"
+}
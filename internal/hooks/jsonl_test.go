@@ -0,0 +1,131 @@
+package hooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+func TestJSONLHook(t *testing.T) {
+	var buf bytes.Buffer
+	hook := NewJSONLHook(&buf)
+
+	received := time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	for i, id := range []string{"1", "2"} {
+		req := httptest.NewRequest("POST", "http://example.com/path", strings.NewReader("data"))
+		req = ids.SetRequestID(req, id)
+
+		body := []byte("hello")
+		if i == 1 {
+			body = []byte{0xff, 0xfe}
+		}
+		resp := &http.Response{
+			StatusCode: 200,
+			Proto:      "HTTP/1.1",
+			Header:     http.Header{"Content-Type": []string{"text/plain"}},
+			Body:       io.NopCloser(bytes.NewReader(body)),
+			Request:    req,
+		}
+		if i == 0 {
+			flowmeta.SetResponse(resp, &flowmeta.Meta{
+				Start:           received.Add(time.Millisecond),
+				Received:        received,
+				InScope:         true,
+				DNS:             2 * time.Millisecond,
+				TimeToFirstByte: 10 * time.Millisecond,
+				Total:           12500 * time.Microsecond,
+				ClientAddr:      "10.0.0.1:5000",
+				UpstreamIP:      "93.184.216.34",
+			})
+		}
+
+		if err := hook(resp); err != nil {
+			t.Fatalf("hook() error = %v", err)
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+
+	var record JSONLRecord
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if record.ID != "1" || record.Request.Method != "POST" || record.Request.Body != "data" || record.Request.Host != "example.com" {
+		t.Errorf("unexpected request in record: %+v", record)
+	}
+	if record.Response.StatusCode != 200 || record.Response.Body != "hello" || record.Response.BodyEncoding != "" {
+		t.Errorf("unexpected response in record: %+v", record.Response)
+	}
+	if !record.Timestamp.Equal(received) || !record.InScope {
+		t.Errorf("record timestamp = %v, in scope = %v, want %v and true", record.Timestamp, record.InScope, received)
+	}
+	wantTimings := JSONLTimings{DNSMs: 2, TTFBMs: 10, TotalMs: 12.5, ClientAddr: "10.0.0.1:5000", UpstreamIP: "93.184.216.34"}
+	if record.Timings == nil || *record.Timings != wantTimings {
+		t.Errorf("record timings = %+v, want %+v", record.Timings, wantTimings)
+	}
+
+	record = JSONLRecord{}
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("invalid JSON line: %v", err)
+	}
+	if record.Response.BodyEncoding != "base64" || record.Response.Body != "//4=" {
+		t.Errorf("expected base64 body, got %q (%s)", record.Response.Body, record.Response.BodyEncoding)
+	}
+}
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := os.MkdirTemp("", "efin-proxy-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "flows.jsonl")
+	rf := NewRotatingFile(path, 10, 2)
+
+	for _, line := range []string{"aaaaaaa\n", "bbbbbbb\n", "ccccccc\n", "ddddddd\n"} {
+		if _, err := rf.Write([]byte(line)); err != nil {
+			t.Fatalf("Write() error = %v", err)
+		}
+	}
+
+	want := map[string]string{
+		path:        "ddddddd\n",
+		path + ".1": "ccccccc\n",
+		path + ".2": "bbbbbbb\n",
+	}
+	for file, content := range want {
+		got, err := os.ReadFile(file)
+		if err != nil {
+			t.Errorf("Failed to read %s: %v", file, err)
+			continue
+		}
+		if string(got) != content {
+			t.Errorf("%s content = %q, want %q", file, got, content)
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("expected only 2 backups to be kept")
+	}
+
+	// reconfiguring the same path reuses the writer with the new limits
+	shared := SharedRotatingFile(path, 10, 2)
+	if again := SharedRotatingFile(path, 100, 3); again != shared || again.MaxSize != 100 || again.MaxBackups != 3 {
+		t.Errorf("SharedRotatingFile() = %p with limits %d and %d, want %p with 100 and 3", again, again.MaxSize, again.MaxBackups, shared)
+	}
+}
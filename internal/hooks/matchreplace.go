@@ -0,0 +1,175 @@
+package hooks
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// Targets of a match and replace rule
+const (
+	TargetRequestHeader  = "request_header"
+	TargetRequestBody    = "request_body"
+	TargetResponseHeader = "response_header"
+	TargetResponseBody   = "response_body"
+)
+
+// MatchReplaceRule replaces the matches of a regex in a part of the requests
+// or responses. Header rules are applied to each header line in the form
+// "Name: value"; a line replaced with an empty string removes the header,
+// and a rule with an empty Match adds Replace as a new header line.
+type MatchReplaceRule struct {
+	Target  string `json:"target"`
+	Match   string `json:"match"`
+	Replace string `json:"replace"`
+	Comment string `json:"comment,omitempty"`
+	Enabled bool   `json:"enabled"`
+}
+
+type compiledRule struct {
+	MatchReplaceRule
+	re *regexp.Regexp
+}
+
+// NewMatchReplaceHooks returns request and response mod hooks that apply the
+// enabled rules in order
+func NewMatchReplaceHooks(rules []MatchReplaceRule) (pipeline.ModHook[*http.Request], pipeline.ModHook[*http.Response], error) {
+	var requestRules, responseRules []compiledRule
+
+	for _, r := range rules {
+		if !r.Enabled {
+			continue
+		}
+
+		cr := compiledRule{MatchReplaceRule: r}
+		if r.Match != "" {
+			re, err := regexp.Compile(r.Match)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid match regex '%s': %v", r.Match, err)
+			}
+			cr.re = re
+		}
+
+		switch r.Target {
+		case TargetRequestHeader, TargetRequestBody:
+			requestRules = append(requestRules, cr)
+		case TargetResponseHeader, TargetResponseBody:
+			responseRules = append(responseRules, cr)
+		default:
+			return nil, nil, fmt.Errorf("invalid match and replace target '%s'", r.Target)
+		}
+	}
+
+	requestHook := func(req *http.Request) (*http.Request, error) {
+		for _, r := range requestRules {
+			if r.Target == TargetRequestHeader {
+				applyHeaderRule(r, req.Header)
+				if host := req.Header.Get("Host"); host != "" {
+					req.Host = host
+				}
+				continue
+			}
+
+			body, err := httpbytes.ReadAndRestore(&req.Body)
+			if err != nil {
+				return req, err
+			}
+			if newBody, ok := applyBodyRule(r, body); ok {
+				req.Body = httpbytes.NewBodyWrapper(newBody)
+				req.ContentLength = int64(len(newBody))
+				if req.Header.Get("Content-Length") != "" {
+					req.Header.Set("Content-Length", fmt.Sprint(len(newBody)))
+				}
+			}
+		}
+		return req, nil
+	}
+
+	responseHook := func(resp *http.Response) (*http.Response, error) {
+		for _, r := range responseRules {
+			if r.Target == TargetResponseHeader {
+				applyHeaderRule(r, resp.Header)
+				continue
+			}
+
+			body, err := httpbytes.ReadAndRestore(&resp.Body)
+			if err != nil {
+				return resp, err
+			}
+			if newBody, ok := applyBodyRule(r, body); ok {
+				resp.Body = httpbytes.NewBodyWrapper(newBody)
+				resp.ContentLength = int64(len(newBody))
+				if resp.Header.Get("Content-Length") != "" {
+					resp.Header.Set("Content-Length", fmt.Sprint(len(newBody)))
+				}
+			}
+		}
+		return resp, nil
+	}
+
+	return requestHook, responseHook, nil
+}
+
+func applyHeaderRule(r compiledRule, header http.Header) {
+	if r.re == nil {
+		if name, value, ok := strings.Cut(r.Replace, ":"); ok {
+			header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+		return
+	}
+
+	added := http.Header{}
+	for name, values := range header {
+		newValues := []string{}
+		for _, value := range values {
+			line := name + ": " + value
+			newLine := r.re.ReplaceAllString(line, r.Replace)
+			if newLine == line {
+				newValues = append(newValues, value)
+				continue
+			}
+
+			newName, newValue, ok := strings.Cut(newLine, ":")
+			if !ok {
+				// the header was removed or is no longer a valid header line
+				continue
+			}
+			newName = http.CanonicalHeaderKey(strings.TrimSpace(newName))
+			newValue = strings.TrimSpace(newValue)
+
+			if newName == name {
+				newValues = append(newValues, newValue)
+			} else {
+				added.Add(newName, newValue)
+			}
+		}
+
+		if len(newValues) == 0 {
+			header.Del(name)
+		} else {
+			header[name] = newValues
+		}
+	}
+
+	for name, values := range added {
+		header[name] = append(header[name], values...)
+	}
+}
+
+func applyBodyRule(r compiledRule, body []byte) ([]byte, bool) {
+	if r.re == nil {
+		return nil, false
+	}
+
+	newBody := r.re.ReplaceAll(body, []byte(r.Replace))
+	if bytes.Equal(newBody, body) {
+		return nil, false
+	}
+
+	return newBody, true
+}
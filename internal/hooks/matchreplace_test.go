@@ -0,0 +1,99 @@
+package hooks
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMatchReplaceRequestHeaders(t *testing.T) {
+	requestHook, _, err := NewMatchReplaceHooks([]MatchReplaceRule{
+		{Target: TargetRequestHeader, Match: "^User-Agent: .*$", Replace: "User-Agent: efin", Enabled: true},
+		{Target: TargetRequestHeader, Match: "^Cookie: .*$", Replace: "", Enabled: true},
+		{Target: TargetRequestHeader, Match: "", Replace: "X-Added: yes", Enabled: true},
+		{Target: TargetRequestHeader, Match: "^Accept: .*$", Replace: "", Enabled: false},
+	})
+	if err != nil {
+		t.Fatalf("NewMatchReplaceHooks() error = %v", err)
+	}
+
+	req := httptest.NewRequest("GET", "https://test.host.com/", nil)
+	req.Header.Set("User-Agent", "curl/8.0")
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("Accept", "*/*")
+
+	req, err = requestHook(req)
+	if err != nil {
+		t.Fatalf("requestHook() error = %v", err)
+	}
+
+	if got := req.Header.Get("User-Agent"); got != "efin" {
+		t.Errorf("User-Agent = %q, want %q", got, "efin")
+	}
+	if _, ok := req.Header["Cookie"]; ok {
+		t.Errorf("Cookie header was not removed")
+	}
+	if got := req.Header.Get("X-Added"); got != "yes" {
+		t.Errorf("X-Added = %q, want %q", got, "yes")
+	}
+	if got := req.Header.Get("Accept"); got != "*/*" {
+		t.Errorf("disabled rule was applied, Accept = %q", got)
+	}
+}
+
+func TestMatchReplaceResponseBody(t *testing.T) {
+	_, responseHook, err := NewMatchReplaceHooks([]MatchReplaceRule{
+		{Target: TargetResponseBody, Match: `"admin":\s*false`, Replace: `"admin":true`, Enabled: true},
+	})
+	if err != nil {
+		t.Fatalf("NewMatchReplaceHooks() error = %v", err)
+	}
+
+	body := `{"user":"bob","admin": false}`
+	resp := &http.Response{
+		StatusCode:    200,
+		Header:        http.Header{"Content-Length": []string{"29"}},
+		Body:          io.NopCloser(strings.NewReader(body)),
+		ContentLength: int64(len(body)),
+	}
+
+	resp, err = responseHook(resp)
+	if err != nil {
+		t.Fatalf("responseHook() error = %v", err)
+	}
+
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read body: %v", err)
+	}
+	want := `{"user":"bob","admin":true}`
+	if string(got) != want {
+		t.Errorf("body = %q, want %q", got, want)
+	}
+	if resp.ContentLength != int64(len(want)) {
+		t.Errorf("ContentLength = %d, want %d", resp.ContentLength, len(want))
+	}
+	if cl := resp.Header.Get("Content-Length"); cl != "27" {
+		t.Errorf("Content-Length header = %q, want %q", cl, "27")
+	}
+}
+
+func TestMatchReplaceInvalidRules(t *testing.T) {
+	tests := []struct {
+		name string
+		rule MatchReplaceRule
+	}{
+		{"invalid regex", MatchReplaceRule{Target: TargetRequestBody, Match: "(", Enabled: true}},
+		{"invalid target", MatchReplaceRule{Target: "url", Match: "a", Enabled: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := NewMatchReplaceHooks([]MatchReplaceRule{tt.rule}); err == nil {
+				t.Errorf("NewMatchReplaceHooks() error = nil, want error")
+			}
+		})
+	}
+}
@@ -3,73 +3,65 @@ package hooks
 import (
 	"bytes"
 	"fmt"
-	"io"
 	"net/http"
-	"os"
-	"path/filepath"
 
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 	"github.com/artilugio0/efin-proxy/internal/ids"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
 )
 
 // RawRequestBytes generates the raw HTTP bytes for a request
 func RawRequestBytes(req *http.Request) ([]byte, error) {
-	var buf bytes.Buffer
-
-	buf.WriteString(fmt.Sprintf("%s %s %s\r\n", req.Method, req.URL.RequestURI(), req.Proto))
+	head := RawRequestHead(req)
 
-	host := req.Host
-	if host == "" {
-		host = req.Header.Get("Host")
-	}
-	if host != "" && req.Header.Get("Host") == "" {
-		req.Header.Set("Host", host)
+	body, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read request body: %v", err)
 	}
 
-	for key, values := range req.Header {
-		for _, value := range values {
-			buf.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
-		}
-	}
+	return append(head, body...), nil
+}
 
-	buf.WriteString("\r\n")
+// RawRequestHead generates the raw HTTP bytes for the request line and
+// headers of a request, including the blank line that precedes the body
+func RawRequestHead(req *http.Request) []byte {
+	var buf bytes.Buffer
 
-	if req.Body != nil {
-		bodyBytes, err := io.ReadAll(req.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read request body: %v", err)
-		}
-		req.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-		buf.Write(bodyBytes)
+	buf.WriteString(httpbytes.RequestLine(req) + "\r\n")
+	for _, h := range httpbytes.RequestHeaders(req) {
+		buf.WriteString(fmt.Sprintf("%s: %s\r\n", h.Name, h.Value))
 	}
 
-	return buf.Bytes(), nil
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
 }
 
 // RawResponseBytes generates the raw HTTP bytes for a response
 func RawResponseBytes(resp *http.Response) ([]byte, error) {
-	var buf bytes.Buffer
-
-	buf.WriteString(fmt.Sprintf("%s %d %s\r\n", resp.Proto, resp.StatusCode, http.StatusText(resp.StatusCode)))
+	head := RawResponseHead(resp)
 
-	for key, values := range resp.Header {
-		for _, value := range values {
-			buf.WriteString(fmt.Sprintf("%s: %s\r\n", key, value))
-		}
+	body, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
 	}
 
-	buf.WriteString("\r\n")
+	return append(head, body...), nil
+}
+
+// RawResponseHead generates the raw HTTP bytes for the status line and
+// headers of a response, including the blank line that precedes the body
+func RawResponseHead(resp *http.Response) []byte {
+	var buf bytes.Buffer
 
-	if resp.Body != nil {
-		bodyBytes, err := io.ReadAll(resp.Body)
-		if err != nil {
-			return nil, fmt.Errorf("failed to read response body: %v", err)
-		}
-		resp.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-		buf.Write(bodyBytes)
+	buf.WriteString(httpbytes.StatusLine(resp) + "\r\n")
+	for _, h := range httpbytes.ResponseHeaders(resp) {
+		buf.WriteString(fmt.Sprintf("%s: %s\r\n", h.Name, h.Value))
 	}
 
-	return buf.Bytes(), nil
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
 }
 
 // LogRawRequest prints the request in raw HTTP format to stdout with request ID
@@ -106,35 +98,7 @@ func LogRawResponse(resp *http.Response) error {
 
 // NewFileSaveHooks returns request and response hooks that save to files in the specified directory
 func NewFileSaveHooks(dir string) (pipeline.ReadOnlyHook[*http.Request], pipeline.ReadOnlyHook[*http.Response]) {
-	if dir == "" {
-		dir = "." // Default to current directory
-	}
-
-	saveRequest := func(req *http.Request) error {
-		raw, err := RawRequestBytes(req)
-		if err != nil {
-			return err
-		}
-		id := ids.GetRequestID(req)
-		if id == "" {
-			id = "unknown"
-		}
-		filename := filepath.Join(dir, fmt.Sprintf("request-%s.txt", id))
-		return os.WriteFile(filename, raw, 0644)
-	}
-
-	saveResponse := func(resp *http.Response) error {
-		raw, err := RawResponseBytes(resp)
-		if err != nil {
-			return err
-		}
-		id := ids.GetResponseID(resp)
-		if id == "" {
-			id = "unknown"
-		}
-		filename := filepath.Join(dir, fmt.Sprintf("response-%s.txt", id))
-		return os.WriteFile(filename, raw, 0644)
-	}
-
+	// The flat layout without retention does not return errors
+	saveRequest, saveResponse, _ := NewFileSaveHooksWithOptions(FileSaveOptions{Dir: dir})
 	return saveRequest, saveResponse
 }
@@ -0,0 +1,451 @@
+package hooks
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"modernc.org/sqlite"
+)
+
+// pruneBatchSize is the number of flows deleted per statement
+const pruneBatchSize = 500
+
+// RetentionPolicy defines which flows are kept in the database. Zero values
+// disable the corresponding limit.
+type RetentionPolicy struct {
+	// MaxAge deletes flows older than this duration
+	MaxAge time.Duration
+
+	// MaxRows keeps only the most recent MaxRows flows
+	MaxRows int
+
+	// MaxSize deletes the oldest flows until the data in the database takes
+	// less than MaxSize bytes. The file only shrinks after a vacuum.
+	MaxSize int64
+
+	// HostRules override MaxAge for the hosts they match. The first
+	// matching rule is used.
+	HostRules []HostRetentionRule
+}
+
+// HostRetentionRule sets the maximum age of the flows of matching hosts
+type HostRetentionRule struct {
+	HostRe *regexp.Regexp
+	MaxAge time.Duration
+}
+
+// IsZero reports whether the policy does not limit anything
+func (rp RetentionPolicy) IsZero() bool {
+	return rp.MaxAge == 0 && rp.MaxRows == 0 && rp.MaxSize == 0 && len(rp.HostRules) == 0
+}
+
+// PruneResult reports what a prune operation did
+type PruneResult struct {
+	DeletedFlows int
+	SizeBefore   int64
+	SizeAfter    int64
+}
+
+// ParseHostRetentionRule parses a rule in the form <host regex>=<duration>
+func ParseHostRetentionRule(rule string) (HostRetentionRule, error) {
+	i := strings.LastIndex(rule, "=")
+	if i == -1 {
+		return HostRetentionRule{}, fmt.Errorf("invalid host retention rule '%s': expected <host regex>=<duration>", rule)
+	}
+
+	re, err := regexp.Compile(rule[:i])
+	if err != nil {
+		return HostRetentionRule{}, fmt.Errorf("invalid host regex in retention rule '%s': %v", rule, err)
+	}
+
+	maxAge, err := time.ParseDuration(rule[i+1:])
+	if err != nil {
+		return HostRetentionRule{}, fmt.Errorf("invalid duration in retention rule '%s': %v", rule, err)
+	}
+
+	return HostRetentionRule{HostRe: re, MaxAge: maxAge}, nil
+}
+
+// PruneHistory deletes the flows that are not allowed by the policy
+func PruneHistory(dbFile string, policy RetentionPolicy) (PruneResult, error) {
+	result := PruneResult{}
+
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return result, fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	if err := InitDatabase(db); err != nil {
+		return result, fmt.Errorf("failed to initialize database: %v", err)
+	}
+
+	result.SizeBefore, err = databaseSize(db)
+	if err != nil {
+		return result, err
+	}
+
+	expired, err := expiredFlowIDs(db, policy, time.Now())
+	if err != nil {
+		return result, err
+	}
+	if err := deleteFlows(db, expired); err != nil {
+		return result, err
+	}
+	result.DeletedFlows += len(expired)
+
+	if policy.MaxRows > 0 {
+		ids, err := queryIDs(db, `
+			SELECT request_id FROM requests
+			ORDER BY request_id DESC
+			LIMIT -1 OFFSET ?
+		`, policy.MaxRows)
+		if err != nil {
+			return result, err
+		}
+		if err := deleteFlows(db, ids); err != nil {
+			return result, err
+		}
+		result.DeletedFlows += len(ids)
+	}
+
+	if policy.MaxSize > 0 {
+		deleted, err := pruneToSize(db, dbFile, policy.MaxSize)
+		result.DeletedFlows += deleted
+		if err != nil {
+			return result, err
+		}
+	}
+
+	result.SizeAfter, err = databaseSize(db)
+	if err != nil {
+		return result, err
+	}
+
+	return result, nil
+}
+
+// pruneToSize deletes the oldest flows until the data in the database takes
+// less than maxSize bytes. It deletes nothing if not even an empty database
+// fits in maxSize, and stops when deleting flows does not free any space.
+func pruneToSize(db *sql.DB, dbFile string, maxSize int64) (int, error) {
+	minSize, err := emptyDatabaseSize(db)
+	if err != nil {
+		return 0, err
+	}
+	if maxSize < minSize {
+		log.Printf("Not pruning %s by size: max size %d is below the %d bytes of an empty database", dbFile, maxSize, minSize)
+		return 0, nil
+	}
+
+	deleted := 0
+	previous := int64(-1)
+	for {
+		used, err := usedDatabaseSize(db)
+		if err != nil {
+			return deleted, err
+		}
+		if used <= maxSize {
+			return deleted, nil
+		}
+		if previous >= 0 && used >= previous {
+			log.Printf("Stopped pruning %s by size: deleting flows does not free space (%d bytes used, max size %d)", dbFile, used, maxSize)
+			return deleted, nil
+		}
+		previous = used
+
+		var count int
+		if err := db.QueryRow("SELECT COUNT(*) FROM requests").Scan(&count); err != nil {
+			return deleted, err
+		}
+		if count == 0 {
+			return deleted, nil
+		}
+
+		// delete a tenth of the flows at a time to avoid deleting more
+		// than needed
+		batch := min(max(count/10, 1), pruneBatchSize)
+		ids, err := queryIDs(db, "SELECT request_id FROM requests ORDER BY request_id LIMIT ?", batch)
+		if err != nil {
+			return deleted, err
+		}
+		if err := deleteFlows(db, ids); err != nil {
+			return deleted, err
+		}
+		deleted += len(ids)
+	}
+}
+
+// VacuumHistory rebuilds the database file, releasing the space of deleted flows
+func VacuumHistory(dbFile string) error {
+	db, err := sql.Open("sqlite", dbFile)
+	if err != nil {
+		return fmt.Errorf("failed to open SQLite database: %v", err)
+	}
+	defer db.Close()
+
+	return retry(5, func() (bool, error) {
+		_, err := db.Exec("VACUUM")
+		if err != nil && isBusyError(err) {
+			log.Printf("Database locked during vacuum, retrying...: %v", err)
+			return true, err
+		}
+		return false, err
+	})
+}
+
+var (
+	retentionJobsMutex sync.Mutex
+	retentionJobs      = map[string]chan struct{}{}
+)
+
+// StartRetentionJob prunes the database periodically according to the
+// policy. Starting a job for a database replaces the previous job for the
+// same database.
+func StartRetentionJob(dbFile string, policy RetentionPolicy, interval time.Duration) {
+	stop := make(chan struct{})
+
+	retentionJobsMutex.Lock()
+	if previous, ok := retentionJobs[dbFile]; ok {
+		close(previous)
+	}
+	retentionJobs[dbFile] = stop
+	retentionJobsMutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			result, err := PruneHistory(dbFile, policy)
+			if err != nil {
+				log.Printf("Failed to prune history in %s: %v", dbFile, err)
+			} else if result.DeletedFlows > 0 {
+				log.Printf("Pruned %d flows from %s", result.DeletedFlows, dbFile)
+			}
+
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// StopRetentionJob stops the retention job of a database, if any
+func StopRetentionJob(dbFile string) {
+	retentionJobsMutex.Lock()
+	defer retentionJobsMutex.Unlock()
+
+	if stop, ok := retentionJobs[dbFile]; ok {
+		close(stop)
+		delete(retentionJobs, dbFile)
+	}
+}
+
+// expiredFlowIDs returns the IDs of the flows older than the max age that
+// applies to their host
+func expiredFlowIDs(db *sql.DB, policy RetentionPolicy, now time.Time) ([]uint64, error) {
+	if policy.MaxAge == 0 && len(policy.HostRules) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query("SELECT request_id, url, timestamp FROM requests")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		var rawURL string
+		var timestamp time.Time
+		if err := rows.Scan(&id, &rawURL, &timestamp); err != nil {
+			return nil, err
+		}
+
+		maxAge := policy.MaxAge
+		if u, err := url.Parse(rawURL); err == nil {
+			for _, rule := range policy.HostRules {
+				if rule.HostRe.MatchString(u.Host) {
+					maxAge = rule.MaxAge
+					break
+				}
+			}
+		}
+
+		if maxAge > 0 && now.Sub(timestamp) > maxAge {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, rows.Err()
+}
+
+// deleteFlows deletes the requests, responses, headers, cookies and links of
+// the flows
+func deleteFlows(db *sql.DB, ids []uint64) error {
+	for start := 0; start < len(ids); start += pruneBatchSize {
+		end := min(start+pruneBatchSize, len(ids))
+		batch := ids[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(batch)), ",")
+		args := make([]any, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+
+		err := retry(5, func() (bool, error) {
+			err := func() error {
+				tx, err := db.Begin()
+				if err != nil {
+					return err
+				}
+				defer tx.Rollback()
+
+				for _, table := range []string{"headers", "cookies"} {
+					_, err := tx.Exec(fmt.Sprintf(
+						"DELETE FROM %s WHERE request_id IN (%s) OR response_id IN (%s)",
+						table, placeholders, placeholders,
+					), append(args, args...)...)
+					if err != nil {
+						return err
+					}
+				}
+
+				_, err = tx.Exec(fmt.Sprintf(
+					"DELETE FROM flow_links WHERE request_id IN (%s) OR original_request_id IN (%s)",
+					placeholders, placeholders,
+				), append(args, args...)...)
+				if err != nil {
+					return err
+				}
+
+				for _, table := range annotationTables {
+					if _, err := tx.Exec(fmt.Sprintf("DELETE FROM %s WHERE request_id IN (%s)", table, placeholders), args...); err != nil {
+						return err
+					}
+				}
+
+				_, err = tx.Exec(fmt.Sprintf("UPDATE attack_results SET request_id = NULL WHERE request_id IN (%s)", placeholders), args...)
+				if err != nil {
+					return err
+				}
+
+				_, err = tx.Exec(fmt.Sprintf("UPDATE findings SET request_id = NULL WHERE request_id IN (%s)", placeholders), args...)
+				if err != nil {
+					return err
+				}
+
+				if _, err := tx.Exec(fmt.Sprintf("DELETE FROM responses WHERE response_id IN (%s)", placeholders), args...); err != nil {
+					return err
+				}
+				if _, err := tx.Exec(fmt.Sprintf("DELETE FROM requests WHERE request_id IN (%s)", placeholders), args...); err != nil {
+					return err
+				}
+
+				return tx.Commit()
+			}()
+
+			if err != nil && isBusyError(err) {
+				log.Printf("Database locked while pruning, retrying...: %v", err)
+				return true, err
+			}
+			return false, err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete flows: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func queryIDs(db *sql.DB, query string, args ...any) ([]uint64, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uint64{}
+	for rows.Next() {
+		var id uint64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// databaseSize returns the size of the database file in bytes
+func databaseSize(db *sql.DB) (int64, error) {
+	var pageCount, pageSize int64
+	if err := db.QueryRow("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pageCount * pageSize, nil
+}
+
+// emptyDatabaseSize returns the size in bytes of a database without flows,
+// measured by creating one in memory with the same page size
+func emptyDatabaseSize(db *sql.DB) (int64, error) {
+	var pageSize int64
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+
+	empty, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		return 0, err
+	}
+	defer empty.Close()
+	// each connection would have its own in-memory database
+	empty.SetMaxOpenConns(1)
+
+	if _, err := empty.Exec(fmt.Sprintf("PRAGMA page_size = %d", pageSize)); err != nil {
+		return 0, err
+	}
+	if err := InitDatabase(empty); err != nil {
+		return 0, err
+	}
+	return databaseSize(empty)
+}
+
+// usedDatabaseSize returns the size of the database file in bytes excluding
+// the free pages left by deleted rows
+func usedDatabaseSize(db *sql.DB) (int64, error) {
+	size, err := databaseSize(db)
+	if err != nil {
+		return 0, err
+	}
+
+	var freePages, pageSize int64
+	if err := db.QueryRow("PRAGMA freelist_count").Scan(&freePages); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+
+	return size - freePages*pageSize, nil
+}
+
+// isBusyError reports whether err is caused by the database being locked
+func isBusyError(err error) bool {
+	sqliteErr, ok := err.(*sqlite.Error)
+	return ok && strings.Contains(strings.ToLower(sqlite.ErrorCodeString[sqliteErr.Code()]), "busy")
+}
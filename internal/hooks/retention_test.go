@@ -0,0 +1,163 @@
+package hooks
+
+import (
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newPruneTestDB(t *testing.T, urls []string, ages []time.Duration, body string) string {
+	t.Helper()
+
+	dbF, err := os.CreateTemp("", "tmpfile-")
+	if err != nil {
+		t.Fatalf("could not create db file: %v", err)
+	}
+	dbF.Close()
+	t.Cleanup(func() { os.Remove(dbF.Name()) })
+
+	now := time.Now()
+	for i, u := range urls {
+		f := newTestFlow("POST", u, body, 200)
+		f.Timestamp = now.Add(-ages[i])
+		if _, err := SaveFlow(dbF.Name(), f); err != nil {
+			t.Fatalf("SaveFlow() error = %v", err)
+		}
+	}
+
+	return dbF.Name()
+}
+
+func remainingIDs(t *testing.T, dbFile string) string {
+	t.Helper()
+
+	flows, err := LoadFlows(dbFile, FlowFilter{})
+	if err != nil {
+		t.Fatalf("LoadFlows() error = %v", err)
+	}
+	ids := []string{}
+	for _, f := range flows {
+		ids = append(ids, f.ID)
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestPruneHistory(t *testing.T) {
+	urls := []string{
+		"http://example.com/1",
+		"http://ads.com/2",
+		"http://example.com/3",
+		"http://ads.com/4",
+	}
+	ages := []time.Duration{72 * time.Hour, 2 * time.Hour, 30 * time.Minute, 10 * time.Minute}
+
+	tests := []struct {
+		name        string
+		policy      RetentionPolicy
+		wantIDs     string
+		wantDeleted int
+	}{
+		{
+			name:        "max age",
+			policy:      RetentionPolicy{MaxAge: 24 * time.Hour},
+			wantIDs:     "2,3,4",
+			wantDeleted: 1,
+		},
+		{
+			name: "host rule overrides max age",
+			policy: RetentionPolicy{
+				MaxAge:    24 * time.Hour,
+				HostRules: []HostRetentionRule{{HostRe: regexp.MustCompile(`^ads\.com$`), MaxAge: time.Hour}},
+			},
+			wantIDs:     "3,4",
+			wantDeleted: 2,
+		},
+		{
+			name:        "max rows",
+			policy:      RetentionPolicy{MaxRows: 1},
+			wantIDs:     "4",
+			wantDeleted: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dbFile := newPruneTestDB(t, urls, ages, "")
+
+			result, err := PruneHistory(dbFile, tt.policy)
+			if err != nil {
+				t.Fatalf("PruneHistory() error = %v", err)
+			}
+			if result.DeletedFlows != tt.wantDeleted {
+				t.Errorf("DeletedFlows = %d, want %d", result.DeletedFlows, tt.wantDeleted)
+			}
+			if got := remainingIDs(t, dbFile); got != tt.wantIDs {
+				t.Errorf("remaining flows = %s, want %s", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestPruneHistoryMaxSize(t *testing.T) {
+	urls := []string{}
+	ages := []time.Duration{}
+	for i := 0; i < 20; i++ {
+		urls = append(urls, "http://example.com/")
+		ages = append(ages, 0)
+	}
+	dbFile := newPruneTestDB(t, urls, ages, strings.Repeat("x", 64*1024))
+
+	const maxSize = 512 * 1024
+	result, err := PruneHistory(dbFile, RetentionPolicy{MaxSize: maxSize})
+	if err != nil {
+		t.Fatalf("PruneHistory() error = %v", err)
+	}
+	if result.DeletedFlows == 0 || result.DeletedFlows == 20 {
+		t.Errorf("expected some flows to be deleted, got %d", result.DeletedFlows)
+	}
+
+	if err := VacuumHistory(dbFile); err != nil {
+		t.Fatalf("VacuumHistory() error = %v", err)
+	}
+
+	info, err := os.Stat(dbFile)
+	if err != nil {
+		t.Fatalf("stat error: %v", err)
+	}
+	if info.Size() > maxSize {
+		t.Errorf("database size after vacuum = %d, want <= %d", info.Size(), maxSize)
+	}
+}
+
+func TestPruneHistoryMaxSizeTooSmall(t *testing.T) {
+	dbFile := newPruneTestDB(t,
+		[]string{"http://example.com/", "http://example.com/"},
+		[]time.Duration{0, 0},
+		"body",
+	)
+
+	// not even an empty database fits, so no flow is deleted
+	result, err := PruneHistory(dbFile, RetentionPolicy{MaxSize: 1})
+	if err != nil {
+		t.Fatalf("PruneHistory() error = %v", err)
+	}
+	if result.DeletedFlows != 0 {
+		t.Errorf("DeletedFlows = %d, want 0", result.DeletedFlows)
+	}
+}
+
+func TestParseHostRetentionRule(t *testing.T) {
+	rule, err := ParseHostRetentionRule(`a=b\.com$=1h30m`)
+	if err != nil {
+		t.Fatalf("ParseHostRetentionRule() error = %v", err)
+	}
+	if rule.MaxAge != 90*time.Minute || rule.HostRe.String() != `a=b\.com$` {
+		t.Errorf("unexpected rule: %v %s", rule.MaxAge, rule.HostRe)
+	}
+
+	if _, err := ParseHostRetentionRule("example.com"); err == nil {
+		t.Errorf("expected error for rule without duration")
+	}
+}
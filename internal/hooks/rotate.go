@@ -0,0 +1,108 @@
+package hooks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an io.Writer that appends to a file and rotates it when it
+// grows beyond MaxSize bytes. Rotated files are renamed to <path>.1,
+// <path>.2, ... keeping at most MaxBackups of them. The file is opened for
+// each write, so no file descriptor is held between writes.
+type RotatingFile struct {
+	Path       string
+	MaxSize    int64
+	MaxBackups int
+
+	mutex sync.Mutex
+}
+
+// NewRotatingFile returns a RotatingFile for the given path. A maxSize of 0
+// disables rotation.
+func NewRotatingFile(path string, maxSize int64, maxBackups int) *RotatingFile {
+	return &RotatingFile{
+		Path:       path,
+		MaxSize:    maxSize,
+		MaxBackups: maxBackups,
+		mutex:      sync.Mutex{},
+	}
+}
+
+// sharedRotatingFiles are the rotating files returned by SharedRotatingFile,
+// by absolute path
+var sharedRotatingFiles = struct {
+	sync.Mutex
+	files map[string]*RotatingFile
+}{files: map[string]*RotatingFile{}}
+
+// SharedRotatingFile returns the RotatingFile of the path, creating it the
+// first time, so that reconfiguring a hook keeps writing through the same
+// file instead of rotating it from two writers. The limits of an existing
+// file are updated.
+func SharedRotatingFile(path string, maxSize int64, maxBackups int) *RotatingFile {
+	key, err := filepath.Abs(path)
+	if err != nil {
+		key = path
+	}
+
+	sharedRotatingFiles.Lock()
+	defer sharedRotatingFiles.Unlock()
+
+	rf, ok := sharedRotatingFiles.files[key]
+	if !ok {
+		rf = NewRotatingFile(path, maxSize, maxBackups)
+		sharedRotatingFiles.files[key] = rf
+		return rf
+	}
+
+	rf.mutex.Lock()
+	rf.MaxSize = maxSize
+	rf.MaxBackups = maxBackups
+	rf.mutex.Unlock()
+
+	return rf
+}
+
+// Write appends p to the file, rotating it first if needed
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.mutex.Lock()
+	defer rf.mutex.Unlock()
+
+	if rf.MaxSize > 0 {
+		if info, err := os.Stat(rf.Path); err == nil && info.Size() > 0 && info.Size()+int64(len(p)) > rf.MaxSize {
+			if err := rf.rotate(); err != nil {
+				return 0, fmt.Errorf("failed to rotate %s: %v", rf.Path, err)
+			}
+		}
+	}
+
+	f, err := os.OpenFile(rf.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return f.Write(p)
+}
+
+// rotate shifts the backups by one and moves the current file to <path>.1
+func (rf *RotatingFile) rotate() error {
+	if rf.MaxBackups <= 0 {
+		return os.Remove(rf.Path)
+	}
+
+	os.Remove(rf.backupName(rf.MaxBackups))
+	for i := rf.MaxBackups - 1; i >= 1; i-- {
+		if err := os.Rename(rf.backupName(i), rf.backupName(i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.Rename(rf.Path, rf.backupName(1))
+}
+
+func (rf *RotatingFile) backupName(n int) string {
+	return fmt.Sprintf("%s.%d", rf.Path, n)
+}
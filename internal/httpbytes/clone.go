@@ -2,6 +2,7 @@ package httpbytes
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
@@ -47,6 +48,82 @@ func (b *BodyWrapper) Reset() {
 	b.reader.Seek(0, io.SeekStart)
 }
 
+// Len returns the size of the body
+func (b *BodyWrapper) Len() int {
+	return len(b.data)
+}
+
+// ReadAndRestore reads the whole body and replaces it with a BodyWrapper of
+// the bytes read, so that it can be read again. A nil body gives nil.
+func ReadAndRestore(body *io.ReadCloser) ([]byte, error) {
+	if *body == nil || *body == http.NoBody {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(*body)
+	(*body).Close()
+	*body = NewBodyWrapper(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+
+	return data, nil
+}
+
+// ReadBody reads and closes a body that is not read again, e.g. because it
+// is replaced. A nil body gives nil.
+func ReadBody(body io.ReadCloser) ([]byte, error) {
+	if body == nil {
+		return nil, nil
+	}
+
+	data, err := io.ReadAll(body)
+	body.Close()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read body: %v", err)
+	}
+
+	return data, nil
+}
+
+// Truncate returns the first max bytes of b
+func Truncate(b []byte, max int) []byte {
+	if len(b) > max {
+		return b[:max]
+	}
+	return b
+}
+
+// CloneRequestHead creates a copy of an HTTP request without its body. The
+// content length is kept.
+func CloneRequestHead(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+
+	r.Header = make(http.Header)
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Body = http.NoBody
+
+	return r
+}
+
+// CloneResponseHead creates a copy of an HTTP response without its body. The
+// content length is kept.
+func CloneResponseHead(resp *http.Response) *http.Response {
+	r := new(http.Response)
+	*r = *resp
+
+	r.Header = make(http.Header)
+	for k, v := range resp.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	r.Body = http.NoBody
+
+	return r
+}
+
 // CloneRequest creates a deep copy of an HTTP request
 func CloneRequest(req *http.Request) *http.Request {
 	r := new(http.Request)
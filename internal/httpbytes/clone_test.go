@@ -53,3 +53,26 @@ func TestCloneRequest(t *testing.T) {
 		t.Errorf("Original body should be preserved, got %s", string(origBody))
 	}
 }
+
+// TestReadAndRestore tests that a body can be read again after reading it
+func TestReadAndRestore(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://example.com", strings.NewReader("body"))
+
+	data, err := ReadAndRestore(&req.Body)
+	if err != nil || string(data) != "body" {
+		t.Fatalf("ReadAndRestore() = %q, %v, want body", data, err)
+	}
+	again, _ := io.ReadAll(req.Body)
+	if string(again) != "body" {
+		t.Errorf("body after ReadAndRestore() = %q, want body", again)
+	}
+
+	req.Body = nil
+	if data, err := ReadAndRestore(&req.Body); data != nil || err != nil || req.Body != nil {
+		t.Errorf("ReadAndRestore() of a nil body = %q, %v", data, err)
+	}
+
+	if got := string(Truncate([]byte("abcdef"), 3)); got != "abc" {
+		t.Errorf("Truncate() = %q, want abc", got)
+	}
+}
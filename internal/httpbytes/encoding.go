@@ -0,0 +1,249 @@
+package httpbytes
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// SupportedEncodings are the content codings that can be decoded and encoded
+var SupportedEncodings = []string{"gzip", "x-gzip", "deflate", "br", "zstd", "identity"}
+
+// maxDecodedSize limits the size of decoded bodies to protect against
+// compression bombs
+const maxDecodedSize = 256 * 1024 * 1024
+
+// parseEncodings splits a Content-Encoding header into its codings in the
+// order they were applied
+func parseEncodings(contentEncoding string) []string {
+	encodings := []string{}
+	for _, e := range strings.Split(contentEncoding, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			encodings = append(encodings, e)
+		}
+	}
+	return encodings
+}
+
+// IsSupportedEncoding reports whether all the codings of a Content-Encoding
+// header are supported
+func IsSupportedEncoding(contentEncoding string) bool {
+	for _, e := range parseEncodings(contentEncoding) {
+		if !slices.Contains(SupportedEncodings, e) {
+			return false
+		}
+	}
+	return true
+}
+
+// DecodeBody decodes data encoded with the codings of a Content-Encoding
+// header, which are undone in reverse order
+func DecodeBody(data []byte, contentEncoding string) ([]byte, error) {
+	encodings := parseEncodings(contentEncoding)
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var r io.Reader
+		var err error
+
+		switch encodings[i] {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			r, err = gzip.NewReader(bytes.NewReader(data))
+		case "deflate":
+			// deflate should be zlib wrapped, but some servers send raw
+			// deflate data
+			r, err = zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				r, err = flate.NewReader(bytes.NewReader(data)), nil
+			}
+		case "br":
+			r = brotli.NewReader(bytes.NewReader(data))
+		case "zstd":
+			var d *zstd.Decoder
+			d, err = zstd.NewReader(bytes.NewReader(data))
+			if err == nil {
+				defer d.Close()
+				r = d
+			}
+		default:
+			return nil, fmt.Errorf("unsupported content encoding '%s'", encodings[i])
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s data: %v", encodings[i], err)
+		}
+
+		decoded, err := io.ReadAll(io.LimitReader(r, maxDecodedSize+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s data: %v", encodings[i], err)
+		}
+		if len(decoded) > maxDecodedSize {
+			return nil, fmt.Errorf("decoded %s data is larger than %d bytes", encodings[i], maxDecodedSize)
+		}
+		data = decoded
+	}
+
+	return data, nil
+}
+
+// EncodeBody encodes data with the codings of a Content-Encoding header, in
+// order
+func EncodeBody(data []byte, contentEncoding string) ([]byte, error) {
+	for _, e := range parseEncodings(contentEncoding) {
+		buf := &bytes.Buffer{}
+		var w io.WriteCloser
+		var err error
+
+		switch e {
+		case "identity":
+			continue
+		case "gzip", "x-gzip":
+			w = gzip.NewWriter(buf)
+		case "deflate":
+			w = zlib.NewWriter(buf)
+		case "br":
+			w = brotli.NewWriter(buf)
+		case "zstd":
+			w, err = zstd.NewWriter(buf)
+		default:
+			return nil, fmt.Errorf("unsupported content encoding '%s'", e)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		data = buf.Bytes()
+	}
+
+	return data, nil
+}
+
+// message is the body and the headers describing it of a request or a
+// response
+type message struct {
+	body             *io.ReadCloser
+	header           http.Header
+	contentLength    *int64
+	transferEncoding *[]string
+}
+
+func requestMessage(req *http.Request) message {
+	return message{&req.Body, req.Header, &req.ContentLength, &req.TransferEncoding}
+}
+
+func responseMessage(resp *http.Response) message {
+	return message{&resp.Body, resp.Header, &resp.ContentLength, &resp.TransferEncoding}
+}
+
+// DecodeResponse replaces the compressed body of a response with the
+// decoded one, removing the Content-Encoding header and updating the
+// Content-Length. It returns the removed Content-Encoding, which is empty if
+// the body was not compressed or used an unsupported encoding.
+func DecodeResponse(resp *http.Response) (string, error) {
+	return decode(responseMessage(resp))
+}
+
+// DecodeRequest replaces the compressed body of a request with the decoded
+// one, as DecodeResponse
+func DecodeRequest(req *http.Request) (string, error) {
+	return decode(requestMessage(req))
+}
+
+func decode(m message) (string, error) {
+	contentEncoding := m.header.Get("Content-Encoding")
+	if contentEncoding == "" || *m.body == nil || !IsSupportedEncoding(contentEncoding) {
+		return "", nil
+	}
+
+	data, err := io.ReadAll(*m.body)
+	(*m.body).Close()
+	if err != nil {
+		*m.body = NewBodyWrapper(data)
+		return "", err
+	}
+
+	// bodies of HEAD requests and 304 responses are empty
+	if len(data) == 0 {
+		*m.body = NewBodyWrapper(data)
+		return "", nil
+	}
+
+	decoded, err := DecodeBody(data, contentEncoding)
+	if err != nil {
+		*m.body = NewBodyWrapper(data)
+		return "", err
+	}
+
+	*m.body = NewBodyWrapper(decoded)
+	m.header.Del("Content-Encoding")
+	m.setContentLength(int64(len(decoded)))
+	return contentEncoding, nil
+}
+
+// EncodeResponse compresses the body of a response with the codings of a
+// Content-Encoding header and updates its headers
+func EncodeResponse(resp *http.Response, contentEncoding string) error {
+	return encode(responseMessage(resp), contentEncoding)
+}
+
+// EncodeRequest compresses the body of a request, as EncodeResponse
+func EncodeRequest(req *http.Request, contentEncoding string) error {
+	return encode(requestMessage(req), contentEncoding)
+}
+
+func encode(m message, contentEncoding string) error {
+	var data []byte
+	if *m.body != nil {
+		var err error
+		data, err = io.ReadAll(*m.body)
+		(*m.body).Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	encoded, err := EncodeBody(data, contentEncoding)
+	if err != nil {
+		*m.body = NewBodyWrapper(data)
+		return err
+	}
+
+	*m.body = NewBodyWrapper(encoded)
+	m.header.Set("Content-Encoding", contentEncoding)
+	m.setContentLength(int64(len(encoded)))
+	return nil
+}
+
+// SetContentLength sets the Content-Length of a response and removes its
+// chunked transfer encoding
+func SetContentLength(resp *http.Response, length int64) {
+	responseMessage(resp).setContentLength(length)
+}
+
+// SetRequestContentLength sets the Content-Length of a request and removes
+// its chunked transfer encoding
+func SetRequestContentLength(req *http.Request, length int64) {
+	requestMessage(req).setContentLength(length)
+}
+
+func (m message) setContentLength(length int64) {
+	*m.contentLength = length
+	*m.transferEncoding = nil
+	m.header.Del("Transfer-Encoding")
+	m.header.Set("Content-Length", strconv.FormatInt(length, 10))
+}
@@ -0,0 +1,130 @@
+package httpbytes
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestEncodeDecodeBody tests that bodies encoded with each supported coding
+// are decoded back
+func TestEncodeDecodeBody(t *testing.T) {
+	data := []byte(strings.Repeat("efin proxy body ", 100))
+
+	for _, enc := range []string{"gzip", "x-gzip", "deflate", "br", "zstd", "identity", "gzip, br"} {
+		t.Run(enc, func(t *testing.T) {
+			encoded, err := EncodeBody(data, enc)
+			if err != nil {
+				t.Fatalf("Failed to encode body: %v", err)
+			}
+			if enc != "identity" && bytes.Equal(encoded, data) {
+				t.Errorf("Expected encoded body to differ from the original")
+			}
+
+			decoded, err := DecodeBody(encoded, enc)
+			if err != nil {
+				t.Fatalf("Failed to decode body: %v", err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Errorf("Expected decoded body %q, got %q", data, decoded)
+			}
+		})
+	}
+
+	if _, err := DecodeBody(data, "compress"); err == nil {
+		t.Error("Expected error decoding unsupported encoding, got nil")
+	}
+	if _, err := DecodeBody(data, "gzip"); err == nil {
+		t.Error("Expected error decoding invalid gzip data, got nil")
+	}
+}
+
+// TestDecodeResponse tests that compressed response bodies are replaced with
+// the decoded ones
+func TestDecodeResponse(t *testing.T) {
+	encoded, err := EncodeBody([]byte("hello"), "gzip")
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+
+	resp := &http.Response{
+		StatusCode:       200,
+		Header:           http.Header{"Content-Encoding": {"gzip"}},
+		Body:             io.NopCloser(bytes.NewReader(encoded)),
+		ContentLength:    -1,
+		TransferEncoding: []string{"chunked"},
+	}
+
+	enc, err := DecodeResponse(resp)
+	if err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if enc != "gzip" {
+		t.Errorf("Expected encoding 'gzip', got %q", enc)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if string(body) != "hello" {
+		t.Errorf("Expected body 'hello', got %q", body)
+	}
+	if resp.Header.Get("Content-Encoding") != "" {
+		t.Errorf("Expected Content-Encoding to be removed, got %q", resp.Header.Get("Content-Encoding"))
+	}
+	if resp.ContentLength != 5 || resp.Header.Get("Content-Length") != "5" {
+		t.Errorf("Expected Content-Length 5, got %d (header %q)", resp.ContentLength, resp.Header.Get("Content-Length"))
+	}
+	if resp.TransferEncoding != nil {
+		t.Errorf("Expected Transfer-Encoding to be removed, got %v", resp.TransferEncoding)
+	}
+
+	// unsupported encodings are left untouched
+	resp = &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Encoding": {"compress"}},
+		Body:       io.NopCloser(strings.NewReader("data")),
+	}
+	enc, err = DecodeResponse(resp)
+	if err != nil || enc != "" {
+		t.Errorf("Expected unsupported encoding to be skipped, got %q, %v", enc, err)
+	}
+	if resp.Header.Get("Content-Encoding") != "compress" {
+		t.Errorf("Expected Content-Encoding 'compress', got %q", resp.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestDecodeEncodeRequest(t *testing.T) {
+	encoded, err := EncodeBody([]byte("a=1"), "gzip")
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+
+	req := httptest.NewRequest("POST", "http://example.com/", bytes.NewReader(encoded))
+	req.Header.Set("Content-Encoding", "gzip")
+
+	enc, err := DecodeRequest(req)
+	if err != nil || enc != "gzip" {
+		t.Fatalf("DecodeRequest() = %q, %v, want gzip", enc, err)
+	}
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != "a=1" {
+		t.Errorf("Expected body 'a=1', got %q", body)
+	}
+	if req.Header.Get("Content-Encoding") != "" || req.ContentLength != 3 {
+		t.Errorf("Expected no Content-Encoding and length 3, got %q and %d", req.Header.Get("Content-Encoding"), req.ContentLength)
+	}
+
+	req.Body = NewBodyWrapper([]byte("a=2"))
+	if err := EncodeRequest(req, "gzip"); err != nil {
+		t.Fatalf("EncodeRequest() error = %v", err)
+	}
+	body, _ = io.ReadAll(req.Body)
+	decoded, err := DecodeBody(body, "gzip")
+	if err != nil || string(decoded) != "a=2" {
+		t.Errorf("Expected encoded 'a=2', got %q, %v", decoded, err)
+	}
+	if req.Header.Get("Content-Encoding") != "gzip" || req.ContentLength != int64(len(body)) {
+		t.Errorf("Expected Content-Encoding gzip and length %d, got %q and %d", len(body), req.Header.Get("Content-Encoding"), req.ContentLength)
+	}
+}
@@ -0,0 +1,345 @@
+package httpbytes
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Header is a header line with the name as it was received
+type Header struct {
+	Name  string
+	Value string
+}
+
+// Wire holds the details of a message as it was received that are lost when
+// it is parsed into an http.Request or http.Response: the raw request or
+// status line, the protocol version, and the order and casing of the headers
+type Wire struct {
+	FirstLine string
+	Proto     string
+	Headers   []Header
+}
+
+type requestWireKeyType struct{}
+type responseWireKeyType struct{}
+
+var (
+	requestWireKey  = requestWireKeyType{}
+	responseWireKey = responseWireKeyType{}
+)
+
+// SetRequestWire returns a copy of req that carries the wire details,
+// which are kept by clones of the request
+func SetRequestWire(req *http.Request, w *Wire) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), requestWireKey, w))
+}
+
+// RequestWire returns the wire details of a request, or nil if unknown
+func RequestWire(req *http.Request) *Wire {
+	w, _ := req.Context().Value(requestWireKey).(*Wire)
+	return w
+}
+
+// SetResponseWire sets the wire details of a response. They are kept in the
+// context of its request, as the request ID is.
+func SetResponseWire(resp *http.Response, w *Wire) {
+	req := resp.Request
+	if req == nil {
+		req = new(http.Request)
+	}
+	resp.Request = req.WithContext(context.WithValue(req.Context(), responseWireKey, w))
+}
+
+// ResponseWire returns the wire details of a response, or nil if unknown
+func ResponseWire(resp *http.Response) *Wire {
+	if resp.Request == nil {
+		return nil
+	}
+	w, _ := resp.Request.Context().Value(responseWireKey).(*Wire)
+	return w
+}
+
+// ParseHead parses the request or status line and the headers of a message
+// head. It returns nil if the head is malformed.
+func ParseHead(head []byte) *Wire {
+	lines := strings.Split(strings.TrimRight(string(head), "\r\n"), "\n")
+	for i := range lines {
+		lines[i] = strings.TrimSuffix(lines[i], "\r")
+	}
+	if len(lines) == 0 || lines[0] == "" {
+		return nil
+	}
+
+	w := &Wire{FirstLine: lines[0], Headers: []Header{}}
+	fields := strings.Fields(lines[0])
+	if len(fields) < 2 {
+		return nil
+	}
+	if strings.HasPrefix(fields[0], "HTTP/") {
+		w.Proto = fields[0]
+	} else if len(fields) == 3 {
+		w.Proto = fields[2]
+	} else {
+		return nil
+	}
+
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+
+		// obsolete line folding continues the previous value
+		if line[0] == ' ' || line[0] == '\t' {
+			if len(w.Headers) == 0 {
+				return nil
+			}
+			last := &w.Headers[len(w.Headers)-1]
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" || strings.ContainsAny(name, " \t") {
+			return nil
+		}
+		w.Headers = append(w.Headers, Header{Name: name, Value: strings.TrimSpace(value)})
+	}
+
+	return w
+}
+
+// Values returns the values of the headers with the name, in any casing
+func (w *Wire) Values(name string) []string {
+	values := []string{}
+	for _, h := range w.Headers {
+		if strings.EqualFold(h.Name, name) {
+			values = append(values, h.Value)
+		}
+	}
+	return values
+}
+
+// OrderHeaders sorts headers as the wire headers, using their names. The
+// values of each header name are assigned in order to the wire positions of
+// that name, so changed values keep their position; headers not in wire are
+// added at the end.
+func OrderHeaders(headers []Header, wire []Header) []Header {
+	byName := map[string][]Header{}
+	for _, h := range headers {
+		key := textproto.CanonicalMIMEHeaderKey(h.Name)
+		byName[key] = append(byName[key], h)
+	}
+
+	ordered := make([]Header, 0, len(headers))
+	for _, wh := range wire {
+		key := textproto.CanonicalMIMEHeaderKey(wh.Name)
+		if len(byName[key]) == 0 {
+			continue
+		}
+		ordered = append(ordered, Header{Name: wh.Name, Value: byName[key][0].Value})
+		byName[key] = byName[key][1:]
+	}
+
+	for _, h := range headers {
+		key := textproto.CanonicalMIMEHeaderKey(h.Name)
+		if len(byName[key]) == 0 {
+			continue
+		}
+		ordered = append(ordered, byName[key][0])
+		byName[key] = byName[key][1:]
+	}
+
+	return ordered
+}
+
+// sortedHeaders returns the headers of h sorted by name
+func sortedHeaders(h http.Header) []Header {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	headers := []Header{}
+	for _, name := range names {
+		for _, v := range h[name] {
+			headers = append(headers, Header{Name: name, Value: v})
+		}
+	}
+	return headers
+}
+
+// RequestHeaders returns the headers of a request, including Host, in the
+// order and casing they were received with
+func RequestHeaders(req *http.Request) []Header {
+	headers := sortedHeaders(req.Header)
+	if req.Host != "" && req.Header.Get("Host") == "" {
+		headers = append([]Header{{Name: "Host", Value: req.Host}}, headers...)
+	}
+
+	if w := RequestWire(req); w != nil {
+		return OrderHeaders(headers, w.Headers)
+	}
+	return headers
+}
+
+// ResponseHeaders returns the headers of a response in the order and casing
+// they were received with
+func ResponseHeaders(resp *http.Response) []Header {
+	headers := sortedHeaders(resp.Header)
+	if w := ResponseWire(resp); w != nil {
+		return OrderHeaders(headers, w.Headers)
+	}
+	return headers
+}
+
+// RequestLine returns the request line of a request, which is the one it
+// was received with if its method and target did not change
+func RequestLine(req *http.Request) string {
+	line := fmt.Sprintf("%s %s %s", req.Method, req.URL.RequestURI(), req.Proto)
+	if w := RequestWire(req); w != nil {
+		// absolute targets are compared with their host
+		target := line
+		if req.URL.IsAbs() {
+			target = fmt.Sprintf("%s %s %s", req.Method, req.URL.String(), req.Proto)
+		}
+		if _, ok := w.requestLine(target); ok {
+			return w.FirstLine
+		}
+	}
+	return line
+}
+
+// StatusLine returns the status line of a response, which is the one it was
+// received with if its status code did not change
+func StatusLine(resp *http.Response) string {
+	line := fmt.Sprintf("%s %d %s", resp.Proto, resp.StatusCode, http.StatusText(resp.StatusCode))
+	if w := ResponseWire(resp); w != nil {
+		if l, ok := w.statusLine(line); ok {
+			return l
+		}
+	}
+	return line
+}
+
+// requestLine returns the wire request line with the target in the form of
+// the one of line, if both have the same method and target
+func (w *Wire) requestLine(line string) (string, bool) {
+	wireFields := strings.Split(w.FirstLine, " ")
+	fields := strings.Split(line, " ")
+	if len(wireFields) != 3 || len(fields) != 3 || wireFields[0] != fields[0] {
+		return "", false
+	}
+
+	target := wireFields[1]
+	if !sameTarget(target, fields[1]) {
+		return "", false
+	}
+	if strings.HasPrefix(fields[1], "/") {
+		target = originForm(target)
+	} else if strings.HasPrefix(target, "/") {
+		target = fields[1]
+	}
+
+	return wireFields[0] + " " + target + " " + wireFields[2], true
+}
+
+// statusLine returns the wire status line if line has the same status code
+func (w *Wire) statusLine(line string) (string, bool) {
+	wireFields := strings.SplitN(w.FirstLine, " ", 3)
+	fields := strings.SplitN(line, " ", 3)
+	if len(wireFields) < 2 || len(fields) < 2 || wireFields[1] != fields[1] {
+		return "", false
+	}
+	return w.FirstLine, true
+}
+
+// sameTarget reports whether two request targets refer to the same
+// resource. Hosts are only compared if both targets are absolute.
+func sameTarget(a, b string) bool {
+	if a == b {
+		return true
+	}
+
+	ua, err := url.ParseRequestURI(a)
+	if err != nil {
+		return false
+	}
+	ub, err := url.ParseRequestURI(b)
+	if err != nil {
+		return false
+	}
+
+	if ua.Host != "" && ub.Host != "" && !strings.EqualFold(ua.Host, ub.Host) {
+		return false
+	}
+	return ua.RequestURI() == ub.RequestURI()
+}
+
+// originForm returns the path and query of an absolute request target
+func originForm(target string) string {
+	_, rest, ok := strings.Cut(target, "://")
+	if !ok {
+		return target
+	}
+	if i := strings.Index(rest, "/"); i >= 0 {
+		return rest[i:]
+	}
+	if i := strings.Index(rest, "?"); i >= 0 {
+		return "/" + rest[i:]
+	}
+	return "/"
+}
+
+// RewriteHead rewrites a head written by net/http with the first line and
+// the header order and casing of wire. Headers added or changed since the
+// message was received are kept.
+func RewriteHead(head []byte, wire *Wire) []byte {
+	written := ParseHead(head)
+	if written == nil || wire == nil {
+		return head
+	}
+
+	firstLine := written.FirstLine
+	if strings.HasPrefix(firstLine, "HTTP/") {
+		if l, ok := wire.statusLine(firstLine); ok {
+			firstLine = l
+		}
+	} else if l, ok := wire.requestLine(firstLine); ok {
+		firstLine = l
+	}
+
+	buf := bytes.Buffer{}
+	buf.WriteString(firstLine + "\r\n")
+	for _, h := range OrderHeaders(written.Headers, wire.Headers) {
+		buf.WriteString(h.Name + ": " + h.Value + "\r\n")
+	}
+	buf.WriteString("\r\n")
+
+	return buf.Bytes()
+}
+
+// requestBodyLength returns the length of the body of a request with the
+// head w. It returns false if the body is chunked or the length is invalid.
+func requestBodyLength(w *Wire) (int64, bool) {
+	if len(w.Values("Transfer-Encoding")) > 0 {
+		return 0, false
+	}
+
+	length := int64(0)
+	for i, v := range w.Values("Content-Length") {
+		n, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || n < 0 || (i > 0 && n != length) {
+			return 0, false
+		}
+		length = n
+	}
+	return length, true
+}
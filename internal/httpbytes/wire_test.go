@@ -0,0 +1,160 @@
+package httpbytes
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// TestParseHead tests parsing request and response heads
+func TestParseHead(t *testing.T) {
+	w := ParseHead([]byte("GET /a?b=%41 HTTP/1.0\r\nhost: example.com\r\nX-Folded: a\r\n  b\r\nAccept: */*\r\n\r\n"))
+	if w == nil {
+		t.Fatal("Expected request head to be parsed, got nil")
+	}
+	if w.FirstLine != "GET /a?b=%41 HTTP/1.0" || w.Proto != "HTTP/1.0" {
+		t.Errorf("Unexpected first line %q or proto %q", w.FirstLine, w.Proto)
+	}
+	expected := []Header{{"host", "example.com"}, {"X-Folded", "a b"}, {"Accept", "*/*"}}
+	if !reflect.DeepEqual(w.Headers, expected) {
+		t.Errorf("Expected headers %v, got %v", expected, w.Headers)
+	}
+
+	w = ParseHead([]byte("HTTP/1.1 200 Fine\nset-cookie: a=1\n\n"))
+	if w == nil || w.Proto != "HTTP/1.1" || w.FirstLine != "HTTP/1.1 200 Fine" {
+		t.Fatalf("Unexpected response head %+v", w)
+	}
+
+	if ParseHead([]byte("GET / HTTP/1.1\r\nInvalid Header\r\n\r\n")) != nil {
+		t.Error("Expected nil for a malformed head")
+	}
+}
+
+// TestOrderHeaders tests that headers follow the wire order and casing
+func TestOrderHeaders(t *testing.T) {
+	wire := []Header{{"x-b", "1"}, {"Cookie", "a=1"}, {"X-A", "2"}, {"x-b", "3"}}
+	headers := []Header{
+		{"Content-Length", "5"},
+		{"Cookie", "a=2"},
+		{"X-A", "2"},
+		{"X-B", "1"},
+		{"X-B", "3"},
+	}
+
+	expected := []Header{{"x-b", "1"}, {"Cookie", "a=2"}, {"X-A", "2"}, {"x-b", "3"}, {"Content-Length", "5"}}
+	if got := OrderHeaders(headers, wire); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+// TestRequestLine tests that the raw request line is used while the method
+// and target do not change
+func TestRequestLine(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://example.com/a%2fb?c=%41", nil)
+	req = SetRequestWire(req, &Wire{FirstLine: "GET http://example.com/a%2fb?c=%41 HTTP/1.1", Proto: "HTTP/1.1"})
+
+	if line := RequestLine(req); line != "GET http://example.com/a%2fb?c=%41 HTTP/1.1" {
+		t.Errorf("Expected the raw request line, got %q", line)
+	}
+
+	req.URL.Host = "other.com"
+	if line := RequestLine(req); line != "GET /a%2fb?c=%41 HTTP/1.1" {
+		t.Errorf("Expected a new request line after changing the host, got %q", line)
+	}
+
+	req.Method = "POST"
+	if line := RequestLine(req); !strings.HasPrefix(line, "POST ") {
+		t.Errorf("Expected a new request line after changing the method, got %q", line)
+	}
+}
+
+// TestRewriteHead tests rewriting heads written by net/http
+func TestRewriteHead(t *testing.T) {
+	wire := ParseHead([]byte("GET http://example.com/p?q HTTP/1.0\r\nhost: example.com\r\nx-custom: 1\r\nAccept: */*\r\n\r\n"))
+	head := "GET /p?q HTTP/1.1\r\nHost: example.com\r\nUser-Agent: Go-http-client/1.1\r\nAccept: */*\r\nX-Custom: 1\r\n\r\n"
+
+	expected := "GET /p?q HTTP/1.0\r\nhost: example.com\r\nx-custom: 1\r\nAccept: */*\r\nUser-Agent: Go-http-client/1.1\r\n\r\n"
+	if got := string(RewriteHead([]byte(head), wire)); got != expected {
+		t.Errorf("Expected head %q, got %q", expected, got)
+	}
+
+	resp := ParseHead([]byte("HTTP/1.1 200 Fine\r\nx-b: 1\r\nX-A: 2\r\n\r\n"))
+	expected = "HTTP/1.1 200 Fine\r\nx-b: 1\r\nX-A: 2\r\nContent-Length: 0\r\n\r\n"
+	got := string(RewriteHead([]byte("HTTP/1.1 200 OK\r\nContent-Length: 0\r\nX-A: 2\r\nX-B: 1\r\n\r\n"), resp))
+	if got != expected {
+		t.Errorf("Expected head %q, got %q", expected, got)
+	}
+}
+
+// TestWireConn tests recording the heads of requests and responses and
+// rewriting the heads written
+func TestWireConn(t *testing.T) {
+	clientSide, serverSide := net.Pipe()
+	defer clientSide.Close()
+	defer serverSide.Close()
+
+	server := NewWireConn(serverSide, true)
+	go func() {
+		io.WriteString(clientSide, "POST /a HTTP/1.1\r\nhost: x\r\ncontent-length: 20\r\n\r\nGET /fake HTTP/1.1\r\n")
+		io.WriteString(clientSide, "GET /b HTTP/1.1\r\nHost: x\r\nx-b: 1\r\n\r\n")
+	}()
+
+	reader := bufio.NewReader(server)
+	for _, path := range []string{"/a", "/b"} {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			t.Fatalf("Failed to read request: %v", err)
+		}
+		io.Copy(io.Discard, req.Body)
+
+		w := server.NextHead()
+		if w == nil || w.FirstLine != req.Method+" "+path+" HTTP/1.1" {
+			t.Fatalf("Expected the head of %s, got %+v", path, w)
+		}
+	}
+
+	// responses are recorded after ExpectHead and requests are rewritten
+	upstream, remote := net.Pipe()
+	defer upstream.Close()
+	defer remote.Close()
+
+	client := NewWireConn(upstream, false)
+	client.RewriteHead(ParseHead([]byte("GET /c HTTP/1.1\r\nx-first: 1\r\nhost: y\r\n\r\n")))
+	client.ExpectHead()
+
+	written := make(chan string)
+	go func() {
+		r := bufio.NewReader(remote)
+		head := ""
+		for !strings.HasSuffix(head, "\r\n\r\n") {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			head += line
+		}
+		written <- head
+		io.WriteString(remote, "HTTP/1.1 100 Continue\r\n\r\nHTTP/1.1 200 Fine\r\nx-z: 1\r\nContent-Length: 0\r\n\r\n")
+		remote.Close()
+	}()
+
+	req, _ := http.NewRequest("GET", "http://y/c", nil)
+	req.Header.Set("X-First", "1")
+	go req.Write(client)
+
+	expected := "GET /c HTTP/1.1\r\nx-first: 1\r\nhost: y\r\nUser-Agent: Go-http-client/1.1\r\n\r\n"
+	if got := <-written; got != expected {
+		t.Errorf("Expected request %q, got %q", expected, got)
+	}
+
+	io.ReadAll(client)
+	w := client.NextHead()
+	if w == nil || w.FirstLine != "HTTP/1.1 200 Fine" || w.Headers[0].Name != "x-z" {
+		t.Errorf("Expected the head of the final response, got %+v", w)
+	}
+}
@@ -0,0 +1,222 @@
+package httpbytes
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"sync"
+)
+
+// maxHeadSize is the size of the largest head recorded by a WireConn, as
+// the default limit of net/http servers
+const maxHeadSize = 1 << 20
+
+// WireConn is a connection that records the wire details of the messages
+// read from it, and can rewrite the head of the next message written to it
+// with the details of the original message.
+//
+// Server connections read requests: every head is recorded and the bodies
+// are skipped, which is not possible for chunked bodies, so recording stops
+// after a chunked request. Client connections read responses: only the head
+// of the response that follows a call to ExpectHead is recorded.
+type WireConn struct {
+	net.Conn
+
+	server bool
+
+	readMutex sync.Mutex
+	recording bool
+	head      []byte
+	skip      int64
+	heads     []*Wire
+
+	writeMutex sync.Mutex
+	rewrite    *Wire
+	out        []byte
+}
+
+// NewWireConn returns a WireConn that reads requests if server is true, and
+// responses otherwise
+func NewWireConn(conn net.Conn, server bool) *WireConn {
+	return &WireConn{Conn: conn, server: server, recording: server}
+}
+
+// Read reads from the connection and records the heads read
+func (c *WireConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	if n > 0 {
+		c.readMutex.Lock()
+		c.record(b[:n])
+		c.readMutex.Unlock()
+	}
+	return n, err
+}
+
+func (c *WireConn) record(data []byte) {
+	for len(data) > 0 {
+		if c.skip > 0 {
+			n := min(int64(len(data)), c.skip)
+			c.skip -= n
+			data = data[n:]
+			continue
+		}
+		if !c.recording {
+			return
+		}
+
+		// blank lines before a message are ignored
+		if len(c.head) == 0 {
+			data = bytes.TrimLeft(data, "\r\n")
+			if len(data) == 0 {
+				return
+			}
+		}
+
+		start := max(0, len(c.head)-3)
+		c.head = append(c.head, data...)
+		end := headEnd(c.head[start:])
+		if end < 0 {
+			if len(c.head) > maxHeadSize {
+				c.stop()
+			}
+			return
+		}
+		end += start
+
+		data = data[len(data)-(len(c.head)-end):]
+		c.finishHead(ParseHead(c.head[:end]))
+		c.head = nil
+	}
+}
+
+func (c *WireConn) finishHead(w *Wire) {
+	if !c.server {
+		// interim responses are followed by the final one
+		if w != nil && isInterim(w) {
+			return
+		}
+		c.heads = []*Wire{w}
+		c.recording = false
+		return
+	}
+
+	c.heads = append(c.heads, w)
+	if w == nil {
+		c.stop()
+		return
+	}
+
+	length, ok := requestBodyLength(w)
+	if !ok {
+		c.stop()
+		return
+	}
+	c.skip = length
+}
+
+// stop stops recording heads. Server connections add an empty head so that
+// the head of the message being read is not taken from a later one.
+func (c *WireConn) stop() {
+	if c.server && c.recording {
+		c.heads = append(c.heads, nil)
+	}
+	c.recording = false
+	c.head = nil
+}
+
+// StopRecording stops recording the heads read, e.g. when the connection
+// is hijacked to tunnel other data
+func (c *WireConn) StopRecording() {
+	c.readMutex.Lock()
+	c.recording = false
+	c.head = nil
+	c.skip = 0
+	c.readMutex.Unlock()
+}
+
+// ExpectHead starts recording the head of the next response read from a
+// client connection
+func (c *WireConn) ExpectHead() {
+	c.readMutex.Lock()
+	c.recording = true
+	c.head = nil
+	c.heads = nil
+	c.readMutex.Unlock()
+}
+
+// NextHead returns the oldest head read and not returned yet, or nil if
+// there is none or it was not recorded
+func (c *WireConn) NextHead() *Wire {
+	c.readMutex.Lock()
+	defer c.readMutex.Unlock()
+
+	if len(c.heads) == 0 {
+		return nil
+	}
+	w := c.heads[0]
+	c.heads = c.heads[1:]
+	return w
+}
+
+// RewriteHead makes the next head written to the connection be rewritten
+// with the first line, header order and casing of wire
+func (c *WireConn) RewriteHead(wire *Wire) {
+	c.writeMutex.Lock()
+	c.rewrite = wire
+	c.out = nil
+	c.writeMutex.Unlock()
+}
+
+// Write writes to the connection. While a head is being rewritten, it is
+// buffered until it is complete.
+func (c *WireConn) Write(b []byte) (int, error) {
+	c.writeMutex.Lock()
+	defer c.writeMutex.Unlock()
+
+	if c.rewrite == nil {
+		return c.Conn.Write(b)
+	}
+
+	start := max(0, len(c.out)-3)
+	c.out = append(c.out, b...)
+	end := headEnd(c.out[start:])
+	if end < 0 {
+		if len(c.out) > maxHeadSize {
+			out := c.out
+			c.rewrite, c.out = nil, nil
+			if _, err := c.Conn.Write(out); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	end += start
+
+	out := append(RewriteHead(c.out[:end], c.rewrite), c.out[end:]...)
+	c.rewrite, c.out = nil, nil
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// headEnd returns the index after the blank line that ends a head, or -1 if
+// it is not complete
+func headEnd(data []byte) int {
+	crlf := bytes.Index(data, []byte("\r\n\r\n"))
+	lf := bytes.Index(data, []byte("\n\n"))
+	switch {
+	case crlf >= 0 && (lf < 0 || crlf < lf):
+		return crlf + 4
+	case lf >= 0:
+		return lf + 2
+	}
+	return -1
+}
+
+// isInterim reports whether a response head is of a 1xx response other than
+// 101 Switching Protocols, which is followed by the final response
+func isInterim(w *Wire) bool {
+	fields := strings.Fields(w.FirstLine)
+	return len(fields) >= 2 && len(fields[1]) == 3 && fields[1][0] == '1' && fields[1] != "101"
+}
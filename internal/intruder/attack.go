@@ -0,0 +1,306 @@
+package intruder
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/rawhttp"
+)
+
+// Mode defines how payloads are placed in the positions
+type Mode string
+
+// Attack modes
+const (
+	// Sniper places each payload of a single set in each position in turn,
+	// leaving the other positions with their original values
+	Sniper Mode = "sniper"
+
+	// BatteringRam places each payload of a single set in all positions
+	BatteringRam Mode = "battering-ram"
+
+	// Pitchfork uses a set per position and iterates all sets in parallel,
+	// stopping at the end of the shortest one
+	Pitchfork Mode = "pitchfork"
+
+	// ClusterBomb uses a set per position and tries all the combinations
+	ClusterBomb Mode = "cluster-bomb"
+)
+
+// DefaultConcurrency is the number of requests sent at the same time
+const DefaultConcurrency = 10
+
+// Attack sends the requests generated from a template and payload sets
+type Attack struct {
+	Template    *Template
+	Mode        Mode
+	PayloadSets [][]string
+
+	// Target is where the requests are sent
+	Target rawhttp.Options
+
+	Concurrency int
+
+	// RateLimit is the maximum number of requests per second, 0 for no limit
+	RateLimit float64
+
+	// DBFile stores the attack, its results and the flows when set
+	DBFile string
+
+	// BaseRequestID is the ID of the flow the template was created from
+	BaseRequestID string
+}
+
+// request is a request generated by an attack
+type request struct {
+	index    int
+	payloads []string
+	raw      []byte
+}
+
+// Validate checks that the payload sets match the mode and template
+func (a *Attack) Validate() error {
+	switch a.Mode {
+	case Sniper, BatteringRam:
+		if len(a.PayloadSets) != 1 {
+			return fmt.Errorf("%s attacks use exactly one payload set, got %d", a.Mode, len(a.PayloadSets))
+		}
+	case Pitchfork, ClusterBomb:
+		if len(a.PayloadSets) != a.Template.Positions() {
+			return fmt.Errorf("%s attacks use a payload set per position: got %d sets for %d positions",
+				a.Mode, len(a.PayloadSets), a.Template.Positions())
+		}
+	default:
+		return fmt.Errorf("unknown attack mode '%s'", a.Mode)
+	}
+
+	return nil
+}
+
+// Count returns the number of requests of the attack
+func (a *Attack) Count() int {
+	switch a.Mode {
+	case Sniper:
+		return len(a.PayloadSets[0]) * a.Template.Positions()
+	case BatteringRam:
+		return len(a.PayloadSets[0])
+	case Pitchfork:
+		n := len(a.PayloadSets[0])
+		for _, set := range a.PayloadSets {
+			n = min(n, len(set))
+		}
+		return n
+	case ClusterBomb:
+		n := 1
+		for _, set := range a.PayloadSets {
+			n *= len(set)
+		}
+		return n
+	}
+	return 0
+}
+
+// generate calls yield with each request of the attack until it returns false
+func (a *Attack) generate(yield func(request) bool) {
+	positions := a.Template.Positions()
+	index := 0
+
+	emit := func(payloads []string, values []string) bool {
+		r := request{index: index, payloads: payloads, raw: a.Template.Render(values)}
+		index++
+		return yield(r)
+	}
+
+	switch a.Mode {
+	case Sniper:
+		for pos := 0; pos < positions; pos++ {
+			for _, p := range a.PayloadSets[0] {
+				values := a.Template.Defaults()
+				values[pos] = p
+				if !emit([]string{p}, values) {
+					return
+				}
+			}
+		}
+
+	case BatteringRam:
+		for _, p := range a.PayloadSets[0] {
+			values := make([]string, positions)
+			for i := range values {
+				values[i] = p
+			}
+			if !emit([]string{p}, values) {
+				return
+			}
+		}
+
+	case Pitchfork:
+		for i := 0; i < a.Count(); i++ {
+			values := make([]string, positions)
+			for pos := range values {
+				values[pos] = a.PayloadSets[pos][i]
+			}
+			if !emit(values, values) {
+				return
+			}
+		}
+
+	case ClusterBomb:
+		for _, set := range a.PayloadSets {
+			if len(set) == 0 {
+				return
+			}
+		}
+
+		indexes := make([]int, positions)
+		for {
+			values := make([]string, positions)
+			for pos, i := range indexes {
+				values[pos] = a.PayloadSets[pos][i]
+			}
+			if !emit(values, values) {
+				return
+			}
+
+			// advance the last position first, like an odometer
+			pos := positions - 1
+			for ; pos >= 0; pos-- {
+				indexes[pos]++
+				if indexes[pos] < len(a.PayloadSets[pos]) {
+					break
+				}
+				indexes[pos] = 0
+			}
+			if pos < 0 {
+				return
+			}
+		}
+	}
+}
+
+// Run sends the requests of the attack and calls onResult with the result of
+// each one, which may be called concurrently. Results are stored in the
+// database if DBFile is set. The ID of the stored attack is returned.
+func (a *Attack) Run(ctx context.Context, onResult func(hooks.AttackResult)) (string, error) {
+	if err := a.Validate(); err != nil {
+		return "", err
+	}
+
+	attackID := ""
+	if a.DBFile != "" {
+		var err error
+		attackID, err = hooks.SaveAttack(a.DBFile, hooks.AttackRecord{
+			BaseRequestID: a.BaseRequestID,
+			Mode:          string(a.Mode),
+			Template:      a.Template.Bytes(),
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	concurrency := a.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultConcurrency
+	}
+
+	var ticker *time.Ticker
+	if a.RateLimit > 0 {
+		ticker = time.NewTicker(time.Duration(float64(time.Second) / a.RateLimit))
+		defer ticker.Stop()
+	}
+
+	requests := make(chan request)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := range requests {
+				result := a.send(attackID, r)
+				if onResult != nil {
+					onResult(result)
+				}
+			}
+		}()
+	}
+
+	a.generate(func(r request) bool {
+		if ticker != nil {
+			select {
+			case <-ctx.Done():
+				return false
+			case <-ticker.C:
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return false
+		case requests <- r:
+			return true
+		}
+	})
+	close(requests)
+	wg.Wait()
+
+	return attackID, ctx.Err()
+}
+
+// send sends one request and stores its result
+func (a *Attack) send(attackID string, r request) hooks.AttackResult {
+	result := hooks.AttackResult{
+		AttackID: attackID,
+		Index:    r.index,
+		Payloads: r.payloads,
+	}
+
+	start := time.Now()
+	rawResponse, err := rawhttp.Send(r.raw, a.Target)
+	result.Duration = time.Since(start)
+	result.Length = len(rawResponse)
+
+	if err != nil {
+		result.Error = err.Error()
+	} else if f, err := rawhttp.NewFlow(r.raw, rawResponse, a.Target); err != nil {
+		result.Error = err.Error()
+	} else {
+		result.StatusCode = f.Response.StatusCode
+
+		if a.DBFile != "" {
+			result.RequestID = a.store(attackID, r, f, rawResponse)
+		}
+	}
+
+	if a.DBFile != "" {
+		if err := hooks.SaveAttackResult(a.DBFile, result); err != nil {
+			log.Printf("Failed to store result of attack %s request %d: %v", attackID, r.index, err)
+		}
+	}
+
+	return result
+}
+
+// store saves the flow of a request linked to the base request and returns
+// its ID, or an empty string if it could not be stored
+func (a *Attack) store(attackID string, r request, f *flow.Flow, rawResponse []byte) string {
+	id, err := hooks.SaveRawFlow(a.DBFile, f, r.raw, rawResponse)
+	if err != nil {
+		log.Printf("Failed to store flow of attack %s request %d: %v", attackID, r.index, err)
+		return ""
+	}
+
+	if a.BaseRequestID != "" {
+		err := hooks.LinkFlow(a.DBFile, hooks.FlowLink{ID: id, OriginalID: a.BaseRequestID, Kind: hooks.LinkIntruder})
+		if err != nil {
+			log.Printf("Failed to link flow %s to %s: %v", id, a.BaseRequestID, err)
+		}
+	}
+
+	return id
+}
@@ -0,0 +1,225 @@
+package intruder
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/rawhttp"
+)
+
+func TestTemplateRender(t *testing.T) {
+	raw := "POST /login?next=§home§ HTTP/1.1\r\nHost: test.host.com\r\nContent-Length: 14\r\n\r\nuser=§admin§&x"
+
+	template, err := ParseTemplate([]byte(raw))
+	if err != nil {
+		t.Fatalf("ParseTemplate() error = %v", err)
+	}
+
+	if template.Positions() != 2 {
+		t.Fatalf("Positions() = %d, want 2", template.Positions())
+	}
+	if !reflect.DeepEqual(template.Defaults(), []string{"home", "admin"}) {
+		t.Errorf("Defaults() = %v", template.Defaults())
+	}
+	if string(template.Bytes()) != raw {
+		t.Errorf("Bytes() = %q, want %q", template.Bytes(), raw)
+	}
+
+	got := string(template.Render([]string{"a", "root"}))
+	want := "POST /login?next=a HTTP/1.1\r\nHost: test.host.com\r\nContent-Length: 11\r\n\r\nuser=root&x"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	if _, err := ParseTemplate([]byte("GET /§a HTTP/1.1\r\n\r\n")); err == nil {
+		t.Errorf("ParseTemplate() with unbalanced markers error = nil")
+	}
+	if _, err := ParseTemplate([]byte("GET / HTTP/1.1\r\n\r\n")); err == nil {
+		t.Errorf("ParseTemplate() without positions error = nil")
+	}
+}
+
+func TestRenderKeepsDuplicatedContentLength(t *testing.T) {
+	raw := "POST / HTTP/1.1\r\nContent-Length: 1\r\ncontent-length: 50\r\n\r\n§x§"
+
+	template, err := ParseTemplate([]byte(raw))
+	if err != nil {
+		t.Fatalf("ParseTemplate() error = %v", err)
+	}
+
+	got := string(template.Render([]string{"abc"}))
+	want := "POST / HTTP/1.1\r\nContent-Length: 1\r\ncontent-length: 50\r\n\r\nabc"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+}
+
+func TestMarkPositions(t *testing.T) {
+	raw := []byte("GET /?a=1&b=2 HTTP/1.1\r\n\r\n")
+
+	got := string(MarkPositions(raw, regexp.MustCompile(`=([^&\s]*)`)))
+	want := "GET /?a=§1§&b=§2§ HTTP/1.1\r\n\r\n"
+	if got != want {
+		t.Errorf("MarkPositions() = %q, want %q", got, want)
+	}
+}
+
+func TestParsePayloadSet(t *testing.T) {
+	wordlistFile := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(wordlistFile, []byte("admin\r\nroot\n"), 0644); err != nil {
+		t.Fatalf("Failed to write wordlist: %v", err)
+	}
+
+	tests := []struct {
+		spec string
+		want []string
+	}{
+		{"wordlist:" + wordlistFile, []string{"admin", "root"}},
+		{"list:a b,c&d|url", []string{"a+b", "c%26d"}},
+		{"range:1-3", []string{"1", "2", "3"}},
+		{"range:10-0:5:%03d", []string{"010", "005", "000"}},
+		{"chars:ab:1-2", []string{"a", "b", "aa", "ab", "ba", "bb"}},
+		{"list:x|base64|hex", []string{"65413d3d"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := ParsePayloadSet(tt.spec)
+			if err != nil {
+				t.Fatalf("ParsePayloadSet() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePayloadSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	for _, spec := range []string{"nope:1", "range:a-b", "list:a|unknown", "chars:abcdefghij:1-10"} {
+		if _, err := ParsePayloadSet(spec); err == nil {
+			t.Errorf("ParsePayloadSet(%q) error = nil, want error", spec)
+		}
+	}
+}
+
+func TestAttackModes(t *testing.T) {
+	template, err := ParseTemplate([]byte("GET /?a=§x§&b=§y§ HTTP/1.1\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ParseTemplate() error = %v", err)
+	}
+
+	tests := []struct {
+		mode Mode
+		sets [][]string
+		want []string
+	}{
+		{Sniper, [][]string{{"1", "2"}}, []string{"a=1&b=y", "a=2&b=y", "a=x&b=1", "a=x&b=2"}},
+		{BatteringRam, [][]string{{"1", "2"}}, []string{"a=1&b=1", "a=2&b=2"}},
+		{Pitchfork, [][]string{{"1", "2", "3"}, {"p", "q"}}, []string{"a=1&b=p", "a=2&b=q"}},
+		{ClusterBomb, [][]string{{"1", "2"}, {"p", "q"}}, []string{"a=1&b=p", "a=1&b=q", "a=2&b=p", "a=2&b=q"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.mode), func(t *testing.T) {
+			a := &Attack{Template: template, Mode: tt.mode, PayloadSets: tt.sets}
+			if err := a.Validate(); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+
+			got := []string{}
+			a.generate(func(r request) bool {
+				query := strings.TrimPrefix(strings.Fields(string(r.raw))[1], "/?")
+				got = append(got, query)
+				return true
+			})
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generated %v, want %v", got, tt.want)
+			}
+			if a.Count() != len(tt.want) {
+				t.Errorf("Count() = %d, want %d", a.Count(), len(tt.want))
+			}
+		})
+	}
+
+	a := &Attack{Template: template, Mode: Pitchfork, PayloadSets: [][]string{{"1"}}}
+	if err := a.Validate(); err == nil {
+		t.Errorf("Validate() with missing payload sets error = nil")
+	}
+}
+
+func TestAttackRun(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("user") == "admin" {
+			w.Write([]byte("welcome admin"))
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	serverURL, _ := url.Parse(server.URL)
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+
+	template, err := ParseTemplate([]byte("GET /?user=§x§ HTTP/1.1\r\nHost: " + serverURL.Host + "\r\n\r\n"))
+	if err != nil {
+		t.Fatalf("ParseTemplate() error = %v", err)
+	}
+
+	a := &Attack{
+		Template:    template,
+		Mode:        Sniper,
+		PayloadSets: [][]string{{"guest", "admin", "root"}},
+		Target:      rawhttp.OptionsForURL(serverURL),
+		Concurrency: 2,
+		RateLimit:   100,
+		DBFile:      dbFile,
+	}
+
+	resultsMutex := sync.Mutex{}
+	results := []hooks.AttackResult{}
+	attackID, err := a.Run(context.Background(), func(r hooks.AttackResult) {
+		resultsMutex.Lock()
+		results = append(results, r)
+		resultsMutex.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	stored, err := hooks.LoadAttackResults(dbFile, attackID, hooks.AttackResultFilter{StatusCode: 200})
+	if err != nil {
+		t.Fatalf("LoadAttackResults() error = %v", err)
+	}
+	if len(stored) != 1 || !reflect.DeepEqual(stored[0].Payloads, []string{"admin"}) {
+		t.Fatalf("stored results with status 200 = %+v", stored)
+	}
+
+	all, err := hooks.LoadAttackResults(dbFile, attackID, hooks.AttackResultFilter{OrderBy: "length", Descending: true})
+	if err != nil {
+		t.Fatalf("LoadAttackResults() error = %v", err)
+	}
+	if len(all) != 3 || all[0].StatusCode != 200 {
+		t.Errorf("results sorted by length = %+v", all)
+	}
+
+	ids := map[string]bool{}
+	for _, r := range all {
+		if r.RequestID == "" || ids[r.RequestID] {
+			t.Errorf("result %d has a missing or repeated flow id %q", r.Index, r.RequestID)
+		}
+		ids[r.RequestID] = true
+	}
+}
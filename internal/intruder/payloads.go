@@ -0,0 +1,212 @@
+package intruder
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxGeneratedPayloads limits the number of payloads of a generated set
+const MaxGeneratedPayloads = 1_000_000
+
+// Encoder transforms a payload before it is placed in the request
+type Encoder func(string) string
+
+// Encoders available to payload sets, by name
+var Encoders = map[string]Encoder{
+	"url":       url.QueryEscape,
+	"url-path":  url.PathEscape,
+	"base64":    func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64url": func(s string) string { return base64.URLEncoding.EncodeToString([]byte(s)) },
+	"hex":       func(s string) string { return hex.EncodeToString([]byte(s)) },
+	"html":      html.EscapeString,
+	"upper":     strings.ToUpper,
+	"lower":     strings.ToLower,
+}
+
+// ParsePayloadSet generates the payloads described by spec, which has one
+// of the following forms, optionally followed by encoders separated by |:
+//
+//	wordlist:<file>                  one payload per line
+//	list:<a>,<b>,...                 the given payloads
+//	range:<from>-<to>[:<step>[:<fmt>]] numbers, formatted with fmt, e.g. %04d
+//	chars:<charset>:<min>-<max>      all strings of the charset with the given lengths
+//
+// e.g. "range:1-100|base64" or "wordlist:users.txt|url".
+func ParsePayloadSet(spec string) ([]string, error) {
+	source, encoderNames, _ := strings.Cut(spec, "|")
+
+	kind, arg, ok := strings.Cut(source, ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid payload set '%s': expected <type>:<arguments>", spec)
+	}
+
+	var payloads []string
+	var err error
+	switch kind {
+	case "wordlist":
+		payloads, err = wordlist(arg)
+	case "list":
+		payloads = strings.Split(arg, ",")
+	case "range":
+		payloads, err = numberRange(arg)
+	case "chars":
+		payloads, err = generatedStrings(arg)
+	default:
+		err = fmt.Errorf("unknown payload type '%s'", kind)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid payload set '%s': %v", spec, err)
+	}
+
+	if encoderNames == "" {
+		return payloads, nil
+	}
+
+	for _, name := range strings.Split(encoderNames, "|") {
+		encode, ok := Encoders[name]
+		if !ok {
+			return nil, fmt.Errorf("invalid payload set '%s': unknown encoder '%s'", spec, name)
+		}
+		for i, p := range payloads {
+			payloads[i] = encode(p)
+		}
+	}
+
+	return payloads, nil
+}
+
+func wordlist(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	payloads := []string{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		payloads = append(payloads, strings.TrimSuffix(scanner.Text(), "\r"))
+	}
+
+	return payloads, scanner.Err()
+}
+
+func numberRange(arg string) ([]string, error) {
+	parts := strings.SplitN(arg, ":", 3)
+
+	fromStr, toStr, ok := strings.Cut(parts[0], "-")
+	if !ok {
+		return nil, fmt.Errorf("expected <from>-<to>")
+	}
+	from, err := strconv.Atoi(fromStr)
+	if err != nil {
+		return nil, err
+	}
+	to, err := strconv.Atoi(toStr)
+	if err != nil {
+		return nil, err
+	}
+
+	step := 1
+	if len(parts) > 1 && parts[1] != "" {
+		step, err = strconv.Atoi(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		if step <= 0 {
+			return nil, fmt.Errorf("step must be positive")
+		}
+	}
+
+	format := "%d"
+	if len(parts) > 2 {
+		format = parts[2]
+	}
+
+	if from > to {
+		step = -step
+	}
+	if (to-from)/step+1 > MaxGeneratedPayloads {
+		return nil, fmt.Errorf("range generates more than %d payloads", MaxGeneratedPayloads)
+	}
+
+	payloads := []string{}
+	for n := from; (step > 0 && n <= to) || (step < 0 && n >= to); n += step {
+		payloads = append(payloads, fmt.Sprintf(format, n))
+	}
+
+	return payloads, nil
+}
+
+func generatedStrings(arg string) ([]string, error) {
+	i := strings.LastIndex(arg, ":")
+	if i == -1 {
+		return nil, fmt.Errorf("expected <charset>:<min>-<max>")
+	}
+	charset := []rune(arg[:i])
+	if len(charset) == 0 {
+		return nil, fmt.Errorf("empty charset")
+	}
+
+	minStr, maxStr, ok := strings.Cut(arg[i+1:], "-")
+	if !ok {
+		maxStr = minStr
+	}
+	minLen, err := strconv.Atoi(minStr)
+	if err != nil {
+		return nil, err
+	}
+	maxLen, err := strconv.Atoi(maxStr)
+	if err != nil {
+		return nil, err
+	}
+	if minLen < 0 || maxLen < minLen {
+		return nil, fmt.Errorf("invalid length range %d-%d", minLen, maxLen)
+	}
+
+	total := 0
+	for l, n := 0, 1; l <= maxLen; l++ {
+		if l >= minLen {
+			total += n
+		}
+		if total > MaxGeneratedPayloads || n > MaxGeneratedPayloads {
+			return nil, fmt.Errorf("charset generates more than %d payloads", MaxGeneratedPayloads)
+		}
+		n *= len(charset)
+	}
+
+	payloads := make([]string, 0, total)
+	for l := minLen; l <= maxLen; l++ {
+		indexes := make([]int, l)
+		for {
+			s := make([]rune, l)
+			for j, idx := range indexes {
+				s[j] = charset[idx]
+			}
+			payloads = append(payloads, string(s))
+
+			// advance the indexes like an odometer
+			j := l - 1
+			for ; j >= 0; j-- {
+				indexes[j]++
+				if indexes[j] < len(charset) {
+					break
+				}
+				indexes[j] = 0
+			}
+			if j < 0 {
+				break
+			}
+		}
+	}
+
+	return payloads, nil
+}
@@ -0,0 +1,126 @@
+package intruder
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// Marker delimits the payload positions of a template
+const Marker = "§"
+
+// Template is a raw request with payload positions. Each position is
+// delimited by a pair of markers enclosing its original value, e.g.
+// "GET /?user=§admin§ HTTP/1.1".
+type Template struct {
+	// parts alternates the fixed parts of the request and the original
+	// values of the positions, starting and ending with a fixed part
+	parts [][]byte
+}
+
+// ParseTemplate parses a raw request with marked payload positions
+func ParseTemplate(raw []byte) (*Template, error) {
+	parts := bytes.Split(raw, []byte(Marker))
+	if len(parts)%2 == 0 {
+		return nil, fmt.Errorf("unbalanced payload markers: found %d %s characters", len(parts)-1, Marker)
+	}
+	if len(parts) == 1 {
+		return nil, fmt.Errorf("no payload positions marked with %s", Marker)
+	}
+
+	return &Template{parts: parts}, nil
+}
+
+// MarkPositions returns raw with each match of re marked as a payload
+// position. If re has a capturing group, only the first group is marked.
+func MarkPositions(raw []byte, re *regexp.Regexp) []byte {
+	var result bytes.Buffer
+	last := 0
+
+	for _, m := range re.FindAllSubmatchIndex(raw, -1) {
+		start, end := m[0], m[1]
+		if len(m) >= 4 && m[2] != -1 {
+			start, end = m[2], m[3]
+		}
+		if start < last {
+			continue
+		}
+
+		result.Write(raw[last:start])
+		result.WriteString(Marker)
+		result.Write(raw[start:end])
+		result.WriteString(Marker)
+		last = end
+	}
+	result.Write(raw[last:])
+
+	return result.Bytes()
+}
+
+// Bytes returns the raw request with its payload markers
+func (t *Template) Bytes() []byte {
+	return bytes.Join(t.parts, []byte(Marker))
+}
+
+// Positions returns the number of payload positions
+func (t *Template) Positions() int {
+	return len(t.parts) / 2
+}
+
+// Defaults returns the original values of the positions
+func (t *Template) Defaults() []string {
+	defaults := make([]string, 0, t.Positions())
+	for i := 1; i < len(t.parts); i += 2 {
+		defaults = append(defaults, string(t.parts[i]))
+	}
+	return defaults
+}
+
+// Render returns the request with the values in the positions. The
+// Content-Length header is updated if the length of the body changed.
+func (t *Template) Render(values []string) []byte {
+	var buf bytes.Buffer
+	for i, part := range t.parts {
+		if i%2 == 0 {
+			buf.Write(part)
+		} else {
+			buf.WriteString(values[i/2])
+		}
+	}
+
+	return updateContentLength(buf.Bytes())
+}
+
+var contentLengthRe = regexp.MustCompile(`(?im)^(content-length:[ \t]*)(\d+)(\r?)$`)
+
+// updateContentLength sets the value of the first Content-Length header to
+// the length of the body. Requests with more than one Content-Length header
+// are left unchanged, since they are likely crafted on purpose.
+func updateContentLength(raw []byte) []byte {
+	headEnd := bytes.Index(raw, []byte("\r\n\r\n"))
+	sepLen := 4
+	if headEnd == -1 {
+		headEnd = bytes.Index(raw, []byte("\n\n"))
+		sepLen = 2
+	}
+	if headEnd == -1 {
+		return raw
+	}
+
+	head := raw[:headEnd]
+	matches := contentLengthRe.FindAllSubmatchIndex(head, -1)
+	if len(matches) != 1 {
+		return raw
+	}
+
+	bodyLen := len(raw) - headEnd - sepLen
+	m := matches[0]
+
+	var result bytes.Buffer
+	result.Write(raw[:m[4]])
+	result.WriteString(strconv.Itoa(bodyLen))
+	result.Write(raw[m[5]:])
+
+	return result.Bytes()
+}
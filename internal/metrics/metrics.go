@@ -0,0 +1,407 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the buckets of the
+// histograms that do not set them
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry the metrics of the proxy are registered in
+var Default = NewRegistry()
+
+// metric is a metric of a registry that writes its samples in the
+// Prometheus text format
+type metric interface {
+	header() (name, help, kind string)
+	write(w io.Writer)
+}
+
+// Registry is a set of metrics exposed in the Prometheus text format
+type Registry struct {
+	mutex   sync.RWMutex
+	metrics map[string]metric
+}
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{metrics: map[string]metric{}}
+}
+
+// register adds a metric to the registry, replacing the one with the same
+// name if any
+func (r *Registry) register(m metric) {
+	name, _, _ := m.header()
+	r.mutex.Lock()
+	r.metrics[name] = m
+	r.mutex.Unlock()
+}
+
+// Write writes the metrics of the registry sorted by name
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.RLock()
+	names := make([]string, 0, len(r.metrics))
+	for name := range r.metrics {
+		names = append(names, name)
+	}
+	metrics := make([]metric, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		metrics = append(metrics, r.metrics[name])
+	}
+	r.mutex.RUnlock()
+
+	for _, m := range metrics {
+		name, help, kind := m.header()
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, helpEscaper.Replace(help), name, kind); err != nil {
+			return err
+		}
+		m.write(w)
+	}
+	return nil
+}
+
+// Handler returns an HTTP handler that serves the metrics of the registry
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.Write(w)
+	})
+}
+
+// series is a time series of a metric, identified by its label values
+type series struct {
+	labelValues []string
+	value       float64
+}
+
+// vec is a metric with a value for each combination of label values
+type vec struct {
+	name   string
+	help   string
+	labels []string
+
+	mutex  sync.Mutex
+	series map[string]*series
+}
+
+// init initializes a vec. The metrics without labels start at 0, so that
+// they are exposed before they change.
+func (v *vec) init(name, help string, labels []string) {
+	v.name = name
+	v.help = help
+	v.labels = labels
+	v.series = map[string]*series{}
+	if len(labels) == 0 {
+		v.get(nil)
+	}
+}
+
+func (v *vec) get(labelValues []string) *series {
+	if len(labelValues) != len(v.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", v.name, len(v.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	s, ok := v.series[key]
+	if !ok {
+		s = &series{labelValues: append([]string{}, labelValues...)}
+		v.series[key] = s
+	}
+	return s
+}
+
+func (v *vec) add(delta float64, labelValues []string) {
+	v.mutex.Lock()
+	v.get(labelValues).value += delta
+	v.mutex.Unlock()
+}
+
+func (v *vec) write(w io.Writer) {
+	v.mutex.Lock()
+	samples := make([]Sample, 0, len(v.series))
+	for _, s := range v.series {
+		samples = append(samples, Sample{LabelValues: s.labelValues, Value: s.value})
+	}
+	v.mutex.Unlock()
+
+	writeSamples(w, v.name, v.labels, samples)
+}
+
+// CounterVec is a counter with a value for each combination of label values
+type CounterVec struct {
+	vec
+}
+
+// NewCounterVec creates a counter in the default registry
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return Default.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec creates a counter in the registry
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{}
+	c.init(name, help, labels)
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) header() (string, string, string) {
+	return c.name, c.help, "counter"
+}
+
+// Inc increments the counter of the label values by one
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.add(1, labelValues)
+}
+
+// Add adds a non-negative value to the counter of the label values
+func (c *CounterVec) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.add(value, labelValues)
+}
+
+// GaugeVec is a gauge with a value for each combination of label values
+type GaugeVec struct {
+	vec
+}
+
+// NewGaugeVec creates a gauge in the default registry
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return Default.NewGaugeVec(name, help, labels...)
+}
+
+// NewGaugeVec creates a gauge in the registry
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{}
+	g.init(name, help, labels)
+	r.register(g)
+	return g
+}
+
+func (g *GaugeVec) header() (string, string, string) {
+	return g.name, g.help, "gauge"
+}
+
+// Set sets the gauge of the label values
+func (g *GaugeVec) Set(value float64, labelValues ...string) {
+	g.mutex.Lock()
+	g.get(labelValues).value = value
+	g.mutex.Unlock()
+}
+
+// Add adds a value, which may be negative, to the gauge of the label values
+func (g *GaugeVec) Add(value float64, labelValues ...string) {
+	g.add(value, labelValues)
+}
+
+// Sample is a value of a metric for a combination of label values
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// Func is a gauge or counter whose samples are collected when the metrics
+// are written, for values kept elsewhere such as the length of a queue
+type Func struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	collect func() []Sample
+}
+
+// NewGaugeFunc creates a gauge collected by a function in the default
+// registry
+func NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	return Default.NewGaugeFunc(name, help, labels, collect)
+}
+
+// NewGaugeFunc creates a gauge collected by a function in the registry
+func (r *Registry) NewGaugeFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	f := &Func{name: name, help: help, kind: "gauge", labels: labels, collect: collect}
+	r.register(f)
+	return f
+}
+
+// NewCounterFunc creates a counter collected by a function in the registry.
+// The values collected must never decrease.
+func (r *Registry) NewCounterFunc(name, help string, labels []string, collect func() []Sample) *Func {
+	f := &Func{name: name, help: help, kind: "counter", labels: labels, collect: collect}
+	r.register(f)
+	return f
+}
+
+func (f *Func) header() (string, string, string) {
+	return f.name, f.help, f.kind
+}
+
+func (f *Func) write(w io.Writer) {
+	writeSamples(w, f.name, f.labels, f.collect())
+}
+
+// histogramSeries are the buckets of a histogram for a combination of label
+// values. The counts are not cumulative.
+type histogramSeries struct {
+	labelValues []string
+	counts      []uint64
+	sum         float64
+	count       uint64
+}
+
+// HistogramVec is a histogram with a series for each combination of label
+// values
+type HistogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+
+	mutex  sync.Mutex
+	series map[string]*histogramSeries
+}
+
+// NewHistogramVec creates a histogram with the default buckets in the
+// default registry
+func NewHistogramVec(name, help string, labels ...string) *HistogramVec {
+	return Default.NewHistogramVec(name, help, DefaultBuckets, labels...)
+}
+
+// NewHistogramVec creates a histogram in the registry. The buckets must be
+// sorted.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{
+		name:    name,
+		help:    help,
+		labels:  labels,
+		buckets: buckets,
+		series:  map[string]*histogramSeries{},
+	}
+	r.register(h)
+	return h
+}
+
+func (h *HistogramVec) header() (string, string, string) {
+	return h.name, h.help, "histogram"
+}
+
+// Observe adds a value to the histogram of the label values
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	if len(labelValues) != len(h.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", h.name, len(h.labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{
+			labelValues: append([]string{}, labelValues...),
+			counts:      make([]uint64, len(h.buckets)),
+		}
+		h.series[key] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, value); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += value
+	s.count++
+}
+
+func (h *HistogramVec) write(w io.Writer) {
+	h.mutex.Lock()
+	series := make([]histogramSeries, 0, len(h.series))
+	for _, s := range h.series {
+		c := *s
+		c.counts = append([]uint64{}, s.counts...)
+		series = append(series, c)
+	}
+	h.mutex.Unlock()
+
+	sort.Slice(series, func(i, j int) bool {
+		return lessLabelValues(series[i].labelValues, series[j].labelValues)
+	})
+
+	bucketLabels := append(append([]string{}, h.labels...), "le")
+	for _, s := range series {
+		var cumulative uint64
+		for i, upper := range h.buckets {
+			cumulative += s.counts[i]
+			writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string{}, s.labelValues...), formatValue(upper)), float64(cumulative))
+		}
+		writeSample(w, h.name+"_bucket", bucketLabels, append(append([]string{}, s.labelValues...), "+Inf"), float64(s.count))
+		writeSample(w, h.name+"_sum", h.labels, s.labelValues, s.sum)
+		writeSample(w, h.name+"_count", h.labels, s.labelValues, float64(s.count))
+	}
+}
+
+// writeSamples writes the samples of a metric sorted by label values
+func writeSamples(w io.Writer, name string, labels []string, samples []Sample) {
+	sort.Slice(samples, func(i, j int) bool {
+		return lessLabelValues(samples[i].LabelValues, samples[j].LabelValues)
+	})
+	for _, s := range samples {
+		writeSample(w, name, labels, s.LabelValues, s.Value)
+	}
+}
+
+func writeSample(w io.Writer, name string, labels, labelValues []string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteString("{")
+		for i, l := range labels {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			v := ""
+			if i < len(labelValues) {
+				v = labelValues[i]
+			}
+			fmt.Fprintf(&b, `%s="%s"`, l, labelEscaper.Replace(v))
+		}
+		b.WriteString("}")
+	}
+	b.WriteString(" ")
+	b.WriteString(formatValue(value))
+	b.WriteString("\n")
+	io.WriteString(w, b.String())
+}
+
+func lessLabelValues(a, b []string) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i] != b[i] {
+			return a[i] < b[i]
+		}
+	}
+	return len(a) < len(b)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWrite(t *testing.T) {
+	r := NewRegistry()
+
+	requests := r.NewCounterVec("test_requests_total", "Requests by host.", "host", "status")
+	requests.Inc("b.com", "200")
+	requests.Inc("a.com", "404")
+	requests.Add(2, "b.com", "200")
+	requests.Add(-1, "b.com", "200")
+
+	tunnels := r.NewGaugeVec("test_tunnels", "Open tunnels.")
+	tunnels.Add(2)
+	tunnels.Add(-1)
+
+	r.NewGaugeFunc("test_queue_depth", "Items in \"queues\".", []string{"queue"}, func() []Sample {
+		return []Sample{{LabelValues: []string{`db "main"`}, Value: 3}}
+	})
+
+	latency := r.NewHistogramVec("test_duration_seconds", "Hook latency\nin seconds.", []float64{0.1, 1}, "hook")
+	latency.Observe(0.05, "h")
+	latency.Observe(0.5, "h")
+	latency.Observe(2, "h")
+
+	want := `# HELP test_duration_seconds Hook latency\nin seconds.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{hook="h",le="0.1"} 1
+test_duration_seconds_bucket{hook="h",le="1"} 2
+test_duration_seconds_bucket{hook="h",le="+Inf"} 3
+test_duration_seconds_sum{hook="h"} 2.55
+test_duration_seconds_count{hook="h"} 3
+# HELP test_queue_depth Items in "queues".
+# TYPE test_queue_depth gauge
+test_queue_depth{queue="db \"main\""} 3
+# HELP test_requests_total Requests by host.
+# TYPE test_requests_total counter
+test_requests_total{host="a.com",status="404"} 1
+test_requests_total{host="b.com",status="200"} 3
+# HELP test_tunnels Open tunnels.
+# TYPE test_tunnels gauge
+test_tunnels 1
+`
+
+	rec := httptest.NewRecorder()
+	r.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if got := rec.Body.String(); got != want {
+		t.Errorf("metrics =\n%s\nwant\n%s", got, want)
+	}
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("Content-Type = %s, want text/plain", ct)
+	}
+}
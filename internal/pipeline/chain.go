@@ -0,0 +1,201 @@
+package pipeline
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultCooldown is the time a hook stays disabled by its circuit breaker
+// when it does not set one.
+const DefaultCooldown = 30 * time.Second
+
+// Policy defines what a modification pipeline does when a hook fails.
+type Policy int
+
+const (
+	// FailClosed rejects the item, returning the error of the hook.
+	FailClosed Policy = iota
+	// FailOpen skips the hook and continues with the item unchanged.
+	FailOpen
+)
+
+// Options are the settings of a hook. The zero value runs the hook on every
+// item without a timeout, fails closed and has no circuit breaker.
+type Options struct {
+	// Timeout is the time the pipeline waits for the hook. When it
+	// expires the hook fails, and Policy decides whether the item is
+	// rejected or continues without the hook.
+	Timeout time.Duration
+
+	Policy Policy
+
+	// MaxFailures is the number of consecutive failures, errors, panics or
+	// timeouts, after which the hook is disabled for Cooldown. The circuit
+	// breaker is off unless it is set. While it is open, fail open hooks
+	// are skipped and fail closed ones reject the items without running.
+	MaxFailures int
+	Cooldown    time.Duration
+
+	// Filter selects the items the hook receives
+	Filter Filter
+}
+
+// Named is a hook with the name and priority used to order the chain of a
+// pipeline. Hooks run in increasing order of priority; hooks with the same
+// priority run in the order they were set, and before the hooks added later.
+type Named[F any] struct {
+	Name     string
+	Priority int
+	Hook     F
+
+	Options
+}
+
+// NamedReadOnlyHook is a named read-only hook.
+type NamedReadOnlyHook[I PipelineItem] = Named[ReadOnlyHook[I]]
+
+// NamedModHook is a named modification hook.
+type NamedModHook[I PipelineItem] = Named[ModHook[I]]
+
+// HookInfo describes a hook of a chain.
+type HookInfo struct {
+	Name     string
+	Priority int
+
+	// Disabled is set while the circuit breaker of the hook is open
+	Disabled bool
+	Failures int
+}
+
+// entry is a hook of a chain with the state of its circuit breaker.
+type entry[F any] struct {
+	Named[F]
+
+	mutex     sync.Mutex
+	failures  int
+	openUntil time.Time
+}
+
+// allow reports whether the circuit breaker lets the hook run. Once the
+// cooldown expires the hook runs again, and a new failure disables it again.
+func (e *entry[F]) allow() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return !time.Now().Before(e.openUntil)
+}
+
+// record updates the circuit breaker with the result of a run of the hook.
+func (e *entry[F]) record(err error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if err == nil {
+		e.failures = 0
+		return
+	}
+	e.failures++
+
+	if e.MaxFailures <= 0 || e.failures < e.MaxFailures {
+		return
+	}
+
+	cooldown := e.Cooldown
+	if cooldown == 0 {
+		cooldown = DefaultCooldown
+	}
+	e.openUntil = time.Now().Add(cooldown)
+	log.Printf("Hook '%s' disabled for %s after %d consecutive failures, last error: %v",
+		e.Name, cooldown, e.failures, err)
+}
+
+func (e *entry[F]) info() HookInfo {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return HookInfo{
+		Name:     e.Name,
+		Priority: e.Priority,
+		Disabled: time.Now().Before(e.openUntil),
+		Failures: e.failures,
+	}
+}
+
+// chain keeps the hooks of a pipeline ordered by priority. The hooks set
+// with setHooks are replaced on each call, while the ones added with add
+// stay until they are removed.
+type chain[F any] struct {
+	mutex   sync.RWMutex
+	set     []*entry[F]
+	added   []*entry[F]
+	ordered []*entry[F]
+}
+
+// entries returns the hooks of the chain in order.
+func (c *chain[F]) entries() []*entry[F] {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.ordered
+}
+
+// info returns the names, priorities and state of the hooks in order.
+func (c *chain[F]) info() []HookInfo {
+	info := []HookInfo{}
+	for _, e := range c.entries() {
+		info = append(info, e.info())
+	}
+	return info
+}
+
+func (c *chain[F]) setHooks(hooks []Named[F]) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.set = nil
+	for _, h := range hooks {
+		c.set = append(c.set, &entry[F]{Named: h})
+	}
+	c.order()
+}
+
+// add adds a hook to the chain and returns a function that removes it.
+func (c *chain[F]) add(hook Named[F]) func() {
+	e := &entry[F]{Named: hook}
+
+	c.mutex.Lock()
+	c.added = append(c.added, e)
+	c.order()
+	c.mutex.Unlock()
+
+	return func() {
+		c.mutex.Lock()
+		defer c.mutex.Unlock()
+		for i, a := range c.added {
+			if a == e {
+				c.added = append(c.added[:i:i], c.added[i+1:]...)
+				c.order()
+				return
+			}
+		}
+	}
+}
+
+// order must be called with the mutex locked. It builds a new slice so that
+// the callers of entries can keep using the previous one.
+func (c *chain[F]) order() {
+	ordered := append(append([]*entry[F]{}, c.set...), c.added...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		return ordered[i].Priority < ordered[j].Priority
+	})
+	c.ordered = ordered
+}
+
+// unnamed names the hooks set without a name by their position.
+func unnamed[F any](hooks []F) []Named[F] {
+	named := make([]Named[F], 0, len(hooks))
+	for i, h := range hooks {
+		named = append(named, Named[F]{Name: fmt.Sprintf("hook-%d", i), Hook: h})
+	}
+	return named
+}
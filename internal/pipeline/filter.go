@@ -0,0 +1,173 @@
+package pipeline
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// Filter selects the items a hook receives. It is evaluated before the item
+// is cloned for the hook. The zero value matches every item.
+type Filter struct {
+	// HostRe and PathRe match the host and path of the request
+	HostRe *regexp.Regexp
+	PathRe *regexp.Regexp
+
+	// Methods are the request methods to match, in any case
+	Methods []string
+
+	// ContentTypes are prefixes of the media types to match, e.g. "text/"
+	// or "application/json". Responses and flows are matched by the content
+	// type of the response.
+	ContentTypes []string
+
+	// MaxBodySize skips the items with a larger body, 0 for no limit. The
+	// body of a flow is the largest of its request and response.
+	MaxBodySize int64
+
+	// OmitBodies passes the items to the hook without their bodies. The
+	// items returned by mod hooks get back their original bodies.
+	OmitBodies bool
+}
+
+func (f *Filter) isZero() bool {
+	return f.HostRe == nil && f.PathRe == nil && len(f.Methods) == 0 &&
+		len(f.ContentTypes) == 0 && f.MaxBodySize == 0
+}
+
+// match reports whether an item passes the filter.
+func match[I PipelineItem](f *Filter, r I) bool {
+	if f.isZero() {
+		return true
+	}
+
+	switch v := any(r).(type) {
+	case *http.Request:
+		return f.matches(v, v.Header, bodySize(v.Body, v.ContentLength))
+	case *http.Response:
+		return f.matches(v.Request, v.Header, bodySize(v.Body, v.ContentLength))
+	case *flow.Flow:
+		if v.Request == nil {
+			return false
+		}
+		header, size := v.Request.Header, bodySize(v.Request.Body, v.Request.ContentLength)
+		if v.Response != nil {
+			header = v.Response.Header
+			size = max(size, bodySize(v.Response.Body, v.Response.ContentLength))
+		}
+		return f.matches(v.Request, header, size)
+	default:
+		return true
+	}
+}
+
+func (f *Filter) matches(req *http.Request, header http.Header, size int64) bool {
+	if f.MaxBodySize > 0 && size > f.MaxBodySize {
+		return false
+	}
+
+	if len(f.ContentTypes) > 0 {
+		contentType := strings.ToLower(header.Get("Content-Type"))
+		found := false
+		for _, ct := range f.ContentTypes {
+			if strings.HasPrefix(contentType, strings.ToLower(ct)) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.HostRe == nil && f.PathRe == nil && len(f.Methods) == 0 {
+		return true
+	}
+	if req == nil {
+		return false
+	}
+
+	if len(f.Methods) > 0 {
+		found := false
+		for _, m := range f.Methods {
+			if strings.EqualFold(m, req.Method) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if f.HostRe != nil && !f.HostRe.MatchString(hostname(req)) {
+		return false
+	}
+	if f.PathRe != nil && (req.URL == nil || !f.PathRe.MatchString(req.URL.Path)) {
+		return false
+	}
+
+	return true
+}
+
+// hostname returns the host of a request without the port.
+func hostname(req *http.Request) string {
+	host := req.Host
+	if host == "" && req.URL != nil {
+		host = req.URL.Host
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// bodySize returns the size of a body, or the content length if the body
+// was not read yet.
+func bodySize(body io.ReadCloser, contentLength int64) int64 {
+	if body == nil || body == http.NoBody {
+		return 0
+	}
+	if wrapper, ok := body.(*httpbytes.BodyWrapper); ok {
+		return int64(wrapper.Len())
+	}
+	return contentLength
+}
+
+// withoutBody creates a copy of the pipeline item without its bodies.
+func withoutBody[I PipelineItem](r I) I {
+	switch v := any(r).(type) {
+	case *http.Request:
+		return any(httpbytes.CloneRequestHead(v)).(I)
+	case *http.Response:
+		return any(httpbytes.CloneResponseHead(v)).(I)
+	case *flow.Flow:
+		return any(v.CloneHeads()).(I)
+	default:
+		return clone(r)
+	}
+}
+
+// restoreBody sets the body of the original item to an item returned by a
+// hook that received it without its body.
+func restoreBody[I PipelineItem](modified, original I) {
+	switch m := any(modified).(type) {
+	case *http.Request:
+		if m == nil {
+			return
+		}
+		o := any(original).(*http.Request)
+		m.Body, m.ContentLength = o.Body, o.ContentLength
+	case *http.Response:
+		if m == nil {
+			return
+		}
+		o := any(original).(*http.Response)
+		m.Body, m.ContentLength = o.Body, o.ContentLength
+	}
+}
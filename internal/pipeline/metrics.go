@@ -0,0 +1,20 @@
+package pipeline
+
+import (
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/metrics"
+)
+
+// hookDuration is the time the hooks take to run, including the ones that
+// fail or time out
+var hookDuration = metrics.NewHistogramVec(
+	"efin_proxy_hook_duration_seconds",
+	"Time the hooks take to run, by pipeline and hook.",
+	"pipeline", "hook",
+)
+
+// observeHook records the time a hook took since start
+func observeHook(pipeline, hook string, start time.Time) {
+	hookDuration.Observe(time.Since(start).Seconds(), pipeline, hook)
+}
@@ -5,7 +5,9 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/flow"
 	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 )
 
@@ -16,28 +18,25 @@ type ReadOnlyHook[I PipelineItem] func(I) error
 type ModHook[I PipelineItem] func(I) (I, error)
 
 // PipelineItem constrains the types that can be processed by the pipelines.
-type PipelineItem interface{ *http.Request | *http.Response }
-
-// roQueueItem represents an item in the read-only pipeline's processing queue.
-type roQueueItem[I PipelineItem] struct {
-	req   I
-	hooks []ReadOnlyHook[I]
+type PipelineItem interface {
+	*http.Request | *http.Response | *flow.Flow
 }
 
 // ReadOnlyPipeline manages a pipeline of read-only hooks processed asynchronously.
 type ReadOnlyPipeline[I PipelineItem] struct {
-	hooks      []ReadOnlyHook[I]
-	hooksMutex sync.RWMutex
-	queue      chan roQueueItem[I]
+	name  string
+	chain chain[ReadOnlyHook[I]]
+	queue *Queue[I]
 }
 
 // NewReadOnlyPipeline initializes a new read-only pipeline with the given hooks.
 func NewReadOnlyPipeline[I PipelineItem](hooks []ReadOnlyHook[I]) *ReadOnlyPipeline[I] {
+	// the drop policy does not fail
+	queue, _ := NewQueue[I](1000, OverflowPolicy{Overflow: Drop})
 	pipeline := &ReadOnlyPipeline[I]{
-		hooks:      append([]ReadOnlyHook[I]{}, hooks...), // Defensive copy of hooks
-		hooksMutex: sync.RWMutex{},
-		queue:      make(chan roQueueItem[I], 1000), // Buffer size of 1000
+		queue: queue,
 	}
+	pipeline.SetHooks(hooks)
 
 	go pipeline.processPipelineQueue()
 	return pipeline
@@ -45,15 +44,14 @@ func NewReadOnlyPipeline[I PipelineItem](hooks []ReadOnlyHook[I]) *ReadOnlyPipel
 
 // processPipelineQueue runs in a goroutine to process items from the queue.
 func (p *ReadOnlyPipeline[I]) processPipelineQueue() {
-	for item := range p.queue {
+	for item := range p.queue.Items() {
 		p.processItem(item)
 	}
 }
 
 // processItem processes a single pipeline item by applying all hooks concurrently.
-func (p *ReadOnlyPipeline[I]) processItem(item roQueueItem[I]) {
-	hooks := item.hooks
-	req := item.req
+func (p *ReadOnlyPipeline[I]) processItem(req I) {
+	hooks := p.chain.entries()
 
 	if len(hooks) == 0 {
 		return
@@ -62,15 +60,27 @@ func (p *ReadOnlyPipeline[I]) processItem(item roQueueItem[I]) {
 	var wg sync.WaitGroup
 	errChan := make(chan error, len(hooks))
 
-	for _, fn := range hooks {
+	for _, e := range hooks {
+		if !match(&e.Filter, req) || !e.allow() {
+			continue
+		}
 		wg.Add(1)
-		go func(f ReadOnlyHook[I]) {
+		go func(e *entry[ReadOnlyHook[I]]) {
 			defer wg.Done()
-			tempReq := clone(req)
-			if err := f(tempReq); err != nil {
+			var tempReq I
+			if e.Filter.OmitBodies {
+				tempReq = withoutBody(req)
+			} else {
+				tempReq = clone(req)
+			}
+			start := time.Now()
+			err := runReadOnly(e, tempReq)
+			observeHook(p.name, e.Name, start)
+			e.record(err)
+			if err != nil {
 				errChan <- err
 			}
-		}(fn)
+		}(e)
 	}
 
 	wg.Wait()
@@ -84,53 +94,104 @@ func (p *ReadOnlyPipeline[I]) processItem(item roQueueItem[I]) {
 	}
 }
 
-// RunPipeline queues an item for processing in the read-only pipeline.
+// RunPipeline queues an item for processing in the read-only pipeline. When
+// the queue is full, the overflow policy of the pipeline is applied.
 func (p *ReadOnlyPipeline[I]) RunPipeline(r I) error {
-	p.hooksMutex.RLock()
-	hooks := p.hooks
-	p.hooksMutex.RUnlock()
-
-	if len(hooks) > 0 {
-		select {
-		case p.queue <- roQueueItem[I]{req: r, hooks: hooks}:
-			// Successfully queued
-		default:
-			return fmt.Errorf("pipeline queue full")
-		}
+	if len(p.chain.entries()) == 0 {
+		return nil
 	}
-	return nil
+	return p.queue.Push(r)
+}
+
+// SetOverflowPolicy sets what the pipeline does with the items that do not
+// fit in its queue. It drops them by default.
+func (p *ReadOnlyPipeline[I]) SetOverflowPolicy(policy OverflowPolicy) error {
+	return p.queue.SetPolicy(policy)
+}
+
+// Dropped returns the number of items the pipeline dropped.
+func (p *ReadOnlyPipeline[I]) Dropped() uint64 {
+	return p.queue.Dropped()
+}
+
+// Spooled returns the number of items waiting in the spool of the pipeline.
+func (p *ReadOnlyPipeline[I]) Spooled() int {
+	return p.queue.Spooled()
+}
+
+// Queued returns the number of items waiting in the queue of the pipeline.
+func (p *ReadOnlyPipeline[I]) Queued() int {
+	return p.queue.Len()
+}
+
+// SetName sets the name the pipeline is reported with in the metrics. It
+// must be called before the pipeline is used.
+func (p *ReadOnlyPipeline[I]) SetName(name string) {
+	p.name = name
 }
 
-// SetHooks updates the hooks in the read-only pipeline.
+// SetHooks updates the hooks in the read-only pipeline. They are named by
+// their position and have priority 0.
 func (p *ReadOnlyPipeline[I]) SetHooks(hooks []ReadOnlyHook[I]) {
-	p.hooksMutex.Lock()
-	p.hooks = append([]ReadOnlyHook[I]{}, hooks...) // Defensive copy
-	p.hooksMutex.Unlock()
+	p.chain.setHooks(unnamed(hooks))
+}
+
+// SetNamedHooks updates the hooks in the read-only pipeline, keeping the ones
+// added with AddHook.
+func (p *ReadOnlyPipeline[I]) SetNamedHooks(hooks []NamedReadOnlyHook[I]) {
+	p.chain.setHooks(hooks)
+}
+
+// AddHook adds a hook to the read-only pipeline and returns a function that
+// removes it.
+func (p *ReadOnlyPipeline[I]) AddHook(hook NamedReadOnlyHook[I]) func() {
+	return p.chain.add(hook)
+}
+
+// Hooks returns the hooks of the read-only pipeline in the order they are
+// started.
+func (p *ReadOnlyPipeline[I]) Hooks() []HookInfo {
+	return p.chain.info()
 }
 
 // ModPipeline manages a pipeline of modification hooks processed synchronously.
 type ModPipeline[I PipelineItem] struct {
-	hooks      []ModHook[I]
-	hooksMutex sync.RWMutex
+	name  string
+	chain chain[ModHook[I]]
 }
 
 // NewModPipeline initializes a new modification pipeline with the given hooks.
 func NewModPipeline[I PipelineItem](hooks []ModHook[I]) *ModPipeline[I] {
-	return &ModPipeline[I]{
-		hooks:      append([]ModHook[I]{}, hooks...), // Defensive copy
-		hooksMutex: sync.RWMutex{},
-	}
+	pipeline := &ModPipeline[I]{}
+	pipeline.SetHooks(hooks)
+	return pipeline
 }
 
-// RunPipeline applies all modification hooks sequentially to the item.
+// RunPipeline applies all modification hooks sequentially to the item. When
+// a hook fails, the item is rejected with its error unless the hook fails
+// open, in which case the hook is skipped.
 func (p *ModPipeline[I]) RunPipeline(r I) (I, error) {
-	p.hooksMutex.RLock()
-	hooks := p.hooks
-	p.hooksMutex.RUnlock()
+	hooks := p.chain.entries()
 
-	for _, fn := range hooks {
-		modifiedReq, err := fn(r)
+	for _, e := range hooks {
+		if !match(&e.Filter, r) {
+			continue
+		}
+		if !e.allow() {
+			if e.Policy == FailOpen {
+				continue
+			}
+			return r, fmt.Errorf("hook '%s' is disabled after consecutive failures", e.Name)
+		}
+		start := time.Now()
+		modifiedReq, err := runMod(e, r)
+		observeHook(p.name, e.Name, start)
+		e.record(err)
 		if err != nil {
+			if e.Policy == FailOpen {
+				log.Printf("Skipping failed hook '%s': %v", e.Name, err)
+				continue
+			}
 			return r, err
 		}
 		r = modifiedReq
@@ -154,11 +215,120 @@ func (p *ModPipeline[I]) RunPipeline(r I) (I, error) {
 	return r, nil
 }
 
-// SetHooks updates the hooks in the modification pipeline.
+// SetHooks updates the hooks in the modification pipeline. They are named by
+// their position and have priority 0.
 func (p *ModPipeline[I]) SetHooks(hooks []ModHook[I]) {
-	p.hooksMutex.Lock()
-	p.hooks = append([]ModHook[I]{}, hooks...) // Defensive copy
-	p.hooksMutex.Unlock()
+	p.chain.setHooks(unnamed(hooks))
+}
+
+// SetNamedHooks updates the hooks in the modification pipeline, keeping the
+// ones added with AddHook.
+func (p *ModPipeline[I]) SetNamedHooks(hooks []NamedModHook[I]) {
+	p.chain.setHooks(hooks)
+}
+
+// AddHook adds a hook to the modification pipeline and returns a function
+// that removes it.
+func (p *ModPipeline[I]) AddHook(hook NamedModHook[I]) func() {
+	return p.chain.add(hook)
+}
+
+// SetName sets the name the pipeline is reported with in the metrics. It
+// must be called before the pipeline is used.
+func (p *ModPipeline[I]) SetName(name string) {
+	p.name = name
+}
+
+// Hooks returns the hooks of the modification pipeline in the order they run.
+func (p *ModPipeline[I]) Hooks() []HookInfo {
+	return p.chain.info()
+}
+
+// runReadOnly runs a read-only hook, recovering from panics and giving up
+// after the timeout of the hook. The item must be a copy owned by the hook.
+func runReadOnly[I PipelineItem](e *entry[ReadOnlyHook[I]], r I) error {
+	call := func() (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = fmt.Errorf("hook '%s' panicked: %v", e.Name, p)
+			}
+		}()
+		return e.Hook(r)
+	}
+
+	if e.Timeout <= 0 {
+		return call()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- call()
+	}()
+
+	timer := time.NewTimer(e.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return fmt.Errorf("hook '%s' timed out after %s", e.Name, e.Timeout)
+	}
+}
+
+// runMod runs a modification hook, recovering from panics and giving up
+// after the timeout of the hook. Hooks that have a timeout or fail open get a
+// copy of the item, so that r is unchanged when they fail, and the hooks
+// that omit bodies get a copy without the body.
+func runMod[I PipelineItem](e *entry[ModHook[I]], r I) (I, error) {
+	in := r
+	if e.Filter.OmitBodies {
+		in = withoutBody(r)
+	} else if e.Timeout > 0 || e.Policy == FailOpen {
+		in = clone(r)
+	}
+
+	call := func() (modified I, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				modified, err = r, fmt.Errorf("hook '%s' panicked: %v", e.Name, p)
+			}
+		}()
+		modified, err = e.Hook(in)
+		if err == nil && e.Filter.OmitBodies {
+			restoreBody(modified, r)
+		}
+		return modified, err
+	}
+
+	if e.Timeout <= 0 {
+		modified, err := call()
+		if err != nil {
+			return r, err
+		}
+		return modified, nil
+	}
+
+	type result struct {
+		modified I
+		err      error
+	}
+	done := make(chan result, 1)
+	go func() {
+		modified, err := call()
+		done <- result{modified, err}
+	}()
+
+	timer := time.NewTimer(e.Timeout)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return r, res.err
+		}
+		return res.modified, nil
+	case <-timer.C:
+		return r, fmt.Errorf("hook '%s' timed out after %s", e.Name, e.Timeout)
+	}
 }
 
 // clone creates a copy of the pipeline item to prevent unintended modifications.
@@ -168,6 +338,8 @@ func clone[I PipelineItem](r I) I {
 		return any(httpbytes.CloneRequest(v)).(I)
 	case *http.Response:
 		return any(httpbytes.CloneResponse(v)).(I)
+	case *flow.Flow:
+		return any(v.Clone()).(I)
 	default:
 		panic(fmt.Sprintf("Error: invalid type in clone function: %T", r))
 	}
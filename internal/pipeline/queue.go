@@ -0,0 +1,382 @@
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/spool"
+)
+
+// DefaultBlockWait is the time a full queue with the Block policy waits for
+// room when the policy does not set it.
+const DefaultBlockWait = 5 * time.Second
+
+// ErrQueueFull is returned when an item is dropped because a queue is full.
+var ErrQueueFull = errors.New("pipeline queue full")
+
+// Overflow defines what a queue does with the items that do not fit in it.
+type Overflow int
+
+const (
+	// Drop drops the item.
+	Drop Overflow = iota
+	// Block waits for room up to the wait of the policy, then drops it.
+	Block
+	// Spool writes the item to a queue in disk, which is delivered once
+	// there is room.
+	Spool
+)
+
+// ParseOverflow parses the name of an overflow policy: drop, block or spool.
+func ParseOverflow(name string) (Overflow, error) {
+	switch name {
+	case "", "drop":
+		return Drop, nil
+	case "block":
+		return Block, nil
+	case "spool":
+		return Spool, nil
+	default:
+		return Drop, fmt.Errorf("invalid overflow policy '%s'", name)
+	}
+}
+
+// OverflowPolicy is the overflow policy of a queue. SpoolDir is the
+// directory of the disk queue of the Spool policy.
+type OverflowPolicy struct {
+	Overflow Overflow
+	Wait     time.Duration
+	SpoolDir string
+}
+
+// Queue is a bounded queue of items that applies an overflow policy when it
+// is full, and counts the items it drops.
+type Queue[I PipelineItem] struct {
+	items chan I
+
+	mutex  sync.RWMutex
+	policy OverflowPolicy
+	spool  *spool.Queue
+	closed bool
+
+	// policyMutex serializes the changes of policy and Close, which start
+	// and stop the spool reader
+	policyMutex sync.Mutex
+
+	// interrupt is closed by SetPolicy and Close before they lock the
+	// mutex, so that the pushes waiting for room release it and try again
+	interrupt chan struct{}
+
+	// wake signals the spool reader that there are new records
+	wake        chan struct{}
+	stopReader  chan struct{}
+	readerGroup sync.WaitGroup
+
+	dropped atomic.Uint64
+}
+
+// NewQueue creates a queue with room for size items in memory.
+func NewQueue[I PipelineItem](size int, policy OverflowPolicy) (*Queue[I], error) {
+	q := &Queue[I]{
+		items:     make(chan I, size),
+		wake:      make(chan struct{}, 1),
+		interrupt: make(chan struct{}),
+	}
+	if err := q.SetPolicy(policy); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// SetPolicy changes the overflow policy of the queue. The records spooled
+// with a previous policy stay in their directory and are delivered when a
+// queue uses it again.
+func (q *Queue[I]) SetPolicy(policy OverflowPolicy) error {
+	q.policyMutex.Lock()
+	defer q.policyMutex.Unlock()
+
+	var sp *spool.Queue
+	if policy.Overflow == Spool {
+		if policy.SpoolDir == "" {
+			return fmt.Errorf("the spool overflow policy requires a spool directory")
+		}
+
+		q.mutex.RLock()
+		current := q.spool
+		currentDir := q.policy.SpoolDir
+		q.mutex.RUnlock()
+
+		if current != nil && currentDir == policy.SpoolDir {
+			sp = current
+		} else {
+			var err error
+			if sp, err = spool.Open(policy.SpoolDir); err != nil {
+				return err
+			}
+		}
+	}
+
+	q.stopSpoolReader()
+
+	close(q.interrupt)
+	q.mutex.Lock()
+	q.interrupt = make(chan struct{})
+	if q.spool != nil && q.spool != sp {
+		q.spool.Close()
+	}
+	q.policy = policy
+	q.spool = sp
+	q.mutex.Unlock()
+
+	if sp != nil {
+		q.startSpoolReader(sp)
+	}
+	return nil
+}
+
+// Items returns the channel the items of the queue are received from. It is
+// closed by Close.
+func (q *Queue[I]) Items() <-chan I {
+	return q.items
+}
+
+// Push adds an item to the queue, applying the overflow policy if it is
+// full. It returns ErrQueueFull if the item is dropped.
+func (q *Queue[I]) Push(item I) error {
+	var deadline time.Time
+	for {
+		interrupted, err := q.push(item, &deadline)
+		if !interrupted {
+			return err
+		}
+	}
+}
+
+// push reports whether the wait for room was interrupted by SetPolicy or
+// Close, in which case the item is pushed again with the new state. The
+// deadline of the wait is kept across the attempts.
+func (q *Queue[I]) push(item I, deadline *time.Time) (bool, error) {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+
+	if q.closed {
+		q.dropped.Add(1)
+		return false, ErrQueueFull
+	}
+
+	// items go to the spool while it has records, to keep their order
+	if q.spool != nil && q.spool.Len() > 0 {
+		return false, q.pushToSpool(item)
+	}
+
+	select {
+	case q.items <- item:
+		return false, nil
+	default:
+	}
+
+	switch q.policy.Overflow {
+	case Block:
+		if deadline.IsZero() {
+			wait := q.policy.Wait
+			if wait <= 0 {
+				wait = DefaultBlockWait
+			}
+			*deadline = time.Now().Add(wait)
+		}
+		timer := time.NewTimer(time.Until(*deadline))
+		defer timer.Stop()
+		select {
+		case q.items <- item:
+			return false, nil
+		case <-q.interrupt:
+			return true, nil
+		case <-timer.C:
+		}
+
+	case Spool:
+		return false, q.pushToSpool(item)
+	}
+
+	q.dropped.Add(1)
+	return false, ErrQueueFull
+}
+
+// pushToSpool must be called with the mutex read locked
+func (q *Queue[I]) pushToSpool(item I) error {
+	record, err := encodeItem(clone(item))
+	if err == nil {
+		err = q.spool.Push(record)
+	}
+	if err != nil {
+		q.dropped.Add(1)
+		return fmt.Errorf("could not spool item: %v", err)
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Dropped returns the number of items dropped by the queue
+func (q *Queue[I]) Dropped() uint64 {
+	return q.dropped.Load()
+}
+
+// Spooled returns the number of items waiting in the spool
+func (q *Queue[I]) Spooled() int {
+	q.mutex.RLock()
+	defer q.mutex.RUnlock()
+	if q.spool == nil {
+		return 0
+	}
+	return q.spool.Len()
+}
+
+// Len returns the number of items waiting in memory
+func (q *Queue[I]) Len() int {
+	return len(q.items)
+}
+
+// Close closes the queue. With the Spool policy, the items waiting in memory
+// are written to the spool so that they are delivered by the next queue
+// that uses it; otherwise they are dropped.
+func (q *Queue[I]) Close() {
+	q.policyMutex.Lock()
+	defer q.policyMutex.Unlock()
+
+	q.stopSpoolReader()
+
+	close(q.interrupt)
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.interrupt = make(chan struct{})
+
+	if q.closed {
+		return
+	}
+	q.closed = true
+
+	if q.spool != nil {
+	DRAIN:
+		for {
+			select {
+			case item := <-q.items:
+				record, err := encodeItem(item)
+				if err == nil {
+					err = q.spool.Push(record)
+				}
+				if err != nil {
+					log.Printf("Could not spool item: %v", err)
+					q.dropped.Add(1)
+				}
+			default:
+				break DRAIN
+			}
+		}
+		q.spool.Close()
+	}
+	close(q.items)
+}
+
+func (q *Queue[I]) startSpoolReader(sp *spool.Queue) {
+	q.stopReader = make(chan struct{})
+	q.readerGroup.Add(1)
+	go q.readSpool(sp, q.stopReader)
+}
+
+func (q *Queue[I]) stopSpoolReader() {
+	if q.stopReader != nil {
+		close(q.stopReader)
+		q.readerGroup.Wait()
+		q.stopReader = nil
+	}
+}
+
+// readSpool moves the records of the spool to the queue as it gets room. A
+// record is only removed from the spool once it is in the queue.
+func (q *Queue[I]) readSpool(sp *spool.Queue, stop <-chan struct{}) {
+	defer q.readerGroup.Done()
+
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		for {
+			record, ok, err := sp.Peek()
+			if err != nil {
+				log.Printf("Could not read spool: %v", err)
+				break
+			}
+			if !ok {
+				break
+			}
+
+			item, err := decodeItem[I](record)
+			if err != nil {
+				log.Printf("Dropping invalid spooled item: %v", err)
+				q.dropped.Add(1)
+			} else {
+				select {
+				case q.items <- item:
+				case <-stop:
+					return
+				}
+			}
+
+			if err := sp.Commit(); err != nil {
+				log.Printf("Could not update spool: %v", err)
+			}
+		}
+
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// encodeItem encodes an item as a spool record
+func encodeItem[I PipelineItem](r I) ([]byte, error) {
+	switch v := any(r).(type) {
+	case *http.Request:
+		return spool.EncodeRequest(v)
+	case *http.Response:
+		return spool.EncodeResponse(v)
+	case *flow.Flow:
+		return spool.EncodeFlow(v)
+	default:
+		return nil, fmt.Errorf("invalid type in encodeItem function: %T", r)
+	}
+}
+
+// decodeItem decodes an item from a spool record
+func decodeItem[I PipelineItem](record []byte) (I, error) {
+	var item I
+	var decoded any
+	var err error
+	switch any(item).(type) {
+	case *http.Request:
+		decoded, err = spool.DecodeRequest(record)
+	case *http.Response:
+		decoded, err = spool.DecodeResponse(record)
+	case *flow.Flow:
+		decoded, err = spool.DecodeFlow(record)
+	default:
+		return item, fmt.Errorf("invalid type in decodeItem function: %T", item)
+	}
+	if err != nil {
+		return item, err
+	}
+	return decoded.(I), nil
+}
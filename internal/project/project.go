@@ -0,0 +1,185 @@
+package project
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/artilugio0/efin-proxy/internal/certs"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+)
+
+// Names of the files stored in a project directory
+const (
+	SettingsFile    = "project.json"
+	HistoryFile     = "history.db"
+	CertificateFile = "ca.crt"
+	KeyFile         = "ca.key"
+)
+
+// Settings are the project settings persisted in the project.json file
+type Settings struct {
+	Name string `json:"name"`
+
+	DomainRe           string   `json:"scope_domain_re"`
+	ExcludedExtensions []string `json:"scope_excluded_extensions"`
+
+	MatchReplaceRules []hooks.MatchReplaceRule `json:"match_replace_rules"`
+
+	Notes string `json:"notes"`
+}
+
+// Project is a directory that bundles the history database, the scope,
+// match and replace rules, notes and the CA of an engagement
+type Project struct {
+	Dir string
+
+	settingsMutex sync.RWMutex
+	settings      Settings
+
+	RootCA  *x509.Certificate
+	RootKey *rsa.PrivateKey
+}
+
+// Open loads the project in dir. If the directory does not exist, a new
+// project is created with the given default settings and a new CA.
+func Open(dir string, defaults Settings) (*Project, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create project directory: %v", err)
+	}
+
+	p := &Project{
+		Dir:           dir,
+		settingsMutex: sync.RWMutex{},
+	}
+
+	data, err := os.ReadFile(p.path(SettingsFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &p.settings); err != nil {
+			return nil, fmt.Errorf("invalid project settings file: %v", err)
+		}
+	case os.IsNotExist(err):
+		p.settings = defaults
+		if p.settings.Name == "" {
+			p.settings.Name = filepath.Base(dir)
+		}
+		if err := p.save(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	if err := p.loadCA(); err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// DBFile returns the path of the history database of the project
+func (p *Project) DBFile() string {
+	return p.path(HistoryFile)
+}
+
+// CertificateFile returns the path of the CA certificate of the project
+func (p *Project) CertificateFile() string {
+	return p.path(CertificateFile)
+}
+
+// KeyFile returns the path of the CA private key of the project
+func (p *Project) KeyFile() string {
+	return p.path(KeyFile)
+}
+
+// Settings returns a copy of the project settings
+func (p *Project) Settings() Settings {
+	p.settingsMutex.RLock()
+	defer p.settingsMutex.RUnlock()
+
+	s := p.settings
+	s.ExcludedExtensions = append([]string(nil), p.settings.ExcludedExtensions...)
+	s.MatchReplaceRules = append([]hooks.MatchReplaceRule(nil), p.settings.MatchReplaceRules...)
+	return s
+}
+
+// Configure sets the project settings, database and CA in the proxy config
+func (p *Project) Configure(c *proxy.Config) {
+	s := p.Settings()
+
+	c.Project = p.Dir
+	c.ProjectNotes = s.Notes
+	c.DBFile = p.DBFile()
+	c.DomainRe = s.DomainRe
+	c.ExcludedExtensions = s.ExcludedExtensions
+	c.MatchReplaceRules = s.MatchReplaceRules
+	c.RootCA = p.RootCA
+	c.RootKey = p.RootKey
+}
+
+// Update stores the scope, rules and notes of the proxy config in the project
+func (p *Project) Update(c *proxy.Config) error {
+	p.settingsMutex.Lock()
+	defer p.settingsMutex.Unlock()
+
+	p.settings.DomainRe = c.DomainRe
+	p.settings.ExcludedExtensions = append([]string(nil), c.ExcludedExtensions...)
+	p.settings.MatchReplaceRules = append([]hooks.MatchReplaceRule(nil), c.MatchReplaceRules...)
+	p.settings.Notes = c.ProjectNotes
+
+	return p.save()
+}
+
+// save writes the settings file. The caller must hold the settings lock or
+// have exclusive access to the project.
+func (p *Project) save() error {
+	data, err := json.MarshalIndent(p.settings, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.WriteFile(p.path(SettingsFile), data, 0600); err != nil {
+		return fmt.Errorf("failed to save project settings: %v", err)
+	}
+
+	return nil
+}
+
+// loadCA loads the project CA, generating it if the project does not have one
+func (p *Project) loadCA() error {
+	_, certErr := os.Stat(p.CertificateFile())
+	_, keyErr := os.Stat(p.KeyFile())
+
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		_, _, certPEM, keyPEM, err := certs.GenerateRootCA()
+		if err != nil {
+			return fmt.Errorf("failed to generate project CA: %v", err)
+		}
+		if err := os.WriteFile(p.CertificateFile(), []byte(certPEM), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p.KeyFile(), []byte(keyPEM), 0600); err != nil {
+			return err
+		}
+	}
+
+	rootCA, rootKey, err := certs.LoadRootCA(p.CertificateFile(), p.KeyFile())
+	if err != nil {
+		return fmt.Errorf("failed to load project CA: %v", err)
+	}
+
+	p.RootCA = rootCA
+	p.RootKey = rootKey
+
+	return nil
+}
+
+func (p *Project) path(name string) string {
+	return filepath.Join(p.Dir, name)
+}
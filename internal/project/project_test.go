@@ -0,0 +1,84 @@
+package project
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+)
+
+func TestOpenCreatesProject(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "acme")
+
+	p, err := Open(dir, Settings{DomainRe: `acme\.com`, ExcludedExtensions: []string{"png"}})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	for _, name := range []string{SettingsFile, CertificateFile, KeyFile} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Errorf("expected %s to exist: %v", name, err)
+		}
+	}
+
+	s := p.Settings()
+	if s.Name != "acme" {
+		t.Errorf("Name = %q, want %q", s.Name, "acme")
+	}
+	if s.DomainRe != `acme\.com` {
+		t.Errorf("DomainRe = %q, want %q", s.DomainRe, `acme\.com`)
+	}
+	if p.RootCA == nil || p.RootKey == nil {
+		t.Fatalf("project CA was not loaded")
+	}
+}
+
+func TestOpenExistingProject(t *testing.T) {
+	dir := t.TempDir()
+
+	p, err := Open(dir, Settings{DomainRe: "first"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	config := &proxy.Config{}
+	p.Configure(config)
+	config.DomainRe = "updated"
+	config.ProjectNotes = "some notes"
+	config.MatchReplaceRules = []hooks.MatchReplaceRule{
+		{Target: hooks.TargetRequestHeader, Match: "^X-A: .*$", Replace: "", Enabled: true},
+	}
+	if err := p.Update(config); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+
+	reopened, err := Open(dir, Settings{DomainRe: "ignored"})
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	s := reopened.Settings()
+	if s.DomainRe != "updated" {
+		t.Errorf("DomainRe = %q, want %q", s.DomainRe, "updated")
+	}
+	if s.Notes != "some notes" {
+		t.Errorf("Notes = %q, want %q", s.Notes, "some notes")
+	}
+	if len(s.MatchReplaceRules) != 1 {
+		t.Errorf("got %d match and replace rules, want 1", len(s.MatchReplaceRules))
+	}
+	if !reopened.RootCA.Equal(p.RootCA) {
+		t.Errorf("reopened project has a different CA")
+	}
+
+	config = &proxy.Config{}
+	reopened.Configure(config)
+	if config.DBFile != filepath.Join(dir, HistoryFile) {
+		t.Errorf("DBFile = %q, want %q", config.DBFile, filepath.Join(dir, HistoryFile))
+	}
+	if config.Project != dir {
+		t.Errorf("Project = %q, want %q", config.Project, dir)
+	}
+}
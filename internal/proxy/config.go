@@ -1,82 +1,287 @@
 package proxy
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
 	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 	"regexp"
+	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/authz"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
 	"github.com/artilugio0/efin-proxy/internal/hooks"
 	"github.com/artilugio0/efin-proxy/internal/ids"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
+	"github.com/artilugio0/efin-proxy/internal/scanner"
 	"github.com/artilugio0/efin-proxy/internal/scope"
+	"github.com/artilugio0/efin-proxy/internal/secrets"
+	"github.com/artilugio0/efin-proxy/internal/session"
+)
+
+// DefaultRetentionInterval is the time between retention policy checks used
+// when Config.RetentionInterval is not set
+const DefaultRetentionInterval = 10 * time.Minute
+
+// Priorities of the built-in mod hooks. Hooks run in increasing order of
+// priority; the other built-in hooks, the user hooks and the gRPC clients
+// have priority 0 unless set.
+const (
+	sessionResponsePriority = -300
+	matchReplacePriority    = -200
+	sessionRequestPriority  = 100
 )
 
 type Config struct {
 	IDProvider ids.IDProvider
 
+	// Project is the directory of the project the settings were loaded
+	// from, if any
+	Project      string
+	ProjectNotes string
+
+	// RootCA and RootKey replace the CA of the proxy when set
+	RootCA  *x509.Certificate
+	RootKey *rsa.PrivateKey
+
 	DBFile    string
 	PrintLogs bool
 	SaveDir   string
 
+	Retention         hooks.RetentionPolicy
+	RetentionInterval time.Duration
+
+	SaveLayout       string
+	SaveBodyFiles    bool
+	SaveMetadata     bool
+	SaveMaxSize      int64
+	SaveGzipSessions bool
+
+	JSONLFile       string
+	JSONLMaxSize    int64
+	JSONLMaxBackups int
+
 	DomainRe           string
 	ExcludedExtensions []string
 
-	RequestInHooks  []pipeline.ReadOnlyHook[*http.Request]
-	RequestModHooks []pipeline.ModHook[*http.Request]
-	RequestOutHooks []pipeline.ReadOnlyHook[*http.Request]
+	MatchReplaceRules []hooks.MatchReplaceRule
+
+	// PassiveScan runs the passive scanner on in scope responses
+	PassiveScan bool
+
+	// DetectSecrets reports the secrets found in in scope requests and
+	// responses. SecretRulesFile adds rules to the default ones.
+	DetectSecrets   bool
+	SecretRulesFile string
+
+	// RedactSecrets replaces the secrets in the flows written to the
+	// database, save directory and JSON Lines file
+	RedactSecrets bool
+
+	// AuthzConfigFile enables the authorization tester, which replays in
+	// scope requests with the sessions of the file
+	AuthzConfigFile string
+
+	// SessionRulesFile enables session handling: a cookie jar, tokens
+	// injected in matching requests and macros run when sessions expire
+	SessionRulesFile string
+
+	// Findings receives the findings of the scanners, they are stored in
+	// DBFile as well when it is set
+	Findings *findings.Broker
+
+	RequestInHooks  []pipeline.NamedReadOnlyHook[*http.Request]
+	RequestModHooks []pipeline.NamedModHook[*http.Request]
+	RequestOutHooks []pipeline.NamedReadOnlyHook[*http.Request]
+
+	ResponseInHooks  []pipeline.NamedReadOnlyHook[*http.Response]
+	ResponseModHooks []pipeline.NamedModHook[*http.Response]
+	ResponseOutHooks []pipeline.NamedReadOnlyHook[*http.Response]
+
+	// FlowOutHooks run once for each completed exchange of an in scope
+	// request, with the request and response before and after the mod hooks
+	FlowOutHooks []pipeline.NamedReadOnlyHook[*flow.Flow]
 
-	ResponseInHooks  []pipeline.ReadOnlyHook[*http.Response]
-	ResponseModHooks []pipeline.ModHook[*http.Response]
-	ResponseOutHooks []pipeline.ReadOnlyHook[*http.Response]
+	// HookPriorities overrides the priority of the hooks with the given
+	// names, including the built-in ones such as match-replace or session
+	HookPriorities map[string]int
+
+	// HookOptions overrides the timeout, error policy and circuit breaker
+	// settings of the hooks with the given names
+	HookOptions map[string]pipeline.Options
+
+	// Overflow sets the overflow policies of the read-only pipelines by
+	// name, see ReadOnlyPipelines. They drop the items that do not fit in
+	// their queue by default.
+	Overflow map[string]pipeline.OverflowPolicy
+
+	// SpoolDir is the directory of the disk queues of the pipelines and
+	// gRPC clients with the spool overflow policy
+	SpoolDir string
 }
 
 func (c *Config) Apply(p *Proxy) error {
-	requestInHooks := append([]pipeline.ReadOnlyHook[*http.Request]{}, c.RequestInHooks...)
-	requestModHooks := append([]pipeline.ModHook[*http.Request]{}, c.RequestModHooks...)
-	requestOutHooks := append([]pipeline.ReadOnlyHook[*http.Request]{}, c.RequestOutHooks...)
-	responseInHooks := append([]pipeline.ReadOnlyHook[*http.Response]{}, c.ResponseInHooks...)
-	responseModHooks := append([]pipeline.ModHook[*http.Response]{}, c.ResponseModHooks...)
-	responseOutHooks := append([]pipeline.ReadOnlyHook[*http.Response]{}, c.ResponseOutHooks...)
+	requestInHooks := append([]pipeline.NamedReadOnlyHook[*http.Request]{}, c.RequestInHooks...)
+	requestModHooks := append([]pipeline.NamedModHook[*http.Request]{}, c.RequestModHooks...)
+	requestOutHooks := append([]pipeline.NamedReadOnlyHook[*http.Request]{}, c.RequestOutHooks...)
+	responseInHooks := append([]pipeline.NamedReadOnlyHook[*http.Response]{}, c.ResponseInHooks...)
+	responseModHooks := append([]pipeline.NamedModHook[*http.Response]{}, c.ResponseModHooks...)
+	responseOutHooks := append([]pipeline.NamedReadOnlyHook[*http.Response]{}, c.ResponseOutHooks...)
+	flowOutHooks := append([]pipeline.NamedReadOnlyHook[*flow.Flow]{}, c.FlowOutHooks...)
 
 	// Add logging hooks if -p is set
 	if c.PrintLogs {
-		requestOutHooks = append(requestOutHooks, hooks.LogRawRequest)
-		responseInHooks = append(responseInHooks, hooks.LogRawResponse)
+		requestOutHooks = append(requestOutHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: "log", Hook: hooks.LogRawRequest})
+		responseInHooks = append(responseInHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "log", Hook: hooks.LogRawResponse})
 		log.Printf("Enabled raw request/response logging to stdout")
 	}
 
-	// Add Accept-Encoding removal hook
-	requestModHooks = append(requestModHooks, func(r *http.Request) (*http.Request, error) {
-		r.Header.Del("Accept-Encoding")
-		return r, nil
-	})
+	// Add match and replace hooks before the user defined mod hooks run
+	if len(c.MatchReplaceRules) > 0 {
+		matchReplaceRequest, matchReplaceResponse, err := hooks.NewMatchReplaceHooks(c.MatchReplaceRules)
+		if err != nil {
+			return err
+		}
+		requestModHooks = append(requestModHooks, pipeline.NamedModHook[*http.Request]{
+			Name: "match-replace", Priority: matchReplacePriority, Hook: matchReplaceRequest,
+		})
+		responseModHooks = append(responseModHooks, pipeline.NamedModHook[*http.Response]{
+			Name: "match-replace", Priority: matchReplacePriority, Hook: matchReplaceResponse,
+		})
+	}
+
+	// Add session handling hooks. The response hook runs first so that the
+	// responses of requests sent again go through the other mod hooks.
+	if c.SessionRulesFile != "" {
+		sessionConfig, err := session.LoadConfig(c.SessionRulesFile)
+		if err != nil {
+			return err
+		}
+		handler := session.NewHandler(sessionConfig)
+		requestModHooks = append(requestModHooks, pipeline.NamedModHook[*http.Request]{
+			Name: "session", Priority: sessionRequestPriority, Hook: session.NewRequestHook(handler),
+		})
+		responseModHooks = append(responseModHooks, pipeline.NamedModHook[*http.Response]{
+			Name: "session", Priority: sessionResponsePriority, Hook: session.NewResponseHook(handler),
+		})
+		log.Printf("Enabled session handling with %d rules", len(sessionConfig.Rules))
+	}
+
+	var detector *secrets.Detector
+	if c.DetectSecrets || c.RedactSecrets {
+		detector = secrets.Default
+		if c.SecretRulesFile != "" {
+			rules, err := secrets.LoadRules(c.SecretRulesFile)
+			if err != nil {
+				return err
+			}
+			// custom rules go first to take precedence over the default ones
+			detector = secrets.NewDetector(append(rules, secrets.DefaultRules...))
+		}
+	}
+
+	// redact wraps the hooks that write flows to disk
+	redactRequest := func(h pipeline.ReadOnlyHook[*http.Request]) pipeline.ReadOnlyHook[*http.Request] { return h }
+	redactResponse := func(h pipeline.ReadOnlyHook[*http.Response]) pipeline.ReadOnlyHook[*http.Response] { return h }
+	if c.RedactSecrets {
+		redactRequest = func(h pipeline.ReadOnlyHook[*http.Request]) pipeline.ReadOnlyHook[*http.Request] {
+			return secrets.RedactRequestHook(detector, h)
+		}
+		redactResponse = func(h pipeline.ReadOnlyHook[*http.Response]) pipeline.ReadOnlyHook[*http.Response] {
+			return secrets.RedactResponseHook(detector, h)
+		}
+		log.Printf("Redacting secrets from saved flows")
+	}
 
 	// Add database save hooks if database is initialized
 	if c.DBFile != "" {
-		// this might cause some requests with repeated ids
-		// TODO: handle error
-		idProvider, err := hooks.NewDBIDProvider(c.DBFile)
+		// the provider is shared with the repeater and the other tools that
+		// save flows, so that they do not take the IDs of captured flows
+		idProvider, err := hooks.SharedDBIDProvider(c.DBFile)
 		if err != nil {
 			return err
 		}
 		p.SetIDProvider(idProvider)
 
 		saveRequest, saveResponse := hooks.NewDBSaveHooks(c.DBFile)
-		requestOutHooks = append(requestOutHooks, saveRequest)
-		responseInHooks = append(responseInHooks, saveResponse)
+		requestOutHooks = append(requestOutHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: "db-save", Hook: redactRequest(saveRequest)})
+		responseInHooks = append(responseInHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "db-save", Hook: redactResponse(saveResponse)})
 		log.Printf("Saving requests and responses to database at %s", c.DBFile)
+
+		if !c.Retention.IsZero() {
+			interval := c.RetentionInterval
+			if interval == 0 {
+				interval = DefaultRetentionInterval
+			}
+			hooks.StartRetentionJob(c.DBFile, c.Retention, interval)
+			log.Printf("Enforcing retention policy on %s every %s", c.DBFile, interval)
+		} else {
+			hooks.StopRetentionJob(c.DBFile)
+		}
 	} else {
 		p.SetIDProvider(ids.NewDefaultProvider())
 	}
 
 	// Add file save hooks if directory is specified
 	if c.SaveDir != "" {
-		saveRequest, saveResponse := hooks.NewFileSaveHooks(c.SaveDir)
-		requestOutHooks = append(requestOutHooks, saveRequest)
-		responseInHooks = append(responseInHooks, saveResponse)
+		saveRequest, saveResponse, err := hooks.NewFileSaveHooksWithOptions(hooks.FileSaveOptions{
+			Dir:             c.SaveDir,
+			Layout:          c.SaveLayout,
+			BodyFiles:       c.SaveBodyFiles,
+			Metadata:        c.SaveMetadata,
+			MaxTotalSize:    c.SaveMaxSize,
+			GzipOldSessions: c.SaveGzipSessions,
+		})
+		if err != nil {
+			return err
+		}
+		requestOutHooks = append(requestOutHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: "file-save", Hook: redactRequest(saveRequest)})
+		responseInHooks = append(responseInHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "file-save", Hook: redactResponse(saveResponse)})
 		log.Printf("Saving requests and responses to directory: %s", c.SaveDir)
 	}
 
+	// Add JSON Lines hook if an output is specified. It records the
+	// responses to out of scope requests too, flagged as such.
+	var responseLogHooks []pipeline.NamedReadOnlyHook[*http.Response]
+	if c.JSONLFile != "" {
+		var w io.Writer = os.Stdout
+		if c.JSONLFile != "-" {
+			w = hooks.SharedRotatingFile(c.JSONLFile, c.JSONLMaxSize, c.JSONLMaxBackups)
+		}
+		responseLogHooks = append(responseLogHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "jsonl", Hook: redactResponse(hooks.NewJSONLHook(w))})
+		log.Printf("Writing JSON Lines flows to %s", c.JSONLFile)
+	}
+
+	// Add scanner hooks if enabled, sharing the sink to de-duplicate their
+	// findings
+	var findingSink findings.Sink
+	if c.PassiveScan || c.DetectSecrets || c.AuthzConfigFile != "" {
+		findingSink = hooks.NewFindingSink(c.DBFile, c.Findings)
+	}
+	if c.PassiveScan {
+		responseOutHooks = append(responseOutHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "passive-scan", Hook: scanner.NewPassiveScanHook(findingSink)})
+		log.Printf("Enabled passive scanner")
+	}
+	if c.DetectSecrets {
+		requestOutHooks = append(requestOutHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: "secrets", Hook: secrets.NewRequestHook(detector, findingSink)})
+		responseInHooks = append(responseInHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "secrets", Hook: secrets.NewResponseHook(detector, findingSink)})
+		log.Printf("Enabled secret detection")
+	}
+	if c.AuthzConfigFile != "" {
+		authzConfig, err := authz.LoadConfig(c.AuthzConfigFile)
+		if err != nil {
+			return err
+		}
+		tester := authz.NewTester(authzConfig, c.DBFile, findingSink)
+		responseOutHooks = append(responseOutHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: "authz", Hook: authz.NewHook(tester)})
+		log.Printf("Enabled authorization tests with %d sessions", len(authzConfig.Sessions))
+	}
+
 	var domainRe *regexp.Regexp
 	if c.DomainRe != "" {
 		var err error
@@ -88,12 +293,52 @@ func (c *Config) Apply(p *Proxy) error {
 	scope := scope.New(domainRe, c.ExcludedExtensions)
 	p.SetScope(scope.IsInScope)
 
-	p.SetRequestInHooks(requestInHooks)
-	p.SetRequestModHooks(requestModHooks)
-	p.SetRequestOutHooks(requestOutHooks)
-	p.SetResponseInHooks(responseInHooks)
-	p.SetResponseModHooks(responseModHooks)
-	p.SetResponseOutHooks(responseOutHooks)
+	if c.RootCA != nil && c.RootKey != nil {
+		p.SetRootCA(c.RootCA, c.RootKey)
+	}
+
+	for name := range c.Overflow {
+		if p.readOnlyPipeline(name) == nil {
+			return fmt.Errorf("unknown read-only pipeline '%s'", name)
+		}
+	}
+	for _, name := range ReadOnlyPipelines {
+		policy := c.Overflow[name]
+		if policy.Overflow == pipeline.Spool && policy.SpoolDir == "" {
+			if c.SpoolDir == "" {
+				return fmt.Errorf("the spool overflow policy of %s requires a spool directory", name)
+			}
+			policy.SpoolDir = filepath.Join(c.SpoolDir, name)
+		}
+		if err := p.SetOverflowPolicy(name, policy); err != nil {
+			return err
+		}
+	}
+
+	p.SetNamedHooks(Hooks{
+		RequestIn:   configureHooks(requestInHooks, c),
+		RequestMod:  configureHooks(requestModHooks, c),
+		RequestOut:  configureHooks(requestOutHooks, c),
+		ResponseIn:  configureHooks(responseInHooks, c),
+		ResponseMod: configureHooks(responseModHooks, c),
+		ResponseOut: configureHooks(responseOutHooks, c),
+		FlowOut:     configureHooks(flowOutHooks, c),
+		ResponseLog: configureHooks(responseLogHooks, c),
+	})
 
 	return nil
 }
+
+// configureHooks sets the priorities and options of the hooks found in
+// HookPriorities and HookOptions
+func configureHooks[F any](hooks []pipeline.Named[F], c *Config) []pipeline.Named[F] {
+	for i := range hooks {
+		if priority, ok := c.HookPriorities[hooks[i].Name]; ok {
+			hooks[i].Priority = priority
+		}
+		if options, ok := c.HookOptions[hooks[i].Name]; ok {
+			hooks[i].Options = options
+		}
+	}
+	return hooks
+}
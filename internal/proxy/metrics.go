@@ -0,0 +1,97 @@
+package proxy
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/artilugio0/efin-proxy/internal/metrics"
+)
+
+var (
+	requestsTotal = metrics.NewCounterVec(
+		"efin_proxy_requests_total",
+		"Requests proxied, by host and status code of the response sent to the client.",
+		"host", "status",
+	)
+
+	scopeRequestsTotal = metrics.NewCounterVec(
+		"efin_proxy_scope_requests_total",
+		"Requests proxied, by whether they were in scope.",
+		"scope",
+	)
+
+	activeTunnels = metrics.NewGaugeVec(
+		"efin_proxy_active_tunnels",
+		"CONNECT tunnels open.",
+	)
+)
+
+// countRequest counts a proxied request with the status sent to the client
+func countRequest(req *http.Request, inScope bool, status int) {
+	host := req.URL.Hostname()
+	if host == "" {
+		host = req.Host
+		if h, _, err := net.SplitHostPort(req.Host); err == nil {
+			host = h
+		}
+	}
+	requestsTotal.Inc(host, strconv.Itoa(status))
+
+	scope := "out"
+	if inScope {
+		scope = "in"
+	}
+	scopeRequestsTotal.Inc(scope)
+}
+
+// RegisterMetrics registers the gauges of the certificate cache and the
+// queues of the read-only pipelines of the proxy in a registry
+func (p *Proxy) RegisterMetrics(r *metrics.Registry) {
+	r.NewGaugeFunc(
+		"efin_proxy_certificate_cache_size",
+		"Certificates generated for the intercepted hosts and kept in the cache.",
+		nil,
+		func() []metrics.Sample {
+			p.CertMutex.RLock()
+			defer p.CertMutex.RUnlock()
+			return []metrics.Sample{{Value: float64(len(p.CertCache))}}
+		},
+	)
+
+	r.NewGaugeFunc(
+		"efin_proxy_pipeline_queue_depth",
+		"Items waiting in memory in the queue of the read-only pipelines.",
+		[]string{"pipeline"},
+		p.pipelineSamples(func(rp overflowPipeline) float64 { return float64(rp.Queued()) }),
+	)
+
+	r.NewGaugeFunc(
+		"efin_proxy_pipeline_spooled_items",
+		"Items waiting in the spool of the read-only pipelines.",
+		[]string{"pipeline"},
+		p.pipelineSamples(func(rp overflowPipeline) float64 { return float64(rp.Spooled()) }),
+	)
+
+	r.NewCounterFunc(
+		"efin_proxy_pipeline_dropped_total",
+		"Items dropped by the read-only pipelines because their queue was full.",
+		[]string{"pipeline"},
+		p.pipelineSamples(func(rp overflowPipeline) float64 { return float64(rp.Dropped()) }),
+	)
+}
+
+// pipelineSamples returns a function that collects a value of each read-only
+// pipeline
+func (p *Proxy) pipelineSamples(value func(overflowPipeline) float64) func() []metrics.Sample {
+	return func() []metrics.Sample {
+		samples := []metrics.Sample{}
+		for _, name := range ReadOnlyPipelines {
+			samples = append(samples, metrics.Sample{
+				LabelValues: []string{name},
+				Value:       value(p.readOnlyPipeline(name)),
+			})
+		}
+		return samples
+	}
+}
@@ -2,12 +2,18 @@ package proxy
 
 import (
 	"errors"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/artilugio0/efin-proxy/internal/certs"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
 )
 
@@ -340,7 +346,7 @@ func TestProcessRequestPipelines(t *testing.T) {
 			p.requestOutPipeline = pipeline.NewReadOnlyPipeline(tt.outPipeline)
 
 			req := httptest.NewRequest("GET", "http://example.com", nil)
-			finalReq, err := p.processRequestPipelines(req)
+			finalReq, err := p.processRequestPipelines(req, nil)
 
 			wg.Wait()
 
@@ -385,3 +391,334 @@ func TestProcessRequestPipelines(t *testing.T) {
 		})
 	}
 }
+
+// TestHookChainOrder tests that native and added hooks run in a single chain
+// ordered by priority
+func TestHookChainOrder(t *testing.T) {
+	rootCA, rootKey, _, _, err := certs.GenerateRootCA()
+	if err != nil {
+		t.Fatalf("Failed to generate Root CA: %v", err)
+	}
+	p := NewProxy(rootCA, rootKey)
+
+	var order []string
+	hook := func(name string) pipeline.ModHook[*http.Request] {
+		return func(r *http.Request) (*http.Request, error) {
+			order = append(order, name)
+			return r, nil
+		}
+	}
+
+	config := &Config{
+		MatchReplaceRules: []hooks.MatchReplaceRule{
+			{Target: hooks.TargetRequestHeader, Match: "^X-A: .*$", Replace: "X-A: b", Enabled: true},
+		},
+		RequestModHooks: []pipeline.NamedModHook[*http.Request]{
+			{Name: "a", Hook: hook("a")},
+			{Name: "b", Priority: -1, Hook: hook("b")},
+		},
+		HookPriorities: map[string]int{"a": 5},
+	}
+	if err := config.Apply(p); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	p.AddRequestModHook(pipeline.NamedModHook[*http.Request]{Name: "grpc:c", Hook: hook("c")})
+	removeD := p.AddRequestModHook(pipeline.NamedModHook[*http.Request]{Name: "grpc:d", Hook: hook("d")})
+
+	// applying the config again keeps the added hooks
+	if err := config.Apply(p); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	var names []string
+	for _, h := range p.HookChains().RequestMod {
+		names = append(names, h.Name)
+	}
+	if got, want := strings.Join(names, ","), "match-replace,b,grpc:c,grpc:d,a"; got != want {
+		t.Errorf("request mod chain = %s, want %s", got, want)
+	}
+
+	req := httptest.NewRequest("GET", "http://example.com", nil)
+	if _, err := p.requestModPipeline.RunPipeline(req); err != nil {
+		t.Fatalf("RunPipeline() error = %v", err)
+	}
+	if got, want := strings.Join(order, ","), "b,c,d,a"; got != want {
+		t.Errorf("hooks ran in order %s, want %s", got, want)
+	}
+
+	removeD()
+	if chain := p.HookChains().RequestMod; len(chain) != 4 || chain[3].Name != "a" {
+		t.Errorf("unexpected chain after removing a hook: %+v", chain)
+	}
+}
+
+// TestModHookFailures tests the timeouts, error policies, panic recovery and
+// circuit breaker of mod hooks
+func TestModHookFailures(t *testing.T) {
+	rootCA, rootKey, _, _, err := certs.GenerateRootCA()
+	if err != nil {
+		t.Fatalf("Failed to generate Root CA: %v", err)
+	}
+	p := NewProxy(rootCA, rootKey)
+
+	flaky := 0
+	p.SetNamedHooks(Hooks{
+		RequestMod: []pipeline.NamedModHook[*http.Request]{
+			{
+				Name: "panic",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					r.Header.Set("X-Panic", "1")
+					panic("boom")
+				},
+				Options: pipeline.Options{Policy: pipeline.FailOpen},
+			},
+			{
+				Name: "slow",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					time.Sleep(time.Second)
+					return r, nil
+				},
+				Options: pipeline.Options{Policy: pipeline.FailOpen, Timeout: 10 * time.Millisecond},
+			},
+			{
+				Name: "flaky",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					flaky++
+					return r, errors.New("failed")
+				},
+				Options: pipeline.Options{Policy: pipeline.FailOpen, MaxFailures: 2, Cooldown: time.Hour},
+			},
+			{
+				Name: "ok",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					r.Header.Set("X-Ok", "1")
+					return r, nil
+				},
+			},
+		},
+	})
+
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		start := time.Now()
+		got, err := p.requestModPipeline.RunPipeline(req)
+		if err != nil {
+			t.Fatalf("RunPipeline() error = %v", err)
+		}
+		if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+			t.Errorf("pipeline waited %s for the slow hook", elapsed)
+		}
+		if got.Header.Get("X-Panic") != "" {
+			t.Errorf("the changes of a failed fail open hook were kept")
+		}
+		if got.Header.Get("X-Ok") != "1" {
+			t.Errorf("the hooks after the failed ones did not run")
+		}
+	}
+	// the breaker of the flaky hook opens after its second failure
+	if flaky != 2 {
+		t.Errorf("flaky hook ran %d times, want 2", flaky)
+	}
+	for _, h := range p.HookChains().RequestMod {
+		if disabled := h.Name == "flaky"; h.Disabled != disabled {
+			t.Errorf("hook %s disabled = %t, want %t", h.Name, h.Disabled, disabled)
+		}
+	}
+
+	// fail closed hooks reject every request they fail on; their breaker is
+	// off unless set, and once open it keeps rejecting without running them
+	rejecting, guarded := 0, 0
+	p.SetNamedHooks(Hooks{
+		RequestMod: []pipeline.NamedModHook[*http.Request]{
+			{
+				Name: "rejecting",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					rejecting++
+					return r, errors.New("rejected")
+				},
+			},
+		},
+	})
+	for i := 0; i < 10; i++ {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		if _, err := p.requestModPipeline.RunPipeline(req); err == nil {
+			t.Fatalf("request %d was not rejected", i)
+		}
+	}
+	if rejecting != 10 {
+		t.Errorf("rejecting hook ran %d times, want 10", rejecting)
+	}
+
+	p.SetNamedHooks(Hooks{
+		RequestMod: []pipeline.NamedModHook[*http.Request]{
+			{
+				Name: "guarded",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					guarded++
+					return r, errors.New("rejected")
+				},
+				Options: pipeline.Options{MaxFailures: 2, Cooldown: time.Hour},
+			},
+		},
+	})
+	for i := 0; i < 3; i++ {
+		req := httptest.NewRequest("GET", "http://example.com", nil)
+		if _, err := p.requestModPipeline.RunPipeline(req); err == nil {
+			t.Fatalf("request %d passed a disabled fail closed hook", i)
+		}
+	}
+	if guarded != 2 {
+		t.Errorf("guarded hook ran %d times, want 2", guarded)
+	}
+}
+
+// TestHookFilters tests that hooks only receive the items matching their
+// filters, without their bodies when requested
+func TestHookFilters(t *testing.T) {
+	rootCA, rootKey, _, _, err := certs.GenerateRootCA()
+	if err != nil {
+		t.Fatalf("Failed to generate Root CA: %v", err)
+	}
+	p := NewProxy(rootCA, rootKey)
+
+	var matched []string
+	var omittedBody string
+	p.SetNamedHooks(Hooks{
+		RequestMod: []pipeline.NamedModHook[*http.Request]{
+			{
+				Name: "filtered",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					matched = append(matched, r.Method+" "+r.Host)
+					return r, nil
+				},
+				Options: pipeline.Options{Filter: pipeline.Filter{
+					HostRe:       regexp.MustCompile(`^example\.com$`),
+					Methods:      []string{"post"},
+					ContentTypes: []string{"application/json"},
+					MaxBodySize:  10,
+				}},
+			},
+			{
+				Name: "no-bodies",
+				Hook: func(r *http.Request) (*http.Request, error) {
+					body, _ := io.ReadAll(r.Body)
+					omittedBody = string(body)
+					r.Header.Set("X-Seen", "1")
+					return r, nil
+				},
+				Options: pipeline.Options{Filter: pipeline.Filter{OmitBodies: true}},
+			},
+		},
+	})
+
+	requests := []struct {
+		method, url, contentType, body string
+	}{
+		{"POST", "http://example.com:8080/a", "application/json; charset=utf-8", `{"a":1}`},
+		{"GET", "http://example.com/a", "application/json", ""},
+		{"POST", "http://other.com/a", "application/json", `{}`},
+		{"POST", "http://example.com/a", "text/plain", "a"},
+		{"POST", "http://example.com/a", "application/json", `{"a":"too large"}`},
+	}
+
+	for _, r := range requests {
+		req := httptest.NewRequest(r.method, r.url, strings.NewReader(r.body))
+		req.Header.Set("Content-Type", r.contentType)
+		got, err := p.requestModPipeline.RunPipeline(req)
+		if err != nil {
+			t.Fatalf("RunPipeline() error = %v", err)
+		}
+
+		if omittedBody != "" {
+			t.Errorf("hook that omits bodies received body %q", omittedBody)
+		}
+		body, _ := io.ReadAll(got.Body)
+		if string(body) != r.body || got.Header.Get("X-Seen") != "1" {
+			t.Errorf("request %s %s: body = %q, X-Seen = %q", r.method, r.url, body, got.Header.Get("X-Seen"))
+		}
+	}
+
+	if got, want := strings.Join(matched, ","), "POST example.com:8080"; got != want {
+		t.Errorf("filtered hook received %s, want %s", got, want)
+	}
+}
+
+func TestReadOnlyPipelineOverflow(t *testing.T) {
+	rootCA, rootKey, _, _, err := certs.GenerateRootCA()
+	if err != nil {
+		t.Fatalf("Failed to generate Root CA: %v", err)
+	}
+
+	// run sends more requests than fit in the queue of the request-in
+	// pipeline while its hook is blocked, then releases it
+	run := func(policy pipeline.OverflowPolicy) (PipelineStats, []string) {
+		p := NewProxy(rootCA, rootKey)
+		if err := p.SetOverflowPolicy("request-in", policy); err != nil {
+			t.Fatalf("SetOverflowPolicy() error = %v", err)
+		}
+
+		release := make(chan struct{})
+		var mutex sync.Mutex
+		var received []string
+		p.SetNamedHooks(Hooks{
+			RequestIn: []pipeline.NamedReadOnlyHook[*http.Request]{{
+				Name: "blocked",
+				Hook: func(r *http.Request) error {
+					<-release
+					mutex.Lock()
+					received = append(received, r.URL.Path)
+					mutex.Unlock()
+					return nil
+				},
+			}},
+		})
+
+		for i := 0; i < 1010; i++ {
+			r := httptest.NewRequest("GET", "http://example.com/"+strconv.Itoa(i), nil)
+			p.requestInPipeline.RunPipeline(r)
+		}
+		stats := p.PipelineStats()
+		close(release)
+
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			mutex.Lock()
+			n := len(received)
+			mutex.Unlock()
+			if uint64(n)+stats[0].Dropped >= 1010 {
+				break
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		if stats[0].Name != "request-in" {
+			t.Fatalf("first pipeline stats = %s, want request-in", stats[0].Name)
+		}
+
+		mutex.Lock()
+		defer mutex.Unlock()
+		return stats[0], append([]string{}, received...)
+	}
+
+	stats, received := run(pipeline.OverflowPolicy{Overflow: pipeline.Drop})
+	if stats.Dropped < 9 || uint64(len(received))+stats.Dropped != 1010 {
+		t.Errorf("drop policy: %d received and %d dropped, want 1010 in total and at least 9 dropped", len(received), stats.Dropped)
+	}
+
+	stats, received = run(pipeline.OverflowPolicy{Overflow: pipeline.Spool, SpoolDir: t.TempDir()})
+	if stats.Dropped != 0 || stats.Spooled < 9 {
+		t.Errorf("spool policy: %d dropped and %d spooled, want 0 dropped and at least 9 spooled", stats.Dropped, stats.Spooled)
+	}
+	if len(received) != 1010 {
+		t.Fatalf("spool policy: %d received, want 1010", len(received))
+	}
+	for i, path := range received {
+		if path != "/"+strconv.Itoa(i) {
+			t.Fatalf("spool policy: request %d is %s, want them in order", i, path)
+		}
+	}
+
+	if err := NewProxy(rootCA, rootKey).SetOverflowPolicy("request-mod", pipeline.OverflowPolicy{}); err == nil {
+		t.Errorf("SetOverflowPolicy() of a mod pipeline did not fail")
+	}
+}
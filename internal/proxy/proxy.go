@@ -2,6 +2,7 @@ package proxy
 
 import (
 	"bufio"
+	"bytes"
 	"crypto/rsa"
 	"crypto/tls"
 	"crypto/x509"
@@ -10,9 +11,14 @@ import (
 	"log"
 	"net"
 	"net/http"
+	"net/http/httptrace"
 	"sync"
+	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/annotations"
 	"github.com/artilugio0/efin-proxy/internal/certs"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
 	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 	"github.com/artilugio0/efin-proxy/internal/ids"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
@@ -33,6 +39,8 @@ type Proxy struct {
 	responseInPipeline  *pipeline.ReadOnlyPipeline[*http.Response] // First response pipeline: read-only
 	responseModPipeline *pipeline.ModPipeline[*http.Response]      // Second response pipeline: read/write
 	responseOutPipeline *pipeline.ReadOnlyPipeline[*http.Response] // Third response pipeline: read-only
+	flowOutPipeline     *pipeline.ReadOnlyPipeline[*flow.Flow]     // Completed exchanges: read-only
+	responseLogPipeline *pipeline.ReadOnlyPipeline[*http.Response] // Every response, in scope or not: read-only
 
 	inScopeFuncMutex sync.RWMutex // Function to determine request scope
 	inScopeFunc      InScopeFunc  // Function to determine request scope
@@ -57,17 +65,14 @@ func NewProxy(rootCA *x509.Certificate, rootKey *rsa.PrivateKey) *Proxy {
 		responseInPipeline:  pipeline.NewReadOnlyPipeline[*http.Response](nil),
 		responseModPipeline: pipeline.NewModPipeline[*http.Response](nil),
 		responseOutPipeline: pipeline.NewReadOnlyPipeline[*http.Response](nil),
+		flowOutPipeline:     pipeline.NewReadOnlyPipeline[*flow.Flow](nil),
+		responseLogPipeline: pipeline.NewReadOnlyPipeline[*http.Response](nil),
 
 		inScopeFuncMutex: sync.RWMutex{},
 		inScopeFunc:      func(*http.Request) bool { return true }, // Default: all requests in scope
 
 		Client: &http.Client{
-			Transport: &http.Transport{
-				Proxy: http.ProxyFromEnvironment,
-				TLSClientConfig: &tls.Config{
-					InsecureSkipVerify: true, // For testing; remove in production
-				},
-			},
+			Transport: newTransport(),
 		},
 
 		CertCache: make(map[string]*tls.Certificate),
@@ -76,16 +81,31 @@ func NewProxy(rootCA *x509.Certificate, rootKey *rsa.PrivateKey) *Proxy {
 		RootKey:   rootKey,
 	}
 
+	p.requestInPipeline.SetName("request-in")
+	p.requestModPipeline.SetName("request-mod")
+	p.requestOutPipeline.SetName("request-out")
+	p.responseInPipeline.SetName("response-in")
+	p.responseModPipeline.SetName("response-mod")
+	p.responseOutPipeline.SetName("response-out")
+	p.flowOutPipeline.SetName("flow-out")
+	p.responseLogPipeline.SetName("response-log")
+
 	return p
 }
 
 // ServeHTTP handles incoming HTTP requests and responses with scope checking
 func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	start := time.Now()
+
 	// Generate UUID v4 and add to request context
 	p.idProviderMutex.RLock()
 	id := p.idProvider.NextID()
 	p.idProviderMutex.RUnlock()
 	req = ids.SetRequestID(req, id)
+	req = withRequestWire(req)
+	meta := &flowmeta.Meta{ClientAddr: req.RemoteAddr, Received: start}
+	req = flowmeta.Set(req, meta)
+	req = annotations.Set(req, &annotations.Bag{})
 
 	var finalReq *http.Request
 	var err error
@@ -94,10 +114,20 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	p.inScopeFuncMutex.RLock()
 	inScope = p.inScopeFunc
 	p.inScopeFuncMutex.RUnlock()
+	meta.InScope = inScope(req)
+
+	// the flow pipeline runs once the response was sent to the client
+	var f *flow.Flow
+	if inScope(req) {
+		f = &flow.Flow{ID: id, Timestamp: start, OriginalRequest: req, Request: req}
+		defer p.processFlowPipeline(f)
+	}
 
 	if inScope(req) {
-		finalReq, err = p.processRequestPipelines(req)
+		finalReq, err = p.processRequestPipelines(req, f)
 		if err != nil {
+			f.Error = err
+			countRequest(req, true, http.StatusInternalServerError)
 			http.Error(w, fmt.Sprintf("Request pipeline error: %v", err), http.StatusInternalServerError)
 			return
 		}
@@ -109,8 +139,10 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	finalReq.RequestURI = ""
 
-	resp, err := p.Client.Do(finalReq)
+	resp, err := p.do(finalReq)
 	if err != nil {
+		setFlowError(f, err)
+		countRequest(req, f != nil, http.StatusBadGateway)
 		http.Error(w, fmt.Sprintf("Error forwarding request: %v", err), http.StatusBadGateway)
 		return
 	}
@@ -118,12 +150,15 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	finalResp := resp
 	if inScope(req) {
-		finalResp, err = p.processResponsePipelines(resp)
+		finalResp, err = p.processResponsePipelines(resp, f)
 		if err != nil {
+			f.Error = err
+			countRequest(req, true, http.StatusInternalServerError)
 			http.Error(w, fmt.Sprintf("Response pipeline error: %v", err), http.StatusInternalServerError)
 			return
 		}
 	}
+	countRequest(req, f != nil, finalResp.StatusCode)
 
 	for key, values := range finalResp.Header {
 		for _, value := range values {
@@ -133,6 +168,79 @@ func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	w.WriteHeader(finalResp.StatusCode)
 	io.Copy(w, finalResp.Body)
 	finalResp.Body.Close()
+
+	if !inScope(req) {
+		p.logOutOfScopeResponse(resp)
+	}
+}
+
+// Send sends a request with the proxy transport, as the repeater does. When
+// runPipelines is true and the request is in scope, the request and
+// response pipelines are run as for proxied requests and true is returned.
+// The body of the returned response is read into memory.
+func (p *Proxy) Send(req *http.Request, runPipelines bool) (*http.Response, bool, error) {
+	start := time.Now()
+
+	p.idProviderMutex.RLock()
+	id := p.idProvider.NextID()
+	p.idProviderMutex.RUnlock()
+	req = ids.SetRequestID(req, id)
+	// the flow a request is loaded from keeps its annotations
+	req = annotations.Set(req, &annotations.Bag{})
+
+	p.inScopeFuncMutex.RLock()
+	inScope := p.inScopeFunc
+	p.inScopeFuncMutex.RUnlock()
+
+	runPipelines = runPipelines && inScope(req)
+
+	var f *flow.Flow
+	if runPipelines {
+		f = &flow.Flow{ID: id, Timestamp: start, OriginalRequest: req, Request: req}
+		defer p.processFlowPipeline(f)
+	}
+
+	finalReq := req
+	if runPipelines {
+		var err error
+		finalReq, err = p.processRequestPipelines(req, f)
+		if err != nil {
+			f.Error = err
+			return nil, false, fmt.Errorf("request pipeline error: %v", err)
+		}
+	}
+
+	finalReq.RequestURI = ""
+
+	resp, err := p.do(finalReq)
+	if err != nil {
+		setFlowError(f, err)
+		return nil, false, fmt.Errorf("error sending request: %v", err)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		setFlowError(f, err)
+		return nil, false, fmt.Errorf("error reading response body: %v", err)
+	}
+	resp.Body = httpbytes.NewBodyWrapper(body)
+	setTotal(resp)
+
+	// the response is not sent to a client, so it is kept decoded
+	if _, err := httpbytes.DecodeResponse(resp); err != nil {
+		log.Printf("Failed to decode response body: %v", err)
+	}
+
+	if runPipelines {
+		resp, err = p.processResponsePipelines(resp, f)
+		if err != nil {
+			f.Error = err
+			return nil, false, fmt.Errorf("response pipeline error: %v", err)
+		}
+	}
+
+	return resp, runPipelines, nil
 }
 
 // HandleConnect handles HTTPS CONNECT requests with MITM and pipeline processing
@@ -142,8 +250,12 @@ func (p *Proxy) HandleConnect(w http.ResponseWriter, req *http.Request) {
 	id := p.idProvider.NextID()
 	p.idProviderMutex.RUnlock()
 	req = ids.SetRequestID(req, id)
+	req = withRequestWire(req)
 
-	destConn, err := net.Dial("tcp", req.URL.Host)
+	// the timings of the connection are set in the first flow of the tunnel
+	connTimer := newFlowTimer(req)
+	dialer := net.Dialer{}
+	destConn, err := dialer.DialContext(httptrace.WithClientTrace(req.Context(), connTimer.clientTrace()), "tcp", req.URL.Host)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error connecting to destination: %v", err), http.StatusBadGateway)
 		return
@@ -156,6 +268,11 @@ func (p *Proxy) HandleConnect(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	// the tunnel is recorded by the connections of the TLS sessions
+	if wc, ok := clientConn.(*httpbytes.WireConn); ok {
+		wc.StopRecording()
+	}
+
 	_, err = clientConn.Write([]byte("HTTP/1.1 200 Connection Established\r\n\r\n"))
 	if err != nil {
 		clientConn.Close()
@@ -177,19 +294,28 @@ func (p *Proxy) HandleConnect(w http.ResponseWriter, req *http.Request) {
 	})
 
 	go func() {
+		activeTunnels.Add(1)
+		defer activeTunnels.Add(-1)
 		defer tlsClientConn.Close()
 		defer destConn.Close()
 
-		clientReader := bufio.NewReader(tlsClientConn)
+		clientWire := httpbytes.NewWireConn(tlsClientConn, true)
+		clientReader := bufio.NewReader(clientWire)
 		tlsDestConn := tls.Client(destConn, &tls.Config{
 			InsecureSkipVerify: true,
 			ServerName:         host,
 		})
 		defer tlsDestConn.Close()
-		destReader := bufio.NewReader(tlsDestConn)
+		if err := connTimer.handshake(tlsDestConn); err != nil {
+			log.Printf("Error in TLS handshake with destination: %v", err)
+			return
+		}
+		destWire := httpbytes.NewWireConn(tlsDestConn, false)
+		destReader := bufio.NewReader(destWire)
 
 		for {
 			httpReq, err := http.ReadRequest(clientReader)
+			start := time.Now()
 			if err != nil {
 				if err != io.EOF {
 					log.Printf("Error reading request from TLS connection: %v", err)
@@ -202,10 +328,20 @@ func (p *Proxy) HandleConnect(w http.ResponseWriter, req *http.Request) {
 			reqID := p.idProvider.NextID()
 			p.idProviderMutex.RUnlock()
 			httpReq = ids.SetRequestID(httpReq, reqID)
+			meta := &flowmeta.Meta{ClientAddr: req.RemoteAddr, Received: start}
+			httpReq = flowmeta.Set(httpReq, meta)
+			httpReq = annotations.Set(httpReq, &annotations.Bag{})
+			if w := clientWire.NextHead(); w != nil {
+				httpReq = httpbytes.SetRequestWire(httpReq, w)
+			}
 
 			if websockets.IsWebSocketRequest(httpReq) {
 				log.Printf("WebSocket connection detected for %s, passing through", httpReq.URL)
-				err = httpReq.Write(tlsDestConn)
+				clientWire.StopRecording()
+				if w := httpbytes.RequestWire(httpReq); w != nil {
+					destWire.RewriteHead(w)
+				}
+				err = httpReq.Write(destWire)
 				if err != nil {
 					log.Printf("Error writing WebSocket request to destination: %v", err)
 					return
@@ -229,80 +365,227 @@ func (p *Proxy) HandleConnect(w http.ResponseWriter, req *http.Request) {
 			p.inScopeFuncMutex.RLock()
 			inScope = p.inScopeFunc
 			p.inScopeFuncMutex.RUnlock()
+			meta.InScope = inScope(httpReq)
+
+			var f *flow.Flow
+			if inScope(httpReq) {
+				f = &flow.Flow{ID: reqID, Timestamp: start, OriginalRequest: httpReq, Request: httpReq}
+			}
 
 			finalReq := httpReq
 			if inScope(httpReq) {
-				finalReq, err = p.processRequestPipelines(httpReq)
+				finalReq, err = p.processRequestPipelines(httpReq, f)
 				if err != nil {
 					log.Printf("Request pipeline error: %v", err)
+					p.endFlow(f, err)
 					return
 				}
 			}
 
-			err = finalReq.Write(tlsDestConn)
+			// the request is written with the request line and headers it
+			// was received with, unless the hooks changed them
+			if w := httpbytes.RequestWire(finalReq); w != nil {
+				destWire.RewriteHead(w)
+			}
+			destWire.ExpectHead()
+			timer := connTimer.next(finalReq)
+			err = finalReq.Write(destWire)
 			if err != nil {
 				log.Printf("Error writing modified request to destination: %v", err)
+				p.endFlow(f, err)
 				return
 			}
+			if _, err := destReader.Peek(1); err == nil {
+				timer.firstByte()
+			}
 
 			resp, err := http.ReadResponse(destReader, finalReq)
 			if err != nil {
 				log.Printf("Error reading response from destination: %v", err)
+				p.endFlow(f, err)
 				return
 			}
 			defer resp.Body.Close()
+			if w := destWire.NextHead(); w != nil {
+				httpbytes.SetResponseWire(resp, w)
+			}
+			flowmeta.SetResponse(resp, timer.result())
 
 			finalResp := resp
 			if inScope(httpReq) {
-				finalResp, err = p.processResponsePipelines(resp)
+				finalResp, err = p.processResponsePipelines(resp, f)
 				if err != nil {
 					log.Printf("Response pipeline error: %v", err)
+					p.endFlow(f, err)
 					return
 				}
 			}
 
-			err = finalResp.Write(tlsClientConn)
+			if w := httpbytes.ResponseWire(finalResp); w != nil {
+				clientWire.RewriteHead(w)
+			}
+			err = finalResp.Write(clientWire)
 			if err != nil {
 				log.Printf("Error writing response to client: %v", err)
+				p.endFlow(f, err)
 				return
 			}
 			finalResp.Body.Close()
+			countRequest(httpReq, f != nil, finalResp.StatusCode)
+			if !inScope(httpReq) {
+				p.logOutOfScopeResponse(resp)
+			}
+			p.endFlow(f, nil)
 		}
 	}()
 }
 
-// processRequestPipelines processes the request through all three request pipelines
-func (p *Proxy) processRequestPipelines(req *http.Request) (*http.Request, error) {
+// processRequestPipelines processes the request through all three request pipelines.
+// Compressed bodies are decoded for the hooks and encoded again afterwards.
+// When f is not nil, the request after the mod hooks is set in it.
+func (p *Proxy) processRequestPipelines(req *http.Request, f *flow.Flow) (*http.Request, error) {
 	currentReq := httpbytes.CloneRequest(req)
 
+	encodedBody, err := httpbytes.ReadAndRestore(&currentReq.Body)
+	if err != nil {
+		return nil, err
+	}
+	contentEncoding, err := httpbytes.DecodeRequest(currentReq)
+	if err != nil {
+		log.Printf("Failed to decode request body: %v", err)
+	}
+	decodedBody, err := httpbytes.ReadAndRestore(&currentReq.Body)
+	if err != nil {
+		return nil, err
+	}
+
 	p.requestInPipeline.RunPipeline(currentReq)
 	currentReq = httpbytes.CloneRequest(currentReq) // avoid race conditions between running ro hooks and mod hooks
 
-	currentReq, err := p.requestModPipeline.RunPipeline(currentReq)
+	currentReq, err = p.requestModPipeline.RunPipeline(currentReq)
 	if err != nil {
 		return nil, err
 	}
 
 	p.requestOutPipeline.RunPipeline(currentReq)
+	if f != nil {
+		f.Request = currentReq
+	}
+
+	if contentEncoding == "" {
+		return currentReq, nil
+	}
+	finalReq := httpbytes.CloneRequest(currentReq)
+	if err := encodeFinalRequest(finalReq, contentEncoding, encodedBody, decodedBody); err != nil {
+		return nil, err
+	}
+
+	return finalReq, nil
+}
+
+// encodeFinalRequest encodes again a request whose body was decoded for the
+// hooks, as encodeFinalResponse does with responses
+func encodeFinalRequest(req *http.Request, contentEncoding string, encodedBody, decodedBody []byte) error {
+	body, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return err
+	}
 
-	return currentReq, nil
+	// a Content-Encoding set by the hooks means they encoded the body
+	if req.Header.Get("Content-Encoding") == "" {
+		if bytes.Equal(body, decodedBody) {
+			req.Body = httpbytes.NewBodyWrapper(encodedBody)
+			req.Header.Set("Content-Encoding", contentEncoding)
+			body = encodedBody
+		} else if err := httpbytes.EncodeRequest(req, contentEncoding); err != nil {
+			log.Printf("Failed to encode request body with %s, sending it decoded: %v", contentEncoding, err)
+		} else {
+			return nil
+		}
+	}
+
+	httpbytes.SetRequestContentLength(req, int64(len(body)))
+	return nil
 }
 
-// processResponsePipelines processes the response through all three response pipelines
-func (p *Proxy) processResponsePipelines(resp *http.Response) (*http.Response, error) {
+// processResponsePipelines processes the response through all three response pipelines.
+// Compressed bodies are decoded for the hooks and encoded again afterwards.
+// When f is not nil, the responses before and after the mod hooks are set in it.
+func (p *Proxy) processResponsePipelines(resp *http.Response, f *flow.Flow) (*http.Response, error) {
 	currentResp := httpbytes.CloneResponse(resp)
 
+	encodedBody, err := httpbytes.ReadAndRestore(&currentResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	setTotal(currentResp)
+	contentEncoding, err := httpbytes.DecodeResponse(currentResp)
+	if err != nil {
+		log.Printf("Failed to decode response body: %v", err)
+	}
+	decodedBody, err := httpbytes.ReadAndRestore(&currentResp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if f != nil {
+		f.OriginalResponse = currentResp
+	}
+
 	p.responseInPipeline.RunPipeline(currentResp)
 	currentResp = httpbytes.CloneResponse(currentResp) // avoid race conditions between running ro hooks and mod hooks
 
-	currentResp, err := p.responseModPipeline.RunPipeline(currentResp)
+	currentResp, err = p.responseModPipeline.RunPipeline(currentResp)
 	if err != nil {
 		return nil, err
 	}
 
 	p.responseOutPipeline.RunPipeline(currentResp)
+	p.responseLogPipeline.RunPipeline(currentResp)
+	if f != nil {
+		f.Response = currentResp
+	}
+
+	// the response sent to the client is a clone so that the body readers
+	// of the read-only hooks are not shared
+	finalResp := httpbytes.CloneResponse(currentResp)
+	if err := encodeFinalResponse(finalResp, contentEncoding, encodedBody, decodedBody); err != nil {
+		return nil, err
+	}
+
+	return finalResp, nil
+}
 
-	return currentResp, nil
+// encodeFinalResponse encodes again a response whose body was decoded for
+// the hooks. If the hooks did not change the body, the original bytes are
+// restored. The Content-Length is updated to the final body.
+func encodeFinalResponse(resp *http.Response, contentEncoding string, encodedBody, decodedBody []byte) error {
+	body, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// a Content-Encoding set by the hooks means they encoded the body
+	if contentEncoding != "" && resp.Header.Get("Content-Encoding") == "" {
+		if bytes.Equal(body, decodedBody) {
+			resp.Body = httpbytes.NewBodyWrapper(encodedBody)
+			resp.Header.Set("Content-Encoding", contentEncoding)
+			body = encodedBody
+		} else if err := httpbytes.EncodeResponse(resp, contentEncoding); err != nil {
+			log.Printf("Failed to encode response body with %s, sending it decoded: %v", contentEncoding, err)
+		} else {
+			return nil
+		}
+	}
+
+	// the Content-Length of responses without body describes the body
+	// they would have
+	bodyless := resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotModified ||
+		(resp.Request != nil && resp.Request.Method == http.MethodHead)
+	if !bodyless {
+		httpbytes.SetContentLength(resp, int64(len(body)))
+	}
+
+	return nil
 }
 
 func (p *Proxy) SetRequestInHooks(hooks []pipeline.ReadOnlyHook[*http.Request]) {
@@ -329,6 +612,191 @@ func (p *Proxy) SetResponseOutHooks(hooks []pipeline.ReadOnlyHook[*http.Response
 	p.responseOutPipeline.SetHooks(hooks)
 }
 
+func (p *Proxy) SetFlowOutHooks(hooks []pipeline.ReadOnlyHook[*flow.Flow]) {
+	p.flowOutPipeline.SetHooks(hooks)
+}
+
+// Hooks are the named hooks of each pipeline of the proxy
+type Hooks struct {
+	RequestIn  []pipeline.NamedReadOnlyHook[*http.Request]
+	RequestMod []pipeline.NamedModHook[*http.Request]
+	RequestOut []pipeline.NamedReadOnlyHook[*http.Request]
+
+	ResponseIn  []pipeline.NamedReadOnlyHook[*http.Response]
+	ResponseMod []pipeline.NamedModHook[*http.Response]
+	ResponseOut []pipeline.NamedReadOnlyHook[*http.Response]
+
+	FlowOut []pipeline.NamedReadOnlyHook[*flow.Flow]
+
+	// ResponseLog receives every response, in scope or not, for hooks that
+	// record the traffic
+	ResponseLog []pipeline.NamedReadOnlyHook[*http.Response]
+}
+
+// SetNamedHooks replaces the hooks of the pipelines, keeping the ones added
+// with the Add methods
+func (p *Proxy) SetNamedHooks(hooks Hooks) {
+	p.requestInPipeline.SetNamedHooks(hooks.RequestIn)
+	p.requestModPipeline.SetNamedHooks(hooks.RequestMod)
+	p.requestOutPipeline.SetNamedHooks(hooks.RequestOut)
+	p.responseInPipeline.SetNamedHooks(hooks.ResponseIn)
+	p.responseModPipeline.SetNamedHooks(hooks.ResponseMod)
+	p.responseOutPipeline.SetNamedHooks(hooks.ResponseOut)
+	p.flowOutPipeline.SetNamedHooks(hooks.FlowOut)
+	p.responseLogPipeline.SetNamedHooks(hooks.ResponseLog)
+}
+
+// AddRequestInHook adds a hook to the request in pipeline and returns a
+// function that removes it. The Add methods are used for the hooks of
+// clients that come and go, such as the ones of the gRPC server.
+func (p *Proxy) AddRequestInHook(hook pipeline.NamedReadOnlyHook[*http.Request]) func() {
+	return p.requestInPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddRequestModHook(hook pipeline.NamedModHook[*http.Request]) func() {
+	return p.requestModPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddRequestOutHook(hook pipeline.NamedReadOnlyHook[*http.Request]) func() {
+	return p.requestOutPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddResponseInHook(hook pipeline.NamedReadOnlyHook[*http.Response]) func() {
+	return p.responseInPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddResponseModHook(hook pipeline.NamedModHook[*http.Response]) func() {
+	return p.responseModPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddResponseOutHook(hook pipeline.NamedReadOnlyHook[*http.Response]) func() {
+	return p.responseOutPipeline.AddHook(hook)
+}
+
+func (p *Proxy) AddFlowOutHook(hook pipeline.NamedReadOnlyHook[*flow.Flow]) func() {
+	return p.flowOutPipeline.AddHook(hook)
+}
+
+// HookChains are the hooks of each pipeline in the order they run
+type HookChains struct {
+	RequestIn  []pipeline.HookInfo
+	RequestMod []pipeline.HookInfo
+	RequestOut []pipeline.HookInfo
+
+	ResponseIn  []pipeline.HookInfo
+	ResponseMod []pipeline.HookInfo
+	ResponseOut []pipeline.HookInfo
+
+	FlowOut []pipeline.HookInfo
+
+	ResponseLog []pipeline.HookInfo
+}
+
+// HookChains returns the effective order of the hooks of each pipeline
+func (p *Proxy) HookChains() HookChains {
+	return HookChains{
+		RequestIn:   p.requestInPipeline.Hooks(),
+		RequestMod:  p.requestModPipeline.Hooks(),
+		RequestOut:  p.requestOutPipeline.Hooks(),
+		ResponseIn:  p.responseInPipeline.Hooks(),
+		ResponseMod: p.responseModPipeline.Hooks(),
+		ResponseOut: p.responseOutPipeline.Hooks(),
+		FlowOut:     p.flowOutPipeline.Hooks(),
+		ResponseLog: p.responseLogPipeline.Hooks(),
+	}
+}
+
+// overflowPipeline is a read-only pipeline with an overflow policy
+type overflowPipeline interface {
+	SetOverflowPolicy(policy pipeline.OverflowPolicy) error
+	Dropped() uint64
+	Spooled() int
+	Queued() int
+}
+
+// ReadOnlyPipelines are the names of the read-only pipelines, which have
+// overflow policies
+var ReadOnlyPipelines = []string{"request-in", "request-out", "response-in", "response-out", "flow-out", "response-log"}
+
+func (p *Proxy) readOnlyPipeline(name string) overflowPipeline {
+	switch name {
+	case "request-in":
+		return p.requestInPipeline
+	case "request-out":
+		return p.requestOutPipeline
+	case "response-in":
+		return p.responseInPipeline
+	case "response-out":
+		return p.responseOutPipeline
+	case "flow-out":
+		return p.flowOutPipeline
+	case "response-log":
+		return p.responseLogPipeline
+	default:
+		return nil
+	}
+}
+
+// SetOverflowPolicy sets what a read-only pipeline does with the items that
+// do not fit in its queue
+func (p *Proxy) SetOverflowPolicy(name string, policy pipeline.OverflowPolicy) error {
+	rp := p.readOnlyPipeline(name)
+	if rp == nil {
+		return fmt.Errorf("unknown read-only pipeline '%s'", name)
+	}
+	return rp.SetOverflowPolicy(policy)
+}
+
+// PipelineStats are the counters of the queue of a read-only pipeline
+type PipelineStats struct {
+	Name    string
+	Dropped uint64
+	Spooled int
+}
+
+// PipelineStats returns the counters of the read-only pipelines
+func (p *Proxy) PipelineStats() []PipelineStats {
+	stats := []PipelineStats{}
+	for _, name := range ReadOnlyPipelines {
+		rp := p.readOnlyPipeline(name)
+		stats = append(stats, PipelineStats{Name: name, Dropped: rp.Dropped(), Spooled: rp.Spooled()})
+	}
+	return stats
+}
+
+// logOutOfScopeResponse runs the response log pipeline for the response to
+// an out of scope request. Its body was streamed to the client without being
+// kept, so the hooks get the response and its request without bodies.
+func (p *Proxy) logOutOfScopeResponse(resp *http.Response) {
+	logged := httpbytes.CloneResponseHead(resp)
+	if resp.Request != nil {
+		logged.Request = httpbytes.CloneRequestHead(resp.Request)
+	}
+	p.responseLogPipeline.RunPipeline(logged)
+}
+
+// processFlowPipeline runs the flow pipeline for a completed exchange. It
+// does nothing if f is nil, as for out of scope requests.
+func (p *Proxy) processFlowPipeline(f *flow.Flow) {
+	if f == nil {
+		return
+	}
+	p.flowOutPipeline.RunPipeline(f)
+}
+
+// endFlow sets the error of a flow, if any, and runs the flow pipeline
+func (p *Proxy) endFlow(f *flow.Flow, err error) {
+	setFlowError(f, err)
+	p.processFlowPipeline(f)
+}
+
+// setFlowError sets the error of a flow if it is not nil
+func setFlowError(f *flow.Flow, err error) {
+	if f != nil && err != nil {
+		f.Error = err
+	}
+}
+
 func (p *Proxy) SetScope(scope InScopeFunc) {
 	p.inScopeFuncMutex.Lock()
 	p.inScopeFunc = scope
@@ -341,6 +809,20 @@ func (p *Proxy) SetIDProvider(idp ids.IDProvider) {
 	p.idProviderMutex.Unlock()
 }
 
+// SetRootCA replaces the CA used to sign the generated certificates and
+// clears the certificate cache
+func (p *Proxy) SetRootCA(rootCA *x509.Certificate, rootKey *rsa.PrivateKey) {
+	p.CertMutex.Lock()
+	if p.RootCA == rootCA && p.RootKey == rootKey {
+		p.CertMutex.Unlock()
+		return
+	}
+	p.RootCA = rootCA
+	p.RootKey = rootKey
+	p.CertCache = make(map[string]*tls.Certificate)
+	p.CertMutex.Unlock()
+}
+
 // generateCert generates a certificate for a given host, caching it
 func (p *Proxy) generateCert(host string) (*tls.Certificate, error) {
 	p.CertMutex.RLock()
@@ -348,9 +830,10 @@ func (p *Proxy) generateCert(host string) (*tls.Certificate, error) {
 		p.CertMutex.RUnlock()
 		return cert, nil
 	}
+	rootCA, rootKey := p.RootCA, p.RootKey
 	p.CertMutex.RUnlock()
 
-	cert, err := certs.GenerateCert([]string{host}, p.RootCA, p.RootKey)
+	cert, err := certs.GenerateCert([]string{host}, rootCA, rootKey)
 	if err != nil {
 		return nil, err
 	}
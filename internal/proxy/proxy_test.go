@@ -1,18 +1,34 @@
 package proxy
 
 import (
+	"bufio"
+	"bytes"
 	"crypto/tls"
 	"crypto/x509"
+	"encoding/json"
 	"encoding/pem"
+	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/artilugio0/efin-proxy/internal/authz"
 	"github.com/artilugio0/efin-proxy/internal/certs"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
 	"github.com/artilugio0/efin-proxy/internal/ids"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
 )
@@ -185,6 +201,45 @@ func TestServeHTTPOutOfScope(t *testing.T) {
 	}
 }
 
+// TestServeHTTPOutOfScopeJSONL tests that the JSON Lines hook records out of
+// scope flows, flagged as such and without bodies
+func TestServeHTTPOutOfScopeJSONL(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Success"))
+	}))
+	defer server.Close()
+
+	jsonlFile := filepath.Join(t.TempDir(), "flows.jsonl")
+	p := NewProxy(nil, nil)
+	config := &Config{JSONLFile: jsonlFile, DomainRe: `example\.com$`}
+	if err := config.Apply(p); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, httptest.NewRequest("GET", server.URL+"/out", nil))
+	if body := w.Body.String(); body != "Success" {
+		t.Fatalf("response body = %q, want Success", body)
+	}
+
+	var data []byte
+	for i := 0; i < 100 && len(data) == 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		data, _ = os.ReadFile(jsonlFile)
+	}
+
+	var record hooks.JSONLRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("invalid JSON Lines record %q: %v", data, err)
+	}
+	if record.InScope || record.Request.URL != server.URL+"/out" || record.Response.StatusCode != 200 {
+		t.Errorf("record = %+v, want an out of scope flow to /out", record)
+	}
+	if record.Response.Body != "" {
+		t.Errorf("out of scope response body = %q, want none", record.Response.Body)
+	}
+}
+
 // TestServeHTTPWithID tests ID accessibility and consistency in ServeHTTP
 func TestServeHTTPWithID(t *testing.T) {
 	_, rootKey, _, _, err := certs.GenerateRootCA()
@@ -506,3 +561,381 @@ func TestHandleConnectDifferentIDs(t *testing.T) {
 		t.Errorf("Expected different IDs, got %q for both requests", theIds[0])
 	}
 }
+
+// TestServeHTTPCompressedResponse tests that hooks see decoded bodies while
+// the client receives them encoded as the server sent them
+func TestServeHTTPCompressedResponse(t *testing.T) {
+	encoded, err := httpbytes.EncodeBody([]byte("compressed body"), "gzip")
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "gzip, br" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(encoded)
+	}))
+	defer server.Close()
+
+	for _, modify := range []bool{false, true} {
+		p := NewProxy(nil, nil)
+		p.Client = &http.Client{Transport: &http.Transport{}}
+
+		var hookBody string
+		p.SetResponseModHooks([]pipeline.ModHook[*http.Response]{
+			func(resp *http.Response) (*http.Response, error) {
+				body, _ := io.ReadAll(resp.Body)
+				hookBody = string(body)
+				if modify {
+					body = []byte("modified body")
+				}
+				resp.Body = httpbytes.NewBodyWrapper(body)
+				return resp, nil
+			},
+		})
+
+		req := httptest.NewRequest("GET", server.URL, nil)
+		req.Header.Set("Accept-Encoding", "gzip, br")
+		w := httptest.NewRecorder()
+
+		p.ServeHTTP(w, req)
+
+		resp := w.Result()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", resp.StatusCode)
+		}
+		if hookBody != "compressed body" {
+			t.Errorf("Expected hooks to receive the decoded body, got %q", hookBody)
+		}
+		if resp.Header.Get("Content-Encoding") != "gzip" {
+			t.Errorf("Expected Content-Encoding 'gzip', got %q", resp.Header.Get("Content-Encoding"))
+		}
+
+		body, _ := io.ReadAll(resp.Body)
+		if !modify && !bytes.Equal(body, encoded) {
+			t.Errorf("Expected the original encoded body, got %q", body)
+		}
+		decoded, err := httpbytes.DecodeBody(body, "gzip")
+		if err != nil {
+			t.Fatalf("Failed to decode body sent to the client: %v", err)
+		}
+		expected := "compressed body"
+		if modify {
+			expected = "modified body"
+		}
+		if string(decoded) != expected {
+			t.Errorf("Expected body %q, got %q", expected, decoded)
+		}
+		if resp.Header.Get("Content-Length") != strconv.Itoa(len(body)) {
+			t.Errorf("Expected Content-Length %d, got %q", len(body), resp.Header.Get("Content-Length"))
+		}
+	}
+}
+
+// TestServeHTTPCompressedRequest tests that request hooks see decoded
+// bodies while the server receives them encoded as the client sent them
+func TestServeHTTPCompressedRequest(t *testing.T) {
+	encoded, err := httpbytes.EncodeBody([]byte("a=1"), "gzip")
+	if err != nil {
+		t.Fatalf("Failed to encode body: %v", err)
+	}
+
+	var received []byte
+	var receivedEncoding string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received, _ = io.ReadAll(r.Body)
+		receivedEncoding = r.Header.Get("Content-Encoding")
+	}))
+	defer server.Close()
+
+	for _, modify := range []bool{false, true} {
+		p := NewProxy(nil, nil)
+		p.Client = &http.Client{Transport: &http.Transport{}}
+
+		var hookBody string
+		p.SetRequestModHooks([]pipeline.ModHook[*http.Request]{
+			func(req *http.Request) (*http.Request, error) {
+				body, _ := io.ReadAll(req.Body)
+				hookBody = string(body)
+				if modify {
+					body = []byte("a=2")
+				}
+				req.Body = httpbytes.NewBodyWrapper(body)
+				return req, nil
+			},
+		})
+
+		req := httptest.NewRequest("POST", server.URL, bytes.NewReader(encoded))
+		req.Header.Set("Content-Encoding", "gzip")
+		w := httptest.NewRecorder()
+
+		p.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d", w.Code)
+		}
+		if hookBody != "a=1" {
+			t.Errorf("Expected hooks to receive the decoded body, got %q", hookBody)
+		}
+		if receivedEncoding != "gzip" {
+			t.Errorf("Expected Content-Encoding 'gzip', got %q", receivedEncoding)
+		}
+		if !modify && !bytes.Equal(received, encoded) {
+			t.Errorf("Expected the original encoded body, got %q", received)
+		}
+		decoded, err := httpbytes.DecodeBody(received, "gzip")
+		if err != nil {
+			t.Fatalf("Failed to decode body sent to the server: %v", err)
+		}
+		expected := "a=1"
+		if modify {
+			expected = "a=2"
+		}
+		if string(decoded) != expected {
+			t.Errorf("Expected body %q, got %q", expected, decoded)
+		}
+	}
+}
+
+// TestServeHTTPWireFidelity tests that requests are forwarded with the
+// request line, header order and casing they were received with, and that
+// hooks see the order and casing of the response headers
+func TestServeHTTPWireFidelity(t *testing.T) {
+	upstream, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer upstream.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := upstream.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		head := ""
+		for !strings.HasSuffix(head, "\r\n\r\n") {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				break
+			}
+			head += line
+		}
+		received <- head
+		io.WriteString(conn, "HTTP/1.1 200 Fine\r\nx-zeta: 1\r\nX-Alpha: 2\r\nContent-Length: 2\r\n\r\nok")
+	}()
+
+	p := NewProxy(nil, nil)
+	respHeads := make(chan string, 1)
+	p.SetResponseOutHooks([]pipeline.ReadOnlyHook[*http.Response]{
+		func(resp *http.Response) error {
+			head := ""
+			for _, h := range httpbytes.ResponseHeaders(resp) {
+				head += h.Name + ","
+			}
+			respHeads <- head
+			return nil
+		},
+	})
+
+	server := httptest.NewUnstartedServer(p)
+	server.Config.ConnContext = ConnContext
+	server.Listener = NewWireListener(server.Listener)
+	server.Start()
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	defer conn.Close()
+
+	addr := upstream.Addr().String()
+	fmt.Fprintf(conn, "GET http://%s/a?b=%%41 HTTP/1.1\r\nhost: %s\r\nx-zeta: 1\r\nAccept-Encoding: identity\r\nX-Alpha: 2\r\n\r\n", addr, addr)
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	resp.Body.Close()
+
+	head := <-received
+	expected := fmt.Sprintf("GET /a?b=%%41 HTTP/1.1\r\nhost: %s\r\nx-zeta: 1\r\nAccept-Encoding: identity\r\nX-Alpha: 2\r\n", addr)
+	if !strings.HasPrefix(head, expected) {
+		t.Errorf("Expected request to start with %q, got %q", expected, head)
+	}
+
+	if respHead := <-respHeads; respHead != "x-zeta,X-Alpha,Content-Length," {
+		t.Errorf("Expected response headers in wire order, got %q", respHead)
+	}
+}
+
+// TestServeHTTPFlowMeta tests that hooks get the timings and connection
+// details of a flow
+func TestServeHTTPFlowMeta(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	p := NewProxy(nil, nil)
+
+	var meta *flowmeta.Meta
+	var state *tls.ConnectionState
+	p.SetResponseModHooks([]pipeline.ModHook[*http.Response]{
+		func(resp *http.Response) (*http.Response, error) {
+			meta = flowmeta.GetResponse(resp)
+			state = resp.TLS
+			return resp, nil
+		},
+	})
+
+	req := httptest.NewRequest("GET", server.URL, nil)
+	w := httptest.NewRecorder()
+	p.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d", w.Code)
+	}
+	if meta == nil {
+		t.Fatal("Expected the response to have flow metadata")
+	}
+	if meta.ClientAddr != req.RemoteAddr {
+		t.Errorf("Expected client address %q, got %q", req.RemoteAddr, meta.ClientAddr)
+	}
+	if meta.UpstreamIP != "127.0.0.1" {
+		t.Errorf("Expected upstream IP 127.0.0.1, got %q", meta.UpstreamIP)
+	}
+	if meta.TLSVersion == "" || meta.TLSCipher == "" {
+		t.Errorf("Expected TLS version and cipher, got %q and %q", meta.TLSVersion, meta.TLSCipher)
+	}
+	if state == nil || !state.HandshakeComplete {
+		t.Errorf("Expected the TLS state of the response, got %+v", state)
+	}
+	if meta.Connect <= 0 || meta.TLSHandshake <= 0 || meta.TimeToFirstByte <= 0 {
+		t.Errorf("Expected connect, TLS handshake and first byte timings, got %+v", meta)
+	}
+	if meta.Total < meta.TimeToFirstByte {
+		t.Errorf("Expected total %v to include the time to first byte %v", meta.Total, meta.TimeToFirstByte)
+	}
+}
+
+// TestServeHTTPFlowPipeline tests that the flow pipeline gets the messages
+// before and after the mod hooks, and the errors of failed exchanges
+func TestServeHTTPFlowPipeline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("original " + r.Header.Get("X-Mod")))
+	}))
+	defer server.Close()
+
+	p := NewProxy(nil, nil)
+	p.SetRequestModHooks([]pipeline.ModHook[*http.Request]{
+		func(req *http.Request) (*http.Request, error) {
+			req.Header.Set("X-Mod", "request")
+			return req, nil
+		},
+	})
+	p.SetResponseModHooks([]pipeline.ModHook[*http.Response]{
+		func(resp *http.Response) (*http.Response, error) {
+			resp.Body = httpbytes.NewBodyWrapper([]byte("modified"))
+			return resp, nil
+		},
+	})
+
+	flows := make(chan *flow.Flow, 2)
+	p.SetFlowOutHooks([]pipeline.ReadOnlyHook[*flow.Flow]{
+		func(f *flow.Flow) error {
+			flows <- f
+			return nil
+		},
+	})
+
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", server.URL, nil))
+
+	var f *flow.Flow
+	select {
+	case f = <-flows:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the flow")
+	}
+
+	if f.ID == "" || f.ID != ids.GetRequestID(f.Request) || f.Error != nil {
+		t.Errorf("Unexpected flow ID %q or error %v", f.ID, f.Error)
+	}
+	if f.OriginalRequest.Header.Get("X-Mod") != "" || f.Request.Header.Get("X-Mod") != "request" {
+		t.Errorf("Expected the request before and after the mod hooks, got %v and %v",
+			f.OriginalRequest.Header, f.Request.Header)
+	}
+	original, _ := io.ReadAll(f.OriginalResponse.Body)
+	final, _ := io.ReadAll(f.Response.Body)
+	if string(original) != "original request" || string(final) != "modified" {
+		t.Errorf("Expected the response before and after the mod hooks, got %q and %q", original, final)
+	}
+	if m := flowmeta.GetResponse(f.Response); m == nil || m.Total <= 0 {
+		t.Errorf("Expected the flow timings, got %+v", m)
+	}
+
+	// the flow of an exchange that failed has its error
+	p.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://127.0.0.1:1/", nil))
+
+	select {
+	case f = <-flows:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the failed flow")
+	}
+	if f.Error == nil || f.Response != nil {
+		t.Errorf("Expected an error and no response, got %v and %v", f.Error, f.Response)
+	}
+}
+
+// TestServeHTTPAuthzReplay tests that the authorization tester replays the
+// flows of plain HTTP requests, whose context is canceled once the response
+// is sent to the client
+func TestServeHTTPAuthzReplay(t *testing.T) {
+	var hits atomic.Int64
+	app := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprint(w, `{"id":1,"owner":"admin"}`)
+	}))
+	defer app.Close()
+
+	reported := make(chan findings.Finding, 1)
+	config := &authz.Config{Sessions: []authz.Session{{Name: "user", Headers: map[string]string{"Authorization": "Bearer user-token"}}}}
+	tester := authz.NewTester(config, "", func(f findings.Finding) {
+		reported <- f
+	})
+
+	p := NewProxy(nil, nil)
+	p.SetResponseOutHooks([]pipeline.ReadOnlyHook[*http.Response]{authz.NewHook(tester)})
+	proxyServer := httptest.NewServer(p)
+	defer proxyServer.Close()
+
+	proxyURL, _ := url.Parse(proxyServer.URL)
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+	req, _ := http.NewRequest("GET", app.URL+"/orders/1", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Failed to send request through the proxy: %v", err)
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	select {
+	case f := <-reported:
+		if f.Evidence != "user" {
+			t.Errorf("Expected a finding for the user session, got %+v", f)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the authorization finding")
+	}
+	if n := hits.Load(); n != 2 {
+		t.Errorf("Expected the request and its replay, got %d requests", n)
+	}
+}
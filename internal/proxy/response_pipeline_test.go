@@ -348,7 +348,7 @@ func TestProcessResponsePipelines(t *testing.T) {
 				ContentLength: 4,
 			}
 
-			finalResp, err := p.processResponsePipelines(resp)
+			finalResp, err := p.processResponsePipelines(resp, nil)
 
 			wg.Wait()
 
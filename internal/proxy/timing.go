@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// flowTimer records the timings and connection details of a flow. Its
+// methods may be called from the goroutines of the transport.
+type flowTimer struct {
+	mutex sync.Mutex
+	meta  flowmeta.Meta
+
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+}
+
+// newFlowTimer returns a timer of a flow whose request is sent now
+func newFlowTimer(req *http.Request) *flowTimer {
+	t := &flowTimer{}
+	if m := flowmeta.Get(req); m != nil {
+		t.meta.ClientAddr = m.ClientAddr
+		t.meta.Received = m.Received
+		t.meta.InScope = m.InScope
+	}
+	t.meta.Start = time.Now()
+	return t
+}
+
+// clientTrace returns the trace that records the timings of a request sent
+// with an http.Client or of a connection opened with a net.Dialer
+func (t *flowTimer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			t.mutex.Lock()
+			t.dnsStart = time.Now()
+			t.mutex.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			t.mutex.Lock()
+			t.meta.DNS = time.Since(t.dnsStart)
+			t.mutex.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			t.mutex.Lock()
+			// several addresses may be tried concurrently
+			if t.connectStart.IsZero() {
+				t.connectStart = time.Now()
+			}
+			t.mutex.Unlock()
+		},
+		ConnectDone: func(_, _ string, err error) {
+			if err != nil {
+				return
+			}
+			t.mutex.Lock()
+			t.meta.Connect = time.Since(t.connectStart)
+			t.mutex.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			t.mutex.Lock()
+			t.tlsStart = time.Now()
+			t.mutex.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			if err != nil {
+				return
+			}
+			t.mutex.Lock()
+			t.meta.TLSHandshake = time.Since(t.tlsStart)
+			t.mutex.Unlock()
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			t.gotConn(info.Conn)
+		},
+		GotFirstResponseByte: t.firstByte,
+	}
+}
+
+// handshake performs the TLS handshake of a connection to the destination
+// and records its duration and the connection details
+func (t *flowTimer) handshake(conn *tls.Conn) error {
+	trace := t.clientTrace()
+	trace.TLSHandshakeStart()
+	err := conn.Handshake()
+	trace.TLSHandshakeDone(conn.ConnectionState(), err)
+	if err != nil {
+		return err
+	}
+
+	t.gotConn(conn)
+	return nil
+}
+
+// gotConn records the details of the connection the request is sent on
+func (t *flowTimer) gotConn(conn net.Conn) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if host, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
+		t.meta.UpstreamIP = host
+	}
+
+	if wc, ok := conn.(*httpbytes.WireConn); ok {
+		conn = wc.Conn
+	}
+	if tc, ok := conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		t.meta.TLSVersion = tls.VersionName(state.Version)
+		t.meta.TLSCipher = tls.CipherSuiteName(state.CipherSuite)
+		t.meta.ALPN = state.NegotiatedProtocol
+	}
+}
+
+// firstByte records the time to the first byte of the response
+func (t *flowTimer) firstByte() {
+	t.mutex.Lock()
+	t.meta.TimeToFirstByte = time.Since(t.meta.Start)
+	t.mutex.Unlock()
+}
+
+// next returns the timer of a flow sent now on the connection of t. Only
+// the first flow sent on a connection gets its timings.
+func (t *flowTimer) next(req *http.Request) *flowTimer {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	n := newFlowTimer(req)
+	n.meta.DNS, n.meta.Connect, n.meta.TLSHandshake = t.meta.DNS, t.meta.Connect, t.meta.TLSHandshake
+	n.meta.UpstreamIP, n.meta.TLSVersion, n.meta.TLSCipher, n.meta.ALPN = t.meta.UpstreamIP, t.meta.TLSVersion, t.meta.TLSCipher, t.meta.ALPN
+	t.meta.DNS, t.meta.Connect, t.meta.TLSHandshake = 0, 0, 0
+
+	return n
+}
+
+// result returns the metadata recorded so far. The total is the time until
+// the response head was received, until setTotal is called.
+func (t *flowTimer) result() *flowmeta.Meta {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	m := t.meta
+	m.Total = time.Since(m.Start)
+	return &m
+}
+
+// setTotal sets the total duration of a flow once its response body was
+// read
+func setTotal(resp *http.Response) {
+	m := flowmeta.GetResponse(resp)
+	if m == nil || m.Start.IsZero() {
+		return
+	}
+
+	total := *m
+	total.Total = time.Since(m.Start)
+	flowmeta.SetResponse(resp, &total)
+}
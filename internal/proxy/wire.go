@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+type connKeyType struct{}
+
+var connKey = connKeyType{}
+
+// wireListener wraps the accepted connections in server WireConns
+type wireListener struct {
+	net.Listener
+}
+
+// NewWireListener returns a listener whose connections record the wire
+// details of the requests read from them. The server must use ConnContext
+// so that the proxy can find them.
+func NewWireListener(l net.Listener) net.Listener {
+	return wireListener{l}
+}
+
+func (l wireListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return httpbytes.NewWireConn(conn, true), nil
+}
+
+// ConnContext adds the connection to the context of the requests read from
+// it. It is meant to be the ConnContext of the proxy http.Server.
+func ConnContext(ctx context.Context, conn net.Conn) context.Context {
+	return context.WithValue(ctx, connKey, conn)
+}
+
+// withRequestWire sets the wire details recorded by the connection of a
+// request received by the proxy server, if any
+func withRequestWire(req *http.Request) *http.Request {
+	conn, ok := req.Context().Value(connKey).(*httpbytes.WireConn)
+	if !ok {
+		return req
+	}
+	if w := conn.NextHead(); w != nil {
+		return httpbytes.SetRequestWire(req, w)
+	}
+	return req
+}
+
+// newTransport returns the transport of the proxy client, whose connections
+// keep the wire details of requests and responses
+func newTransport() *http.Transport {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: true, // For testing; remove in production
+	}
+	dialer := &net.Dialer{}
+
+	return &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return httpbytes.NewWireConn(conn, false), nil
+		},
+		DialTLSContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				host = addr
+			}
+			config := tlsConfig.Clone()
+			config.ServerName = host
+
+			// the transport only traces the handshakes of the connections
+			// it makes, so it is traced here
+			trace := httptrace.ContextClientTrace(ctx)
+			if trace != nil && trace.TLSHandshakeStart != nil {
+				trace.TLSHandshakeStart()
+			}
+			tlsConn := tls.Client(conn, config)
+			err = tlsConn.HandshakeContext(ctx)
+			if trace != nil && trace.TLSHandshakeDone != nil {
+				trace.TLSHandshakeDone(tlsConn.ConnectionState(), err)
+			}
+			if err != nil {
+				conn.Close()
+				return nil, err
+			}
+			return httpbytes.NewWireConn(tlsConn, false), nil
+		},
+	}
+}
+
+// do sends a request with the proxy client. When the connection is a
+// WireConn, the request is written with the request line, header order and
+// casing it was received with, and those of the response are recorded.
+// The timings and connection details of the flow are set in the response.
+func (p *Proxy) do(req *http.Request) (*http.Response, error) {
+	var conn *httpbytes.WireConn
+	wire := httpbytes.RequestWire(req)
+	timer := newFlowTimer(req)
+
+	trace := &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c, ok := info.Conn.(*httpbytes.WireConn)
+			if !ok {
+				return
+			}
+			conn = c
+			if wire != nil {
+				c.RewriteHead(wire)
+			}
+			c.ExpectHead()
+		},
+	}
+
+	ctx := httptrace.WithClientTrace(req.Context(), timer.clientTrace())
+	resp, err := p.Client.Do(req.WithContext(httptrace.WithClientTrace(ctx, trace)))
+	if err != nil {
+		return nil, err
+	}
+	flowmeta.SetResponse(resp, timer.result())
+
+	if conn != nil {
+		if w := conn.NextHead(); w != nil {
+			httpbytes.SetResponseWire(resp, w)
+		}
+
+		// the transport only sets the TLS state when the connection is a
+		// tls.Conn, not a WireConn wrapping one
+		if tc, ok := conn.Conn.(*tls.Conn); ok && resp.TLS == nil {
+			state := tc.ConnectionState()
+			resp.TLS = &state
+		}
+	}
+
+	return resp, nil
+}
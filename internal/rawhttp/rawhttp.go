@@ -0,0 +1,275 @@
+package rawhttp
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// DefaultTimeout is the time allowed for a raw request to be sent and its
+// response read
+const DefaultTimeout = 30 * time.Second
+
+// Options define where a raw request is sent
+type Options struct {
+	// Addr is the host:port of the target
+	Addr string
+
+	TLS bool
+
+	// ServerName is sent in the TLS SNI extension. It defaults to the host
+	// of Addr.
+	ServerName string
+
+	Timeout time.Duration
+}
+
+// OptionsForURL returns the options to send requests to the host of u
+func OptionsForURL(u *url.URL) Options {
+	opts := Options{
+		Addr: u.Host,
+		TLS:  u.Scheme == "https" || u.Scheme == "wss",
+	}
+
+	if u.Port() == "" {
+		port := "80"
+		if opts.TLS {
+			port = "443"
+		}
+		opts.Addr = net.JoinHostPort(u.Hostname(), port)
+	}
+
+	return opts
+}
+
+// Send writes the raw bytes to a connection to the target and returns the
+// bytes received back. The request is written exactly as given, without
+// validating it or normalizing it in any way.
+//
+// The response is read until a complete HTTP response is received, including
+// any bytes that arrived with it, e.g. the responses of smuggled requests.
+// If the bytes received can not be parsed as a response, they are read until
+// the connection is closed or the timeout expires.
+func Send(raw []byte, opts Options) ([]byte, error) {
+	timeout := opts.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	dialer := &net.Dialer{Timeout: timeout}
+
+	var conn net.Conn
+	var err error
+	if opts.TLS {
+		serverName := opts.ServerName
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(opts.Addr)
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", opts.Addr, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: true,
+			NextProtos:         []string{"http/1.1"},
+		})
+	} else {
+		conn, err = dialer.Dial("tcp", opts.Addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", opts.Addr, err)
+	}
+	defer conn.Close()
+
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	if _, err := conn.Write(raw); err != nil {
+		return nil, fmt.Errorf("failed to write request: %v", err)
+	}
+
+	var received bytes.Buffer
+	br := bufio.NewReader(io.TeeReader(conn, &received))
+
+	var req *http.Request
+	if bytes.HasPrefix(raw, []byte("HEAD ")) {
+		req = &http.Request{Method: http.MethodHead}
+	}
+
+	resp, err := http.ReadResponse(br, req)
+	if err == nil {
+		_, err = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if err != nil {
+		// not a valid response, keep everything the target sends
+		_, err = io.Copy(io.Discard, br)
+	}
+
+	if err != nil && !isTimeout(err) && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return received.Bytes(), fmt.Errorf("failed to read response: %v", err)
+	}
+	if received.Len() == 0 {
+		return nil, fmt.Errorf("no response received from %s", opts.Addr)
+	}
+
+	return received.Bytes(), nil
+}
+
+// NormalizeLineEndings replaces the LF line endings of the request line and
+// headers with CRLF, and terminates the headers if the blank line after them
+// is missing. It is meant for requests written in text editors; the body is
+// not modified.
+func NormalizeLineEndings(raw []byte) []byte {
+	head, body := splitMessage(raw)
+	head = bytes.TrimRight(head, "\r\n")
+
+	normalized := []byte(strings.Join(splitLines(head), "\r\n"))
+	normalized = append(normalized, "\r\n\r\n"...)
+
+	return append(normalized, body...)
+}
+
+// ParseRequest parses a raw request leniently, keeping the header names as
+// written. Lines that are not valid headers are ignored. The URL is built from
+// the scheme and the Host header, or addr if there is none.
+func ParseRequest(raw []byte, scheme string, addr string) (*http.Request, error) {
+	head, body := splitMessage(raw)
+	lines := splitLines(head)
+	if len(lines) == 0 || lines[0] == "" {
+		return nil, fmt.Errorf("empty request")
+	}
+
+	requestLine := strings.SplitN(lines[0], " ", 3)
+	method := requestLine[0]
+	target := "/"
+	if len(requestLine) > 1 {
+		target = requestLine[1]
+	}
+	proto := "HTTP/1.1"
+	if len(requestLine) > 2 {
+		proto = requestLine[2]
+	}
+
+	header := parseHeaderLines(lines[1:])
+
+	host := addr
+	for name, values := range header {
+		if strings.EqualFold(name, "Host") && len(values) > 0 {
+			host = values[0]
+			break
+		}
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		u = &url.URL{Path: target}
+	}
+	if !u.IsAbs() {
+		u.Scheme = scheme
+		u.Host = host
+	}
+
+	req := &http.Request{
+		Method:        method,
+		URL:           u,
+		Proto:         proto,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Host:          host,
+		Body:          httpbytes.NewBodyWrapper(body),
+		ContentLength: int64(len(body)),
+	}
+
+	return req, nil
+}
+
+// ParseResponse parses a raw response. If the response is not valid, a
+// response with status code 0 and the received bytes as body is returned.
+func ParseResponse(raw []byte, req *http.Request) *http.Response {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), req)
+	if err == nil {
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			resp.Body = httpbytes.NewBodyWrapper(body)
+			resp.Request = req
+			return resp
+		}
+	}
+
+	return &http.Response{
+		StatusCode:    0,
+		Header:        http.Header{},
+		Body:          httpbytes.NewBodyWrapper(raw),
+		ContentLength: int64(len(raw)),
+		Request:       req,
+	}
+}
+
+// NewFlow builds a flow from the raw bytes sent and received
+func NewFlow(rawRequest, rawResponse []byte, opts Options) (*flow.Flow, error) {
+	scheme := "http"
+	if opts.TLS {
+		scheme = "https"
+	}
+
+	req, err := ParseRequest(rawRequest, scheme, opts.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &flow.Flow{
+		Timestamp: time.Now(),
+		Request:   req,
+		Response:  ParseResponse(rawResponse, req),
+	}, nil
+}
+
+func splitMessage(raw []byte) ([]byte, []byte) {
+	crlf := bytes.Index(raw, []byte("\r\n\r\n"))
+	lf := bytes.Index(raw, []byte("\n\n"))
+
+	switch {
+	case crlf != -1 && (lf == -1 || crlf < lf):
+		return raw[:crlf], raw[crlf+4:]
+	case lf != -1:
+		return raw[:lf], raw[lf+2:]
+	default:
+		return raw, nil
+	}
+}
+
+func splitLines(head []byte) []string {
+	lines := strings.Split(string(head), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+func parseHeaderLines(lines []string) http.Header {
+	header := http.Header{}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || name == "" {
+			continue
+		}
+		// header names are kept as written instead of canonicalized
+		header[name] = append(header[name], strings.TrimSpace(value))
+	}
+	return header
+}
+
+func isTimeout(err error) bool {
+	return errors.Is(err, os.ErrDeadlineExceeded)
+}
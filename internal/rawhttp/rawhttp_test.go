@@ -0,0 +1,124 @@
+package rawhttp
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendPreservesBytes(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	raw := []byte("POST /a HTTP/1.1\r\nhOsT: test.host.com\r\nContent-Length: 3\r\nContent-Length: 0\r\nX-Weird :value\r\n\r\nabc")
+	response := "HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nokHTTP/1.1 404 Not Found\r\nContent-Length: 0\r\n\r\n"
+
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, len(raw))
+		io.ReadFull(conn, buf)
+		received <- buf
+		conn.Write([]byte(response))
+	}()
+
+	got, err := Send(raw, Options{Addr: l.Addr().String(), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	select {
+	case sent := <-received:
+		if !bytes.Equal(sent, raw) {
+			t.Errorf("target received %q, want %q", sent, raw)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("target did not receive the request")
+	}
+
+	if string(got) != response {
+		t.Errorf("Send() = %q, want %q", got, response)
+	}
+}
+
+func TestSendInvalidResponse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		conn.Write([]byte("garbage\n"))
+		conn.Close()
+	}()
+
+	got, err := Send([]byte("GET / HTTP/1.1\r\n\r\n"), Options{Addr: l.Addr().String(), Timeout: 5 * time.Second})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if string(got) != "garbage\n" {
+		t.Errorf("Send() = %q, want %q", got, "garbage\n")
+	}
+}
+
+func TestNewFlow(t *testing.T) {
+	rawRequest := []byte("get /path?q=1 HTTP/1.1\r\nhost: test.host.com\r\nX-lower: a\r\nnot a header\r\n\r\nbody")
+	rawResponse := []byte("HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nhi")
+
+	f, err := NewFlow(rawRequest, rawResponse, Options{Addr: "10.0.0.1:443", TLS: true})
+	if err != nil {
+		t.Fatalf("NewFlow() error = %v", err)
+	}
+
+	if f.Request.Method != "get" {
+		t.Errorf("Method = %q, want %q", f.Request.Method, "get")
+	}
+	if got := f.Request.URL.String(); got != "https://test.host.com/path?q=1" {
+		t.Errorf("URL = %q", got)
+	}
+	if _, ok := f.Request.Header["X-lower"]; !ok {
+		t.Errorf("header casing was not preserved: %v", f.Request.Header)
+	}
+	body, _ := io.ReadAll(f.Request.Body)
+	if string(body) != "body" {
+		t.Errorf("request body = %q", body)
+	}
+
+	if f.Response.StatusCode != 201 {
+		t.Errorf("StatusCode = %d, want 201", f.Response.StatusCode)
+	}
+
+	invalid := ParseResponse([]byte("garbage"), f.Request)
+	if invalid.StatusCode != 0 {
+		t.Errorf("StatusCode of invalid response = %d, want 0", invalid.StatusCode)
+	}
+}
+
+func TestNormalizeLineEndings(t *testing.T) {
+	got := NormalizeLineEndings([]byte("GET / HTTP/1.1\nHost: a\n\nline1\nline2"))
+	want := "GET / HTTP/1.1\r\nHost: a\r\n\r\nline1\nline2"
+	if string(got) != want {
+		t.Errorf("NormalizeLineEndings() = %q, want %q", got, want)
+	}
+
+	got = NormalizeLineEndings([]byte("GET / HTTP/1.1\nHost: a\n"))
+	want = "GET / HTTP/1.1\r\nHost: a\r\n\r\n"
+	if string(got) != want {
+		t.Errorf("NormalizeLineEndings() = %q, want %q", got, want)
+	}
+}
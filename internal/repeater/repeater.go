@@ -0,0 +1,216 @@
+package repeater
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+)
+
+// Repeater sends requests again through the transport of a proxy and stores
+// the new flows linked to the original ones
+type Repeater struct {
+	Proxy  *proxy.Proxy
+	DBFile string
+}
+
+// New returns a repeater that sends requests with p and stores the flows in
+// dbFile. If dbFile is empty, flows are not stored.
+func New(p *proxy.Proxy, dbFile string) *Repeater {
+	return &Repeater{
+		Proxy:  p,
+		DBFile: dbFile,
+	}
+}
+
+// Load returns the request of a stored flow ready to be sent again
+func (r *Repeater) Load(id string) (*http.Request, error) {
+	if r.DBFile == "" {
+		return nil, fmt.Errorf("no database configured")
+	}
+
+	f, err := hooks.LoadFlow(r.DBFile, id)
+	if err != nil {
+		return nil, err
+	}
+
+	req := f.Request.WithContext(context.Background())
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+
+	return req, nil
+}
+
+// Send sends the request and returns the new flow. When runPipelines is true
+// and the request is in scope, the proxy pipelines process the flow and its
+// hooks store it, as for proxied flows; otherwise the flow is stored by the
+// repeater. If originalID is not empty, the new flow is linked to it.
+func (r *Repeater) Send(originalID string, req *http.Request, runPipelines bool) (*flow.Flow, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read request body: %v", err)
+		}
+		req.Body = httpbytes.NewBodyWrapper(body)
+	}
+
+	timestamp := time.Now()
+	resp, pipelinesRun, err := r.Proxy.Send(req, runPipelines)
+	if err != nil {
+		return nil, err
+	}
+
+	sentReq := resp.Request
+	if bw, ok := sentReq.Body.(*httpbytes.BodyWrapper); ok && pipelinesRun {
+		sentReq.Body = bw.ShallowClone()
+	} else {
+		sentReq.Body = httpbytes.NewBodyWrapper(body)
+	}
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	resp.Body = httpbytes.NewBodyWrapper(respBody)
+
+	f := &flow.Flow{
+		ID:        ids.GetRequestID(sentReq),
+		Timestamp: timestamp,
+		Request:   sentReq,
+		Response:  resp,
+	}
+
+	if r.DBFile == "" {
+		return f, nil
+	}
+
+	if !pipelinesRun {
+		if _, err := hooks.SaveFlow(r.DBFile, f); err != nil {
+			return f, fmt.Errorf("failed to store flow: %v", err)
+		}
+		f.Request.Body = httpbytes.NewBodyWrapper(body)
+		f.Response.Body = httpbytes.NewBodyWrapper(respBody)
+	}
+
+	if originalID != "" {
+		err := hooks.LinkFlow(r.DBFile, hooks.FlowLink{
+			ID:         f.ID,
+			OriginalID: originalID,
+			Kind:       hooks.LinkRepeater,
+		})
+		if err != nil {
+			return f, fmt.Errorf("failed to link flow %s to %s: %v", f.ID, originalID, err)
+		}
+	}
+
+	return f, nil
+}
+
+// Edit describes changes applied to a request before sending it again. Zero
+// values leave the corresponding part of the request unchanged.
+type Edit struct {
+	Method string
+	URL    string
+
+	// SetHeaders replaces the values of the headers
+	SetHeaders    http.Header
+	RemoveHeaders []string
+
+	Body *[]byte
+}
+
+// Apply applies the changes to the request
+func (e Edit) Apply(req *http.Request) error {
+	if e.Method != "" {
+		req.Method = e.Method
+	}
+
+	if e.URL != "" {
+		u, err := url.Parse(e.URL)
+		if err != nil {
+			return fmt.Errorf("invalid url '%s': %v", e.URL, err)
+		}
+		req.URL = u
+		req.Host = u.Host
+		if req.Header.Get("Host") != "" {
+			req.Header.Set("Host", u.Host)
+		}
+	}
+
+	for _, name := range e.RemoveHeaders {
+		req.Header.Del(name)
+	}
+
+	for name, values := range e.SetHeaders {
+		req.Header[http.CanonicalHeaderKey(name)] = values
+		if http.CanonicalHeaderKey(name) == "Host" && len(values) > 0 {
+			req.Host = values[0]
+		}
+	}
+
+	if e.Body != nil {
+		setBody(req, *e.Body)
+	}
+
+	return nil
+}
+
+// ParseRawRequest parses a request in the format written by the file save
+// hooks. Since the request line only contains the path, the URL is built
+// with the given scheme and the Host header. The body is everything after
+// the headers, so the Content-Length header is updated after editing it.
+func ParseRawRequest(raw []byte, scheme string) (*http.Request, error) {
+	head, body, found := bytes.Cut(raw, []byte("\r\n\r\n"))
+	if !found {
+		head, body, found = bytes.Cut(raw, []byte("\n\n"))
+	}
+	if !found {
+		head = bytes.TrimRight(raw, "\r\n")
+	}
+
+	head = append(bytes.Clone(head), "\r\n\r\n"...)
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid raw request: %v", err)
+	}
+	req.RequestURI = ""
+
+	if req.URL.Host == "" {
+		req.URL.Host = req.Host
+	}
+	if req.URL.Scheme == "" {
+		req.URL.Scheme = scheme
+	}
+	if req.URL.Host == "" {
+		return nil, fmt.Errorf("invalid raw request: missing Host header")
+	}
+
+	setBody(req, body)
+
+	return req, nil
+}
+
+func setBody(req *http.Request, body []byte) {
+	req.Body = httpbytes.NewBodyWrapper(body)
+	req.ContentLength = int64(len(body))
+	if req.Header.Get("Content-Length") != "" || len(body) > 0 {
+		req.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	req.Header.Del("Transfer-Encoding")
+	req.TransferEncoding = nil
+}
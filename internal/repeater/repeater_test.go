@@ -0,0 +1,134 @@
+package repeater
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+)
+
+func TestParseRawRequest(t *testing.T) {
+	raw := "POST /api/login?next=%2F HTTP/1.1\nHost: test.host.com\nContent-Type: application/json\nContent-Length: 2\n\n{\"user\":\"edited\"}"
+
+	req, err := ParseRawRequest([]byte(raw), "https")
+	if err != nil {
+		t.Fatalf("ParseRawRequest() error = %v", err)
+	}
+
+	if req.Method != "POST" {
+		t.Errorf("Method = %q, want %q", req.Method, "POST")
+	}
+	if got := req.URL.String(); got != "https://test.host.com/api/login?next=%2F" {
+		t.Errorf("URL = %q", got)
+	}
+
+	body, _ := io.ReadAll(req.Body)
+	if string(body) != `{"user":"edited"}` {
+		t.Errorf("body = %q", body)
+	}
+	if req.ContentLength != int64(len(body)) || req.Header.Get("Content-Length") != "17" {
+		t.Errorf("Content-Length was not updated: %d, %q", req.ContentLength, req.Header.Get("Content-Length"))
+	}
+}
+
+func TestEditApply(t *testing.T) {
+	req := httptest.NewRequest("GET", "https://test.host.com/a", nil)
+	req.Header.Set("Cookie", "session=1")
+	req.Header.Set("Host", "test.host.com")
+
+	body := []byte("x=1")
+	err := Edit{
+		Method:        "PUT",
+		URL:           "https://other.host.com/b",
+		SetHeaders:    http.Header{"X-Test": []string{"yes"}},
+		RemoveHeaders: []string{"Cookie"},
+		Body:          &body,
+	}.Apply(req)
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	if req.Method != "PUT" || req.URL.String() != "https://other.host.com/b" {
+		t.Errorf("request line = %s %s", req.Method, req.URL)
+	}
+	if req.Host != "other.host.com" || req.Header.Get("Host") != "other.host.com" {
+		t.Errorf("Host was not updated: %q, %q", req.Host, req.Header.Get("Host"))
+	}
+	if req.Header.Get("Cookie") != "" || req.Header.Get("X-Test") != "yes" {
+		t.Errorf("headers were not updated: %v", req.Header)
+	}
+	if req.ContentLength != 3 {
+		t.Errorf("ContentLength = %d, want 3", req.ContentLength)
+	}
+}
+
+func TestSendStoresLinkedFlow(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Method", r.Method)
+		w.Write([]byte("echo:" + string(body)))
+	}))
+	defer server.Close()
+
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+
+	original, err := http.NewRequest("POST", server.URL+"/echo", strings.NewReader("original"))
+	if err != nil {
+		t.Fatalf("Failed to create request: %v", err)
+	}
+	originalID, err := hooks.SaveFlow(dbFile, &flow.Flow{Timestamp: time.Now(), Request: original})
+	if err != nil {
+		t.Fatalf("SaveFlow() error = %v", err)
+	}
+
+	rep := New(proxy.NewProxy(nil, nil), dbFile)
+	req, err := rep.Load(originalID)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	body := []byte("edited")
+	if err := (Edit{Body: &body}).Apply(req); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	f, err := rep.Send(originalID, req, false)
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+
+	respBody, _ := io.ReadAll(f.Response.Body)
+	if string(respBody) != "echo:edited" {
+		t.Errorf("response body = %q, want %q", respBody, "echo:edited")
+	}
+	if f.ID == "" || f.ID == originalID {
+		t.Fatalf("unexpected new flow id %q", f.ID)
+	}
+
+	stored, err := hooks.LoadFlow(dbFile, f.ID)
+	if err != nil {
+		t.Fatalf("LoadFlow() error = %v", err)
+	}
+	if stored.Response == nil || stored.Response.StatusCode != http.StatusOK {
+		t.Errorf("stored flow has no response")
+	}
+	storedBody, _ := io.ReadAll(stored.Request.Body)
+	if string(storedBody) != "edited" {
+		t.Errorf("stored request body = %q, want %q", storedBody, "edited")
+	}
+
+	links, err := hooks.LoadFlowLinks(dbFile, originalID)
+	if err != nil {
+		t.Fatalf("LoadFlowLinks() error = %v", err)
+	}
+	if len(links) != 1 || links[0].ID != f.ID || links[0].Kind != hooks.LinkRepeater {
+		t.Errorf("links = %+v, want a repeater link to %s", links, f.ID)
+	}
+}
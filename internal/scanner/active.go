@@ -0,0 +1,378 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/scope"
+)
+
+// SourceActive is the source of the findings reported by the active scanner
+const SourceActive = "active"
+
+// Defaults of the active scanner
+const (
+	DefaultActiveConcurrency = 5
+	DefaultTimeDelay         = 5 * time.Second
+	DefaultActiveTimeout     = 30 * time.Second
+)
+
+// DefaultActiveMethods are the methods of the requests scanned by default.
+// DELETE requests are not scanned since replaying them is destructive.
+var DefaultActiveMethods = []string{"GET", "POST", "PUT", "PATCH"}
+
+// maxProbeBodySize is the number of bytes read from each response
+const maxProbeBodySize = 5 * 1024 * 1024
+
+// ActiveScanner sends requests derived from stored flows with payloads in
+// their insertion points and reports the vulnerabilities detected
+type ActiveScanner struct {
+	Checks []ActiveCheck
+
+	// Scope selects the flows that are scanned, all if nil
+	Scope   *scope.Scope
+	Methods []string
+
+	Client      *http.Client
+	Concurrency int
+
+	// TimeDelay is the delay requested by time based payloads
+	TimeDelay time.Duration
+
+	// DBFile stores the flows that prove the findings, linked to the
+	// scanned flows, when set
+	DBFile string
+
+	Sink findings.Sink
+
+	// token is included in payloads to recognize their reflections
+	token string
+
+	scannedMutex sync.Mutex
+	scanned      map[string]bool
+}
+
+// NewActiveScanner returns a scanner with the default checks and settings
+// that reports findings to sink
+func NewActiveScanner(dbFile string, sink findings.Sink) *ActiveScanner {
+	return &ActiveScanner{
+		Checks:      ActiveChecks,
+		Methods:     DefaultActiveMethods,
+		Client:      NewActiveClient(DefaultActiveTimeout),
+		Concurrency: DefaultActiveConcurrency,
+		TimeDelay:   DefaultTimeDelay,
+		DBFile:      dbFile,
+		Sink:        sink,
+	}
+}
+
+// NewActiveClient returns a client that does not verify certificates nor
+// follow redirects, so that redirect responses can be analysed
+func NewActiveClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			Proxy:           http.ProxyFromEnvironment,
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// Scan scans the flows and returns the number of insertion points tested.
+// Flows out of scope, with other methods or with insertion points already
+// tested are skipped.
+func (s *ActiveScanner) Scan(ctx context.Context, flows []*flow.Flow) (int, error) {
+	if s.token == "" {
+		b := make([]byte, 4)
+		rand.Read(b)
+		s.token = hex.EncodeToString(b)
+	}
+
+	s.scannedMutex.Lock()
+	if s.scanned == nil {
+		s.scanned = map[string]bool{}
+	}
+	s.scannedMutex.Unlock()
+
+	concurrency := s.Concurrency
+	if concurrency <= 0 {
+		concurrency = DefaultActiveConcurrency
+	}
+
+	testedMutex := sync.Mutex{}
+	tested := 0
+
+	queue := make(chan *flow.Flow)
+	wg := sync.WaitGroup{}
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range queue {
+				n := s.scanFlow(ctx, f)
+
+				testedMutex.Lock()
+				tested += n
+				testedMutex.Unlock()
+			}
+		}()
+	}
+
+feed:
+	for _, f := range flows {
+		if !s.shouldScan(f) {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			break feed
+		case queue <- f:
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	return tested, ctx.Err()
+}
+
+func (s *ActiveScanner) shouldScan(f *flow.Flow) bool {
+	req := f.Request
+	if req == nil || !slices.Contains(s.Methods, req.Method) {
+		return false
+	}
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+
+	return s.Scope == nil || s.Scope.IsInScope(req)
+}
+
+// markScanned reports whether the insertion point of the endpoint was not
+// tested before, and marks it as tested
+func (s *ActiveScanner) markScanned(req *http.Request, ip InsertionPoint) bool {
+	key := req.Method + " " + req.Host + req.URL.Path + " " + ip.String()
+
+	s.scannedMutex.Lock()
+	defer s.scannedMutex.Unlock()
+
+	if s.scanned[key] {
+		return false
+	}
+	s.scanned[key] = true
+	return true
+}
+
+// scanFlow runs the checks on each insertion point of a flow and returns the
+// number of insertion points tested
+func (s *ActiveScanner) scanFlow(ctx context.Context, f *flow.Flow) int {
+	var body []byte
+	if f.Request.Body != nil {
+		var err error
+		body, err = io.ReadAll(f.Request.Body)
+		if err != nil {
+			log.Printf("Failed to read body of flow %s: %v", f.ID, err)
+			return 0
+		}
+		f.Request.Body = httpbytes.NewBodyWrapper(body)
+	}
+
+	t := &target{
+		ctx:     ctx,
+		scanner: s,
+		flowID:  f.ID,
+		req:     f.Request.WithContext(ctx),
+		body:    body,
+	}
+
+	points := []InsertionPoint{}
+	for _, ip := range InsertionPoints(t.req, body) {
+		if s.markScanned(t.req, ip) {
+			points = append(points, ip)
+		}
+	}
+	if len(points) == 0 {
+		return 0
+	}
+
+	// the baseline is sent twice to know whether the responses are stable
+	var err error
+	if t.baseline, err = t.sendRequest(t.req, body); err != nil {
+		log.Printf("Failed to send baseline request of flow %s: %v", f.ID, err)
+		return 0
+	}
+	if t.baseline2, err = t.sendRequest(t.req, body); err != nil {
+		log.Printf("Failed to send baseline request of flow %s: %v", f.ID, err)
+		return 0
+	}
+
+	for _, ip := range points {
+		found := map[string]bool{}
+		for _, check := range s.Checks {
+			if ctx.Err() != nil {
+				return len(points)
+			}
+			if found[check.Type] {
+				continue
+			}
+
+			finding, evidence := check.Run(t, ip)
+			if finding == nil {
+				continue
+			}
+			found[check.Type] = true
+
+			finding.Source = SourceActive
+			finding.Type = check.Type
+			finding.Evidence = ip.String()
+			finding.Timestamp = time.Now()
+			finding.FlowID = f.ID
+			if evidence != nil {
+				if id := s.store(f.ID, evidence); id != "" {
+					finding.FlowID = id
+					finding.Detail += fmt.Sprintf(" The request was derived from flow %s.", f.ID)
+				}
+			}
+
+			if s.Sink != nil {
+				s.Sink(*finding)
+			}
+		}
+	}
+
+	return len(points)
+}
+
+// store saves the flow of a probe linked to the scanned flow and returns its
+// ID, or an empty string if it could not be stored
+func (s *ActiveScanner) store(originalID string, p *probe) string {
+	if s.DBFile == "" {
+		return ""
+	}
+
+	p.req.Body = httpbytes.NewBodyWrapper(p.reqBody)
+	p.resp.Body = httpbytes.NewBodyWrapper(p.body)
+	p.resp.Request = p.req
+
+	id, err := hooks.SaveFlow(s.DBFile, &flow.Flow{Timestamp: p.timestamp, Request: p.req, Response: p.resp})
+	if err != nil {
+		log.Printf("Failed to store flow derived from %s: %v", originalID, err)
+		return ""
+	}
+
+	if originalID != "" {
+		err := hooks.LinkFlow(s.DBFile, hooks.FlowLink{ID: id, OriginalID: originalID, Kind: hooks.LinkScanner})
+		if err != nil {
+			log.Printf("Failed to link flow %s to %s: %v", id, originalID, err)
+		}
+	}
+
+	return id
+}
+
+// target is a flow being scanned
+type target struct {
+	ctx     context.Context
+	scanner *ActiveScanner
+	flowID  string
+
+	req  *http.Request
+	body []byte
+
+	baseline  *probe
+	baseline2 *probe
+}
+
+// probe is a request sent by the scanner and its response
+type probe struct {
+	req     *http.Request
+	reqBody []byte
+
+	resp *http.Response
+	body []byte
+
+	timestamp time.Time
+	duration  time.Duration
+}
+
+// send sends the request with value in the insertion point. Errors are
+// logged and nil is returned.
+func (t *target) send(ip InsertionPoint, value string) *probe {
+	req, body := ip.Inject(t.req, t.body, value)
+
+	p, err := t.sendRequest(req, body)
+	if err != nil {
+		if t.ctx.Err() == nil {
+			log.Printf("Failed to send request derived from flow %s: %v", t.flowID, err)
+		}
+		return nil
+	}
+	return p
+}
+
+func (t *target) sendRequest(req *http.Request, body []byte) (*probe, error) {
+	r := req.Clone(t.ctx)
+	r.RequestURI = ""
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	r.ContentLength = int64(len(body))
+
+	start := time.Now()
+	resp, err := t.scanner.Client.Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := httpbytes.DecodeResponse(resp); err != nil {
+		log.Printf("Failed to decode response body: %v", err)
+	}
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, maxProbeBodySize))
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return &probe{
+		req:       req,
+		reqBody:   body,
+		resp:      resp,
+		body:      respBody,
+		timestamp: start,
+		duration:  time.Since(start),
+	}, nil
+}
+
+// stable reports whether the baseline responses are similar, which is
+// required to detect differences caused by payloads
+func (t *target) stable() bool {
+	return similar(t.baseline, t.baseline2)
+}
+
+// similar reports whether two responses have the same status code and
+// bodies of about the same length
+func similar(a, b *probe) bool {
+	if a.resp.StatusCode != b.resp.StatusCode {
+		return false
+	}
+
+	diff := len(a.body) - len(b.body)
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff <= max(10, len(a.body)/50)
+}
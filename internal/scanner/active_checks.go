@@ -0,0 +1,262 @@
+package scanner
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+)
+
+// Finding types reported by the active checks
+const (
+	TypeSQLInjection      = "sql-injection"
+	TypeCrossSiteScript   = "cross-site-scripting"
+	TypeTemplateInjection = "template-injection"
+	TypePathTraversal     = "path-traversal"
+	TypeOpenRedirect      = "open-redirect"
+)
+
+// ActiveCheck tests an insertion point of a flow. Run returns the finding,
+// without source, type, evidence nor flow ID, and the probe that proves it,
+// or nil if the vulnerability was not detected.
+type ActiveCheck struct {
+	Name string
+	Type string
+	Run  func(t *target, ip InsertionPoint) (*findings.Finding, *probe)
+}
+
+// ActiveChecks are the checks run by the active scanner, the cheapest first
+var ActiveChecks = []ActiveCheck{
+	{Name: "sqli-error", Type: TypeSQLInjection, Run: checkSQLErrors},
+	{Name: "sqli-boolean", Type: TypeSQLInjection, Run: checkSQLBoolean},
+	{Name: "xss", Type: TypeCrossSiteScript, Run: checkXSS},
+	{Name: "ssti", Type: TypeTemplateInjection, Run: checkSSTI},
+	{Name: "path-traversal", Type: TypePathTraversal, Run: checkPathTraversal},
+	{Name: "open-redirect", Type: TypeOpenRedirect, Run: checkOpenRedirect},
+	{Name: "sqli-time", Type: TypeSQLInjection, Run: checkSQLTime},
+}
+
+// SelectActiveChecks returns the checks with the given names
+func SelectActiveChecks(names []string) ([]ActiveCheck, error) {
+	checks := []ActiveCheck{}
+	for _, name := range names {
+		found := false
+		for _, c := range ActiveChecks {
+			if c.Name == name {
+				checks = append(checks, c)
+				found = true
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown check '%s': expected one of %s", name, strings.Join(ActiveCheckNames(), ", "))
+		}
+	}
+	return checks, nil
+}
+
+// ActiveCheckNames returns the names of the active checks
+func ActiveCheckNames() []string {
+	names := []string{}
+	for _, c := range ActiveChecks {
+		names = append(names, c.Name)
+	}
+	return names
+}
+
+func activeFinding(t *target, severity findings.Severity, title, detail string) *findings.Finding {
+	f := newFinding(t.req, "", severity, title, detail, "")
+	return &f
+}
+
+var sqlErrorPayloads = []string{"'", `"`, "')", `\`}
+
+func checkSQLErrors(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	if sqlErrorRe.Match(t.baseline.body) {
+		return nil, nil
+	}
+
+	for _, payload := range sqlErrorPayloads {
+		p := t.send(ip, ip.Value+payload)
+		if p == nil {
+			continue
+		}
+		if m := sqlErrorRe.Find(p.body); m != nil {
+			return activeFinding(t, findings.SeverityHigh, "SQL injection in "+ip.String(),
+				fmt.Sprintf("Appending %q to %s caused the database error: %s.", payload, ip, m)), p
+		}
+	}
+
+	return nil, nil
+}
+
+// sqlBooleanPayloads are pairs of conditions that are true and false when
+// appended to string and numeric values
+var sqlBooleanPayloads = [][2]string{
+	{"' AND '1'='1", "' AND '1'='2"},
+	{" AND 1=1", " AND 1=2"},
+}
+
+func checkSQLBoolean(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	if !t.stable() {
+		return nil, nil
+	}
+
+	for _, pair := range sqlBooleanPayloads {
+		var falseProbe *probe
+		confirmed := true
+
+		// the difference must be seen twice to rule out unstable responses
+		for i := 0; i < 2 && confirmed; i++ {
+			trueProbe := t.send(ip, ip.Value+pair[0])
+			falseProbe = t.send(ip, ip.Value+pair[1])
+			confirmed = trueProbe != nil && falseProbe != nil &&
+				similar(trueProbe, t.baseline) && !similar(falseProbe, t.baseline)
+		}
+
+		if confirmed {
+			return activeFinding(t, findings.SeverityHigh, "SQL injection in "+ip.String(),
+				fmt.Sprintf("Appending %q to %s returned the original response, while appending %q returned status %d with a body of %d bytes instead of %d.",
+					pair[0], ip, pair[1], falseProbe.resp.StatusCode, len(falseProbe.body), len(t.baseline.body))), falseProbe
+		}
+	}
+
+	return nil, nil
+}
+
+// sqlTimePayloads request a delay of %s seconds in several databases
+var sqlTimePayloads = []string{
+	"' AND SLEEP(%s)-- -",
+	" AND SLEEP(%s)",
+	"'||pg_sleep(%s)--",
+	"'; WAITFOR DELAY '0:0:%s'--",
+}
+
+func checkSQLTime(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	delay := t.scanner.TimeDelay
+	if delay <= 0 {
+		delay = DefaultTimeDelay
+	}
+	seconds := strconv.FormatFloat(delay.Seconds(), 'f', -1, 64)
+	threshold := max(t.baseline.duration, t.baseline2.duration) + delay*8/10
+
+	for _, payload := range sqlTimePayloads {
+		slow := t.send(ip, ip.Value+fmt.Sprintf(payload, seconds))
+		if slow == nil || slow.duration < threshold {
+			continue
+		}
+
+		// confirm that the delay depends on the payload
+		fast := t.send(ip, ip.Value+fmt.Sprintf(payload, "0"))
+		if fast == nil || fast.duration >= threshold {
+			continue
+		}
+		slow = t.send(ip, ip.Value+fmt.Sprintf(payload, seconds))
+		if slow == nil || slow.duration < threshold {
+			continue
+		}
+
+		return activeFinding(t, findings.SeverityHigh, "Time based SQL injection in "+ip.String(),
+			fmt.Sprintf("Appending %q to %s delayed the response %s, while the original request took %s.",
+				fmt.Sprintf(payload, seconds), ip, slow.duration.Round(time.Millisecond), t.baseline.duration.Round(time.Millisecond))), slow
+	}
+
+	return nil, nil
+}
+
+func checkXSS(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	tag := "<efin" + t.scanner.token + ">"
+	payload := `'"` + tag
+
+	p := t.send(ip, ip.Value+payload)
+	if p == nil || !isHTML(p.resp) || !bytes.Contains(p.body, []byte(tag)) {
+		return nil, nil
+	}
+
+	severity := findings.SeverityMedium
+	if bytes.Contains(p.body, []byte(payload)) {
+		severity = findings.SeverityHigh
+	}
+
+	return activeFinding(t, severity, "Cross-site scripting in "+ip.String(),
+		fmt.Sprintf("The payload %q appended to %s is included in the HTML response without encoding.", payload, ip)), p
+}
+
+// sstiPayloads evaluate 1337*1337 in common template engines
+var sstiPayloads = []string{"{{1337*1337}}", "${1337*1337}", "<%= 1337*1337 %>", "#{1337*1337}", "{{=1337*1337}}"}
+
+const sstiResult = "1787569"
+
+func checkSSTI(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	if bytes.Contains(t.baseline.body, []byte(sstiResult)) {
+		return nil, nil
+	}
+
+	for _, payload := range sstiPayloads {
+		p := t.send(ip, ip.Value+payload)
+		if p != nil && bytes.Contains(p.body, []byte(sstiResult)) {
+			return activeFinding(t, findings.SeverityHigh, "Server side template injection in "+ip.String(),
+				fmt.Sprintf("The expression %q appended to %s was evaluated to %s.", payload, ip, sstiResult)), p
+		}
+	}
+
+	return nil, nil
+}
+
+var pathTraversalPayloads = []string{
+	"../../../../../../../../etc/passwd",
+	"..%2f..%2f..%2f..%2f..%2f..%2f..%2f..%2fetc%2fpasswd",
+	"....//....//....//....//....//....//etc/passwd",
+	"/etc/passwd",
+	`..\..\..\..\..\..\..\..\windows\win.ini`,
+}
+
+var pathTraversalRe = regexp.MustCompile(`(root:[^:\n]*:0:0:|\[fonts\]|; for 16-bit app support)`)
+
+func checkPathTraversal(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	if pathTraversalRe.Match(t.baseline.body) {
+		return nil, nil
+	}
+
+	for _, payload := range pathTraversalPayloads {
+		p := t.send(ip, payload)
+		if p == nil {
+			continue
+		}
+		if m := pathTraversalRe.Find(p.body); m != nil {
+			return activeFinding(t, findings.SeverityHigh, "Path traversal in "+ip.String(),
+				fmt.Sprintf("Replacing %s with %q returned the content of a system file: %s", ip, payload, m)), p
+		}
+	}
+
+	return nil, nil
+}
+
+// redirectHost is a host that is never redirected to unless injected
+const redirectHost = "efin-redirect.invalid"
+
+var openRedirectPayloads = []string{"https://" + redirectHost + "/", "//" + redirectHost + "/", `/\` + redirectHost + "/"}
+
+func checkOpenRedirect(t *target, ip InsertionPoint) (*findings.Finding, *probe) {
+	for _, payload := range openRedirectPayloads {
+		p := t.send(ip, payload)
+		if p == nil || p.resp.StatusCode < 300 || p.resp.StatusCode >= 400 {
+			continue
+		}
+
+		location := p.resp.Header.Get("Location")
+		u, err := url.Parse(strings.ReplaceAll(location, `\`, "/"))
+		if err != nil || !strings.EqualFold(u.Hostname(), redirectHost) {
+			continue
+		}
+
+		return activeFinding(t, findings.SeverityMedium, "Open redirect in "+ip.String(),
+			fmt.Sprintf("Replacing %s with %q redirected to %s.", ip, payload, location)), p
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,231 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/scope"
+)
+
+var sleepRe = regexp.MustCompile(`SLEEP\(([\d.]+)\)`)
+
+// newVulnerableServer returns a server with an endpoint vulnerable to each
+// kind of issue detected by the active scanner, and a safe one
+func newVulnerableServer() *httptest.Server {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/error", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Count(r.FormValue("id"), "'")%2 == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "You have an error in your SQL syntax near '%s'", r.FormValue("id"))
+			return
+		}
+		fmt.Fprint(w, "item")
+	})
+
+	mux.HandleFunc("/bool", func(w http.ResponseWriter, r *http.Request) {
+		id := r.URL.Query().Get("id")
+		id, _ = strings.CutSuffix(id, "' AND '1'='1")
+		if id == "1" {
+			fmt.Fprint(w, "Item 1: a widget with a long description that is only shown for existing items")
+			return
+		}
+		fmt.Fprint(w, "no results")
+	})
+
+	mux.HandleFunc("/sleep", func(w http.ResponseWriter, r *http.Request) {
+		if m := sleepRe.FindStringSubmatch(r.URL.Query().Get("id")); m != nil {
+			seconds, _ := strconv.ParseFloat(m[1], 64)
+			time.Sleep(time.Duration(seconds * float64(time.Second)))
+		}
+		fmt.Fprint(w, "ok")
+	})
+
+	mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<html>Results for %s</html>", r.URL.Query().Get("q"))
+	})
+
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		name := strings.ReplaceAll(r.URL.Query().Get("name"), "{{1337*1337}}", "1787569")
+		fmt.Fprintf(w, "Hello %s", name)
+	})
+
+	mux.HandleFunc("/file", func(w http.ResponseWriter, r *http.Request) {
+		if p := r.URL.Query().Get("path"); strings.Contains(p, "../") && strings.HasSuffix(p, "etc/passwd") {
+			fmt.Fprint(w, "root:x:0:0:root:/root:/bin/bash\n")
+			return
+		}
+		fmt.Fprint(w, "file content")
+	})
+
+	mux.HandleFunc("/go", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, r.URL.Query().Get("next"), http.StatusFound)
+	})
+
+	mux.HandleFunc("/safe", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>nothing to see</html>")
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func newTargetFlow(t *testing.T, id, method, url, contentType, body string) *flow.Flow {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	return &flow.Flow{ID: id, Request: req}
+}
+
+func TestActiveScanner(t *testing.T) {
+	server := newVulnerableServer()
+	defer server.Close()
+
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+
+	flows := []*flow.Flow{
+		newTargetFlow(t, "", "POST", server.URL+"/error", "application/x-www-form-urlencoded", "id=1"),
+		newTargetFlow(t, "", "GET", server.URL+"/bool?id=1", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/sleep?id=1", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/search?q=shoes", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/hello?name=alice", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/file?path=report.pdf", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/go?next=/home", "", ""),
+		newTargetFlow(t, "", "GET", server.URL+"/safe?id=1", "", ""),
+		newTargetFlow(t, "", "DELETE", server.URL+"/error?id=1", "", ""),
+	}
+	for _, f := range flows {
+		id, err := hooks.SaveFlow(dbFile, f)
+		if err != nil {
+			t.Fatalf("SaveFlow() error = %v", err)
+		}
+		f.ID = id
+	}
+
+	mutex := sync.Mutex{}
+	reported := map[string]findings.Finding{}
+	s := NewActiveScanner(dbFile, func(f findings.Finding) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		reported[f.Path+" "+f.Type] = f
+	})
+	s.TimeDelay = 500 * time.Millisecond
+
+	stored, err := hooks.LoadFlows(dbFile, hooks.FlowFilter{})
+	if err != nil {
+		t.Fatalf("LoadFlows() error = %v", err)
+	}
+
+	tested, err := s.Scan(context.Background(), stored)
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if tested != 8 {
+		t.Errorf("tested %d insertion points, want 8", tested)
+	}
+
+	want := []string{
+		"/error " + TypeSQLInjection,
+		"/bool " + TypeSQLInjection,
+		"/sleep " + TypeSQLInjection,
+		"/search " + TypeCrossSiteScript,
+		"/hello " + TypeTemplateInjection,
+		"/file " + TypePathTraversal,
+		"/go " + TypeOpenRedirect,
+	}
+	for _, w := range want {
+		if _, ok := reported[w]; !ok {
+			t.Errorf("finding %s not reported", w)
+		}
+	}
+	if len(reported) != len(want) {
+		t.Errorf("reported %d findings, want %d: %v", len(reported), len(want), reported)
+	}
+
+	f := reported["/error "+TypeSQLInjection]
+	if f.Source != SourceActive || f.Evidence != "body:id" || f.FlowID == flows[0].ID {
+		t.Errorf("finding = %+v", f)
+	}
+	links, err := hooks.LoadFlowLinks(dbFile, flows[0].ID)
+	if err != nil {
+		t.Fatalf("LoadFlowLinks() error = %v", err)
+	}
+	if len(links) != 1 || links[0].ID != f.FlowID || links[0].Kind != hooks.LinkScanner {
+		t.Errorf("links = %+v, want a link to the evidence flow %s", links, f.FlowID)
+	}
+
+	// insertion points already tested are skipped
+	if tested, _ := s.Scan(context.Background(), stored); tested != 0 {
+		t.Errorf("second scan tested %d insertion points, want 0", tested)
+	}
+}
+
+func TestActiveScannerScope(t *testing.T) {
+	server := newVulnerableServer()
+	defer server.Close()
+
+	reported := 0
+	s := NewActiveScanner("", func(findings.Finding) { reported++ })
+	s.Scope = scope.New(regexp.MustCompile(`^other\.host\.com$`), nil)
+	s.Concurrency = 1
+
+	tested, err := s.Scan(context.Background(), []*flow.Flow{newTargetFlow(t, "1", "GET", server.URL+"/search?q=shoes", "", "")})
+	if err != nil {
+		t.Fatalf("Scan() error = %v", err)
+	}
+	if tested != 0 || reported != 0 {
+		t.Errorf("out of scope flow was scanned: tested %d, reported %d", tested, reported)
+	}
+}
+
+func TestInsertionPoints(t *testing.T) {
+	req := httptest.NewRequest("POST", "https://test.host.com/api?a=1&b=x%20y", nil)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Cookie", "session=abc; lang=en")
+	req.Header.Set("X-Api-Version", "2")
+	body := []byte(`{"name":"alice","age":30,"tags":["x"]}`)
+
+	got := []string{}
+	for _, ip := range InsertionPoints(req, body) {
+		got = append(got, ip.String()+"="+ip.Value)
+	}
+	want := "query:a=1 query:b=x y json:age=30 json:name=alice cookie:session=abc cookie:lang=en header:X-Api-Version=2"
+	if strings.Join(got, " ") != want {
+		t.Errorf("InsertionPoints() = %v, want %s", got, want)
+	}
+
+	injected, _ := InsertionPoint{Kind: PointQuery, Name: "b"}.Inject(req, body, "'&c")
+	if injected.URL.RawQuery != "a=1&b=%27%26c" {
+		t.Errorf("injected query = %s", injected.URL.RawQuery)
+	}
+	if req.URL.RawQuery != "a=1&b=x%20y" {
+		t.Errorf("original query modified: %s", req.URL.RawQuery)
+	}
+
+	injected, _ = InsertionPoint{Kind: PointCookie, Name: "lang"}.Inject(req, body, "<x>")
+	if c := injected.Header.Get("Cookie"); c != "session=abc; lang=<x>" {
+		t.Errorf("injected cookie = %s", c)
+	}
+
+	_, injectedBody := InsertionPoint{Kind: PointJSON, Name: "age"}.Inject(req, body, "30'")
+	if string(injectedBody) != `{"age":"30'","name":"alice","tags":["x"]}` {
+		t.Errorf("injected body = %s", injectedBody)
+	}
+}
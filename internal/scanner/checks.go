@@ -0,0 +1,309 @@
+package scanner
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/secrets"
+)
+
+// Finding types reported by the passive checks
+const (
+	TypeMissingHSTS                = "missing-hsts"
+	TypeMissingCSP                 = "missing-csp"
+	TypeMissingClickjackProtection = "missing-clickjacking-protection"
+	TypeMissingNoSniff             = "missing-x-content-type-options"
+	TypeInsecureCookie             = "insecure-cookie"
+	TypeMixedContent               = "mixed-content"
+	TypeReflectedParameter         = "reflected-parameter"
+	TypeVerboseError               = "verbose-error"
+	TypeCORSMisconfiguration       = "cors-misconfiguration"
+	TypeExposedSecret              = secrets.TypeSecret
+)
+
+// CheckSecurityHeaders reports missing HSTS, CSP, clickjacking protection and
+// X-Content-Type-Options headers
+func CheckSecurityHeaders(f *Flow) []findings.Finding {
+	req, resp := f.Request, f.Response
+	result := []findings.Finding{}
+
+	if isHTTPS(req) && resp.Header.Get("Strict-Transport-Security") == "" {
+		finding := newFinding(req, TypeMissingHSTS, findings.SeverityLow,
+			"Strict-Transport-Security header not set",
+			"The host is served over HTTPS without HSTS, so browsers may be downgraded to HTTP.", "")
+		finding.Path = ""
+		result = append(result, finding)
+	}
+
+	// the remaining headers only matter for content rendered by browsers
+	if resp.StatusCode >= 300 && resp.StatusCode < 400 || len(f.ResponseBody) == 0 {
+		return result
+	}
+
+	if resp.Header.Get("X-Content-Type-Options") != "nosniff" {
+		result = append(result, newFinding(req, TypeMissingNoSniff, findings.SeverityInfo,
+			"X-Content-Type-Options header not set to nosniff",
+			"Browsers may interpret the response as a different content type.", ""))
+	}
+
+	if !isHTML(resp) {
+		return result
+	}
+
+	csp := resp.Header.Get("Content-Security-Policy")
+	if csp == "" {
+		result = append(result, newFinding(req, TypeMissingCSP, findings.SeverityLow,
+			"Content-Security-Policy header not set",
+			"The page has no CSP to mitigate cross-site scripting.", ""))
+	}
+
+	if resp.Header.Get("X-Frame-Options") == "" && !strings.Contains(strings.ToLower(csp), "frame-ancestors") {
+		result = append(result, newFinding(req, TypeMissingClickjackProtection, findings.SeverityLow,
+			"Page can be framed by other sites",
+			"Neither X-Frame-Options nor the CSP frame-ancestors directive is set.", ""))
+	}
+
+	return result
+}
+
+// CheckCookies reports cookies set without the Secure, HttpOnly or SameSite
+// attributes
+func CheckCookies(f *Flow) []findings.Finding {
+	req := f.Request
+	result := []findings.Finding{}
+
+	for _, cookie := range f.Response.Cookies() {
+		if cookie.MaxAge < 0 {
+			// the cookie is being deleted
+			continue
+		}
+
+		missing := []string{}
+		severity := findings.SeverityInfo
+		if !cookie.Secure && isHTTPS(req) {
+			missing = append(missing, "Secure")
+			severity = findings.SeverityLow
+		}
+		if !cookie.HttpOnly {
+			missing = append(missing, "HttpOnly")
+			severity = findings.SeverityLow
+		}
+		if cookie.SameSite == http.SameSiteDefaultMode {
+			missing = append(missing, "SameSite")
+		}
+		if len(missing) == 0 {
+			continue
+		}
+
+		finding := newFinding(req, TypeInsecureCookie, severity,
+			fmt.Sprintf("Cookie %s set without %s", cookie.Name, strings.Join(missing, ", ")),
+			fmt.Sprintf("The cookie %s is missing the attributes: %s.", cookie.Name, strings.Join(missing, ", ")),
+			cookie.Name)
+		finding.Path = ""
+		result = append(result, finding)
+	}
+
+	return result
+}
+
+var mixedContentRe = regexp.MustCompile(`(?i)<(script|iframe|frame|object|embed|link|img|audio|video|source)\b[^>]*?\s(?:src|href|data)\s*=\s*["']?(http://[^"'\s>]+)`)
+
+// CheckMixedContent reports HTTPS pages that load resources over HTTP
+func CheckMixedContent(f *Flow) []findings.Finding {
+	if !isHTTPS(f.Request) || !isHTML(f.Response) {
+		return nil
+	}
+
+	severity := findings.SeverityLow
+	urls := []string{}
+	for _, m := range mixedContentRe.FindAllSubmatch(f.ResponseBody, -1) {
+		switch strings.ToLower(string(m[1])) {
+		case "img", "audio", "video", "source":
+		default:
+			// active content can change the whole page
+			severity = findings.SeverityMedium
+		}
+		if u := string(m[2]); !slices.Contains(urls, u) {
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return nil
+	}
+
+	return []findings.Finding{newFinding(f.Request, TypeMixedContent, severity,
+		"HTTPS page loads resources over HTTP",
+		"Resources loaded over HTTP: "+strings.Join(urls[:min(len(urls), 5)], ", "), "")}
+}
+
+// minReflectedLength is the minimum length of the parameter values looked for
+// in responses, shorter ones appear by chance too often
+const minReflectedLength = 4
+
+// CheckReflectedParameters reports query and form parameters whose values
+// appear in HTML responses
+func CheckReflectedParameters(f *Flow) []findings.Finding {
+	if !isHTML(f.Response) || len(f.ResponseBody) == 0 {
+		return nil
+	}
+
+	params := map[string]url.Values{"query": f.Request.URL.Query()}
+	if mediaType(f.Request.Header) == "application/x-www-form-urlencoded" {
+		if form, err := url.ParseQuery(string(f.RequestBody)); err == nil {
+			params["body"] = form
+		}
+	}
+
+	body := string(f.ResponseBody)
+	result := []findings.Finding{}
+	for location, values := range params {
+		for name, vs := range values {
+			for _, v := range vs {
+				if len(v) < minReflectedLength || !strings.Contains(body, v) {
+					continue
+				}
+
+				severity := findings.SeverityInfo
+				detail := fmt.Sprintf("The value of the %s parameter %s is included in the response.", location, name)
+				if strings.ContainsAny(v, `<>"'`) {
+					severity = findings.SeverityMedium
+					detail += " It contains HTML special characters that are not encoded, which may allow cross-site scripting."
+				}
+
+				result = append(result, newFinding(f.Request, TypeReflectedParameter, severity,
+					fmt.Sprintf("Parameter %s reflected in the response", name), detail, location+":"+name))
+				break
+			}
+		}
+	}
+
+	return result
+}
+
+// sqlErrorRe matches error messages of databases
+var sqlErrorRe = regexp.MustCompile(`(SQLSTATE\[|You have an error in your SQL syntax|ORA-\d{5}|PG::[A-Z][a-zA-Z]+Error|Microsoft OLE DB Provider for|unterminated quoted string at or near|SQLite3::SQLException|unrecognized token: "|near "[^"]*": syntax error)`)
+
+// verboseErrorPatterns match stack traces and error messages that disclose
+// implementation details
+var verboseErrorPatterns = []struct {
+	name string
+	re   *regexp.Regexp
+}{
+	{"python-traceback", regexp.MustCompile(`Traceback \(most recent call last\)`)},
+	{"java-stack-trace", regexp.MustCompile(`(?m)(Exception in thread "|^\s+at [a-zA-Z_$][\w$]*(\.[\w$<>]+)+\([\w$]*\.java:\d+\))`)},
+	{"dotnet-stack-trace", regexp.MustCompile(`(System\.[A-Za-z]+Exception|Server Error in '/' Application|ASP\.NET is configured to show verbose error messages)`)},
+	{"php-error", regexp.MustCompile(`<b>(Fatal error|Warning|Parse error|Notice)</b>:.+ on line <b>\d+</b>`)},
+	{"go-panic", regexp.MustCompile(`goroutine \d+ \[running\]:`)},
+	{"ruby-stack-trace", regexp.MustCompile(`\.rb:\d+:in ` + "`")},
+	{"node-stack-trace", regexp.MustCompile(`(?m)^\s+at .+ \(/.+\.js:\d+:\d+\)`)},
+	{"sql-error", sqlErrorRe},
+}
+
+// CheckVerboseErrors reports responses with stack traces or detailed error
+// messages
+func CheckVerboseErrors(f *Flow) []findings.Finding {
+	if len(f.ResponseBody) == 0 || isBinary(f.Response) {
+		return nil
+	}
+
+	result := []findings.Finding{}
+	for _, p := range verboseErrorPatterns {
+		m := p.re.Find(f.ResponseBody)
+		if m == nil {
+			continue
+		}
+
+		result = append(result, newFinding(f.Request, TypeVerboseError, findings.SeverityLow,
+			"Verbose error message",
+			fmt.Sprintf("The response discloses implementation details (%s): %s", p.name, strings.TrimSpace(string(m))),
+			p.name))
+	}
+
+	return result
+}
+
+// CheckCORS reports CORS policies that allow arbitrary origins to read
+// responses
+func CheckCORS(f *Flow) []findings.Finding {
+	req, resp := f.Request, f.Response
+
+	allowOrigin := resp.Header.Get("Access-Control-Allow-Origin")
+	if allowOrigin == "" {
+		return nil
+	}
+	credentials := strings.EqualFold(resp.Header.Get("Access-Control-Allow-Credentials"), "true")
+	origin := req.Header.Get("Origin")
+
+	var severity findings.Severity
+	var detail, evidence string
+	switch {
+	case allowOrigin == "null":
+		severity, evidence = findings.SeverityLow, "null-origin"
+		detail = "The null origin, used by sandboxed documents, is allowed."
+	case allowOrigin == "*" && credentials:
+		severity, evidence = findings.SeverityLow, "wildcard-with-credentials"
+		detail = "A wildcard origin is allowed together with credentials."
+	case origin != "" && allowOrigin == origin && !sameHost(origin, requestHost(req)):
+		severity, evidence = findings.SeverityLow, "reflected-origin"
+		detail = fmt.Sprintf("The origin %s sent in the request is allowed, the policy may reflect any origin.", origin)
+	default:
+		return nil
+	}
+
+	if credentials && evidence != "wildcard-with-credentials" {
+		severity = findings.SeverityMedium
+		detail += " Credentials are allowed, so other sites can read authenticated responses."
+	}
+
+	return []findings.Finding{newFinding(req, TypeCORSMisconfiguration, severity,
+		"Permissive CORS policy", detail, evidence)}
+}
+
+// CheckSecrets reports credentials exposed in response bodies
+func CheckSecrets(f *Flow) []findings.Finding {
+	if len(f.ResponseBody) == 0 || isBinary(f.Response) {
+		return nil
+	}
+
+	location := secrets.Location{Message: "response", Part: secrets.PartBody}
+	return secrets.Findings(f.Request, secrets.Default.Scan(location, f.ResponseBody))
+}
+
+func mediaType(h http.Header) string {
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mt
+}
+
+func isHTML(resp *http.Response) bool {
+	mt := mediaType(resp.Header)
+	return mt == "text/html" || mt == "application/xhtml+xml"
+}
+
+// isBinary reports whether the response has a content type that is not text
+func isBinary(resp *http.Response) bool {
+	mt := mediaType(resp.Header)
+	for _, prefix := range []string{"image/", "audio/", "video/", "font/", "application/octet-stream", "application/zip", "application/pdf"} {
+		if strings.HasPrefix(mt, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameHost reports whether an origin refers to host
+func sameHost(origin, host string) bool {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, host)
+}
@@ -0,0 +1,164 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// Kinds of insertion points
+const (
+	PointQuery  = "query"
+	PointBody   = "body"
+	PointJSON   = "json"
+	PointHeader = "header"
+	PointCookie = "cookie"
+)
+
+// injectableHeaders are the headers used as insertion points when present,
+// in addition to the X- headers
+var injectableHeaders = []string{"User-Agent", "Referer", "Origin"}
+
+// InsertionPoint is a part of a request whose value is replaced with
+// payloads by the active scanner
+type InsertionPoint struct {
+	Kind  string
+	Name  string
+	Value string
+}
+
+func (ip InsertionPoint) String() string {
+	return ip.Kind + ":" + ip.Name
+}
+
+// InsertionPoints returns the query and body parameters, top level JSON
+// fields, cookies and some headers of a request
+func InsertionPoints(req *http.Request, body []byte) []InsertionPoint {
+	points := []InsertionPoint{}
+
+	for _, p := range rawParams(req.URL.RawQuery) {
+		points = append(points, InsertionPoint{Kind: PointQuery, Name: p[0], Value: p[1]})
+	}
+
+	switch mediaType(req.Header) {
+	case "application/x-www-form-urlencoded":
+		for _, p := range rawParams(string(body)) {
+			points = append(points, InsertionPoint{Kind: PointBody, Name: p[0], Value: p[1]})
+		}
+	case "application/json":
+		fields := map[string]any{}
+		if err := json.Unmarshal(body, &fields); err == nil {
+			names := make([]string, 0, len(fields))
+			for name := range fields {
+				names = append(names, name)
+			}
+			slices.Sort(names)
+
+			for _, name := range names {
+				switch v := fields[name].(type) {
+				case string:
+					points = append(points, InsertionPoint{Kind: PointJSON, Name: name, Value: v})
+				case float64, bool:
+					value, _ := json.Marshal(v)
+					points = append(points, InsertionPoint{Kind: PointJSON, Name: name, Value: string(value)})
+				}
+			}
+		}
+	}
+
+	for _, c := range req.Cookies() {
+		points = append(points, InsertionPoint{Kind: PointCookie, Name: c.Name, Value: c.Value})
+	}
+
+	headers := []string{}
+	for name := range req.Header {
+		if slices.Contains(injectableHeaders, name) || strings.HasPrefix(name, "X-") {
+			headers = append(headers, name)
+		}
+	}
+	slices.Sort(headers)
+	for _, name := range headers {
+		points = append(points, InsertionPoint{Kind: PointHeader, Name: name, Value: req.Header.Get(name)})
+	}
+
+	return points
+}
+
+// Inject returns a copy of the request, and its body, with value in the
+// insertion point
+func (ip InsertionPoint) Inject(req *http.Request, body []byte, value string) (*http.Request, []byte) {
+	r := req.Clone(req.Context())
+	u := *req.URL
+	r.URL = &u
+	body = bytes.Clone(body)
+
+	switch ip.Kind {
+	case PointQuery:
+		r.URL.RawQuery = replaceParam(r.URL.RawQuery, ip.Name, value)
+
+	case PointBody:
+		body = []byte(replaceParam(string(body), ip.Name, value))
+
+	case PointJSON:
+		fields := map[string]any{}
+		if err := json.Unmarshal(body, &fields); err == nil {
+			fields[ip.Name] = value
+			if b, err := json.Marshal(fields); err == nil {
+				body = b
+			}
+		}
+
+	case PointCookie:
+		cookies := []string{}
+		for _, c := range req.Cookies() {
+			v := c.Value
+			if c.Name == ip.Name {
+				v = value
+			}
+			cookies = append(cookies, c.Name+"="+v)
+		}
+		r.Header.Set("Cookie", strings.Join(cookies, "; "))
+
+	case PointHeader:
+		r.Header.Set(ip.Name, value)
+	}
+
+	r.ContentLength = int64(len(body))
+	r.Header.Del("Content-Length")
+
+	return r, body
+}
+
+// rawParams returns the decoded names and values of a query string in order
+func rawParams(query string) [][2]string {
+	params := [][2]string{}
+	for _, pair := range strings.Split(query, "&") {
+		if pair == "" {
+			continue
+		}
+		name, value, _ := strings.Cut(pair, "=")
+		name, err1 := url.QueryUnescape(name)
+		value, err2 := url.QueryUnescape(value)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		params = append(params, [2]string{name, value})
+	}
+	return params
+}
+
+// replaceParam replaces the value of the parameters named name of a query
+// string, keeping the order and encoding of the others
+func replaceParam(query, name, value string) string {
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		rawName, _, _ := strings.Cut(pair, "=")
+		if n, err := url.QueryUnescape(rawName); err == nil && n == name {
+			pairs[i] = rawName + "=" + url.QueryEscape(value)
+		}
+	}
+	return strings.Join(pairs, "&")
+}
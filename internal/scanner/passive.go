@@ -0,0 +1,116 @@
+package scanner
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// SourcePassive is the source of the findings reported by the passive scanner
+const SourcePassive = "passive"
+
+// MaxScannedBodySize is the number of bytes of each body that are inspected
+const MaxScannedBodySize = 2 * 1024 * 1024
+
+// Flow is the request and response inspected by the checks
+type Flow struct {
+	Request      *http.Request
+	RequestBody  []byte
+	Response     *http.Response
+	ResponseBody []byte
+}
+
+// PassiveCheck inspects a flow without sending requests and returns the
+// issues found in it
+type PassiveCheck func(f *Flow) []findings.Finding
+
+// PassiveChecks are the checks run by the passive scanner
+var PassiveChecks = []PassiveCheck{
+	CheckSecurityHeaders,
+	CheckCookies,
+	CheckMixedContent,
+	CheckReflectedParameters,
+	CheckVerboseErrors,
+	CheckCORS,
+	CheckSecrets,
+}
+
+// NewPassiveScanHook returns a hook that runs the passive checks on each
+// response and reports the issues found to sink
+func NewPassiveScanHook(sink findings.Sink) pipeline.ReadOnlyHook[*http.Response] {
+	return func(resp *http.Response) error {
+		if resp.Request == nil {
+			return nil
+		}
+
+		requestBody, err := httpbytes.ReadAndRestore(&resp.Request.Body)
+		if err != nil {
+			return err
+		}
+		responseBody, err := httpbytes.ReadAndRestore(&resp.Body)
+		if err != nil {
+			return err
+		}
+
+		f := &Flow{
+			Request:      resp.Request,
+			RequestBody:  httpbytes.Truncate(requestBody, MaxScannedBodySize),
+			Response:     resp,
+			ResponseBody: httpbytes.Truncate(responseBody, MaxScannedBodySize),
+		}
+
+		flowID := ids.GetResponseID(resp)
+		for _, finding := range Scan(f) {
+			finding.FlowID = flowID
+			sink(finding)
+		}
+
+		return nil
+	}
+}
+
+// Scan runs the passive checks on a flow
+func Scan(f *Flow) []findings.Finding {
+	result := []findings.Finding{}
+	now := time.Now()
+
+	for _, check := range PassiveChecks {
+		for _, finding := range check(f) {
+			finding.Source = SourcePassive
+			finding.Timestamp = now
+			result = append(result, finding)
+		}
+	}
+
+	return result
+}
+
+// newFinding returns a finding located in the host and path of the request
+func newFinding(req *http.Request, typ string, severity findings.Severity, title, detail, evidence string) findings.Finding {
+	return findings.Finding{
+		Type:     typ,
+		Severity: severity,
+		Host:     requestHost(req),
+		Path:     req.URL.Path,
+		Title:    title,
+		Detail:   detail,
+		Evidence: evidence,
+	}
+}
+
+func requestHost(req *http.Request) string {
+	if req.Host != "" {
+		return req.Host
+	}
+	return req.URL.Host
+}
+
+// isHTTPS reports whether the request was sent over TLS. Requests read from
+// CONNECT tunnels have no scheme.
+func isHTTPS(req *http.Request) bool {
+	return req.URL.Scheme == "https" || req.URL.Scheme == "" || req.TLS != nil
+}
@@ -0,0 +1,292 @@
+package secrets
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// Source and type of the findings reported for detected secrets
+const (
+	SourceSecrets = "secrets"
+	TypeSecret    = "exposed-secret"
+)
+
+// Parts of a message where secrets are looked for
+const (
+	PartURL    = "url"
+	PartHeader = "header"
+	PartCookie = "cookie"
+	PartBody   = "body"
+)
+
+// Location is where a secret was found
+type Location struct {
+	// Message is "request" or "response"
+	Message string
+	Part    string
+
+	// Name is the name of the header or cookie
+	Name string
+}
+
+func (l Location) String() string {
+	if l.Name == "" {
+		return l.Message + " " + l.Part
+	}
+	return l.Message + " " + l.Part + " " + l.Name
+}
+
+// Match is a secret found by a detector
+type Match struct {
+	Rule     *Rule
+	Location Location
+	Value    string
+
+	// JWT is the decoded token for matches of the jwt rule
+	JWT *JWT
+}
+
+// Detector finds secrets in requests and responses
+type Detector struct {
+	rules []Rule
+}
+
+// NewDetector returns a detector that uses the given rules
+func NewDetector(rules []Rule) *Detector {
+	return &Detector{rules: append([]Rule{}, rules...)}
+}
+
+// Default is a detector that uses the default rules
+var Default = NewDetector(DefaultRules)
+
+type span struct {
+	rule       *Rule
+	start, end int
+}
+
+// find returns the secrets in data, discarding the matches that overlap a
+// match of a previous rule
+func (d *Detector) find(data []byte) []span {
+	spans := []span{}
+
+	for i := range d.rules {
+		rule := &d.rules[i]
+		for _, m := range rule.Pattern.FindAllSubmatchIndex(data, -1) {
+			start, end := m[2*rule.Group], m[2*rule.Group+1]
+			if start < 0 || start == end {
+				continue
+			}
+			if rule.MinEntropy > 0 && Entropy(string(data[start:end])) < rule.MinEntropy {
+				continue
+			}
+
+			overlaps := slices.ContainsFunc(spans, func(s span) bool {
+				return start < s.end && s.start < end
+			})
+			if !overlaps {
+				spans = append(spans, span{rule: rule, start: start, end: end})
+			}
+		}
+	}
+
+	slices.SortFunc(spans, func(a, b span) int { return a.start - b.start })
+	return spans
+}
+
+// Scan returns the secrets found in data
+func (d *Detector) Scan(location Location, data []byte) []Match {
+	matches := []Match{}
+	for _, s := range d.find(data) {
+		m := Match{Rule: s.rule, Location: location, Value: string(data[s.start:s.end])}
+		if s.rule.Name == RuleJWT {
+			if jwt, err := DecodeJWT(m.Value); err == nil {
+				m.JWT = jwt
+			}
+		}
+		matches = append(matches, m)
+	}
+	return matches
+}
+
+// ScanRequest returns the secrets found in the URL, headers, cookies and body
+// of a request
+func (d *Detector) ScanRequest(req *http.Request, body []byte) []Match {
+	matches := d.Scan(Location{Message: "request", Part: PartURL}, []byte(req.URL.String()))
+	matches = append(matches, d.scanHeaders("request", req.Header)...)
+	for _, c := range req.Cookies() {
+		matches = append(matches, d.Scan(Location{Message: "request", Part: PartCookie, Name: c.Name}, []byte(c.Name+"="+c.Value))...)
+	}
+	return append(matches, d.Scan(Location{Message: "request", Part: PartBody}, body)...)
+}
+
+// ScanResponse returns the secrets found in the headers, cookies and body of
+// a response
+func (d *Detector) ScanResponse(resp *http.Response, body []byte) []Match {
+	matches := d.scanHeaders("response", resp.Header)
+	for _, c := range resp.Cookies() {
+		matches = append(matches, d.Scan(Location{Message: "response", Part: PartCookie, Name: c.Name}, []byte(c.Name+"="+c.Value))...)
+	}
+	return append(matches, d.Scan(Location{Message: "response", Part: PartBody}, body)...)
+}
+
+// scanHeaders scans each header as a "<name>: <value>" line, so that rules
+// can use the name as context. Cookies are scanned separately.
+func (d *Detector) scanHeaders(message string, header http.Header) []Match {
+	matches := []Match{}
+	for name, values := range header {
+		if name == "Cookie" || name == "Set-Cookie" {
+			continue
+		}
+		for _, v := range values {
+			matches = append(matches, d.Scan(Location{Message: message, Part: PartHeader, Name: name}, []byte(name+": "+v))...)
+		}
+	}
+	return matches
+}
+
+// Redact returns data with the secrets replaced by [REDACTED:<rule>]
+func (d *Detector) Redact(data []byte) []byte {
+	spans := d.find(data)
+	if len(spans) == 0 {
+		return data
+	}
+
+	var buf bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		buf.Write(data[last:s.start])
+		buf.WriteString("[REDACTED:" + s.rule.Name + "]")
+		last = s.end
+	}
+	buf.Write(data[last:])
+
+	return buf.Bytes()
+}
+
+// RedactRequest replaces the secrets in the URL, headers and body of req
+func (d *Detector) RedactRequest(req *http.Request) error {
+	if req.URL.User != nil {
+		if _, ok := req.URL.User.Password(); ok {
+			req.URL.User = url.UserPassword(req.URL.User.Username(), "[REDACTED]")
+		}
+	}
+	req.URL.RawQuery = string(d.Redact([]byte(req.URL.RawQuery)))
+	d.redactHeaders(req.Header)
+
+	if req.Body == nil {
+		return nil
+	}
+	body, err := httpbytes.ReadBody(req.Body)
+	if err != nil {
+		return err
+	}
+	redacted := d.Redact(body)
+	req.Body = httpbytes.NewBodyWrapper(redacted)
+	if len(redacted) != len(body) {
+		req.ContentLength = int64(len(redacted))
+		if req.Header.Get("Content-Length") != "" {
+			req.Header.Set("Content-Length", strconv.Itoa(len(redacted)))
+		}
+	}
+
+	return nil
+}
+
+// RedactResponse replaces the secrets in the headers and body of resp
+func (d *Detector) RedactResponse(resp *http.Response) error {
+	d.redactHeaders(resp.Header)
+
+	if resp.Body == nil {
+		return nil
+	}
+	body, err := httpbytes.ReadBody(resp.Body)
+	if err != nil {
+		return err
+	}
+	redacted := d.Redact(body)
+	resp.Body = httpbytes.NewBodyWrapper(redacted)
+	if len(redacted) != len(body) {
+		resp.ContentLength = int64(len(redacted))
+		if resp.Header.Get("Content-Length") != "" {
+			resp.Header.Set("Content-Length", strconv.Itoa(len(redacted)))
+		}
+	}
+
+	return nil
+}
+
+func (d *Detector) redactHeaders(header http.Header) {
+	for name, values := range header {
+		prefix := name + ": "
+		for i, v := range values {
+			values[i] = strings.TrimPrefix(string(d.Redact([]byte(prefix+v))), prefix)
+		}
+	}
+}
+
+// Findings converts the matches of a flow to findings. Secrets found in
+// headers and cookies apply to the whole host, the others to the path of
+// the request. Secrets sent by clients are reported with low severity at
+// most, since sending credentials is expected.
+func Findings(req *http.Request, matches []Match) []findings.Finding {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	now := time.Now()
+
+	result := []findings.Finding{}
+	for _, m := range matches {
+		masked := Mask(m.Value)
+
+		severity := m.Rule.Severity
+		if m.Location.Message == "request" && severity.Rank() > findings.SeverityLow.Rank() {
+			severity = findings.SeverityLow
+		}
+
+		detail := fmt.Sprintf("A value that looks like a %s was found in the %s: %s", m.Rule.Name, m.Location, masked)
+		if m.JWT != nil {
+			detail += ". Token: " + m.JWT.Summary()
+			if m.JWT.Unsigned() {
+				severity = findings.SeverityMedium
+				detail += ". The token is not signed."
+			}
+		}
+
+		path := req.URL.Path
+		if m.Location.Part == PartHeader || m.Location.Part == PartCookie {
+			path = ""
+		}
+
+		result = append(result, findings.Finding{
+			Source:    SourceSecrets,
+			Type:      TypeSecret,
+			Severity:  severity,
+			Host:      host,
+			Path:      path,
+			Title:     fmt.Sprintf("Secret in %s: %s", m.Location, m.Rule.Name),
+			Detail:    detail,
+			Evidence:  m.Rule.Name + ":" + m.Location.String() + ":" + masked,
+			Timestamp: now,
+		})
+	}
+
+	return result
+}
+
+// Mask hides all but the first and last characters of a secret
+func Mask(secret string) string {
+	if len(secret) <= 8 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:4] + strings.Repeat("*", len(secret)-8) + secret[len(secret)-4:]
+}
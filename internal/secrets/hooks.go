@@ -0,0 +1,92 @@
+package secrets
+
+import (
+	"net/http"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+// MaxScannedBodySize is the number of bytes of each body that are scanned
+// for secrets
+const MaxScannedBodySize = 2 * 1024 * 1024
+
+// NewRequestHook returns a hook that reports the secrets found in requests
+// to sink
+func NewRequestHook(d *Detector, sink findings.Sink) pipeline.ReadOnlyHook[*http.Request] {
+	return func(req *http.Request) error {
+		body, err := httpbytes.ReadAndRestore(&req.Body)
+		if err != nil {
+			return err
+		}
+
+		flowID := ids.GetRequestID(req)
+		for _, f := range Findings(req, d.ScanRequest(req, httpbytes.Truncate(body, MaxScannedBodySize))) {
+			f.FlowID = flowID
+			sink(f)
+		}
+		return nil
+	}
+}
+
+// NewResponseHook returns a hook that reports the secrets found in responses
+// to sink
+func NewResponseHook(d *Detector, sink findings.Sink) pipeline.ReadOnlyHook[*http.Response] {
+	return func(resp *http.Response) error {
+		if resp.Request == nil {
+			return nil
+		}
+
+		body, err := httpbytes.ReadAndRestore(&resp.Body)
+		if err != nil {
+			return err
+		}
+
+		flowID := ids.GetResponseID(resp)
+		for _, f := range Findings(resp.Request, d.ScanResponse(resp, httpbytes.Truncate(body, MaxScannedBodySize))) {
+			f.FlowID = flowID
+			sink(f)
+		}
+		return nil
+	}
+}
+
+// RedactRequestHook returns a hook that redacts the secrets of requests
+// before passing them to next
+func RedactRequestHook(d *Detector, next pipeline.ReadOnlyHook[*http.Request]) pipeline.ReadOnlyHook[*http.Request] {
+	return func(req *http.Request) error {
+		// the URL is shared with the requests given to other hooks
+		u := *req.URL
+		req.URL = &u
+
+		if err := d.RedactRequest(req); err != nil {
+			return err
+		}
+		return next(req)
+	}
+}
+
+// RedactResponseHook returns a hook that redacts the secrets of responses,
+// and of their requests, before passing them to next
+func RedactResponseHook(d *Detector, next pipeline.ReadOnlyHook[*http.Response]) pipeline.ReadOnlyHook[*http.Response] {
+	return func(resp *http.Response) error {
+		if err := d.RedactResponse(resp); err != nil {
+			return err
+		}
+
+		if resp.Request != nil {
+			// the request is shared with the responses given to other hooks
+			req := httpbytes.CloneRequest(resp.Request)
+			u := *req.URL
+			req.URL = &u
+			if err := d.RedactRequest(req); err != nil {
+				return err
+			}
+			resp.Request = req
+		}
+
+		return next(resp)
+	}
+}
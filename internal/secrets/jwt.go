@@ -0,0 +1,81 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWT is a decoded JSON Web Token. The signature is not verified.
+type JWT struct {
+	Header map[string]any
+	Claims map[string]any
+}
+
+// DecodeJWT decodes the header and claims of a token
+func DecodeJWT(token string) (*JWT, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid JWT: expected 3 parts, got %d", len(parts))
+	}
+
+	jwt := &JWT{}
+	if err := decodeJWTPart(parts[0], &jwt.Header); err != nil {
+		return nil, fmt.Errorf("invalid JWT header: %v", err)
+	}
+	if err := decodeJWTPart(parts[1], &jwt.Claims); err != nil {
+		return nil, fmt.Errorf("invalid JWT claims: %v", err)
+	}
+
+	return jwt, nil
+}
+
+func decodeJWTPart(part string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(part, "="))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Algorithm returns the signing algorithm of the token
+func (j *JWT) Algorithm() string {
+	alg, _ := j.Header["alg"].(string)
+	return alg
+}
+
+// Unsigned reports whether the token uses the "none" algorithm
+func (j *JWT) Unsigned() bool {
+	return strings.EqualFold(j.Algorithm(), "none")
+}
+
+// ExpiresAt returns the expiration time of the token, if it has one
+func (j *JWT) ExpiresAt() (time.Time, bool) {
+	exp, ok := j.Claims["exp"].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(exp), 0), true
+}
+
+// Summary describes the algorithm, subject, issuer and expiration of the token
+func (j *JWT) Summary() string {
+	parts := []string{"alg=" + j.Algorithm()}
+	for _, claim := range []string{"sub", "iss", "aud"} {
+		if v, ok := j.Claims[claim]; ok {
+			parts = append(parts, fmt.Sprintf("%s=%v", claim, v))
+		}
+	}
+	if exp, ok := j.ExpiresAt(); ok {
+		s := "exp=" + exp.UTC().Format(time.RFC3339)
+		if exp.Before(time.Now()) {
+			s += " (expired)"
+		}
+		parts = append(parts, s)
+	} else {
+		parts = append(parts, "no expiration")
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,127 @@
+package secrets
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+)
+
+// Rule detects a kind of secret
+type Rule struct {
+	Name     string
+	Severity findings.Severity
+
+	// Pattern matches the secret. If Group is set, only that group of the
+	// match is the secret, the rest of the match gives context.
+	Pattern *regexp.Regexp
+	Group   int
+
+	// MinEntropy is the minimum Shannon entropy, in bits per character, of
+	// the secret. It discards matches of generic patterns that are not
+	// random enough to be credentials, e.g. "password=changeme".
+	MinEntropy float64
+}
+
+// RuleJWT is the name of the rule that detects JSON Web Tokens
+const RuleJWT = "jwt"
+
+// DefaultRules are the rules used when no other rules are configured. More
+// specific rules go first, since matches overlapping a previous one are
+// discarded.
+var DefaultRules = []Rule{
+	{Name: "private-key", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`-----BEGIN (?:RSA |EC |DSA |OPENSSH |ENCRYPTED |PGP )?PRIVATE KEY(?: BLOCK)?-----`)},
+	{Name: "aws-access-key", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`\b(?:AKIA|ASIA)[0-9A-Z]{16}\b`)},
+	{Name: "aws-secret-key", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`(?i)aws.{0,20}?(?:secret|key).{0,5}?["':= ]+([A-Za-z0-9/+]{40})\b`), Group: 1, MinEntropy: 4},
+	{Name: "github-token", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`\b(?:gh[pousr]_[0-9A-Za-z]{36}|github_pat_[0-9A-Za-z_]{82})\b`)},
+	{Name: "gitlab-token", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`\bglpat-[0-9A-Za-z_-]{20}\b`)},
+	{Name: "slack-token", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`\bxox[abposr]-[0-9A-Za-z-]{10,}`)},
+	{Name: "slack-webhook", Severity: findings.SeverityMedium, Pattern: regexp.MustCompile(`https://hooks\.slack\.com/services/[A-Za-z0-9/_]+`)},
+	{Name: "google-api-key", Severity: findings.SeverityMedium, Pattern: regexp.MustCompile(`\bAIza[0-9A-Za-z_-]{35}\b`)},
+	{Name: "stripe-secret-key", Severity: findings.SeverityHigh, Pattern: regexp.MustCompile(`\b[sr]k_live_[0-9A-Za-z]{24,}\b`)},
+	{Name: RuleJWT, Severity: findings.SeverityLow, Pattern: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]+\.eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	{Name: "url-password", Severity: findings.SeverityMedium, Pattern: regexp.MustCompile(`\b[a-zA-Z][a-zA-Z0-9+.-]*://[^/\s:@"']+:([^/\s:@"']+)@`), Group: 1},
+	{Name: "bearer-token", Severity: findings.SeverityLow, Pattern: regexp.MustCompile(`(?i)\bbearer\s+([A-Za-z0-9._~+/-]{16,}=*)`), Group: 1, MinEntropy: 3},
+	{Name: "basic-auth", Severity: findings.SeverityLow, Pattern: regexp.MustCompile(`(?i)\bbasic\s+([A-Za-z0-9+/]{8,}={0,2})`), Group: 1},
+	{Name: "generic-secret", Severity: findings.SeverityLow, Pattern: regexp.MustCompile(`(?i)(?:api[_-]?key|secret|token|passw(?:or)?d|access[_-]?key|client[_-]?secret)[a-z0-9_-]*["']?\s*[:=]\s*["']?([A-Za-z0-9+/_.~-]{16,})`), Group: 1, MinEntropy: 3.5},
+}
+
+// jsonRule is the format of the rules in rules files
+type jsonRule struct {
+	Name       string  `json:"name"`
+	Severity   string  `json:"severity"`
+	Pattern    string  `json:"pattern"`
+	Group      int     `json:"group"`
+	MinEntropy float64 `json:"min_entropy"`
+}
+
+// LoadRules reads rules from a JSON file with an array of objects with the
+// fields name, severity, pattern, group and min_entropy
+func LoadRules(file string) ([]Rule, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var jsonRules []jsonRule
+	if err := json.Unmarshal(data, &jsonRules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %v", file, err)
+	}
+
+	rules := make([]Rule, 0, len(jsonRules))
+	for _, jr := range jsonRules {
+		if jr.Name == "" {
+			return nil, fmt.Errorf("invalid rule in %s: name is required", file)
+		}
+
+		pattern, err := regexp.Compile(jr.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern of rule %s: %v", jr.Name, err)
+		}
+		if jr.Group < 0 || jr.Group > pattern.NumSubexp() {
+			return nil, fmt.Errorf("invalid group of rule %s: the pattern has %d groups", jr.Name, pattern.NumSubexp())
+		}
+
+		severity := findings.Severity(jr.Severity)
+		if jr.Severity == "" {
+			severity = findings.SeverityMedium
+		} else if severity.Rank() == 0 {
+			return nil, fmt.Errorf("invalid severity of rule %s: %s", jr.Name, jr.Severity)
+		}
+
+		rules = append(rules, Rule{
+			Name:       jr.Name,
+			Severity:   severity,
+			Pattern:    pattern,
+			Group:      jr.Group,
+			MinEntropy: jr.MinEntropy,
+		})
+	}
+
+	return rules, nil
+}
+
+// Entropy returns the Shannon entropy of s in bits per character
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+
+	counts := map[rune]int{}
+	n := 0
+	for _, r := range s {
+		counts[r]++
+		n++
+	}
+
+	entropy := 0.0
+	for _, c := range counts {
+		p := float64(c) / float64(n)
+		entropy -= p * math.Log2(p)
+	}
+
+	return entropy
+}
@@ -0,0 +1,267 @@
+// Package session keeps the session state of the tested applications: a
+// cookie jar updated from the responses, tokens extracted from them, and
+// macros that log in again when the session expires
+package session
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// Config holds the session handling rules and macros
+type Config struct {
+	Rules  []Rule  `json:"rules"`
+	Macros []Macro `json:"macros"`
+
+	// Tokens are the initial values of the tokens
+	Tokens map[string]string `json:"tokens,omitempty"`
+}
+
+// Rule applies the session state to the requests whose host and URL match
+// its regexes, empty regexes match all requests
+type Rule struct {
+	Name string `json:"name"`
+	Host string `json:"host,omitempty"`
+	URL  string `json:"url,omitempty"`
+
+	// Cookies adds the cookies of the jar to matching requests, replacing
+	// the ones with the same name
+	Cookies bool `json:"cookies,omitempty"`
+
+	// Headers are set in matching requests. {{name}} is replaced with the
+	// current value of the token name; headers that reference unknown
+	// tokens are not set.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Extract updates tokens from the responses to matching requests
+	Extract []Extractor `json:"extract,omitempty"`
+
+	// Expired detects the responses caused by an expired session. When one
+	// is received, Macro is run and the request is sent again.
+	Expired *Condition `json:"expired,omitempty"`
+	Macro   string     `json:"macro,omitempty"`
+
+	hostRe *regexp.Regexp
+	urlRe  *regexp.Regexp
+}
+
+// Condition matches a response when all its criteria match. Header is
+// matched against each header line in the form "Name: value".
+type Condition struct {
+	Status []int  `json:"status,omitempty"`
+	Body   string `json:"body,omitempty"`
+	Header string `json:"header,omitempty"`
+
+	bodyRe   *regexp.Regexp
+	headerRe *regexp.Regexp
+}
+
+// Extractor sets a token to the first group of the first match of a regex,
+// or to the whole match if it has no groups. The regex is applied to the
+// values of Header if it is set, and to the body otherwise.
+type Extractor struct {
+	Token  string `json:"token"`
+	Header string `json:"header,omitempty"`
+	Regex  string `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+// Macro is a sequence of requests that restores a session, e.g. a login.
+// The cookies of the jar are sent with each request and the cookies and
+// tokens of the responses update the session state. Redirects are not
+// followed.
+type Macro struct {
+	Name     string         `json:"name"`
+	Requests []MacroRequest `json:"requests"`
+	Extract  []Extractor    `json:"extract,omitempty"`
+}
+
+// MacroRequest is a request of a macro. {{name}} in the URL, headers and
+// body is replaced with the current value of the token name.
+type MacroRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// LoadConfig reads a JSON config file
+func LoadConfig(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read session rules file: %v", err)
+	}
+
+	config := &Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid session rules file %s: %v", file, err)
+	}
+
+	if err := config.compile(); err != nil {
+		return nil, fmt.Errorf("invalid session rules file %s: %v", file, err)
+	}
+
+	return config, nil
+}
+
+// compile validates the config and compiles its regexes
+func (c *Config) compile() error {
+	macros := map[string]bool{}
+	for i := range c.Macros {
+		m := &c.Macros[i]
+		if m.Name == "" {
+			return fmt.Errorf("macro %d has no name", i+1)
+		}
+		if len(m.Requests) == 0 {
+			return fmt.Errorf("macro '%s' has no requests", m.Name)
+		}
+		for _, r := range m.Requests {
+			if r.URL == "" {
+				return fmt.Errorf("macro '%s' has a request without URL", m.Name)
+			}
+		}
+		if err := compileExtractors(m.Extract); err != nil {
+			return fmt.Errorf("macro '%s': %v", m.Name, err)
+		}
+		macros[m.Name] = true
+	}
+
+	for i := range c.Rules {
+		r := &c.Rules[i]
+		if r.Name == "" {
+			r.Name = fmt.Sprintf("rule %d", i+1)
+		}
+
+		var err error
+		if r.hostRe, err = compileOptional(r.Host); err != nil {
+			return fmt.Errorf("%s: invalid host regex: %v", r.Name, err)
+		}
+		if r.urlRe, err = compileOptional(r.URL); err != nil {
+			return fmt.Errorf("%s: invalid url regex: %v", r.Name, err)
+		}
+		if err := compileExtractors(r.Extract); err != nil {
+			return fmt.Errorf("%s: %v", r.Name, err)
+		}
+
+		if (r.Expired == nil) != (r.Macro == "") {
+			return fmt.Errorf("%s: expired and macro must be set together", r.Name)
+		}
+		if r.Macro != "" && !macros[r.Macro] {
+			return fmt.Errorf("%s: unknown macro '%s'", r.Name, r.Macro)
+		}
+		if r.Expired != nil {
+			if len(r.Expired.Status) == 0 && r.Expired.Body == "" && r.Expired.Header == "" {
+				return fmt.Errorf("%s: expired condition has no criteria", r.Name)
+			}
+			if r.Expired.bodyRe, err = compileOptional(r.Expired.Body); err != nil {
+				return fmt.Errorf("%s: invalid expired body regex: %v", r.Name, err)
+			}
+			if r.Expired.headerRe, err = compileOptional(r.Expired.Header); err != nil {
+				return fmt.Errorf("%s: invalid expired header regex: %v", r.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func compileExtractors(extractors []Extractor) error {
+	for i := range extractors {
+		e := &extractors[i]
+		if e.Token == "" {
+			return fmt.Errorf("extractor %d has no token", i+1)
+		}
+		re, err := regexp.Compile(e.Regex)
+		if err != nil {
+			return fmt.Errorf("invalid regex of token '%s': %v", e.Token, err)
+		}
+		e.re = re
+	}
+	return nil
+}
+
+func compileOptional(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// matches reports whether the rule applies to the request
+func (r *Rule) matches(req *http.Request) bool {
+	if r.hostRe != nil && !r.hostRe.MatchString(requestURL(req).Host) {
+		return false
+	}
+	return r.urlRe == nil || r.urlRe.MatchString(requestURL(req).String())
+}
+
+// Matches reports whether the response matches the condition
+func (c *Condition) Matches(resp *http.Response, body []byte) bool {
+	if len(c.Status) > 0 && !slices.Contains(c.Status, resp.StatusCode) {
+		return false
+	}
+	if c.bodyRe != nil && !c.bodyRe.Match(body) {
+		return false
+	}
+	if c.headerRe != nil {
+		found := false
+		for name, values := range resp.Header {
+			for _, v := range values {
+				if c.headerRe.MatchString(name + ": " + v) {
+					found = true
+				}
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// extract returns the value of the token found in the response, if any
+func (e *Extractor) extract(header http.Header, body []byte) (string, bool) {
+	if e.Header != "" {
+		for _, v := range header.Values(e.Header) {
+			if value, ok := e.match(v); ok {
+				return value, true
+			}
+		}
+		return "", false
+	}
+	return e.match(string(body))
+}
+
+func (e *Extractor) match(s string) (string, bool) {
+	m := e.re.FindStringSubmatch(s)
+	if m == nil {
+		return "", false
+	}
+	if len(m) > 1 {
+		return m[1], true
+	}
+	return m[0], true
+}
+
+var tokenRefRe = regexp.MustCompile(`\{\{\s*([\w.-]+)\s*\}\}`)
+
+// expand replaces the token references of s with their values. It returns
+// false if a referenced token is unknown.
+func expand(s string, tokens map[string]string) (string, bool) {
+	ok := true
+	result := tokenRefRe.ReplaceAllStringFunc(s, func(ref string) string {
+		name := strings.TrimSpace(ref[2 : len(ref)-2])
+		value, found := tokens[name]
+		if !found {
+			ok = false
+		}
+		return value
+	})
+	return result, ok
+}
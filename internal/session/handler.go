@@ -0,0 +1,369 @@
+package session
+
+import (
+	"bytes"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
+)
+
+const (
+	DefaultTimeout = 30 * time.Second
+
+	// MacroCooldown is the time after running a macro during which it is
+	// not run again, so that the responses of requests sent concurrently
+	// with an expired session trigger a single login
+	MacroCooldown = 5 * time.Second
+)
+
+// Handler holds the session state and applies the rules of its config
+type Handler struct {
+	Config *Config
+	Jar    *cookiejar.Jar
+
+	// Client sends the macro requests and the requests sent again after
+	// running a macro
+	Client *http.Client
+
+	tokensMutex sync.RWMutex
+	tokens      map[string]string
+
+	macroMutex sync.Mutex
+	macroRuns  map[string]time.Time
+}
+
+// NewHandler returns a handler with an empty cookie jar and the initial
+// tokens of the config
+func NewHandler(config *Config) *Handler {
+	// a jar without public suffix list never fails to be created
+	jar, _ := cookiejar.New(nil)
+
+	tokens := map[string]string{}
+	maps.Copy(tokens, config.Tokens)
+
+	return &Handler{
+		Config: config,
+		Jar:    jar,
+		Client: &http.Client{
+			Timeout: DefaultTimeout,
+			Transport: &http.Transport{
+				Proxy:           http.ProxyFromEnvironment,
+				TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		tokens:    tokens,
+		macroRuns: map[string]time.Time{},
+	}
+}
+
+// NewRequestHook returns a hook that applies the session state to the
+// matching requests
+func NewRequestHook(h *Handler) pipeline.ModHook[*http.Request] {
+	return func(req *http.Request) (*http.Request, error) {
+		h.Apply(req)
+		return req, nil
+	}
+}
+
+// NewResponseHook returns a hook that updates the session state from each
+// response. When a response matches the expired condition of a rule, the
+// macro of the rule is run and the response is replaced by the one of the
+// request sent again.
+func NewResponseHook(h *Handler) pipeline.ModHook[*http.Response] {
+	return func(resp *http.Response) (*http.Response, error) {
+		if resp.Request == nil {
+			return resp, nil
+		}
+
+		body, err := httpbytes.ReadAndRestore(&resp.Body)
+		if err != nil {
+			return resp, err
+		}
+		h.Update(resp, body)
+
+		rule := h.expiredRule(resp, body)
+		if rule == nil {
+			return resp, nil
+		}
+
+		log.Printf("Session expired for %s %s, running macro %s", resp.Request.Method, resp.Request.URL, rule.Macro)
+		if err := h.RunMacro(rule.Macro); err != nil {
+			log.Printf("Failed to run macro %s: %v", rule.Macro, err)
+			return resp, nil
+		}
+
+		retried, err := h.resend(resp.Request)
+		if err != nil {
+			log.Printf("Failed to send %s %s again after running macro %s: %v", resp.Request.Method, resp.Request.URL, rule.Macro, err)
+			return resp, nil
+		}
+
+		return retried, nil
+	}
+}
+
+// Token returns the current value of a token
+func (h *Handler) Token(name string) (string, bool) {
+	h.tokensMutex.RLock()
+	defer h.tokensMutex.RUnlock()
+
+	value, ok := h.tokens[name]
+	return value, ok
+}
+
+// SetToken sets the value of a token
+func (h *Handler) SetToken(name, value string) {
+	h.tokensMutex.Lock()
+	defer h.tokensMutex.Unlock()
+
+	if h.tokens[name] != value {
+		log.Printf("Updated session token %s", name)
+	}
+	h.tokens[name] = value
+}
+
+// Tokens returns a copy of the current tokens
+func (h *Handler) Tokens() map[string]string {
+	h.tokensMutex.RLock()
+	defer h.tokensMutex.RUnlock()
+
+	return maps.Clone(h.tokens)
+}
+
+// Apply sets the cookies and headers of the rules that match the request
+func (h *Handler) Apply(req *http.Request) {
+	tokens := h.Tokens()
+
+	for i := range h.Config.Rules {
+		r := &h.Config.Rules[i]
+		if !r.matches(req) {
+			continue
+		}
+
+		if r.Cookies {
+			setCookies(req, h.Jar.Cookies(requestURL(req)))
+		}
+
+		for name, template := range r.Headers {
+			if value, ok := expand(template, tokens); ok {
+				req.Header.Set(name, value)
+			}
+		}
+	}
+}
+
+// Update stores the cookies set by the response in the jar and the tokens
+// extracted by the rules that match its request
+func (h *Handler) Update(resp *http.Response, body []byte) {
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		h.Jar.SetCookies(requestURL(resp.Request), cookies)
+	}
+
+	for i := range h.Config.Rules {
+		r := &h.Config.Rules[i]
+		if r.matches(resp.Request) {
+			h.extract(r.Extract, resp.Header, body)
+		}
+	}
+}
+
+func (h *Handler) extract(extractors []Extractor, header http.Header, body []byte) {
+	for i := range extractors {
+		if value, ok := extractors[i].extract(header, body); ok {
+			h.SetToken(extractors[i].Token, value)
+		}
+	}
+}
+
+// expiredRule returns the first rule that matches the request of the
+// response and whose expired condition matches the response
+func (h *Handler) expiredRule(resp *http.Response, body []byte) *Rule {
+	for i := range h.Config.Rules {
+		r := &h.Config.Rules[i]
+		if r.Expired != nil && r.matches(resp.Request) && r.Expired.Matches(resp, body) {
+			return r
+		}
+	}
+	return nil
+}
+
+// RunMacro sends the requests of a macro and updates the session state with
+// their responses. Macros are run one at a time, and a macro that finished
+// less than MacroCooldown ago is not run again.
+func (h *Handler) RunMacro(name string) error {
+	var macro *Macro
+	for i := range h.Config.Macros {
+		if h.Config.Macros[i].Name == name {
+			macro = &h.Config.Macros[i]
+		}
+	}
+	if macro == nil {
+		return fmt.Errorf("unknown macro '%s'", name)
+	}
+
+	h.macroMutex.Lock()
+	defer h.macroMutex.Unlock()
+
+	if time.Since(h.macroRuns[name]) < MacroCooldown {
+		return nil
+	}
+
+	for i, mr := range macro.Requests {
+		req, err := h.macroRequest(mr)
+		if err != nil {
+			return fmt.Errorf("request %d: %v", i+1, err)
+		}
+
+		resp, err := h.Client.Do(req)
+		if err != nil {
+			return fmt.Errorf("request %d: %v", i+1, err)
+		}
+		if _, err := httpbytes.DecodeResponse(resp); err != nil {
+			log.Printf("Failed to decode response body: %v", err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("request %d: failed to read response body: %v", i+1, err)
+		}
+		resp.Request = req
+
+		h.Update(resp, body)
+		h.extract(macro.Extract, resp.Header, body)
+	}
+
+	h.macroRuns[name] = time.Now()
+	log.Printf("Ran session macro %s", name)
+	return nil
+}
+
+// macroRequest builds a request of a macro with the current tokens and the
+// cookies of the jar
+func (h *Handler) macroRequest(mr MacroRequest) (*http.Request, error) {
+	tokens := h.Tokens()
+
+	rawURL, ok := expand(mr.URL, tokens)
+	if !ok {
+		return nil, fmt.Errorf("unknown token in URL %s", mr.URL)
+	}
+	body, ok := expand(mr.Body, tokens)
+	if !ok {
+		return nil, fmt.Errorf("unknown token in body")
+	}
+
+	method := mr.Method
+	if method == "" {
+		method = http.MethodGet
+	}
+
+	req, err := http.NewRequest(strings.ToUpper(method), rawURL, strings.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	for name, template := range mr.Headers {
+		value, ok := expand(template, tokens)
+		if !ok {
+			return nil, fmt.Errorf("unknown token in header %s", name)
+		}
+		req.Header.Set(name, value)
+	}
+	if host := req.Header.Get("Host"); host != "" {
+		req.Host = host
+	}
+	setCookies(req, h.Jar.Cookies(req.URL))
+
+	return req, nil
+}
+
+// resend sends a request again with the current session state
+func (h *Handler) resend(original *http.Request) (*http.Response, error) {
+	req := httpbytes.CloneRequest(original)
+	body, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	h.Apply(req)
+	req.URL = requestURL(req)
+	req.RequestURI = ""
+	req.Body = io.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := httpbytes.DecodeResponse(resp); err != nil {
+		log.Printf("Failed to decode response body: %v", err)
+	}
+	respBody, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	req.Body = httpbytes.NewBodyWrapper(body)
+	resp.Body = httpbytes.NewBodyWrapper(respBody)
+	resp.Request = req
+	h.Update(resp, respBody)
+
+	return resp, nil
+}
+
+// setCookies replaces the cookies of the request with the same names and
+// adds the rest
+func setCookies(req *http.Request, cookies []*http.Cookie) {
+	if len(cookies) == 0 {
+		return
+	}
+
+	values := map[string]string{}
+	for _, c := range cookies {
+		values[c.Name] = c.Value
+	}
+
+	pairs := []string{}
+	for _, c := range req.Cookies() {
+		if value, ok := values[c.Name]; ok {
+			c.Value = value
+			delete(values, c.Name)
+		}
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	for _, c := range cookies {
+		if _, ok := values[c.Name]; ok {
+			pairs = append(pairs, c.Name+"="+c.Value)
+			delete(values, c.Name)
+		}
+	}
+
+	req.Header.Set("Cookie", strings.Join(pairs, "; "))
+}
+
+// requestURL returns the absolute URL of a request. Requests read from
+// CONNECT tunnels have no scheme nor host in their URL.
+func requestURL(req *http.Request) *url.URL {
+	u := *req.URL
+	if u.Scheme == "" {
+		u.Scheme = "https"
+	}
+	if u.Host == "" {
+		u.Host = req.Host
+	}
+	return &u
+}
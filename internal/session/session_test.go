@@ -0,0 +1,216 @@
+package session
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// newApp returns a server whose /api endpoint requires the cookie and token
+// given by the last login
+func newApp(logins *atomic.Int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := logins.Load()
+		switch r.URL.Path {
+		case "/login":
+			if r.FormValue("user") != "alice" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			n = logins.Add(1)
+			http.SetCookie(w, &http.Cookie{Name: "sid", Value: fmt.Sprint(n), Path: "/"})
+			fmt.Fprintf(w, `{"access_token":"tok%d"}`, n)
+
+		case "/api":
+			c, err := r.Cookie("sid")
+			if err != nil || c.Value != fmt.Sprint(n) || r.Header.Get("Authorization") != fmt.Sprintf("Bearer tok%d", n) {
+				w.WriteHeader(http.StatusUnauthorized)
+				fmt.Fprint(w, `{"error":"token expired"}`)
+				return
+			}
+			fmt.Fprintf(w, "hello alice, session %d", n)
+		}
+	}))
+}
+
+func newConfig(t *testing.T, appURL string) *Config {
+	config := &Config{
+		Rules: []Rule{{
+			Name:    "api",
+			URL:     "/api",
+			Cookies: true,
+			Headers: map[string]string{"Authorization": "Bearer {{access_token}}"},
+			Expired: &Condition{Status: []int{401}, Body: "expired"},
+			Macro:   "login",
+		}},
+		Macros: []Macro{{
+			Name: "login",
+			Requests: []MacroRequest{{
+				Method:  "POST",
+				URL:     appURL + "/login",
+				Headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded"},
+				Body:    "user={{user}}",
+			}},
+			Extract: []Extractor{{Token: "access_token", Regex: `"access_token":"([^"]+)"`}},
+		}},
+		Tokens: map[string]string{"user": "alice", "access_token": "stale"},
+	}
+	if err := config.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	return config
+}
+
+// proxy sends a request through the session hooks as the proxy does
+func proxy(t *testing.T, h *Handler, req *http.Request) *http.Response {
+	req, _ = NewRequestHook(h)(req)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to send request: %v", err)
+	}
+	resp.Request = req
+
+	resp, err = NewResponseHook(h)(resp)
+	if err != nil {
+		t.Fatalf("response hook error = %v", err)
+	}
+	return resp
+}
+
+func TestExpiredSessionRunsMacro(t *testing.T) {
+	logins := &atomic.Int32{}
+	app := newApp(logins)
+	defer app.Close()
+
+	h := NewHandler(newConfig(t, app.URL))
+
+	req, _ := http.NewRequest("GET", app.URL+"/api", nil)
+	req.Header.Set("Cookie", "sid=old; theme=dark")
+	resp := proxy(t, h, req)
+
+	body, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(body) != "hello alice, session 1" {
+		t.Fatalf("response = %d %s, want the response after logging in", resp.StatusCode, body)
+	}
+	if c := resp.Request.Header.Get("Cookie"); c != "sid=1; theme=dark" {
+		t.Errorf("Cookie of the request sent again = %s", c)
+	}
+	if token, _ := h.Token("access_token"); token != "tok1" {
+		t.Errorf("access_token = %s, want tok1", token)
+	}
+
+	// the next requests use the new session without logging in again
+	req, _ = http.NewRequest("GET", app.URL+"/api", nil)
+	resp = proxy(t, h, req)
+	if resp.StatusCode != http.StatusOK || logins.Load() != 1 {
+		t.Errorf("status = %d with %d logins, want 200 with 1 login", resp.StatusCode, logins.Load())
+	}
+}
+
+func TestRunMacroCooldown(t *testing.T) {
+	logins := &atomic.Int32{}
+	app := newApp(logins)
+	defer app.Close()
+
+	h := NewHandler(newConfig(t, app.URL))
+	for i := 0; i < 3; i++ {
+		if err := h.RunMacro("login"); err != nil {
+			t.Fatalf("RunMacro() error = %v", err)
+		}
+	}
+	if logins.Load() != 1 {
+		t.Errorf("macro ran %d times, want 1", logins.Load())
+	}
+
+	if err := h.RunMacro("missing"); err == nil {
+		t.Errorf("RunMacro() of unknown macro succeeded")
+	}
+}
+
+func TestApply(t *testing.T) {
+	config := &Config{
+		Rules: []Rule{
+			{Host: `^api\.test\.com$`, Headers: map[string]string{"X-Csrf": "{{csrf}}", "X-Api-Key": "key-{{key}}"}},
+			{Host: `^other\.com$`, Headers: map[string]string{"X-Other": "1"}},
+		},
+		Tokens: map[string]string{"key": "123"},
+	}
+	if err := config.compile(); err != nil {
+		t.Fatalf("compile() error = %v", err)
+	}
+	h := NewHandler(config)
+
+	req := httptest.NewRequest("GET", "https://api.test.com/x", nil)
+	h.Apply(req)
+	if req.Header.Get("X-Api-Key") != "key-123" || req.Header.Get("X-Csrf") != "" || req.Header.Get("X-Other") != "" {
+		t.Errorf("headers = %v", req.Header)
+	}
+
+	// tokens are extracted from the responses to matching requests
+	config.Rules[0].Extract = []Extractor{{Token: "csrf", Header: "Set-Cookie", Regex: `csrf=(\w+)`}}
+	config.compile()
+	resp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Set-Cookie": {"csrf=abc; Path=/"}},
+		Body:       io.NopCloser(strings.NewReader("")),
+		Request:    req,
+	}
+	if _, err := NewResponseHook(h)(resp); err != nil {
+		t.Fatalf("response hook error = %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "https://api.test.com/y", nil)
+	h.Apply(req)
+	if req.Header.Get("X-Csrf") != "abc" {
+		t.Errorf("X-Csrf = %s, want abc", req.Header.Get("X-Csrf"))
+	}
+
+	// cookies of the jar are only sent by rules with cookies enabled
+	if c := req.Header.Get("Cookie"); c != "" {
+		t.Errorf("Cookie = %s, want none", c)
+	}
+	if cookies := h.Jar.Cookies(req.URL); len(cookies) != 1 || cookies[0].Value != "abc" {
+		t.Errorf("jar cookies = %v", cookies)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+
+	macro := `"macros": [{"name": "login", "requests": [{"method": "POST", "url": "https://x.com/login"}]}]`
+	tests := []struct {
+		name    string
+		content string
+		wantErr string
+	}{
+		{"valid", `{"rules": [{"host": "x\\.com", "cookies": true, "expired": {"status": [401]}, "macro": "login"}], ` + macro + `}`, ""},
+		{"unknown macro", `{"rules": [{"expired": {"status": [401]}, "macro": "logout"}], ` + macro + `}`, "unknown macro"},
+		{"macro without condition", `{"rules": [{"macro": "login"}], ` + macro + `}`, "must be set together"},
+		{"empty condition", `{"rules": [{"expired": {}, "macro": "login"}], ` + macro + `}`, "no criteria"},
+		{"invalid regex", `{"rules": [{"host": "("}]}`, "invalid host regex"},
+		{"extractor without token", `{"rules": [{"extract": [{"regex": "x"}]}]}`, "no token"},
+		{"macro without requests", `{"macros": [{"name": "login"}]}`, "no requests"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(dir, strings.ReplaceAll(tt.name, " ", "-")+".json")
+			os.WriteFile(file, []byte(tt.content), 0644)
+
+			_, err := LoadConfig(file)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("LoadConfig() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("LoadConfig() error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
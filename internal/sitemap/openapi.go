@@ -0,0 +1,126 @@
+package sitemap
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// OpenAPI returns an OpenAPI 3.0 skeleton of the endpoints of a host, with
+// the paths, methods, parameter names and status codes seen. Parameter
+// types and descriptions are not inferred.
+func (sm *SiteMap) OpenAPI(host string) (map[string]any, error) {
+	root, ok := sm.Hosts[host]
+	if !ok {
+		return nil, fmt.Errorf("host %s not found in the site map", host)
+	}
+
+	servers := []any{}
+	schemes := root.Schemes
+	if len(schemes) == 0 {
+		schemes = []string{"https"}
+	}
+	for _, scheme := range schemes {
+		servers = append(servers, map[string]any{"url": scheme + "://" + host})
+	}
+
+	paths := map[string]any{}
+	root.Walk(func(n *Node, _ int) {
+		if len(n.Methods) == 0 {
+			return
+		}
+
+		path, pathParams := openAPIPath(n.Path)
+		item := map[string]any{}
+		for _, e := range n.SortedMethods() {
+			item[strings.ToLower(e.Method)] = openAPIOperation(e, pathParams)
+		}
+		paths[path] = item
+	})
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   host,
+			"version": "1.0.0",
+		},
+		"servers": servers,
+		"paths":   paths,
+	}, nil
+}
+
+// openAPIPath replaces the {id} segments of a path with numbered parameters
+// and returns their names
+func openAPIPath(path string) (string, []string) {
+	if path == "" {
+		return "/", nil
+	}
+
+	params := []string{}
+	segments := strings.Split(path, "/")
+	for i, s := range segments {
+		if s != IDSegment {
+			continue
+		}
+		name := "id"
+		if len(params) > 0 {
+			name += strconv.Itoa(len(params) + 1)
+		}
+		params = append(params, name)
+		segments[i] = "{" + name + "}"
+	}
+
+	return strings.Join(segments, "/"), params
+}
+
+func openAPIOperation(e *Endpoint, pathParams []string) map[string]any {
+	stringSchema := map[string]any{"type": "string"}
+
+	parameters := []any{}
+	for _, p := range pathParams {
+		parameters = append(parameters, map[string]any{"name": p, "in": "path", "required": true, "schema": stringSchema})
+	}
+	for _, p := range e.QueryParams {
+		parameters = append(parameters, map[string]any{"name": p, "in": "query", "schema": stringSchema})
+	}
+
+	responses := map[string]any{}
+	for code := range e.StatusCodes {
+		description := http.StatusText(code)
+		if description == "" {
+			description = "Status " + strconv.Itoa(code)
+		}
+		responses[strconv.Itoa(code)] = map[string]any{"description": description}
+	}
+	if len(responses) == 0 {
+		responses["default"] = map[string]any{"description": "No response recorded"}
+	}
+
+	op := map[string]any{"responses": responses}
+	if len(parameters) > 0 {
+		op["parameters"] = parameters
+	}
+
+	if len(e.ContentTypes) > 0 {
+		properties := map[string]any{}
+		for _, p := range e.BodyParams {
+			// nested fields are described by their top level property
+			name, _, _ := strings.Cut(p, ".")
+			name = strings.TrimSuffix(name, "[]")
+			properties[name] = map[string]any{}
+		}
+
+		content := map[string]any{}
+		for _, ct := range e.ContentTypes {
+			schema := map[string]any{"type": "object"}
+			if len(properties) > 0 {
+				schema["properties"] = properties
+			}
+			content[ct] = map[string]any{"schema": schema}
+		}
+		op["requestBody"] = map[string]any{"content": content}
+	}
+
+	return op
+}
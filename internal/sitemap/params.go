@@ -0,0 +1,106 @@
+package sitemap
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// QueryParams returns the sorted names of the parameters of a query string
+func QueryParams(rawQuery string) []string {
+	if rawQuery == "" {
+		return nil
+	}
+
+	values, _ := url.ParseQuery(rawQuery)
+	return sortedKeys(values)
+}
+
+// BodyParams returns the sorted names of the parameters of a form, JSON or
+// multipart body. Nested JSON fields are named with dots, e.g. "user.name",
+// and array elements with [], e.g. "items[].id".
+func BodyParams(contentType string, body []byte) []string {
+	mt, params, _ := mime.ParseMediaType(contentType)
+
+	switch {
+	case mt == "application/x-www-form-urlencoded":
+		values, err := url.ParseQuery(string(body))
+		if err != nil {
+			return nil
+		}
+		return sortedKeys(values)
+
+	case mt == "multipart/form-data":
+		return multipartParams(body, params["boundary"])
+
+	case mt == "application/json" || strings.HasSuffix(mt, "+json") || mt == "" && json.Valid(body):
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return nil
+		}
+		names := []string{}
+		jsonParams(v, "", &names)
+		return addAll(nil, names)
+	}
+
+	return nil
+}
+
+func jsonParams(v any, prefix string, names *[]string) {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			name := k
+			if prefix != "" {
+				name = prefix + "." + k
+			}
+			*names = append(*names, name)
+			jsonParams(child, name, names)
+		}
+	case []any:
+		for _, child := range v {
+			jsonParams(child, prefix+"[]", names)
+		}
+	}
+}
+
+func multipartParams(body []byte, boundary string) []string {
+	if boundary == "" {
+		return nil
+	}
+
+	names := []string{}
+	reader := multipart.NewReader(bytes.NewReader(body), boundary)
+	for {
+		part, err := reader.NextPart()
+		if err != nil {
+			break
+		}
+		if name := part.FormName(); name != "" {
+			names = append(names, name)
+		}
+	}
+
+	return addAll(nil, names)
+}
+
+func sortedKeys(values url.Values) []string {
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func mediaType(contentType string) string {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return ""
+	}
+	return mt
+}
@@ -0,0 +1,220 @@
+package sitemap
+
+import (
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+)
+
+// IDSegment replaces the path segments that look like identifiers, so that
+// e.g. /users/1 and /users/2 are the same node
+const IDSegment = "{id}"
+
+// Node is a host or a path segment of a site map
+type Node struct {
+	Name string `json:"name"`
+
+	// Path is the path of the node from its host, empty for hosts
+	Path string `json:"path"`
+
+	// Schemes are the schemes used to reach a host
+	Schemes []string `json:"schemes,omitempty"`
+
+	Methods  map[string]*Endpoint `json:"methods,omitempty"`
+	Children map[string]*Node     `json:"children,omitempty"`
+}
+
+// Endpoint aggregates the requests sent with a method to a path
+type Endpoint struct {
+	Method string `json:"method"`
+	Count  int    `json:"count"`
+
+	// StatusCodes counts the responses by status code. Requests without a
+	// response are not counted.
+	StatusCodes map[int]int `json:"status_codes,omitempty"`
+
+	QueryParams  []string `json:"query_params,omitempty"`
+	BodyParams   []string `json:"body_params,omitempty"`
+	ContentTypes []string `json:"content_types,omitempty"`
+
+	// FlowIDs are the IDs of the first and last flows sent to the endpoint
+	FirstFlowID string `json:"first_flow_id,omitempty"`
+	LastFlowID  string `json:"last_flow_id,omitempty"`
+}
+
+// SiteMap is a tree of the hosts, path segments and methods seen in traffic
+type SiteMap struct {
+	Hosts map[string]*Node `json:"hosts"`
+}
+
+// New returns an empty site map
+func New() *SiteMap {
+	return &SiteMap{Hosts: map[string]*Node{}}
+}
+
+// Build returns the site map of the flows
+func Build(flows []*flow.Flow) *SiteMap {
+	sm := New()
+	for _, f := range flows {
+		sm.Add(f)
+	}
+	return sm
+}
+
+// Add adds a flow to the site map
+func (sm *SiteMap) Add(f *flow.Flow) {
+	req := f.Request
+	if req == nil {
+		return
+	}
+
+	host := req.URL.Host
+	if host == "" {
+		host = req.Host
+	}
+
+	node, ok := sm.Hosts[host]
+	if !ok {
+		node = &Node{Name: host}
+		sm.Hosts[host] = node
+	}
+	if scheme := req.URL.Scheme; scheme != "" && !slices.Contains(node.Schemes, scheme) {
+		node.Schemes = append(node.Schemes, scheme)
+		slices.Sort(node.Schemes)
+	}
+
+	for _, segment := range strings.Split(req.URL.Path, "/") {
+		if segment == "" {
+			continue
+		}
+		segment = normalizeSegment(segment)
+
+		if node.Children == nil {
+			node.Children = map[string]*Node{}
+		}
+		child, ok := node.Children[segment]
+		if !ok {
+			child = &Node{Name: segment, Path: node.Path + "/" + segment}
+			node.Children[segment] = child
+		}
+		node = child
+	}
+
+	if node.Methods == nil {
+		node.Methods = map[string]*Endpoint{}
+	}
+	e, ok := node.Methods[req.Method]
+	if !ok {
+		e = &Endpoint{Method: req.Method, FirstFlowID: f.ID}
+		node.Methods[req.Method] = e
+	}
+	e.Count++
+	e.LastFlowID = f.ID
+
+	if f.Response != nil {
+		if e.StatusCodes == nil {
+			e.StatusCodes = map[int]int{}
+		}
+		e.StatusCodes[f.Response.StatusCode]++
+	}
+
+	e.QueryParams = addAll(e.QueryParams, QueryParams(req.URL.RawQuery))
+
+	contentType := req.Header.Get("Content-Type")
+	body, _ := httpbytes.ReadAndRestore(&req.Body)
+	if len(body) > 0 {
+		e.BodyParams = addAll(e.BodyParams, BodyParams(contentType, body))
+		if mt := mediaType(contentType); mt != "" {
+			e.ContentTypes = addAll(e.ContentTypes, []string{mt})
+		}
+	}
+}
+
+var (
+	uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	hexRe  = regexp.MustCompile(`^[0-9a-fA-F]{16,}$`)
+	numRe  = regexp.MustCompile(`^\d+$`)
+)
+
+func normalizeSegment(segment string) string {
+	if numRe.MatchString(segment) || uuidRe.MatchString(segment) || hexRe.MatchString(segment) {
+		return IDSegment
+	}
+	return segment
+}
+
+// Find returns the node of a host and path, or nil if it is not in the site
+// map. Identifier segments of path are matched by the {id} node.
+func (sm *SiteMap) Find(host, path string) *Node {
+	node, ok := sm.Hosts[host]
+	if !ok {
+		return nil
+	}
+
+	for _, segment := range strings.Split(path, "/") {
+		if segment == "" {
+			continue
+		}
+		child, ok := node.Children[segment]
+		if !ok {
+			child, ok = node.Children[normalizeSegment(segment)]
+		}
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+
+	return node
+}
+
+// SortedChildren returns the children of the node sorted by name
+func (n *Node) SortedChildren() []*Node {
+	children := make([]*Node, 0, len(n.Children))
+	for _, c := range n.Children {
+		children = append(children, c)
+	}
+	slices.SortFunc(children, func(a, b *Node) int { return strings.Compare(a.Name, b.Name) })
+	return children
+}
+
+// SortedMethods returns the endpoints of the node sorted by method
+func (n *Node) SortedMethods() []*Endpoint {
+	endpoints := make([]*Endpoint, 0, len(n.Methods))
+	for _, e := range n.Methods {
+		endpoints = append(endpoints, e)
+	}
+	slices.SortFunc(endpoints, func(a, b *Endpoint) int { return strings.Compare(a.Method, b.Method) })
+	return endpoints
+}
+
+// SortedHosts returns the host nodes sorted by name
+func (sm *SiteMap) SortedHosts() []*Node {
+	return (&Node{Children: sm.Hosts}).SortedChildren()
+}
+
+// Walk calls fn with each node of the tree rooted at n, in depth-first order
+// with the children sorted by name
+func (n *Node) Walk(fn func(*Node, int)) {
+	n.walk(fn, 0)
+}
+
+func (n *Node) walk(fn func(*Node, int), depth int) {
+	fn(n, depth)
+	for _, c := range n.SortedChildren() {
+		c.walk(fn, depth+1)
+	}
+}
+
+// addAll adds the values missing in a sorted set
+func addAll(set []string, values []string) []string {
+	for _, v := range values {
+		if i, found := slices.BinarySearch(set, v); !found {
+			set = slices.Insert(set, i, v)
+		}
+	}
+	return set
+}
@@ -0,0 +1,125 @@
+package sitemap
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+)
+
+func newTestFlow(id, method, url, contentType, body string, status int) *flow.Flow {
+	req := httptest.NewRequest(method, url, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	f := &flow.Flow{ID: id, Request: req}
+	if status != 0 {
+		f.Response = &http.Response{StatusCode: status, Request: req}
+	}
+	return f
+}
+
+func TestBuild(t *testing.T) {
+	sm := Build([]*flow.Flow{
+		newTestFlow("1", "GET", "https://test.host.com/api/users/1?fields=name", "", "", 200),
+		newTestFlow("2", "GET", "https://test.host.com/api/users/2?page=2", "", "", 404),
+		newTestFlow("3", "POST", "https://test.host.com/api/users", "application/json", `{"name":"a","address":{"city":"b"},"tags":[{"id":1}]}`, 201),
+		newTestFlow("4", "POST", "http://other.host.com/login", "application/x-www-form-urlencoded", "user=a&pass=b", 0),
+		newTestFlow("5", "GET", "https://test.host.com/", "", "", 200),
+	})
+
+	if len(sm.Hosts) != 2 {
+		t.Fatalf("got %d hosts, want 2", len(sm.Hosts))
+	}
+
+	user := sm.Find("test.host.com", "/api/users/99")
+	if user == nil || user.Path != "/api/users/{id}" {
+		t.Fatalf("Find() = %+v", user)
+	}
+	get := user.Methods["GET"]
+	if get.Count != 2 || get.StatusCodes[200] != 1 || get.StatusCodes[404] != 1 {
+		t.Errorf("GET endpoint = %+v", get)
+	}
+	if !reflect.DeepEqual(get.QueryParams, []string{"fields", "page"}) {
+		t.Errorf("query params = %v", get.QueryParams)
+	}
+	if get.FirstFlowID != "1" || get.LastFlowID != "2" {
+		t.Errorf("flow ids = %s, %s", get.FirstFlowID, get.LastFlowID)
+	}
+
+	post := sm.Find("test.host.com", "/api/users").Methods["POST"]
+	want := []string{"address", "address.city", "name", "tags", "tags[].id"}
+	if !reflect.DeepEqual(post.BodyParams, want) {
+		t.Errorf("JSON body params = %v, want %v", post.BodyParams, want)
+	}
+	if !reflect.DeepEqual(post.ContentTypes, []string{"application/json"}) {
+		t.Errorf("content types = %v", post.ContentTypes)
+	}
+
+	login := sm.Find("other.host.com", "/login").Methods["POST"]
+	if !reflect.DeepEqual(login.BodyParams, []string{"pass", "user"}) || len(login.StatusCodes) != 0 {
+		t.Errorf("form endpoint = %+v", login)
+	}
+	if !reflect.DeepEqual(sm.Hosts["other.host.com"].Schemes, []string{"http"}) {
+		t.Errorf("schemes = %v", sm.Hosts["other.host.com"].Schemes)
+	}
+
+	if root := sm.Find("test.host.com", "/"); root.Methods["GET"] == nil {
+		t.Errorf("root endpoint not found")
+	}
+}
+
+func TestMultipartParams(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("title", "x")
+	fw, _ := w.CreateFormFile("file", "a.txt")
+	fw.Write([]byte("data"))
+	w.Close()
+
+	got := BodyParams(w.FormDataContentType(), body.Bytes())
+	if !reflect.DeepEqual(got, []string{"file", "title"}) {
+		t.Errorf("BodyParams() = %v", got)
+	}
+}
+
+func TestOpenAPI(t *testing.T) {
+	sm := Build([]*flow.Flow{
+		newTestFlow("1", "GET", "https://test.host.com/users/1/posts/2?sort=asc", "", "", 200),
+		newTestFlow("2", "PUT", "https://test.host.com/users/1", "application/json", `{"name":"a"}`, 204),
+	})
+
+	doc, err := sm.OpenAPI("test.host.com")
+	if err != nil {
+		t.Fatalf("OpenAPI() error = %v", err)
+	}
+
+	paths := doc["paths"].(map[string]any)
+	get, ok := paths["/users/{id}/posts/{id2}"].(map[string]any)["get"].(map[string]any)
+	if !ok {
+		t.Fatalf("paths = %v", paths)
+	}
+	if params := get["parameters"].([]any); len(params) != 3 {
+		t.Errorf("parameters = %v", params)
+	}
+	if _, ok := get["responses"].(map[string]any)["200"]; !ok {
+		t.Errorf("responses = %v", get["responses"])
+	}
+
+	put := paths["/users/{id}"].(map[string]any)["put"].(map[string]any)
+	content := put["requestBody"].(map[string]any)["content"].(map[string]any)
+	schema := content["application/json"].(map[string]any)["schema"].(map[string]any)
+	if _, ok := schema["properties"].(map[string]any)["name"]; !ok {
+		t.Errorf("request body schema = %v", schema)
+	}
+
+	if _, err := sm.OpenAPI("missing.host.com"); err == nil {
+		t.Errorf("OpenAPI() of missing host error = nil")
+	}
+}
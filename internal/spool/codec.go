@@ -0,0 +1,290 @@
+package spool
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/httpbytes"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+// request is the record of a request. It keeps the values of its context:
+// the ID, the wire details, the flow metadata and the annotations, which for
+// the request of a response are the ones of the response.
+type request struct {
+	ID            string
+	Method        string
+	URL           string
+	Proto         string
+	ProtoMajor    int
+	ProtoMinor    int
+	Host          string
+	RemoteAddr    string
+	Header        http.Header
+	ContentLength int64
+	Body          []byte
+
+	Wire         *httpbytes.Wire `json:",omitempty"`
+	ResponseWire *httpbytes.Wire `json:",omitempty"`
+	Meta         *flowmeta.Meta  `json:",omitempty"`
+
+	Annotations *annotations.Annotations `json:",omitempty"`
+}
+
+type response struct {
+	Status        string
+	StatusCode    int
+	Proto         string
+	ProtoMajor    int
+	ProtoMinor    int
+	Header        http.Header
+	ContentLength int64
+	Body          []byte
+
+	Request *request `json:",omitempty"`
+}
+
+type flowRecord struct {
+	ID        string
+	Timestamp time.Time
+	Error     string `json:",omitempty"`
+
+	Request          *request  `json:",omitempty"`
+	Response         *response `json:",omitempty"`
+	OriginalRequest  *request  `json:",omitempty"`
+	OriginalResponse *response `json:",omitempty"`
+}
+
+// EncodeRequest encodes a request as a record
+func EncodeRequest(req *http.Request) ([]byte, error) {
+	r, err := toRequest(req)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(r)
+}
+
+// DecodeRequest decodes a request encoded with EncodeRequest
+func DecodeRequest(record []byte) (*http.Request, error) {
+	r := &request{}
+	if err := json.Unmarshal(record, r); err != nil {
+		return nil, fmt.Errorf("invalid request record: %v", err)
+	}
+	return fromRequest(r)
+}
+
+// EncodeResponse encodes a response and its request as a record
+func EncodeResponse(resp *http.Response) ([]byte, error) {
+	r, err := toResponse(resp)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(r)
+}
+
+// DecodeResponse decodes a response encoded with EncodeResponse
+func DecodeResponse(record []byte) (*http.Response, error) {
+	r := &response{}
+	if err := json.Unmarshal(record, r); err != nil {
+		return nil, fmt.Errorf("invalid response record: %v", err)
+	}
+	return fromResponse(r)
+}
+
+// EncodeFlow encodes a flow as a record
+func EncodeFlow(f *flow.Flow) ([]byte, error) {
+	r := &flowRecord{ID: f.ID, Timestamp: f.Timestamp}
+	if f.Error != nil {
+		r.Error = f.Error.Error()
+	}
+
+	var err error
+	if r.Request, err = toRequest(f.Request); err != nil {
+		return nil, err
+	}
+	if r.Response, err = toResponse(f.Response); err != nil {
+		return nil, err
+	}
+	if r.OriginalRequest, err = toRequest(f.OriginalRequest); err != nil {
+		return nil, err
+	}
+	if r.OriginalResponse, err = toResponse(f.OriginalResponse); err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(r)
+}
+
+// DecodeFlow decodes a flow encoded with EncodeFlow
+func DecodeFlow(record []byte) (*flow.Flow, error) {
+	r := &flowRecord{}
+	if err := json.Unmarshal(record, r); err != nil {
+		return nil, fmt.Errorf("invalid flow record: %v", err)
+	}
+
+	f := &flow.Flow{ID: r.ID, Timestamp: r.Timestamp}
+	if r.Error != "" {
+		f.Error = errors.New(r.Error)
+	}
+
+	var err error
+	if f.Request, err = fromRequest(r.Request); err != nil {
+		return nil, err
+	}
+	if f.Response, err = fromResponse(r.Response); err != nil {
+		return nil, err
+	}
+	if f.OriginalRequest, err = fromRequest(r.OriginalRequest); err != nil {
+		return nil, err
+	}
+	if f.OriginalResponse, err = fromResponse(r.OriginalResponse); err != nil {
+		return nil, err
+	}
+
+	return f, nil
+}
+
+func toRequest(req *http.Request) (*request, error) {
+	if req == nil {
+		return nil, nil
+	}
+
+	body, err := httpbytes.ReadAndRestore(&req.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &request{
+		ID:            ids.GetRequestID(req),
+		Method:        req.Method,
+		Proto:         req.Proto,
+		ProtoMajor:    req.ProtoMajor,
+		ProtoMinor:    req.ProtoMinor,
+		Host:          req.Host,
+		RemoteAddr:    req.RemoteAddr,
+		Header:        req.Header,
+		ContentLength: req.ContentLength,
+		Body:          body,
+		Wire:          httpbytes.RequestWire(req),
+		Meta:          flowmeta.Get(req),
+	}
+	if bag := annotations.Get(req); bag != nil {
+		a := bag.Get()
+		r.Annotations = &a
+	}
+	if req.URL != nil {
+		r.URL = req.URL.String()
+	}
+
+	return r, nil
+}
+
+func fromRequest(r *request) (*http.Request, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid request URL %q: %v", r.URL, err)
+	}
+
+	req := (&http.Request{
+		Method:        r.Method,
+		URL:           u,
+		Proto:         r.Proto,
+		ProtoMajor:    r.ProtoMajor,
+		ProtoMinor:    r.ProtoMinor,
+		Host:          r.Host,
+		RemoteAddr:    r.RemoteAddr,
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+		Body:          httpbytes.NewBodyWrapper(r.Body),
+	}).WithContext(context.Background())
+	if req.Header == nil {
+		req.Header = http.Header{}
+	}
+
+	if r.ID != "" {
+		req = ids.SetRequestID(req, r.ID)
+	}
+	if r.Wire != nil {
+		req = httpbytes.SetRequestWire(req, r.Wire)
+	}
+	if r.Meta != nil {
+		req = flowmeta.Set(req, r.Meta)
+	}
+	if r.Annotations != nil {
+		req = annotations.Set(req, annotations.NewBag(*r.Annotations))
+	}
+	return req, nil
+}
+
+func toResponse(resp *http.Response) (*response, error) {
+	if resp == nil {
+		return nil, nil
+	}
+
+	body, err := httpbytes.ReadAndRestore(&resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := toRequest(resp.Request)
+	if err != nil {
+		return nil, err
+	}
+	if req != nil {
+		req.ResponseWire = httpbytes.ResponseWire(resp)
+	}
+
+	return &response{
+		Status:        resp.Status,
+		StatusCode:    resp.StatusCode,
+		Proto:         resp.Proto,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
+		Header:        resp.Header,
+		ContentLength: resp.ContentLength,
+		Body:          body,
+		Request:       req,
+	}, nil
+}
+
+func fromResponse(r *response) (*http.Response, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	req, err := fromRequest(r.Request)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &http.Response{
+		Status:        r.Status,
+		StatusCode:    r.StatusCode,
+		Proto:         r.Proto,
+		ProtoMajor:    r.ProtoMajor,
+		ProtoMinor:    r.ProtoMinor,
+		Header:        r.Header,
+		ContentLength: r.ContentLength,
+		Body:          httpbytes.NewBodyWrapper(r.Body),
+		Request:       req,
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	if r.Request != nil && r.Request.ResponseWire != nil {
+		httpbytes.SetResponseWire(resp, r.Request.ResponseWire)
+	}
+	return resp, nil
+}
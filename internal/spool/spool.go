@@ -0,0 +1,216 @@
+package spool
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	dataFile   = "queue.dat"
+	offsetFile = "offset"
+)
+
+// Queue is a FIFO queue of records kept in a directory, for the items that
+// do not fit in memory. The records survive restarts: the offset of the next
+// record is saved with the data, and a record is only removed once Commit
+// is called after reading it with Peek.
+type Queue struct {
+	mutex sync.Mutex
+
+	dir    string
+	file   *os.File
+	offset int64
+	size   int64
+	count  int
+
+	// peeked is the size of the record returned by Peek, including its
+	// length prefix
+	peeked int64
+}
+
+// Open opens the queue of a directory, creating it if needed
+func Open(dir string) (*Queue, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("could not create spool directory %s: %v", dir, err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("could not open spool file: %v", err)
+	}
+
+	q := &Queue{dir: dir, file: file}
+	if err := q.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return q, nil
+}
+
+// load reads the offset and counts the pending records. A record cut short,
+// as when the proxy stops while writing it, is discarded.
+func (q *Queue) load() error {
+	info, err := q.file.Stat()
+	if err != nil {
+		return fmt.Errorf("could not read spool file: %v", err)
+	}
+	q.size = info.Size()
+
+	data, err := os.ReadFile(filepath.Join(q.dir, offsetFile))
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not read spool offset: %v", err)
+	}
+	if len(data) > 0 {
+		q.offset, err = strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+		if err != nil || q.offset < 0 {
+			return fmt.Errorf("invalid spool offset %q", data)
+		}
+	}
+	// the file is emptied before the offset is reset once all the records
+	// were read, so an offset past the end means there are none left
+	if q.offset > q.size {
+		q.offset = 0
+	}
+
+	end := q.offset
+	for end < q.size {
+		n, err := q.recordSize(end)
+		if err != nil || end+n > q.size {
+			break
+		}
+		end += n
+		q.count++
+	}
+	if end < q.size {
+		if err := q.file.Truncate(end); err != nil {
+			return fmt.Errorf("could not truncate spool file: %v", err)
+		}
+		q.size = end
+	}
+
+	return nil
+}
+
+// recordSize returns the size of the record at offset, including its length
+// prefix
+func (q *Queue) recordSize(offset int64) (int64, error) {
+	var prefix [4]byte
+	if _, err := q.file.ReadAt(prefix[:], offset); err != nil {
+		return 0, err
+	}
+	return 4 + int64(binary.BigEndian.Uint32(prefix[:])), nil
+}
+
+// Push adds a record at the end of the queue
+func (q *Queue) Push(record []byte) error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	data := make([]byte, 4+len(record))
+	binary.BigEndian.PutUint32(data, uint32(len(record)))
+	copy(data[4:], record)
+
+	if _, err := q.file.WriteAt(data, q.size); err != nil {
+		return fmt.Errorf("could not write to spool: %v", err)
+	}
+	q.size += int64(len(data))
+	q.count++
+	return nil
+}
+
+// Peek returns the first record of the queue without removing it. ok is
+// false if the queue is empty.
+func (q *Queue) Peek() (record []byte, ok bool, err error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.offset >= q.size {
+		return nil, false, nil
+	}
+
+	n, err := q.recordSize(q.offset)
+	if err != nil {
+		return nil, false, fmt.Errorf("could not read from spool: %v", err)
+	}
+	record = make([]byte, n-4)
+	if _, err := q.file.ReadAt(record, q.offset+4); err != nil && err != io.EOF {
+		return nil, false, fmt.Errorf("could not read from spool: %v", err)
+	}
+	q.peeked = n
+	return record, true, nil
+}
+
+// Commit removes the record returned by the last call to Peek. The file is
+// emptied once all its records are removed.
+func (q *Queue) Commit() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.peeked == 0 {
+		return nil
+	}
+	q.offset += q.peeked
+	q.peeked = 0
+	q.count--
+
+	if q.offset >= q.size {
+		if err := q.file.Truncate(0); err != nil {
+			return fmt.Errorf("could not truncate spool file: %v", err)
+		}
+		q.offset, q.size = 0, 0
+	}
+
+	return q.saveOffset()
+}
+
+// saveOffset replaces the offset file with the current offset. It is written
+// to a temporary file that is renamed over the previous one, so that a crash
+// leaves either the old or the new offset.
+func (q *Queue) saveOffset() error {
+	tmp, err := os.CreateTemp(q.dir, offsetFile+".tmp-")
+	if err != nil {
+		return fmt.Errorf("could not save spool offset: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.WriteString(strconv.FormatInt(q.offset, 10))
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(q.dir, offsetFile))
+	}
+	if err != nil {
+		return fmt.Errorf("could not save spool offset: %v", err)
+	}
+
+	// the rename is durable once the directory is synced
+	if dir, err := os.Open(q.dir); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Len returns the number of records in the queue
+func (q *Queue) Len() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.count
+}
+
+// Close closes the file of the queue. The pending records are kept.
+func (q *Queue) Close() error {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return q.file.Close()
+}
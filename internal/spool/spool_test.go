@@ -0,0 +1,202 @@
+package spool
+
+import (
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/flowmeta"
+	"github.com/artilugio0/efin-proxy/internal/ids"
+)
+
+func TestQueue(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, r := range []string{"one", "two", "three"} {
+		if err := q.Push([]byte(r)); err != nil {
+			t.Fatalf("Push() error = %v", err)
+		}
+	}
+
+	record, ok, err := q.Peek()
+	if err != nil || !ok || string(record) != "one" {
+		t.Fatalf("Peek() = %q, %t, %v, want one", record, ok, err)
+	}
+	// a record is only removed once committed
+	record, _, _ = q.Peek()
+	if string(record) != "one" {
+		t.Fatalf("Peek() without Commit = %q, want one", record)
+	}
+	if err := q.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", q.Len())
+	}
+	q.Close()
+
+	// the pending records survive reopening the queue, and a record cut
+	// short is discarded
+	f, err := os.OpenFile(filepath.Join(dir, dataFile), os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("Failed to open spool file: %v", err)
+	}
+	f.Write([]byte{0, 0, 0, 10, 'x'})
+	f.Close()
+
+	q, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer q.Close()
+
+	if q.Len() != 2 {
+		t.Errorf("Len() after reopening = %d, want 2", q.Len())
+	}
+	got := []string{}
+	for {
+		record, ok, err := q.Peek()
+		if err != nil {
+			t.Fatalf("Peek() error = %v", err)
+		}
+		if !ok {
+			break
+		}
+		got = append(got, string(record))
+		q.Commit()
+	}
+	if strings.Join(got, ",") != "two,three" {
+		t.Errorf("records = %v, want [two three]", got)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, dataFile))
+	if err != nil || info.Size() != 0 {
+		t.Errorf("spool file not emptied after reading all records")
+	}
+}
+
+func TestCodec(t *testing.T) {
+	req, _ := http.NewRequest("POST", "http://example.com/a?b=c", strings.NewReader("request body"))
+	req.Header.Set("Content-Type", "text/plain")
+	req = ids.SetRequestID(req, "id-1")
+	req = flowmeta.Set(req, &flowmeta.Meta{ClientAddr: "127.0.0.1:1234"})
+
+	record, err := EncodeRequest(req)
+	if err != nil {
+		t.Fatalf("EncodeRequest() error = %v", err)
+	}
+	decoded, err := DecodeRequest(record)
+	if err != nil {
+		t.Fatalf("DecodeRequest() error = %v", err)
+	}
+	body, _ := io.ReadAll(decoded.Body)
+	if decoded.Method != "POST" || decoded.URL.String() != "http://example.com/a?b=c" ||
+		decoded.Header.Get("Content-Type") != "text/plain" || string(body) != "request body" {
+		t.Errorf("decoded request = %s %s %v %q", decoded.Method, decoded.URL, decoded.Header, body)
+	}
+	if ids.GetRequestID(decoded) != "id-1" {
+		t.Errorf("decoded request ID = %q, want id-1", ids.GetRequestID(decoded))
+	}
+	if m := flowmeta.Get(decoded); m == nil || m.ClientAddr != "127.0.0.1:1234" {
+		t.Errorf("decoded request meta = %+v", m)
+	}
+	// encoding does not consume the body of the original
+	if body, _ := io.ReadAll(req.Body); string(body) != "request body" {
+		t.Errorf("original body = %q after encoding", body)
+	}
+
+	resp := &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{"X-A": {"b"}},
+		Body:       io.NopCloser(strings.NewReader("response body")),
+		Request:    req,
+	}
+	f := &flow.Flow{
+		ID:        "id-1",
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Request:   req,
+		Response:  resp,
+	}
+
+	record, err = EncodeFlow(f)
+	if err != nil {
+		t.Fatalf("EncodeFlow() error = %v", err)
+	}
+	decodedFlow, err := DecodeFlow(record)
+	if err != nil {
+		t.Fatalf("DecodeFlow() error = %v", err)
+	}
+	if decodedFlow.ID != "id-1" || !decodedFlow.Timestamp.Equal(f.Timestamp) || decodedFlow.Error != nil {
+		t.Errorf("decoded flow = %+v", decodedFlow)
+	}
+	if decodedFlow.OriginalRequest != nil || decodedFlow.OriginalResponse != nil {
+		t.Errorf("decoded flow has original messages")
+	}
+	body, _ = io.ReadAll(decodedFlow.Response.Body)
+	if decodedFlow.Response.StatusCode != 200 || decodedFlow.Response.Header.Get("X-A") != "b" || string(body) != "response body" {
+		t.Errorf("decoded response = %d %v %q", decodedFlow.Response.StatusCode, decodedFlow.Response.Header, body)
+	}
+	if ids.GetResponseID(decodedFlow.Response) != "id-1" {
+		t.Errorf("decoded response ID = %q, want id-1", ids.GetResponseID(decodedFlow.Response))
+	}
+}
+
+func TestQueueOffset(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := Open(dir)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	q.Push([]byte("one"))
+	q.Push([]byte("two"))
+	q.Peek()
+	if err := q.Commit(); err != nil {
+		t.Fatalf("Commit() error = %v", err)
+	}
+	q.Close()
+
+	// the offset is replaced without leaving temporary files
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir() error = %v", err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	if strings.Join(names, ",") != "offset,queue.dat" {
+		t.Errorf("spool directory files = %v, want [offset queue.dat]", names)
+	}
+
+	// a crash after emptying the file and before resetting the offset
+	// leaves an offset past the end, which means there are no records
+	if err := os.Truncate(filepath.Join(dir, dataFile), 0); err != nil {
+		t.Fatalf("Truncate() error = %v", err)
+	}
+	q, err = Open(dir)
+	if err != nil {
+		t.Fatalf("Open() with a stale offset error = %v", err)
+	}
+	defer q.Close()
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d, want 0", q.Len())
+	}
+	q.Push([]byte("three"))
+	if record, ok, _ := q.Peek(); !ok || string(record) != "three" {
+		t.Errorf("Peek() = %q, %t, want three", record, ok)
+	}
+}
@@ -1,11 +1,14 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
 	"os"
 	"strings"
+	"time"
 
 	efinproxy "github.com/artilugio0/efin-proxy"
+	"github.com/artilugio0/efin-proxy/internal/pipeline"
 	"github.com/spf13/cobra"
 )
 
@@ -14,10 +17,27 @@ const (
 	DefaultCertFile string = ""
 	DefaultDBFile   string = ""
 	DefaultGRPCAddr string = "127.0.0.1:8670"
+	DefaultMetrics  string = ""
+	DefaultJSONL    string = ""
 	DefaultKeyFile  string = ""
 	DefaultPrint    bool   = false
+	DefaultPassive  bool   = false
+	DefaultSecrets  bool   = false
+	DefaultRedact   bool   = false
+	DefaultProject  string = ""
 	DefaultSaveDir  string = ""
 	DefaultScope    string = ".*"
+
+	DefaultSaveLayout       string = ""
+	DefaultSaveBodyFiles    bool   = false
+	DefaultSaveMetadata     bool   = false
+	DefaultSaveMaxSize      int64  = 0
+	DefaultSaveGzipSessions bool   = false
+
+	DefaultRetentionInterval time.Duration = 10 * time.Minute
+
+	DefaultJSONLMaxSize    int64 = 0
+	DefaultJSONLMaxBackups int   = 5
 )
 
 var DefaultExcludeExtensions string = strings.Join(efinproxy.DefaultExcludedExtensions, ",")
@@ -33,13 +53,34 @@ func NewProxyCmd(use string) *cobra.Command {
 	var (
 		proxyAddr          string
 		grpcAddr           string
+		metricsAddr        string
 		certFile           string
 		keyFile            string
+		projectDir         string
 		saveDir            string
 		dbFile             string
 		printLogs          bool
 		domainRe           string
 		excludedExtensions string
+		saveLayout         string
+		saveBodyFiles      bool
+		saveMetadata       bool
+		saveMaxSize        int64
+		saveGzipSessions   bool
+		jsonlFile          string
+		jsonlMaxSize       int64
+		jsonlMaxBackups    int
+		retention          retentionFlags
+		retentionInterval  time.Duration
+		passiveScan        bool
+		detectSecrets      bool
+		secretRulesFile    string
+		redactSecrets      bool
+		authzConfigFile    string
+		sessionRulesFile   string
+		overflow           []string
+		overflowWait       time.Duration
+		spoolDir           string
 	)
 
 	efinProxyCmd := &cobra.Command{
@@ -51,16 +92,46 @@ func NewProxyCmd(use string) *cobra.Command {
 				excludedExtensionsList = strings.Split(excludedExtensions, ",")
 			}
 
+			retentionPolicy, err := retention.policy()
+			if err != nil {
+				panic(err)
+			}
+
+			overflowPolicies, err := parseOverflowFlags(overflow, overflowWait)
+			if err != nil {
+				panic(err)
+			}
+
 			proxy, err := (&efinproxy.ProxyBuilder{
 				Addr:               proxyAddr,
+				Project:            projectDir,
 				GRPCAddr:           grpcAddr,
+				MetricsAddr:        metricsAddr,
 				CertificateFile:    certFile,
 				KeyFile:            keyFile,
 				DBFile:             dbFile,
+				Retention:          retentionPolicy,
+				RetentionInterval:  retentionInterval,
 				PrintLogs:          printLogs,
 				SaveDir:            saveDir,
+				SaveLayout:         saveLayout,
+				SaveBodyFiles:      saveBodyFiles,
+				SaveMetadata:       saveMetadata,
+				SaveMaxSize:        saveMaxSize,
+				SaveGzipSessions:   saveGzipSessions,
+				JSONLFile:          jsonlFile,
+				JSONLMaxSize:       jsonlMaxSize,
+				JSONLMaxBackups:    jsonlMaxBackups,
 				DomainRe:           domainRe,
 				ExcludedExtensions: excludedExtensionsList,
+				PassiveScan:        passiveScan,
+				DetectSecrets:      detectSecrets,
+				SecretRulesFile:    secretRulesFile,
+				RedactSecrets:      redactSecrets,
+				AuthzConfigFile:    authzConfigFile,
+				SessionRulesFile:   sessionRulesFile,
+				Overflow:           overflowPolicies,
+				SpoolDir:           spoolDir,
 			}).GetProxy()
 
 			if err != nil {
@@ -96,6 +167,13 @@ func NewProxyCmd(use string) *cobra.Command {
 		"Start GRPC hooks server on the specified address",
 	)
 
+	efinProxyCmd.Flags().StringVar(
+		&metricsAddr,
+		"metrics-addr",
+		DefaultMetrics,
+		"Serve Prometheus metrics in /metrics on the specified address, disabled if empty",
+	)
+
 	efinProxyCmd.Flags().StringVarP(
 		&excludedExtensions,
 		"exclude-extensions",
@@ -112,6 +190,14 @@ func NewProxyCmd(use string) *cobra.Command {
 		"Enable raw request/response logging to stdout",
 	)
 
+	efinProxyCmd.Flags().StringVarP(
+		&projectDir,
+		"project",
+		"P",
+		DefaultProject,
+		"Project directory with the history database, scope, match and replace rules and CA. It is created if it does not exist",
+	)
+
 	efinProxyCmd.Flags().StringVarP(
 		&dbFile,
 		"db-file",
@@ -120,6 +206,15 @@ func NewProxyCmd(use string) *cobra.Command {
 		"Save requests and responses in the specified Sqlite3 db file",
 	)
 
+	retention.register(efinProxyCmd)
+
+	efinProxyCmd.Flags().DurationVar(
+		&retentionInterval,
+		"retention-interval",
+		DefaultRetentionInterval,
+		"Time between retention policy checks",
+	)
+
 	efinProxyCmd.Flags().StringVarP(
 		&saveDir,
 		"save-directory",
@@ -128,6 +223,126 @@ func NewProxyCmd(use string) *cobra.Command {
 		"Save each request and response to files in the specified directory",
 	)
 
+	efinProxyCmd.Flags().StringVar(
+		&saveLayout,
+		"save-layout",
+		DefaultSaveLayout,
+		"Directory layout for saved files built from {session}, {host}, {date} and {id}, e.g. {session}/{host}/{id}. Empty for a flat directory",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&saveBodyFiles,
+		"save-body-files",
+		DefaultSaveBodyFiles,
+		"Save bodies to separate files with an extension derived from their Content-Type",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&saveMetadata,
+		"save-metadata",
+		DefaultSaveMetadata,
+		"Save a JSON metadata file for each flow",
+	)
+
+	efinProxyCmd.Flags().Int64Var(
+		&saveMaxSize,
+		"save-max-size",
+		DefaultSaveMaxSize,
+		"Delete the oldest sessions when the save directory grows beyond this size in bytes, 0 disables the limit",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&saveGzipSessions,
+		"save-gzip-sessions",
+		DefaultSaveGzipSessions,
+		"Compress the directories of previous sessions on startup",
+	)
+
+	efinProxyCmd.Flags().StringVarP(
+		&jsonlFile,
+		"jsonl",
+		"j",
+		DefaultJSONL,
+		"Write each completed flow as a JSON object per line to the specified file, - for stdout",
+	)
+
+	efinProxyCmd.Flags().Int64Var(
+		&jsonlMaxSize,
+		"jsonl-max-size",
+		DefaultJSONLMaxSize,
+		"Rotate the JSON Lines file when it grows beyond this size in bytes, 0 disables rotation",
+	)
+
+	efinProxyCmd.Flags().IntVar(
+		&jsonlMaxBackups,
+		"jsonl-max-backups",
+		DefaultJSONLMaxBackups,
+		"Number of rotated JSON Lines files to keep",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&passiveScan,
+		"passive-scan",
+		DefaultPassive,
+		"Report security issues found in the in scope responses",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&detectSecrets,
+		"detect-secrets",
+		DefaultSecrets,
+		"Report tokens, API keys and other secrets found in the in scope requests and responses",
+	)
+
+	efinProxyCmd.Flags().StringVar(
+		&secretRulesFile,
+		"secret-rules",
+		"",
+		"JSON file with secret detection rules to use in addition to the default ones",
+	)
+
+	efinProxyCmd.Flags().BoolVar(
+		&redactSecrets,
+		"redact-secrets",
+		DefaultRedact,
+		"Replace secrets with [REDACTED:<rule>] in the flows saved to the database, directory and JSON Lines file",
+	)
+
+	efinProxyCmd.Flags().StringVar(
+		&authzConfigFile,
+		"authz-config",
+		"",
+		"JSON file with alternate sessions used to replay the in scope requests and report the ones whose access control is not enforced",
+	)
+
+	efinProxyCmd.Flags().StringVar(
+		&sessionRulesFile,
+		"session-rules",
+		"",
+		"JSON file with session handling rules: cookie jar, tokens injected in matching requests and login macros run when the session expires",
+	)
+
+	efinProxyCmd.Flags().StringArrayVar(
+		&overflow,
+		"overflow",
+		nil,
+		"What a read-only pipeline does when its queue is full, in the form <pipeline>=<drop|block|spool>, can be repeated. Pipelines: request-in, request-out, response-in, response-out, flow-out and response-log",
+	)
+
+	efinProxyCmd.Flags().DurationVar(
+		&overflowWait,
+		"overflow-wait",
+		pipeline.DefaultBlockWait,
+		"Time the pipelines with the block overflow policy wait for room in their queue",
+	)
+
+	efinProxyCmd.Flags().StringVar(
+		&spoolDir,
+		"spool-dir",
+		"",
+		"Directory of the disk queues of the pipelines and gRPC clients with the spool overflow policy",
+	)
+
 	efinProxyCmd.Flags().StringVarP(
 		&certFile,
 		"cert",
@@ -146,5 +361,37 @@ func NewProxyCmd(use string) *cobra.Command {
 
 	efinProxyCmd.MarkFlagsRequiredTogether("cert", "key")
 
+	efinProxyCmd.AddCommand(
+		newExportCmd(),
+		newImportCmd(),
+		newHistoryCmd(),
+		newRepeatCmd(),
+		newRawCmd(),
+		newIntruderCmd(),
+		newFindingsCmd(),
+		newSiteMapCmd(),
+		newScanCmd(),
+		newDiffCmd(),
+	)
+
 	return efinProxyCmd
 }
+
+// parseOverflowFlags parses the overflow policies given in the form
+// <pipeline>=<policy>
+func parseOverflowFlags(flags []string, wait time.Duration) (map[string]pipeline.OverflowPolicy, error) {
+	policies := map[string]pipeline.OverflowPolicy{}
+	for _, f := range flags {
+		name, policyName, found := strings.Cut(f, "=")
+		if !found {
+			return nil, fmt.Errorf("invalid overflow policy '%s', expected <pipeline>=<policy>", f)
+		}
+
+		overflow, err := pipeline.ParseOverflow(policyName)
+		if err != nil {
+			return nil, err
+		}
+		policies[name] = pipeline.OverflowPolicy{Overflow: overflow, Wait: wait}
+	}
+	return policies, nil
+}
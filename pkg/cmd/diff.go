@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/diff"
+	"github.com/artilugio0/efin-proxy/internal/flow"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+	"github.com/artilugio0/efin-proxy/internal/repeater"
+	"github.com/spf13/cobra"
+)
+
+func newDiffCmd() *cobra.Command {
+	var (
+		dbFile        string
+		replay        bool
+		ignoreHeaders []string
+		format        string
+	)
+
+	diffCmd := &cobra.Command{
+		Use:   "diff <old-id> [<new-id>]",
+		Short: "Compare the status, headers and body of the responses of two flows",
+		Args:  cobra.RangeArgs(1, 2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if replay == (len(args) == 2) {
+				return fmt.Errorf("either two flow ids or one flow id and --replay must be given")
+			}
+			if format != "text" && format != "json" {
+				return fmt.Errorf("invalid format '%s': expected text or json", format)
+			}
+
+			oldFlow, err := hooks.LoadFlow(dbFile, args[0])
+			if err != nil {
+				return err
+			}
+
+			var newFlow *flow.Flow
+			if replay {
+				rep := repeater.New(proxy.NewProxy(nil, nil), dbFile)
+				req, err := rep.Load(args[0])
+				if err != nil {
+					return err
+				}
+				newFlow, err = rep.Send(args[0], req, false)
+			} else {
+				newFlow, err = hooks.LoadFlow(dbFile, args[1])
+			}
+			if err != nil {
+				return err
+			}
+
+			result, err := diff.Compare(oldFlow, newFlow, diff.Options{IgnoreHeaders: ignoreHeaders})
+			if err != nil {
+				return err
+			}
+
+			if format == "json" {
+				return writeJSON(os.Stdout, result)
+			}
+			printDiff(os.Stdout, result)
+			return nil
+		},
+	}
+
+	diffCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the flows")
+	diffCmd.Flags().BoolVarP(&replay, "replay", "r", false, "Send the request of the flow again and compare its response with the stored one")
+	diffCmd.Flags().StringArrayVarP(&ignoreHeaders, "ignore-header", "i", nil, "Do not compare this header, can be repeated")
+	diffCmd.Flags().StringVarP(&format, "format", "f", "text", "Output format: text or json")
+	diffCmd.MarkFlagRequired("db-file")
+
+	return diffCmd
+}
+
+func printDiff(w io.Writer, result *diff.Result) {
+	fmt.Fprintf(w, "--- flow %s\n+++ flow %s\n", result.OldID, result.NewID)
+	if result.Equal() {
+		fmt.Fprintln(w, "responses are equal")
+		return
+	}
+
+	if result.OldStatus != result.NewStatus {
+		fmt.Fprintf(w, "status: %d -> %d\n", result.OldStatus, result.NewStatus)
+	}
+
+	for _, h := range result.Headers {
+		switch h.Op {
+		case diff.OpAdded:
+			fmt.Fprintf(w, "+ %s: %s\n", h.Name, strings.Join(h.New, ", "))
+		case diff.OpRemoved:
+			fmt.Fprintf(w, "- %s: %s\n", h.Name, strings.Join(h.Old, ", "))
+		default:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", h.Name, strings.Join(h.Old, ", "), strings.Join(h.New, ", "))
+		}
+	}
+
+	body := result.Body
+	if !body.Changed {
+		return
+	}
+	fmt.Fprintf(w, "body (%s, %d -> %d bytes):\n", body.Kind, body.OldSize, body.NewSize)
+
+	for _, c := range body.JSON {
+		old, _ := json.Marshal(c.Old)
+		new, _ := json.Marshal(c.New)
+		switch c.Op {
+		case diff.OpAdded:
+			fmt.Fprintf(w, "+ %s: %s\n", c.Path, new)
+		case diff.OpRemoved:
+			fmt.Fprintf(w, "- %s: %s\n", c.Path, old)
+		default:
+			fmt.Fprintf(w, "~ %s: %s -> %s\n", c.Path, old, new)
+		}
+	}
+
+	for _, c := range body.Lines {
+		if c.Op == diff.OpAdded {
+			fmt.Fprintf(w, "+%d: %s\n", c.NewLine, c.Text)
+		} else {
+			fmt.Fprintf(w, "-%d: %s\n", c.OldLine, c.Text)
+		}
+	}
+}
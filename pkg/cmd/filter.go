@@ -0,0 +1,115 @@
+package cmd
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+// flowFilterFlags holds the command line flags used to select flows from the
+// database
+type flowFilterFlags struct {
+	fromID     uint64
+	toID       uint64
+	method     string
+	statusCode int
+	hostRe     string
+	urlRe      string
+	since      string
+	until      string
+	tags       []string
+	color      string
+	comment    string
+	values     []string
+	limit      int
+}
+
+func (ff *flowFilterFlags) register(cmd *cobra.Command) {
+	cmd.Flags().Uint64Var(&ff.fromID, "from-id", 0, "Only include flows with ID greater or equal than this value")
+	cmd.Flags().Uint64Var(&ff.toID, "to-id", 0, "Only include flows with ID lower or equal than this value")
+	cmd.Flags().StringVar(&ff.method, "method", "", "Only include requests with this method")
+	cmd.Flags().IntVar(&ff.statusCode, "status", 0, "Only include responses with this status code")
+	cmd.Flags().StringVar(&ff.hostRe, "host", "", "Only include requests whose host matches this regex")
+	cmd.Flags().StringVar(&ff.urlRe, "url", "", "Only include requests whose URL matches this regex")
+	cmd.Flags().StringVar(&ff.since, "since", "", "Only include flows recorded after this time (RFC3339)")
+	cmd.Flags().StringVar(&ff.until, "until", "", "Only include flows recorded before this time (RFC3339)")
+	cmd.Flags().StringArrayVar(&ff.tags, "tag", nil, "Only include flows with this tag, can be repeated")
+	cmd.Flags().StringVar(&ff.color, "color", "", "Only include flows highlighted with this color")
+	cmd.Flags().StringVar(&ff.comment, "comment", "", "Only include flows whose comment contains this text")
+	cmd.Flags().StringArrayVar(&ff.values, "value", nil, "Only include flows with this custom value, in the form <key>=<value>, can be repeated")
+	cmd.Flags().IntVar(&ff.limit, "limit", 0, "Maximum number of flows to include")
+}
+
+func (ff *flowFilterFlags) filter() (hooks.FlowFilter, error) {
+	filter := hooks.FlowFilter{
+		FromID:     ff.fromID,
+		ToID:       ff.toID,
+		Method:     ff.method,
+		StatusCode: ff.statusCode,
+		Tags:       ff.tags,
+		Color:      ff.color,
+		Comment:    ff.comment,
+		Limit:      ff.limit,
+	}
+
+	values, err := parseKeyValues(ff.values)
+	if err != nil {
+		return filter, err
+	}
+	filter.Values = values
+
+	if ff.hostRe != "" {
+		re, err := regexp.Compile(ff.hostRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid host regex: %v", err)
+		}
+		filter.HostRe = re
+	}
+
+	if ff.urlRe != "" {
+		re, err := regexp.Compile(ff.urlRe)
+		if err != nil {
+			return filter, fmt.Errorf("invalid url regex: %v", err)
+		}
+		filter.URLRe = re
+	}
+
+	if ff.since != "" {
+		t, err := time.Parse(time.RFC3339, ff.since)
+		if err != nil {
+			return filter, fmt.Errorf("invalid since time: %v", err)
+		}
+		filter.Since = t
+	}
+
+	if ff.until != "" {
+		t, err := time.Parse(time.RFC3339, ff.until)
+		if err != nil {
+			return filter, fmt.Errorf("invalid until time: %v", err)
+		}
+		filter.Until = t
+	}
+
+	return filter, nil
+}
+
+// parseKeyValues parses values given in the form <key>=<value>
+func parseKeyValues(flags []string) (map[string]string, error) {
+	if len(flags) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]string{}
+	for _, f := range flags {
+		key, value, found := strings.Cut(f, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid value '%s', expected <key>=<value>", f)
+		}
+		values[key] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+func newFindingsCmd() *cobra.Command {
+	var (
+		dbFile      string
+		minSeverity string
+		filter      hooks.FindingFilter
+		verbose     bool
+	)
+
+	findingsCmd := &cobra.Command{
+		Use:   "findings",
+		Short: "List the findings stored in the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			filter.MinSeverity = findings.Severity(minSeverity)
+			if minSeverity != "" && filter.MinSeverity.Rank() == 0 {
+				return fmt.Errorf("invalid severity '%s': expected info, low, medium or high", minSeverity)
+			}
+
+			result, err := hooks.LoadFindings(dbFile, filter)
+			if err != nil {
+				return err
+			}
+
+			for _, f := range result {
+				printFinding(f, verbose)
+			}
+			return nil
+		},
+	}
+
+	findingsCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the findings")
+	findingsCmd.Flags().StringVar(&minSeverity, "severity", "", "Only show findings of at least this severity: info, low, medium or high")
+	findingsCmd.Flags().StringVar(&filter.Source, "source", "", "Only show findings reported by this source, e.g. passive")
+	findingsCmd.Flags().StringVar(&filter.Type, "type", "", "Only show findings of this type")
+	findingsCmd.Flags().StringVar(&filter.Host, "host", "", "Only show findings of this host")
+	findingsCmd.Flags().StringVar(&filter.FlowID, "flow", "", "Only show findings of this flow")
+	findingsCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the details of each finding")
+	findingsCmd.MarkFlagRequired("db-file")
+
+	return findingsCmd
+}
+
+func printFinding(f findings.Finding, verbose bool) {
+	path := f.Path
+	if path == "" {
+		path = "(host)"
+	}
+	fmt.Printf("%s\t%s\t%s\t%s\t%s %s\tflow: %s\t%s\n",
+		f.ID, f.Timestamp.Format(time.RFC3339), f.Severity, f.Type, f.Host, path, f.FlowID, f.Title)
+	if verbose && f.Detail != "" {
+		fmt.Printf("\t%s\n", f.Detail)
+	}
+}
@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+
+	"github.com/artilugio0/efin-proxy/internal/har"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+func newExportCmd() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export flows from the database",
+	}
+
+	exportCmd.AddCommand(newExportHARCmd())
+
+	return exportCmd
+}
+
+func newExportHARCmd() *cobra.Command {
+	var (
+		dbFile     string
+		outputFile string
+		filter     flowFilterFlags
+	)
+
+	exportHARCmd := &cobra.Command{
+		Use:   "har",
+		Short: "Export flows from the database as a HAR 1.2 file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := filter.filter()
+			if err != nil {
+				return err
+			}
+
+			flows, err := hooks.LoadFlows(dbFile, f)
+			if err != nil {
+				return fmt.Errorf("failed to load flows: %v", err)
+			}
+
+			h, err := har.FromFlows(flows)
+			if err != nil {
+				return err
+			}
+
+			var out io.Writer = os.Stdout
+			if outputFile != "" && outputFile != "-" {
+				file, err := os.Create(outputFile)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+
+			if err := har.Encode(out, h); err != nil {
+				return err
+			}
+
+			log.Printf("Exported %d flows", len(flows))
+			return nil
+		},
+	}
+
+	exportHARCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to export flows from")
+	exportHARCmd.Flags().StringVarP(&outputFile, "output", "o", "-", "Output file, - for stdout")
+	exportHARCmd.MarkFlagRequired("db-file")
+	filter.register(exportHARCmd)
+
+	return exportHARCmd
+}
+
+func newImportCmd() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:   "import",
+		Short: "Import flows into the database",
+	}
+
+	importCmd.AddCommand(newImportHARCmd())
+
+	return importCmd
+}
+
+func newImportHARCmd() *cobra.Command {
+	var dbFile string
+
+	importHARCmd := &cobra.Command{
+		Use:   "har <file.har>...",
+		Short: "Import the entries of HAR files into the database",
+		Args:  cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, file := range args {
+				n, err := importHARFile(dbFile, file)
+				if err != nil {
+					return fmt.Errorf("failed to import %s: %v", file, err)
+				}
+				log.Printf("Imported %d flows from %s", n, file)
+			}
+			return nil
+		},
+	}
+
+	importHARCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to import flows into")
+	importHARCmd.MarkFlagRequired("db-file")
+
+	return importHARCmd
+}
+
+func importHARFile(dbFile string, file string) (int, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	h, err := har.Decode(f)
+	if err != nil {
+		return 0, err
+	}
+
+	flows, err := h.Flows()
+	if err != nil {
+		return 0, err
+	}
+
+	for i, fl := range flows {
+		if _, err := hooks.SaveFlow(dbFile, fl); err != nil {
+			return i, err
+		}
+	}
+
+	return len(flows), nil
+}
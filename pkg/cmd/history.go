@@ -0,0 +1,245 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/annotations"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/spf13/cobra"
+)
+
+// retentionFlags holds the command line flags that define a retention policy
+type retentionFlags struct {
+	maxAge    time.Duration
+	maxRows   int
+	maxSize   int64
+	hostRules []string
+}
+
+func (rf *retentionFlags) register(cmd *cobra.Command) {
+	cmd.Flags().DurationVar(&rf.maxAge, "retention-max-age", 0, "Delete flows older than this duration, e.g. 72h")
+	cmd.Flags().IntVar(&rf.maxRows, "retention-max-rows", 0, "Keep only this number of most recent flows")
+	cmd.Flags().Int64Var(&rf.maxSize, "retention-max-size", 0, "Delete the oldest flows when the data in the database grows beyond this size in bytes")
+	cmd.Flags().StringArrayVar(&rf.hostRules, "retention-host", nil, "Per host max age in the form <host regex>=<duration>, can be repeated")
+}
+
+func (rf *retentionFlags) policy() (hooks.RetentionPolicy, error) {
+	policy := hooks.RetentionPolicy{
+		MaxAge:  rf.maxAge,
+		MaxRows: rf.maxRows,
+		MaxSize: rf.maxSize,
+	}
+
+	for _, r := range rf.hostRules {
+		rule, err := hooks.ParseHostRetentionRule(r)
+		if err != nil {
+			return policy, err
+		}
+		policy.HostRules = append(policy.HostRules, rule)
+	}
+
+	return policy, nil
+}
+
+func newHistoryCmd() *cobra.Command {
+	historyCmd := &cobra.Command{
+		Use:   "history",
+		Short: "Manage the flows stored in the database",
+	}
+
+	historyCmd.AddCommand(
+		newHistoryPruneCmd(),
+		newHistoryVacuumCmd(),
+		newHistoryListCmd(),
+		newHistoryAnnotateCmd(),
+	)
+
+	return historyCmd
+}
+
+func newHistoryPruneCmd() *cobra.Command {
+	var (
+		dbFile    string
+		vacuum    bool
+		retention retentionFlags
+	)
+
+	pruneCmd := &cobra.Command{
+		Use:   "prune",
+		Short: "Delete the flows that are not allowed by the retention policy",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			policy, err := retention.policy()
+			if err != nil {
+				return err
+			}
+			if policy.IsZero() {
+				return fmt.Errorf("no retention limit specified")
+			}
+
+			result, err := hooks.PruneHistory(dbFile, policy)
+			if err != nil {
+				return err
+			}
+			log.Printf("Deleted %d flows", result.DeletedFlows)
+
+			if vacuum {
+				if err := hooks.VacuumHistory(dbFile); err != nil {
+					return err
+				}
+				log.Printf("Vacuumed database %s", dbFile)
+			}
+
+			return nil
+		},
+	}
+
+	pruneCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to prune")
+	pruneCmd.Flags().BoolVar(&vacuum, "vacuum", false, "Vacuum the database after pruning")
+	pruneCmd.MarkFlagRequired("db-file")
+	retention.register(pruneCmd)
+
+	return pruneCmd
+}
+
+func newHistoryVacuumCmd() *cobra.Command {
+	var dbFile string
+
+	vacuumCmd := &cobra.Command{
+		Use:   "vacuum",
+		Short: "Release the space of deleted flows in the database file",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if err := hooks.VacuumHistory(dbFile); err != nil {
+				return err
+			}
+			log.Printf("Vacuumed database %s", dbFile)
+			return nil
+		},
+	}
+
+	vacuumCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to vacuum")
+	vacuumCmd.MarkFlagRequired("db-file")
+
+	return vacuumCmd
+}
+
+func newHistoryListCmd() *cobra.Command {
+	var (
+		dbFile string
+		filter flowFilterFlags
+	)
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the flows stored in the database with their annotations",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := filter.filter()
+			if err != nil {
+				return err
+			}
+
+			flows, err := hooks.LoadFlows(dbFile, f)
+			if err != nil {
+				return err
+			}
+
+			for _, fl := range flows {
+				status := "-"
+				if fl.Response != nil {
+					status = strconv.Itoa(fl.Response.StatusCode)
+				}
+				fmt.Printf("%s\t%s\t%s %s\t%s%s\n",
+					fl.ID, fl.Timestamp.Format(time.RFC3339), fl.Request.Method, fl.Request.URL, status,
+					formatAnnotations(annotations.Get(fl.Request).Get()))
+			}
+			return nil
+		},
+	}
+
+	listCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to list flows from")
+	listCmd.MarkFlagRequired("db-file")
+	filter.register(listCmd)
+
+	return listCmd
+}
+
+func newHistoryAnnotateCmd() *cobra.Command {
+	var (
+		dbFile       string
+		addTags      []string
+		removeTags   []string
+		color        string
+		comment      string
+		setValues    []string
+		deleteValues []string
+	)
+
+	annotateCmd := &cobra.Command{
+		Use:   "annotate <id>",
+		Short: "Edit the tags, color, comment and custom values of a stored flow",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			values, err := parseKeyValues(setValues)
+			if err != nil {
+				return err
+			}
+
+			edit := annotations.Edit{
+				AddTags:      addTags,
+				RemoveTags:   removeTags,
+				SetValues:    values,
+				DeleteValues: deleteValues,
+			}
+			if cmd.Flags().Changed("color") {
+				edit.Color = &color
+			}
+			if cmd.Flags().Changed("comment") {
+				edit.Comment = &comment
+			}
+
+			a, err := hooks.EditAnnotations(dbFile, args[0], edit)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s%s\n", args[0], formatAnnotations(a))
+			return nil
+		},
+	}
+
+	annotateCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the flow")
+	annotateCmd.Flags().StringArrayVar(&addTags, "tag", nil, "Add a tag, can be repeated")
+	annotateCmd.Flags().StringArrayVar(&removeTags, "untag", nil, "Remove a tag, can be repeated")
+	annotateCmd.Flags().StringVar(&color, "color", "", "Highlight the flow with a color: "+strings.Join(annotations.Colors, ", ")+". Empty removes it")
+	annotateCmd.Flags().StringVar(&comment, "comment", "", "Set the comment of the flow. Empty removes it")
+	annotateCmd.Flags().StringArrayVar(&setValues, "set", nil, "Set a custom value in the form <key>=<value>, can be repeated")
+	annotateCmd.Flags().StringArrayVar(&deleteValues, "unset", nil, "Remove a custom value, can be repeated")
+	annotateCmd.MarkFlagRequired("db-file")
+
+	return annotateCmd
+}
+
+// formatAnnotations formats the annotations of a flow as tab separated
+// fields, each preceded by a tab
+func formatAnnotations(a annotations.Annotations) string {
+	s := ""
+	if len(a.Tags) > 0 {
+		s += "\ttags: " + strings.Join(a.Tags, ",")
+	}
+	if a.Color != "" {
+		s += "\tcolor: " + a.Color
+	}
+	if a.Comment != "" {
+		s += "\tcomment: " + strconv.Quote(a.Comment)
+	}
+
+	keys := slices.Sorted(maps.Keys(a.Values))
+	for _, k := range keys {
+		s += "\t" + k + "=" + strconv.Quote(a.Values[k])
+	}
+	return s
+}
@@ -0,0 +1,288 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/intruder"
+	"github.com/artilugio0/efin-proxy/internal/rawhttp"
+	"github.com/spf13/cobra"
+)
+
+func newIntruderCmd() *cobra.Command {
+	intruderCmd := &cobra.Command{
+		Use:   "intruder",
+		Short: "Send requests with payloads placed in marked positions",
+	}
+
+	intruderCmd.AddCommand(
+		newIntruderAttackCmd(),
+		newIntruderListCmd(),
+		newIntruderResultsCmd(),
+	)
+
+	return intruderCmd
+}
+
+func newIntruderAttackCmd() *cobra.Command {
+	var (
+		dbFile       string
+		templateFile string
+		marks        []string
+		edit         bool
+		mode         string
+		payloadSpecs []string
+		target       string
+		useTLS       bool
+		serverName   string
+		concurrency  int
+		rateLimit    float64
+		timeout      time.Duration
+	)
+
+	attackCmd := &cobra.Command{
+		Use:   "attack [<id>]",
+		Short: "Run an attack based on a request from the database or a template file",
+		Long: `Run an attack based on a request from the database or a template file.
+
+Payload positions are delimited with pairs of ` + intruder.Marker + ` characters enclosing the
+original value, e.g. "GET /?user=` + intruder.Marker + `admin` + intruder.Marker + ` HTTP/1.1". They can be marked in the
+template file, with --mark or in $EDITOR with --edit.
+
+Payload sets have one of the following forms, optionally followed by
+encoders (` + strings.Join(encoderNames(), ", ") + `) separated by |:
+
+  wordlist:<file>
+  list:<a>,<b>,...
+  range:<from>-<to>[:<step>[:<fmt>]]
+  chars:<charset>:<min>-<max>`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			baseID := ""
+			if len(args) > 0 {
+				baseID = args[0]
+			}
+			if (baseID == "") == (templateFile == "") {
+				return fmt.Errorf("either a request id or --file must be given")
+			}
+
+			raw, opts, err := loadAttackBase(dbFile, baseID, templateFile)
+			if err != nil {
+				return err
+			}
+
+			for _, m := range marks {
+				re, err := regexp.Compile(m)
+				if err != nil {
+					return fmt.Errorf("invalid mark regex '%s': %v", m, err)
+				}
+				raw = intruder.MarkPositions(raw, re)
+			}
+			if edit {
+				raw, err = editBytes(raw)
+				if err != nil {
+					return err
+				}
+			}
+
+			template, err := intruder.ParseTemplate(raw)
+			if err != nil {
+				return err
+			}
+
+			payloadSets := [][]string{}
+			for _, spec := range payloadSpecs {
+				payloads, err := intruder.ParsePayloadSet(spec)
+				if err != nil {
+					return err
+				}
+				payloadSets = append(payloadSets, payloads)
+			}
+
+			if target != "" {
+				opts.Addr = target
+				opts.TLS = useTLS
+			}
+			if opts.Addr == "" {
+				return fmt.Errorf("--target is required for templates without a Host header")
+			}
+			opts.ServerName = serverName
+			opts.Timeout = timeout
+
+			attack := &intruder.Attack{
+				Template:      template,
+				Mode:          intruder.Mode(mode),
+				PayloadSets:   payloadSets,
+				Target:        opts,
+				Concurrency:   concurrency,
+				RateLimit:     rateLimit,
+				DBFile:        dbFile,
+				BaseRequestID: baseID,
+			}
+			if err := attack.Validate(); err != nil {
+				return err
+			}
+
+			log.Printf("Sending %d requests to %s", attack.Count(), opts.Addr)
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			outputMutex := sync.Mutex{}
+			attackID, err := attack.Run(ctx, func(r hooks.AttackResult) {
+				outputMutex.Lock()
+				defer outputMutex.Unlock()
+				printAttackResult(r)
+			})
+			if attackID != "" {
+				log.Printf("Stored attack %s", attackID)
+			}
+
+			return err
+		},
+	}
+
+	attackCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to load the base request from and store the results in")
+	attackCmd.Flags().StringVarP(&templateFile, "file", "f", "", "Raw request file with marked payload positions")
+	attackCmd.Flags().StringArrayVar(&marks, "mark", nil, "Mark the matches of a regex, or of its first group, as payload positions, can be repeated")
+	attackCmd.Flags().BoolVarP(&edit, "edit", "e", false, "Mark the payload positions in $EDITOR")
+	attackCmd.Flags().StringVarP(&mode, "mode", "m", string(intruder.Sniper), "Attack mode: sniper, battering-ram, pitchfork or cluster-bomb")
+	attackCmd.Flags().StringArrayVarP(&payloadSpecs, "payloads", "p", nil, "Payload set, can be repeated for pitchfork and cluster-bomb attacks")
+	attackCmd.Flags().StringVarP(&target, "target", "t", "", "Address of the target in the form <host>:<port>. Defaults to the host of the stored request, or to port 443 of the Host header of template files")
+	attackCmd.Flags().BoolVar(&useTLS, "tls", false, "Connect to --target with TLS")
+	attackCmd.Flags().StringVar(&serverName, "sni", "", "Server name sent in the TLS handshake, defaults to the target host")
+	attackCmd.Flags().IntVarP(&concurrency, "concurrency", "c", intruder.DefaultConcurrency, "Number of requests sent at the same time")
+	attackCmd.Flags().Float64Var(&rateLimit, "rate", 0, "Maximum number of requests per second, 0 for no limit")
+	attackCmd.Flags().DurationVar(&timeout, "timeout", rawhttp.DefaultTimeout, "Time allowed for each request")
+	attackCmd.MarkFlagRequired("payloads")
+
+	return attackCmd
+}
+
+// loadAttackBase returns the raw base request of an attack and the options
+// to reach its host
+func loadAttackBase(dbFile, baseID, templateFile string) ([]byte, rawhttp.Options, error) {
+	if templateFile != "" {
+		raw, err := os.ReadFile(templateFile)
+		if err != nil {
+			return nil, rawhttp.Options{}, err
+		}
+
+		req, err := rawhttp.ParseRequest(raw, "https", "")
+		if err != nil || req.Host == "" {
+			return raw, rawhttp.Options{}, nil
+		}
+		return raw, rawhttp.OptionsForURL(&url.URL{Scheme: "https", Host: req.Host}), nil
+	}
+
+	if dbFile == "" {
+		return nil, rawhttp.Options{}, fmt.Errorf("--db-file is required to load request %s", baseID)
+	}
+
+	f, err := hooks.LoadFlow(dbFile, baseID)
+	if err != nil {
+		return nil, rawhttp.Options{}, err
+	}
+	opts := rawhttp.OptionsForURL(f.Request.URL)
+
+	raw, _, err := hooks.LoadRawFlow(dbFile, baseID)
+	if err != nil {
+		return nil, rawhttp.Options{}, err
+	}
+	if raw == nil {
+		raw, err = hooks.RawRequestBytes(f.Request)
+		if err != nil {
+			return nil, rawhttp.Options{}, err
+		}
+	}
+
+	return raw, opts, nil
+}
+
+func newIntruderListCmd() *cobra.Command {
+	var dbFile string
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the attacks stored in the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			attacks, err := hooks.LoadAttacks(dbFile)
+			if err != nil {
+				return err
+			}
+
+			for _, a := range attacks {
+				fmt.Printf("%s\t%s\t%s\tbase request: %s\n",
+					a.ID, a.Started.Format(time.RFC3339), a.Mode, a.BaseRequestID)
+			}
+			return nil
+		},
+	}
+
+	listCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the attacks")
+	listCmd.MarkFlagRequired("db-file")
+
+	return listCmd
+}
+
+func newIntruderResultsCmd() *cobra.Command {
+	var (
+		dbFile string
+		filter hooks.AttackResultFilter
+	)
+
+	resultsCmd := &cobra.Command{
+		Use:   "results <attack id>",
+		Short: "Show the results of an attack",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			results, err := hooks.LoadAttackResults(dbFile, args[0], filter)
+			if err != nil {
+				return err
+			}
+
+			for _, r := range results {
+				printAttackResult(r)
+			}
+			return nil
+		},
+	}
+
+	resultsCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the attacks")
+	resultsCmd.Flags().IntVar(&filter.StatusCode, "status", 0, "Only show results with this status code")
+	resultsCmd.Flags().IntVar(&filter.MinLength, "min-length", 0, "Only show results with responses of at least this length")
+	resultsCmd.Flags().IntVar(&filter.MaxLength, "max-length", 0, "Only show results with responses of at most this length")
+	resultsCmd.Flags().StringVar(&filter.OrderBy, "sort", "index", "Sort by index, status, length or duration")
+	resultsCmd.Flags().BoolVar(&filter.Descending, "desc", false, "Sort in descending order")
+	resultsCmd.MarkFlagRequired("db-file")
+
+	return resultsCmd
+}
+
+func printAttackResult(r hooks.AttackResult) {
+	status := fmt.Sprint(r.StatusCode)
+	if r.Error != "" {
+		status = "error: " + r.Error
+	}
+	fmt.Printf("%d\t%s\t%d\t%dms\tflow: %s\t%s\n",
+		r.Index, status, r.Length, r.Duration.Milliseconds(), r.RequestID, strings.Join(r.Payloads, ", "))
+}
+
+func encoderNames() []string {
+	names := []string{}
+	for name := range intruder.Encoders {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
@@ -0,0 +1,86 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/rawhttp"
+	"github.com/spf13/cobra"
+)
+
+func newRawCmd() *cobra.Command {
+	var (
+		dbFile      string
+		requestFile string
+		target      string
+		useTLS      bool
+		serverName  string
+		timeout     time.Duration
+		crlf        bool
+	)
+
+	rawCmd := &cobra.Command{
+		Use:   "raw",
+		Short: "Send the exact bytes of a request to a target and print the bytes received",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var raw []byte
+			var err error
+			if requestFile == "" || requestFile == "-" {
+				raw, err = io.ReadAll(os.Stdin)
+			} else {
+				raw, err = os.ReadFile(requestFile)
+			}
+			if err != nil {
+				return err
+			}
+
+			if crlf {
+				raw = rawhttp.NormalizeLineEndings(raw)
+			}
+
+			opts := rawhttp.Options{
+				Addr:       target,
+				TLS:        useTLS,
+				ServerName: serverName,
+				Timeout:    timeout,
+			}
+
+			rawResponse, err := rawhttp.Send(raw, opts)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(rawResponse)
+
+			if dbFile == "" {
+				return nil
+			}
+
+			f, err := rawhttp.NewFlow(raw, rawResponse, opts)
+			if err != nil {
+				return fmt.Errorf("failed to parse flow, it was not stored: %v", err)
+			}
+			id, err := hooks.SaveRawFlow(dbFile, f, raw, rawResponse)
+			if err != nil {
+				return err
+			}
+			log.Printf("Stored flow %s", id)
+
+			return nil
+		},
+	}
+
+	rawCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to store the flow in")
+	rawCmd.Flags().StringVarP(&requestFile, "file", "f", "-", "File with the raw request, - for stdin")
+	rawCmd.Flags().StringVarP(&target, "target", "t", "", "Address of the target in the form <host>:<port>")
+	rawCmd.Flags().BoolVar(&useTLS, "tls", false, "Connect to the target with TLS")
+	rawCmd.Flags().StringVar(&serverName, "sni", "", "Server name sent in the TLS handshake, defaults to the target host")
+	rawCmd.Flags().DurationVar(&timeout, "timeout", rawhttp.DefaultTimeout, "Time allowed to send the request and read the response")
+	rawCmd.Flags().BoolVar(&crlf, "crlf", false, "Replace the LF line endings of the request line and headers with CRLF")
+	rawCmd.MarkFlagRequired("target")
+
+	return rawCmd
+}
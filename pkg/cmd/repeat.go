@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/proxy"
+	"github.com/artilugio0/efin-proxy/internal/repeater"
+	"github.com/spf13/cobra"
+)
+
+func newRepeatCmd() *cobra.Command {
+	var (
+		dbFile        string
+		requestFile   string
+		scheme        string
+		method        string
+		targetURL     string
+		headers       []string
+		removeHeaders []string
+		body          string
+		bodyFile      string
+		edit          bool
+	)
+
+	repeatCmd := &cobra.Command{
+		Use:   "repeat [<id>]",
+		Short: "Send again a request stored in the database or in a raw request file",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			originalID := ""
+			if len(args) > 0 {
+				originalID = args[0]
+			}
+			if (originalID == "") == (requestFile == "") {
+				return fmt.Errorf("either a request id or --file must be given")
+			}
+
+			rep := repeater.New(proxy.NewProxy(nil, nil), dbFile)
+
+			var req *http.Request
+			var err error
+			if originalID != "" {
+				req, err = rep.Load(originalID)
+			} else {
+				var raw []byte
+				raw, err = os.ReadFile(requestFile)
+				if err == nil {
+					req, err = repeater.ParseRawRequest(raw, scheme)
+				}
+			}
+			if err != nil {
+				return err
+			}
+
+			e := repeater.Edit{
+				Method:        method,
+				URL:           targetURL,
+				SetHeaders:    http.Header{},
+				RemoveHeaders: removeHeaders,
+			}
+			for _, h := range headers {
+				name, value, ok := strings.Cut(h, ":")
+				if !ok {
+					return fmt.Errorf("invalid header '%s': expected <name>: <value>", h)
+				}
+				e.SetHeaders.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+			}
+			if cmd.Flags().Changed("body") {
+				b := []byte(body)
+				e.Body = &b
+			}
+			if bodyFile != "" {
+				b, err := os.ReadFile(bodyFile)
+				if err != nil {
+					return err
+				}
+				e.Body = &b
+			}
+			if err := e.Apply(req); err != nil {
+				return err
+			}
+
+			if edit {
+				req, err = editRequest(req)
+				if err != nil {
+					return err
+				}
+			}
+
+			f, err := rep.Send(originalID, req, false)
+			if err != nil {
+				return err
+			}
+
+			raw, err := hooks.RawResponseBytes(f.Response)
+			if err != nil {
+				return err
+			}
+			os.Stdout.Write(raw)
+
+			if dbFile != "" {
+				log.Printf("Stored flow %s", f.ID)
+			}
+			return nil
+		},
+	}
+
+	repeatCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to load the request from and store the new flow in")
+	repeatCmd.Flags().StringVarP(&requestFile, "file", "f", "", "Raw request file to send, e.g. a request-<id>.txt file of the save directory")
+	repeatCmd.Flags().StringVar(&scheme, "scheme", "https", "Scheme used for requests loaded from raw request files")
+	repeatCmd.Flags().StringVarP(&method, "method", "X", "", "Replace the request method")
+	repeatCmd.Flags().StringVarP(&targetURL, "url", "u", "", "Replace the request URL")
+	repeatCmd.Flags().StringArrayVarP(&headers, "header", "H", nil, "Set a header in the form <name>: <value>, can be repeated")
+	repeatCmd.Flags().StringArrayVar(&removeHeaders, "remove-header", nil, "Remove a header, can be repeated")
+	repeatCmd.Flags().StringVar(&body, "body", "", "Replace the request body")
+	repeatCmd.Flags().StringVar(&bodyFile, "body-file", "", "Replace the request body with the content of a file")
+	repeatCmd.Flags().BoolVarP(&edit, "edit", "e", false, "Edit the raw request with $EDITOR before sending it")
+	repeatCmd.MarkFlagsMutuallyExclusive("body", "body-file")
+
+	return repeatCmd
+}
+
+// editRequest opens the raw request in $EDITOR and parses the result
+func editRequest(req *http.Request) (*http.Request, error) {
+	raw, err := hooks.RawRequestBytes(req)
+	if err != nil {
+		return nil, err
+	}
+
+	edited, err := editBytes(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	return repeater.ParseRawRequest(edited, req.URL.Scheme)
+}
+
+// editBytes opens data in $EDITOR and returns the edited content
+func editBytes(data []byte) ([]byte, error) {
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	tmp, err := os.CreateTemp("", "efin-proxy-request-*.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return nil, err
+	}
+	tmp.Close()
+
+	editCmd := exec.Command("sh", "-c", editor+` "$1"`, "--", tmp.Name())
+	editCmd.Stdin = os.Stdin
+	editCmd.Stdout = os.Stdout
+	editCmd.Stderr = os.Stderr
+	if err := editCmd.Run(); err != nil {
+		return nil, fmt.Errorf("editor failed: %v", err)
+	}
+
+	return os.ReadFile(tmp.Name())
+}
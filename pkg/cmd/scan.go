@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/scanner"
+	"github.com/artilugio0/efin-proxy/internal/scope"
+	"github.com/spf13/cobra"
+)
+
+func newScanCmd() *cobra.Command {
+	var (
+		dbFile             string
+		filter             flowFilterFlags
+		domainRe           string
+		excludedExtensions string
+		checks             string
+		methods            string
+		concurrency        int
+		timeDelay          time.Duration
+		timeout            time.Duration
+		verbose            bool
+	)
+
+	scanCmd := &cobra.Command{
+		Use:   "scan",
+		Short: "Actively scan the in scope flows of the database for injection vulnerabilities",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := filter.filter()
+			if err != nil {
+				return err
+			}
+
+			re, err := regexp.Compile(domainRe)
+			if err != nil {
+				return fmt.Errorf("invalid scope regex: %v", err)
+			}
+			var excludedExtensionsList []string
+			if excludedExtensions != "" {
+				excludedExtensionsList = strings.Split(excludedExtensions, ",")
+			}
+
+			flows, err := hooks.LoadFlows(dbFile, f)
+			if err != nil {
+				return fmt.Errorf("failed to load flows: %v", err)
+			}
+
+			sink := hooks.NewFindingSink(dbFile, nil)
+			mutex := sync.Mutex{}
+			s := scanner.NewActiveScanner(dbFile, func(f findings.Finding) {
+				mutex.Lock()
+				defer mutex.Unlock()
+				sink(f)
+				printFinding(f, verbose)
+			})
+			s.Scope = scope.New(re, excludedExtensionsList)
+			s.Client = scanner.NewActiveClient(timeout)
+			s.Concurrency = concurrency
+			s.TimeDelay = timeDelay
+			if methods != "" {
+				s.Methods = strings.Split(strings.ToUpper(methods), ",")
+			}
+			if checks != "" {
+				s.Checks, err = scanner.SelectActiveChecks(strings.Split(checks, ","))
+				if err != nil {
+					return err
+				}
+			}
+
+			ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+			defer cancel()
+
+			tested, err := s.Scan(ctx, flows)
+			log.Printf("Tested %d insertion points of %d flows", tested, len(flows))
+			return err
+		},
+	}
+
+	scanCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file with the flows to scan. Findings and the requests that prove them are stored in it")
+	filter.register(scanCmd)
+	scanCmd.Flags().StringVarP(&domainRe, "scope", "s", DefaultScope, "Regex of the hosts to scan")
+	scanCmd.Flags().StringVarP(&excludedExtensions, "exclude-extensions", "E", DefaultExcludeExtensions, "Comma separated list of file extensions to exclude")
+	scanCmd.Flags().StringVar(&checks, "checks", "", "Comma separated list of checks to run: "+strings.Join(scanner.ActiveCheckNames(), ", ")+". All by default")
+	scanCmd.Flags().StringVar(&methods, "methods", strings.Join(scanner.DefaultActiveMethods, ","), "Comma separated list of methods of the requests to scan")
+	scanCmd.Flags().IntVarP(&concurrency, "concurrency", "c", scanner.DefaultActiveConcurrency, "Number of flows scanned in parallel")
+	scanCmd.Flags().DurationVar(&timeDelay, "time-delay", scanner.DefaultTimeDelay, "Delay requested by time based payloads")
+	scanCmd.Flags().DurationVar(&timeout, "timeout", scanner.DefaultActiveTimeout, "Timeout of each request")
+	scanCmd.Flags().BoolVarP(&verbose, "verbose", "v", false, "Show the details of each finding")
+	scanCmd.MarkFlagRequired("db-file")
+
+	return scanCmd
+}
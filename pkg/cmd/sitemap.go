@@ -0,0 +1,125 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/sitemap"
+	"github.com/spf13/cobra"
+)
+
+func newSiteMapCmd() *cobra.Command {
+	var (
+		dbFile     string
+		outputFile string
+		format     string
+		filter     flowFilterFlags
+	)
+
+	siteMapCmd := &cobra.Command{
+		Use:   "sitemap",
+		Short: "Show the hosts, paths, methods and parameters of the flows in the database",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, err := filter.filter()
+			if err != nil {
+				return err
+			}
+
+			flows, err := hooks.LoadFlows(dbFile, f)
+			if err != nil {
+				return fmt.Errorf("failed to load flows: %v", err)
+			}
+			sm := sitemap.Build(flows)
+
+			var out io.Writer = os.Stdout
+			if outputFile != "" && outputFile != "-" {
+				file, err := os.Create(outputFile)
+				if err != nil {
+					return err
+				}
+				defer file.Close()
+				out = file
+			}
+
+			switch format {
+			case "tree":
+				printSiteMap(out, sm)
+				return nil
+
+			case "json":
+				return writeJSON(out, sm)
+
+			case "openapi":
+				if len(sm.Hosts) != 1 {
+					hosts := []string{}
+					for _, h := range sm.SortedHosts() {
+						hosts = append(hosts, h.Name)
+					}
+					return fmt.Errorf("OpenAPI export requires flows of exactly one host, use --host to select one of: %s",
+						strings.Join(hosts, ", "))
+				}
+
+				doc, err := sm.OpenAPI(sm.SortedHosts()[0].Name)
+				if err != nil {
+					return err
+				}
+				return writeJSON(out, doc)
+			}
+
+			return fmt.Errorf("invalid format '%s': expected tree, json or openapi", format)
+		},
+	}
+
+	siteMapCmd.Flags().StringVarP(&dbFile, "db-file", "D", DefaultDBFile, "Sqlite3 db file to build the site map from")
+	siteMapCmd.Flags().StringVarP(&outputFile, "output", "o", "-", "Output file, - for stdout")
+	siteMapCmd.Flags().StringVarP(&format, "format", "f", "tree", "Output format: tree, json or openapi")
+	siteMapCmd.MarkFlagRequired("db-file")
+	filter.register(siteMapCmd)
+
+	return siteMapCmd
+}
+
+func printSiteMap(w io.Writer, sm *sitemap.SiteMap) {
+	for _, host := range sm.SortedHosts() {
+		host.Walk(func(n *sitemap.Node, depth int) {
+			indent := strings.Repeat("  ", depth)
+			if depth == 0 {
+				fmt.Fprintf(w, "%s [%s]\n", n.Name, strings.Join(n.Schemes, ", "))
+			} else {
+				fmt.Fprintf(w, "%s/%s\n", indent, n.Name)
+			}
+
+			for _, e := range n.SortedMethods() {
+				fmt.Fprintf(w, "%s  %s %d", indent, e.Method, e.Count)
+
+				codes := []int{}
+				for code := range e.StatusCodes {
+					codes = append(codes, code)
+				}
+				slices.Sort(codes)
+				for _, code := range codes {
+					fmt.Fprintf(w, " %d:%d", code, e.StatusCodes[code])
+				}
+
+				if len(e.QueryParams) > 0 {
+					fmt.Fprintf(w, " query: %s", strings.Join(e.QueryParams, ","))
+				}
+				if len(e.BodyParams) > 0 {
+					fmt.Fprintf(w, " body: %s", strings.Join(e.BodyParams, ","))
+				}
+				fmt.Fprintln(w)
+			}
+		})
+	}
+}
+
+func writeJSON(w io.Writer, v any) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
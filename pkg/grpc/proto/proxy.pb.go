@@ -237,28 +237,2528 @@ func (*ResponseModClientMessage_Register) isResponseModClientMessage_Msg() {}
 
 func (*ResponseModClientMessage_ModifiedResponse) isResponseModClientMessage_Msg() {}
 
+// Register names a client. Hooks run in increasing order of priority;
+// clients with the same priority run after the native hooks, in the order
+// they registered.
+//
+// The proxy waits timeout_ms for each answer of a mod client, 10 seconds if
+// not set, and removes the client if it does not answer in time. When the
+// client fails, the request continues unchanged; clients that set fail_open
+// to false reject it instead. After max_failures consecutive failures, 5 if
+// not set and never if negative, the client is skipped for cooldown_ms, 30
+// seconds if not set.
+//
+// overflow is what the proxy does when the queue of a read-only client is
+// full: "disconnect" (the default) removes the client, "drop" drops the
+// item, "block" waits overflow_wait_ms for room, 5 seconds if not set, and
+// "spool" writes the item to a disk queue that is delivered in order, also
+// after the client reconnects with the same name. spool requires the proxy
+// to have a spool directory.
 type Register struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Name           string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Priority       int32                  `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	TimeoutMs      int64                  `protobuf:"varint,3,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	FailOpen       *bool                  `protobuf:"varint,4,opt,name=fail_open,json=failOpen,proto3,oneof" json:"fail_open,omitempty"`
+	MaxFailures    int32                  `protobuf:"varint,5,opt,name=max_failures,json=maxFailures,proto3" json:"max_failures,omitempty"`
+	CooldownMs     int64                  `protobuf:"varint,6,opt,name=cooldown_ms,json=cooldownMs,proto3" json:"cooldown_ms,omitempty"`
+	Filter         *HookFilter            `protobuf:"bytes,7,opt,name=filter,proto3" json:"filter,omitempty"`
+	Overflow       string                 `protobuf:"bytes,8,opt,name=overflow,proto3" json:"overflow,omitempty"`
+	OverflowWaitMs int64                  `protobuf:"varint,9,opt,name=overflow_wait_ms,json=overflowWaitMs,proto3" json:"overflow_wait_ms,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Register) Reset() {
+	*x = Register{}
+	mi := &file_proxy_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Register) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Register) ProtoMessage() {}
+
+func (x *Register) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Register.ProtoReflect.Descriptor instead.
+func (*Register) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Register) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Register) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *Register) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+func (x *Register) GetFailOpen() bool {
+	if x != nil && x.FailOpen != nil {
+		return *x.FailOpen
+	}
+	return false
+}
+
+func (x *Register) GetMaxFailures() int32 {
+	if x != nil {
+		return x.MaxFailures
+	}
+	return 0
+}
+
+func (x *Register) GetCooldownMs() int64 {
+	if x != nil {
+		return x.CooldownMs
+	}
+	return 0
+}
+
+func (x *Register) GetFilter() *HookFilter {
+	if x != nil {
+		return x.Filter
+	}
+	return nil
+}
+
+func (x *Register) GetOverflow() string {
+	if x != nil {
+		return x.Overflow
+	}
+	return ""
+}
+
+func (x *Register) GetOverflowWaitMs() int64 {
+	if x != nil {
+		return x.OverflowWaitMs
+	}
+	return 0
+}
+
+// HookFilter selects the traffic a client receives. Empty fields match
+// everything. content_types are prefixes of the media type, matched against
+// the response for responses and flows. Items with bodies larger than
+// max_body_size are skipped. With omit_bodies the items are sent without
+// their bodies, and mod clients cannot change them.
+type HookFilter struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	HostRe        string                 `protobuf:"bytes,1,opt,name=host_re,json=hostRe,proto3" json:"host_re,omitempty"`
+	PathRe        string                 `protobuf:"bytes,2,opt,name=path_re,json=pathRe,proto3" json:"path_re,omitempty"`
+	Methods       []string               `protobuf:"bytes,3,rep,name=methods,proto3" json:"methods,omitempty"`
+	ContentTypes  []string               `protobuf:"bytes,4,rep,name=content_types,json=contentTypes,proto3" json:"content_types,omitempty"`
+	MaxBodySize   int64                  `protobuf:"varint,5,opt,name=max_body_size,json=maxBodySize,proto3" json:"max_body_size,omitempty"`
+	OmitBodies    bool                   `protobuf:"varint,6,opt,name=omit_bodies,json=omitBodies,proto3" json:"omit_bodies,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HookFilter) Reset() {
+	*x = HookFilter{}
+	mi := &file_proxy_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HookFilter) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HookFilter) ProtoMessage() {}
+
+func (x *HookFilter) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HookFilter.ProtoReflect.Descriptor instead.
+func (*HookFilter) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *HookFilter) GetHostRe() string {
+	if x != nil {
+		return x.HostRe
+	}
+	return ""
+}
+
+func (x *HookFilter) GetPathRe() string {
+	if x != nil {
+		return x.PathRe
+	}
+	return ""
+}
+
+func (x *HookFilter) GetMethods() []string {
+	if x != nil {
+		return x.Methods
+	}
+	return nil
+}
+
+func (x *HookFilter) GetContentTypes() []string {
+	if x != nil {
+		return x.ContentTypes
+	}
+	return nil
+}
+
+func (x *HookFilter) GetMaxBodySize() int64 {
+	if x != nil {
+		return x.MaxBodySize
+	}
+	return 0
+}
+
+func (x *HookFilter) GetOmitBodies() bool {
+	if x != nil {
+		return x.OmitBodies
+	}
+	return false
+}
+
+// HookInfo is a hook of a chain. Clients are named "grpc:<name>". disabled
+// is set while the hook is skipped after too many consecutive failures.
+// dropped and spooled are the counters of the queue of read-only clients.
+type HookInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Priority      int32                  `protobuf:"varint,2,opt,name=priority,proto3" json:"priority,omitempty"`
+	Disabled      bool                   `protobuf:"varint,3,opt,name=disabled,proto3" json:"disabled,omitempty"`
+	Failures      int32                  `protobuf:"varint,4,opt,name=failures,proto3" json:"failures,omitempty"`
+	Dropped       uint64                 `protobuf:"varint,5,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	Spooled       int64                  `protobuf:"varint,6,opt,name=spooled,proto3" json:"spooled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HookInfo) Reset() {
+	*x = HookInfo{}
+	mi := &file_proxy_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HookInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HookInfo) ProtoMessage() {}
+
+func (x *HookInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HookInfo.ProtoReflect.Descriptor instead.
+func (*HookInfo) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *HookInfo) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *HookInfo) GetPriority() int32 {
+	if x != nil {
+		return x.Priority
+	}
+	return 0
+}
+
+func (x *HookInfo) GetDisabled() bool {
+	if x != nil {
+		return x.Disabled
+	}
+	return false
+}
+
+func (x *HookInfo) GetFailures() int32 {
+	if x != nil {
+		return x.Failures
+	}
+	return 0
+}
+
+func (x *HookInfo) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *HookInfo) GetSpooled() int64 {
+	if x != nil {
+		return x.Spooled
+	}
+	return 0
+}
+
+// PipelineStats are the counters of the queue of a read-only pipeline: the
+// items it dropped and the ones waiting in its spool
+type PipelineStats struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Dropped       uint64                 `protobuf:"varint,2,opt,name=dropped,proto3" json:"dropped,omitempty"`
+	Spooled       int64                  `protobuf:"varint,3,opt,name=spooled,proto3" json:"spooled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PipelineStats) Reset() {
+	*x = PipelineStats{}
+	mi := &file_proxy_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PipelineStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PipelineStats) ProtoMessage() {}
+
+func (x *PipelineStats) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PipelineStats.ProtoReflect.Descriptor instead.
+func (*PipelineStats) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *PipelineStats) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *PipelineStats) GetDropped() uint64 {
+	if x != nil {
+		return x.Dropped
+	}
+	return 0
+}
+
+func (x *PipelineStats) GetSpooled() int64 {
+	if x != nil {
+		return x.Spooled
+	}
+	return 0
+}
+
+// HookChains are the hooks of each pipeline in the order they run
+type HookChains struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	RequestIn     []*HookInfo            `protobuf:"bytes,1,rep,name=request_in,json=requestIn,proto3" json:"request_in,omitempty"`
+	RequestMod    []*HookInfo            `protobuf:"bytes,2,rep,name=request_mod,json=requestMod,proto3" json:"request_mod,omitempty"`
+	RequestOut    []*HookInfo            `protobuf:"bytes,3,rep,name=request_out,json=requestOut,proto3" json:"request_out,omitempty"`
+	ResponseIn    []*HookInfo            `protobuf:"bytes,4,rep,name=response_in,json=responseIn,proto3" json:"response_in,omitempty"`
+	ResponseMod   []*HookInfo            `protobuf:"bytes,5,rep,name=response_mod,json=responseMod,proto3" json:"response_mod,omitempty"`
+	ResponseOut   []*HookInfo            `protobuf:"bytes,6,rep,name=response_out,json=responseOut,proto3" json:"response_out,omitempty"`
+	FlowOut       []*HookInfo            `protobuf:"bytes,7,rep,name=flow_out,json=flowOut,proto3" json:"flow_out,omitempty"`
+	Pipelines     []*PipelineStats       `protobuf:"bytes,8,rep,name=pipelines,proto3" json:"pipelines,omitempty"`
+	ResponseLog   []*HookInfo            `protobuf:"bytes,9,rep,name=response_log,json=responseLog,proto3" json:"response_log,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HookChains) Reset() {
+	*x = HookChains{}
+	mi := &file_proxy_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HookChains) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HookChains) ProtoMessage() {}
+
+func (x *HookChains) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HookChains.ProtoReflect.Descriptor instead.
+func (*HookChains) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *HookChains) GetRequestIn() []*HookInfo {
+	if x != nil {
+		return x.RequestIn
+	}
+	return nil
+}
+
+func (x *HookChains) GetRequestMod() []*HookInfo {
+	if x != nil {
+		return x.RequestMod
+	}
+	return nil
+}
+
+func (x *HookChains) GetRequestOut() []*HookInfo {
+	if x != nil {
+		return x.RequestOut
+	}
+	return nil
+}
+
+func (x *HookChains) GetResponseIn() []*HookInfo {
+	if x != nil {
+		return x.ResponseIn
+	}
+	return nil
+}
+
+func (x *HookChains) GetResponseMod() []*HookInfo {
+	if x != nil {
+		return x.ResponseMod
+	}
+	return nil
+}
+
+func (x *HookChains) GetResponseOut() []*HookInfo {
+	if x != nil {
+		return x.ResponseOut
+	}
+	return nil
+}
+
+func (x *HookChains) GetFlowOut() []*HookInfo {
+	if x != nil {
+		return x.FlowOut
+	}
+	return nil
+}
+
+func (x *HookChains) GetPipelines() []*PipelineStats {
+	if x != nil {
+		return x.Pipelines
+	}
+	return nil
+}
+
+func (x *HookChains) GetResponseLog() []*HookInfo {
+	if x != nil {
+		return x.ResponseLog
+	}
+	return nil
+}
+
+// HttpRequest represents an HTTP request. Headers are in the order and
+// casing they were received with; request_line is the raw request line.
+// The annotations sent back by mod clients replace the ones of the flow,
+// which are left unchanged if they are not set.
+type HttpRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Method        string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
+	Url           string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
+	Headers       []*Header              `protobuf:"bytes,4,rep,name=headers,proto3" json:"headers,omitempty"`
+	Body          []byte                 `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+	Proto         string                 `protobuf:"bytes,6,opt,name=proto,proto3" json:"proto,omitempty"`
+	RequestLine   string                 `protobuf:"bytes,7,opt,name=request_line,json=requestLine,proto3" json:"request_line,omitempty"`
+	Meta          *FlowMeta              `protobuf:"bytes,8,opt,name=meta,proto3" json:"meta,omitempty"`
+	Annotations   *Annotations           `protobuf:"bytes,9,opt,name=annotations,proto3" json:"annotations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HttpRequest) Reset() {
+	*x = HttpRequest{}
+	mi := &file_proxy_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HttpRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HttpRequest) ProtoMessage() {}
+
+func (x *HttpRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HttpRequest.ProtoReflect.Descriptor instead.
+func (*HttpRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *HttpRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *HttpRequest) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *HttpRequest) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *HttpRequest) GetHeaders() []*Header {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *HttpRequest) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *HttpRequest) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *HttpRequest) GetRequestLine() string {
+	if x != nil {
+		return x.RequestLine
+	}
+	return ""
+}
+
+func (x *HttpRequest) GetMeta() *FlowMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+func (x *HttpRequest) GetAnnotations() *Annotations {
+	if x != nil {
+		return x.Annotations
+	}
+	return nil
+}
+
+// HttpResponse represents an HTTP response. Headers are in the order and
+// casing they were received with; status_line is the raw status line.
+type HttpResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,2,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	Headers       []*Header              `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty"`
+	Body          []byte                 `protobuf:"bytes,4,opt,name=body,proto3" json:"body,omitempty"`
+	Proto         string                 `protobuf:"bytes,5,opt,name=proto,proto3" json:"proto,omitempty"`
+	StatusLine    string                 `protobuf:"bytes,6,opt,name=status_line,json=statusLine,proto3" json:"status_line,omitempty"`
+	Meta          *FlowMeta              `protobuf:"bytes,7,opt,name=meta,proto3" json:"meta,omitempty"`
+	Annotations   *Annotations           `protobuf:"bytes,8,opt,name=annotations,proto3" json:"annotations,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HttpResponse) Reset() {
+	*x = HttpResponse{}
+	mi := &file_proxy_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HttpResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HttpResponse) ProtoMessage() {}
+
+func (x *HttpResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HttpResponse.ProtoReflect.Descriptor instead.
+func (*HttpResponse) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *HttpResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *HttpResponse) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *HttpResponse) GetHeaders() []*Header {
+	if x != nil {
+		return x.Headers
+	}
+	return nil
+}
+
+func (x *HttpResponse) GetBody() []byte {
+	if x != nil {
+		return x.Body
+	}
+	return nil
+}
+
+func (x *HttpResponse) GetProto() string {
+	if x != nil {
+		return x.Proto
+	}
+	return ""
+}
+
+func (x *HttpResponse) GetStatusLine() string {
+	if x != nil {
+		return x.StatusLine
+	}
+	return ""
+}
+
+func (x *HttpResponse) GetMeta() *FlowMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+func (x *HttpResponse) GetAnnotations() *Annotations {
+	if x != nil {
+		return x.Annotations
+	}
+	return nil
+}
+
+// FlowMeta holds the timings, in milliseconds, and the connection details
+// of a flow. Requests only have the client address. Connection timings are
+// 0 when the connection to the destination was reused. It is ignored in the
+// messages sent by plugins.
+type FlowMeta struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	ClientAddr     string                 `protobuf:"bytes,1,opt,name=client_addr,json=clientAddr,proto3" json:"client_addr,omitempty"`
+	DnsMs          float64                `protobuf:"fixed64,2,opt,name=dns_ms,json=dnsMs,proto3" json:"dns_ms,omitempty"`
+	ConnectMs      float64                `protobuf:"fixed64,3,opt,name=connect_ms,json=connectMs,proto3" json:"connect_ms,omitempty"`
+	TlsHandshakeMs float64                `protobuf:"fixed64,4,opt,name=tls_handshake_ms,json=tlsHandshakeMs,proto3" json:"tls_handshake_ms,omitempty"`
+	TtfbMs         float64                `protobuf:"fixed64,5,opt,name=ttfb_ms,json=ttfbMs,proto3" json:"ttfb_ms,omitempty"`
+	TotalMs        float64                `protobuf:"fixed64,6,opt,name=total_ms,json=totalMs,proto3" json:"total_ms,omitempty"`
+	UpstreamIp     string                 `protobuf:"bytes,7,opt,name=upstream_ip,json=upstreamIp,proto3" json:"upstream_ip,omitempty"`
+	TlsVersion     string                 `protobuf:"bytes,8,opt,name=tls_version,json=tlsVersion,proto3" json:"tls_version,omitempty"`
+	TlsCipher      string                 `protobuf:"bytes,9,opt,name=tls_cipher,json=tlsCipher,proto3" json:"tls_cipher,omitempty"`
+	Alpn           string                 `protobuf:"bytes,10,opt,name=alpn,proto3" json:"alpn,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *FlowMeta) Reset() {
+	*x = FlowMeta{}
+	mi := &file_proxy_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowMeta) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowMeta) ProtoMessage() {}
+
+func (x *FlowMeta) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowMeta.ProtoReflect.Descriptor instead.
+func (*FlowMeta) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *FlowMeta) GetClientAddr() string {
+	if x != nil {
+		return x.ClientAddr
+	}
+	return ""
+}
+
+func (x *FlowMeta) GetDnsMs() float64 {
+	if x != nil {
+		return x.DnsMs
+	}
+	return 0
+}
+
+func (x *FlowMeta) GetConnectMs() float64 {
+	if x != nil {
+		return x.ConnectMs
+	}
+	return 0
+}
+
+func (x *FlowMeta) GetTlsHandshakeMs() float64 {
+	if x != nil {
+		return x.TlsHandshakeMs
+	}
+	return 0
+}
+
+func (x *FlowMeta) GetTtfbMs() float64 {
+	if x != nil {
+		return x.TtfbMs
+	}
+	return 0
+}
+
+func (x *FlowMeta) GetTotalMs() float64 {
+	if x != nil {
+		return x.TotalMs
+	}
+	return 0
+}
+
+func (x *FlowMeta) GetUpstreamIp() string {
+	if x != nil {
+		return x.UpstreamIp
+	}
+	return ""
+}
+
+func (x *FlowMeta) GetTlsVersion() string {
+	if x != nil {
+		return x.TlsVersion
+	}
+	return ""
+}
+
+func (x *FlowMeta) GetTlsCipher() string {
+	if x != nil {
+		return x.TlsCipher
+	}
+	return ""
+}
+
+func (x *FlowMeta) GetAlpn() string {
+	if x != nil {
+		return x.Alpn
+	}
+	return ""
+}
+
+// Flow is a completed exchange of an in scope request. The original
+// messages are the ones received by the proxy and the others the ones sent
+// after the mod hooks ran. error is set if the exchange failed, in which
+// case the responses may be missing. meta holds the timings of the flow.
+type Flow struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Id               string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	TimestampMs      int64                  `protobuf:"varint,2,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	OriginalRequest  *HttpRequest           `protobuf:"bytes,3,opt,name=original_request,json=originalRequest,proto3" json:"original_request,omitempty"`
+	Request          *HttpRequest           `protobuf:"bytes,4,opt,name=request,proto3" json:"request,omitempty"`
+	OriginalResponse *HttpResponse          `protobuf:"bytes,5,opt,name=original_response,json=originalResponse,proto3" json:"original_response,omitempty"`
+	Response         *HttpResponse          `protobuf:"bytes,6,opt,name=response,proto3" json:"response,omitempty"`
+	Error            string                 `protobuf:"bytes,7,opt,name=error,proto3" json:"error,omitempty"`
+	Meta             *FlowMeta              `protobuf:"bytes,8,opt,name=meta,proto3" json:"meta,omitempty"`
+	Annotations      *Annotations           `protobuf:"bytes,9,opt,name=annotations,proto3" json:"annotations,omitempty"`
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *Flow) Reset() {
+	*x = Flow{}
+	mi := &file_proxy_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Flow) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Flow) ProtoMessage() {}
+
+func (x *Flow) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Flow.ProtoReflect.Descriptor instead.
+func (*Flow) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Flow) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Flow) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+func (x *Flow) GetOriginalRequest() *HttpRequest {
+	if x != nil {
+		return x.OriginalRequest
+	}
+	return nil
+}
+
+func (x *Flow) GetRequest() *HttpRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *Flow) GetOriginalResponse() *HttpResponse {
+	if x != nil {
+		return x.OriginalResponse
+	}
+	return nil
+}
+
+func (x *Flow) GetResponse() *HttpResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+func (x *Flow) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+func (x *Flow) GetMeta() *FlowMeta {
+	if x != nil {
+		return x.Meta
+	}
+	return nil
+}
+
+func (x *Flow) GetAnnotations() *Annotations {
+	if x != nil {
+		return x.Annotations
+	}
+	return nil
+}
+
+// Annotations are the information attached to a flow by hooks, plugins and
+// users. color is one of red, orange, yellow, green, cyan, blue, purple,
+// pink and gray.
+type Annotations struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Tags          []string               `protobuf:"bytes,1,rep,name=tags,proto3" json:"tags,omitempty"`
+	Color         string                 `protobuf:"bytes,2,opt,name=color,proto3" json:"color,omitempty"`
+	Comment       string                 `protobuf:"bytes,3,opt,name=comment,proto3" json:"comment,omitempty"`
+	Values        map[string]string      `protobuf:"bytes,4,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Annotations) Reset() {
+	*x = Annotations{}
+	mi := &file_proxy_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Annotations) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Annotations) ProtoMessage() {}
+
+func (x *Annotations) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Annotations.ProtoReflect.Descriptor instead.
+func (*Annotations) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Annotations) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *Annotations) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+func (x *Annotations) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *Annotations) GetValues() map[string]string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// AnnotateRequest edits the annotations of a stored flow. color and comment
+// are only changed if set_color and set_comment are set, and removed if they
+// are empty. Removals are applied after additions.
+type AnnotateRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	AddTags       []string               `protobuf:"bytes,2,rep,name=add_tags,json=addTags,proto3" json:"add_tags,omitempty"`
+	RemoveTags    []string               `protobuf:"bytes,3,rep,name=remove_tags,json=removeTags,proto3" json:"remove_tags,omitempty"`
+	Color         string                 `protobuf:"bytes,4,opt,name=color,proto3" json:"color,omitempty"`
+	SetColor      bool                   `protobuf:"varint,5,opt,name=set_color,json=setColor,proto3" json:"set_color,omitempty"`
+	Comment       string                 `protobuf:"bytes,6,opt,name=comment,proto3" json:"comment,omitempty"`
+	SetComment    bool                   `protobuf:"varint,7,opt,name=set_comment,json=setComment,proto3" json:"set_comment,omitempty"`
+	SetValues     map[string]string      `protobuf:"bytes,8,rep,name=set_values,json=setValues,proto3" json:"set_values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	DeleteValues  []string               `protobuf:"bytes,9,rep,name=delete_values,json=deleteValues,proto3" json:"delete_values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *AnnotateRequest) Reset() {
+	*x = AnnotateRequest{}
+	mi := &file_proxy_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AnnotateRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AnnotateRequest) ProtoMessage() {}
+
+func (x *AnnotateRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AnnotateRequest.ProtoReflect.Descriptor instead.
+func (*AnnotateRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *AnnotateRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *AnnotateRequest) GetAddTags() []string {
+	if x != nil {
+		return x.AddTags
+	}
+	return nil
+}
+
+func (x *AnnotateRequest) GetRemoveTags() []string {
+	if x != nil {
+		return x.RemoveTags
+	}
+	return nil
+}
+
+func (x *AnnotateRequest) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+func (x *AnnotateRequest) GetSetColor() bool {
+	if x != nil {
+		return x.SetColor
+	}
+	return false
+}
+
+func (x *AnnotateRequest) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *AnnotateRequest) GetSetComment() bool {
+	if x != nil {
+		return x.SetComment
+	}
+	return false
+}
+
+func (x *AnnotateRequest) GetSetValues() map[string]string {
+	if x != nil {
+		return x.SetValues
+	}
+	return nil
+}
+
+func (x *AnnotateRequest) GetDeleteValues() []string {
+	if x != nil {
+		return x.DeleteValues
+	}
+	return nil
+}
+
+// FlowQuery selects stored flows. Empty fields match every flow. Flows must
+// have all the tags and values, and a comment that contains comment.
+type FlowQuery struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        uint64                 `protobuf:"varint,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	ToId          uint64                 `protobuf:"varint,2,opt,name=to_id,json=toId,proto3" json:"to_id,omitempty"`
+	Method        string                 `protobuf:"bytes,3,opt,name=method,proto3" json:"method,omitempty"`
+	StatusCode    int32                  `protobuf:"varint,4,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
+	HostRe        string                 `protobuf:"bytes,5,opt,name=host_re,json=hostRe,proto3" json:"host_re,omitempty"`
+	UrlRe         string                 `protobuf:"bytes,6,opt,name=url_re,json=urlRe,proto3" json:"url_re,omitempty"`
+	Tags          []string               `protobuf:"bytes,7,rep,name=tags,proto3" json:"tags,omitempty"`
+	Color         string                 `protobuf:"bytes,8,opt,name=color,proto3" json:"color,omitempty"`
+	Comment       string                 `protobuf:"bytes,9,opt,name=comment,proto3" json:"comment,omitempty"`
+	Values        map[string]string      `protobuf:"bytes,10,rep,name=values,proto3" json:"values,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	Limit         int32                  `protobuf:"varint,11,opt,name=limit,proto3" json:"limit,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FlowQuery) Reset() {
+	*x = FlowQuery{}
+	mi := &file_proxy_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FlowQuery) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FlowQuery) ProtoMessage() {}
+
+func (x *FlowQuery) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FlowQuery.ProtoReflect.Descriptor instead.
+func (*FlowQuery) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *FlowQuery) GetFromId() uint64 {
+	if x != nil {
+		return x.FromId
+	}
+	return 0
+}
+
+func (x *FlowQuery) GetToId() uint64 {
+	if x != nil {
+		return x.ToId
+	}
+	return 0
+}
+
+func (x *FlowQuery) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *FlowQuery) GetStatusCode() int32 {
+	if x != nil {
+		return x.StatusCode
+	}
+	return 0
+}
+
+func (x *FlowQuery) GetHostRe() string {
+	if x != nil {
+		return x.HostRe
+	}
+	return ""
+}
+
+func (x *FlowQuery) GetUrlRe() string {
+	if x != nil {
+		return x.UrlRe
+	}
+	return ""
+}
+
+func (x *FlowQuery) GetTags() []string {
+	if x != nil {
+		return x.Tags
+	}
+	return nil
+}
+
+func (x *FlowQuery) GetColor() string {
+	if x != nil {
+		return x.Color
+	}
+	return ""
+}
+
+func (x *FlowQuery) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *FlowQuery) GetValues() map[string]string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+func (x *FlowQuery) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+type Config struct {
+	state                   protoimpl.MessageState `protogen:"open.v1"`
+	DbFile                  string                 `protobuf:"bytes,1,opt,name=db_file,json=dbFile,proto3" json:"db_file,omitempty"`
+	PrintLogs               bool                   `protobuf:"varint,2,opt,name=print_logs,json=printLogs,proto3" json:"print_logs,omitempty"`
+	SaveDir                 string                 `protobuf:"bytes,3,opt,name=save_dir,json=saveDir,proto3" json:"save_dir,omitempty"`
+	ScopeDomainRe           string                 `protobuf:"bytes,4,opt,name=scopeDomainRe,proto3" json:"scopeDomainRe,omitempty"`
+	ScopeExcludedExtensions []string               `protobuf:"bytes,5,rep,name=scopeExcludedExtensions,proto3" json:"scopeExcludedExtensions,omitempty"`
+	Project                 string                 `protobuf:"bytes,6,opt,name=project,proto3" json:"project,omitempty"`
+	ProjectNotes            string                 `protobuf:"bytes,7,opt,name=project_notes,json=projectNotes,proto3" json:"project_notes,omitempty"`
+	MatchReplaceRules       []*MatchReplaceRule    `protobuf:"bytes,8,rep,name=match_replace_rules,json=matchReplaceRules,proto3" json:"match_replace_rules,omitempty"`
+	PassiveScan             bool                   `protobuf:"varint,9,opt,name=passive_scan,json=passiveScan,proto3" json:"passive_scan,omitempty"`
+	DetectSecrets           bool                   `protobuf:"varint,10,opt,name=detect_secrets,json=detectSecrets,proto3" json:"detect_secrets,omitempty"`
+	RedactSecrets           bool                   `protobuf:"varint,11,opt,name=redact_secrets,json=redactSecrets,proto3" json:"redact_secrets,omitempty"`
+	SecretRulesFile         string                 `protobuf:"bytes,12,opt,name=secret_rules_file,json=secretRulesFile,proto3" json:"secret_rules_file,omitempty"`
+	AuthzConfigFile         string                 `protobuf:"bytes,13,opt,name=authz_config_file,json=authzConfigFile,proto3" json:"authz_config_file,omitempty"`
+	SessionRulesFile        string                 `protobuf:"bytes,14,opt,name=session_rules_file,json=sessionRulesFile,proto3" json:"session_rules_file,omitempty"`
+	// hook_priorities overrides the priority of the native hooks by name
+	HookPriorities []*HookInfo `protobuf:"bytes,15,rep,name=hook_priorities,json=hookPriorities,proto3" json:"hook_priorities,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *Config) Reset() {
+	*x = Config{}
+	mi := &file_proxy_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Config) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Config) ProtoMessage() {}
+
+func (x *Config) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Config.ProtoReflect.Descriptor instead.
+func (*Config) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Config) GetDbFile() string {
+	if x != nil {
+		return x.DbFile
+	}
+	return ""
+}
+
+func (x *Config) GetPrintLogs() bool {
+	if x != nil {
+		return x.PrintLogs
+	}
+	return false
+}
+
+func (x *Config) GetSaveDir() string {
+	if x != nil {
+		return x.SaveDir
+	}
+	return ""
+}
+
+func (x *Config) GetScopeDomainRe() string {
+	if x != nil {
+		return x.ScopeDomainRe
+	}
+	return ""
+}
+
+func (x *Config) GetScopeExcludedExtensions() []string {
+	if x != nil {
+		return x.ScopeExcludedExtensions
+	}
+	return nil
+}
+
+func (x *Config) GetProject() string {
+	if x != nil {
+		return x.Project
+	}
+	return ""
+}
+
+func (x *Config) GetProjectNotes() string {
+	if x != nil {
+		return x.ProjectNotes
+	}
+	return ""
+}
+
+func (x *Config) GetMatchReplaceRules() []*MatchReplaceRule {
+	if x != nil {
+		return x.MatchReplaceRules
+	}
+	return nil
+}
+
+func (x *Config) GetPassiveScan() bool {
+	if x != nil {
+		return x.PassiveScan
+	}
+	return false
+}
+
+func (x *Config) GetDetectSecrets() bool {
+	if x != nil {
+		return x.DetectSecrets
+	}
+	return false
+}
+
+func (x *Config) GetRedactSecrets() bool {
+	if x != nil {
+		return x.RedactSecrets
+	}
+	return false
+}
+
+func (x *Config) GetSecretRulesFile() string {
+	if x != nil {
+		return x.SecretRulesFile
+	}
+	return ""
+}
+
+func (x *Config) GetAuthzConfigFile() string {
+	if x != nil {
+		return x.AuthzConfigFile
+	}
+	return ""
+}
+
+func (x *Config) GetSessionRulesFile() string {
+	if x != nil {
+		return x.SessionRulesFile
+	}
+	return ""
+}
+
+func (x *Config) GetHookPriorities() []*HookInfo {
+	if x != nil {
+		return x.HookPriorities
+	}
+	return nil
+}
+
+type MatchReplaceRule struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Target        string                 `protobuf:"bytes,1,opt,name=target,proto3" json:"target,omitempty"`
+	Match         string                 `protobuf:"bytes,2,opt,name=match,proto3" json:"match,omitempty"`
+	Replace       string                 `protobuf:"bytes,3,opt,name=replace,proto3" json:"replace,omitempty"`
+	Comment       string                 `protobuf:"bytes,4,opt,name=comment,proto3" json:"comment,omitempty"`
+	Enabled       bool                   `protobuf:"varint,5,opt,name=enabled,proto3" json:"enabled,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MatchReplaceRule) Reset() {
+	*x = MatchReplaceRule{}
+	mi := &file_proxy_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MatchReplaceRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MatchReplaceRule) ProtoMessage() {}
+
+func (x *MatchReplaceRule) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MatchReplaceRule.ProtoReflect.Descriptor instead.
+func (*MatchReplaceRule) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *MatchReplaceRule) GetTarget() string {
+	if x != nil {
+		return x.Target
+	}
+	return ""
+}
+
+func (x *MatchReplaceRule) GetMatch() string {
+	if x != nil {
+		return x.Match
+	}
+	return ""
+}
+
+func (x *MatchReplaceRule) GetReplace() string {
+	if x != nil {
+		return x.Replace
+	}
+	return ""
+}
+
+func (x *MatchReplaceRule) GetComment() string {
+	if x != nil {
+		return x.Comment
+	}
+	return ""
+}
+
+func (x *MatchReplaceRule) GetEnabled() bool {
+	if x != nil {
+		return x.Enabled
+	}
+	return false
+}
+
+type HostRetentionRule struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	HostRe        string                 `protobuf:"bytes,1,opt,name=host_re,json=hostRe,proto3" json:"host_re,omitempty"`
+	MaxAgeSeconds int64                  `protobuf:"varint,2,opt,name=max_age_seconds,json=maxAgeSeconds,proto3" json:"max_age_seconds,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *HostRetentionRule) Reset() {
+	*x = HostRetentionRule{}
+	mi := &file_proxy_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HostRetentionRule) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HostRetentionRule) ProtoMessage() {}
+
+func (x *HostRetentionRule) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HostRetentionRule.ProtoReflect.Descriptor instead.
+func (*HostRetentionRule) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *HostRetentionRule) GetHostRe() string {
+	if x != nil {
+		return x.HostRe
+	}
+	return ""
+}
+
+func (x *HostRetentionRule) GetMaxAgeSeconds() int64 {
+	if x != nil {
+		return x.MaxAgeSeconds
+	}
+	return 0
+}
+
+// PruneRequest defines the retention policy to enforce. If all fields are
+// empty, the policy configured in the proxy is used.
+type PruneRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MaxAgeSeconds int64                  `protobuf:"varint,1,opt,name=max_age_seconds,json=maxAgeSeconds,proto3" json:"max_age_seconds,omitempty"`
+	MaxRows       int64                  `protobuf:"varint,2,opt,name=max_rows,json=maxRows,proto3" json:"max_rows,omitempty"`
+	MaxSize       int64                  `protobuf:"varint,3,opt,name=max_size,json=maxSize,proto3" json:"max_size,omitempty"`
+	HostRules     []*HostRetentionRule   `protobuf:"bytes,4,rep,name=host_rules,json=hostRules,proto3" json:"host_rules,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PruneRequest) Reset() {
+	*x = PruneRequest{}
+	mi := &file_proxy_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneRequest) ProtoMessage() {}
+
+func (x *PruneRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneRequest.ProtoReflect.Descriptor instead.
+func (*PruneRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *PruneRequest) GetMaxAgeSeconds() int64 {
+	if x != nil {
+		return x.MaxAgeSeconds
+	}
+	return 0
+}
+
+func (x *PruneRequest) GetMaxRows() int64 {
+	if x != nil {
+		return x.MaxRows
+	}
+	return 0
+}
+
+func (x *PruneRequest) GetMaxSize() int64 {
+	if x != nil {
+		return x.MaxSize
+	}
+	return 0
+}
+
+func (x *PruneRequest) GetHostRules() []*HostRetentionRule {
+	if x != nil {
+		return x.HostRules
+	}
+	return nil
+}
+
+type PruneResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	DeletedFlows  int64                  `protobuf:"varint,1,opt,name=deleted_flows,json=deletedFlows,proto3" json:"deleted_flows,omitempty"`
+	SizeBefore    int64                  `protobuf:"varint,2,opt,name=size_before,json=sizeBefore,proto3" json:"size_before,omitempty"`
+	SizeAfter     int64                  `protobuf:"varint,3,opt,name=size_after,json=sizeAfter,proto3" json:"size_after,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PruneResult) Reset() {
+	*x = PruneResult{}
+	mi := &file_proxy_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PruneResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PruneResult) ProtoMessage() {}
+
+func (x *PruneResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PruneResult.ProtoReflect.Descriptor instead.
+func (*PruneResult) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *PruneResult) GetDeletedFlows() int64 {
+	if x != nil {
+		return x.DeletedFlows
+	}
+	return 0
+}
+
+func (x *PruneResult) GetSizeBefore() int64 {
+	if x != nil {
+		return x.SizeBefore
+	}
+	return 0
+}
+
+func (x *PruneResult) GetSizeAfter() int64 {
+	if x != nil {
+		return x.SizeAfter
+	}
+	return 0
+}
+
+type Null struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Null) Reset() {
+	*x = Null{}
+	mi := &file_proxy_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Null) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Null) ProtoMessage() {}
+
+func (x *Null) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Null.ProtoReflect.Descriptor instead.
+func (*Null) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{20}
+}
+
+// SendRequestMessage sends a request again. If request is not set, the
+// request of the flow original_id is loaded from the database.
+type SendRequestMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	OriginalId    string                 `protobuf:"bytes,1,opt,name=original_id,json=originalId,proto3" json:"original_id,omitempty"`
+	Request       *HttpRequest           `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	RunPipelines  bool                   `protobuf:"varint,3,opt,name=run_pipelines,json=runPipelines,proto3" json:"run_pipelines,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendRequestMessage) Reset() {
+	*x = SendRequestMessage{}
+	mi := &file_proxy_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendRequestMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendRequestMessage) ProtoMessage() {}
+
+func (x *SendRequestMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendRequestMessage.ProtoReflect.Descriptor instead.
+func (*SendRequestMessage) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SendRequestMessage) GetOriginalId() string {
+	if x != nil {
+		return x.OriginalId
+	}
+	return ""
+}
+
+func (x *SendRequestMessage) GetRequest() *HttpRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *SendRequestMessage) GetRunPipelines() bool {
+	if x != nil {
+		return x.RunPipelines
+	}
+	return false
+}
+
+type SendRequestResult struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Request       *HttpRequest           `protobuf:"bytes,2,opt,name=request,proto3" json:"request,omitempty"`
+	Response      *HttpResponse          `protobuf:"bytes,3,opt,name=response,proto3" json:"response,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendRequestResult) Reset() {
+	*x = SendRequestResult{}
+	mi := &file_proxy_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendRequestResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendRequestResult) ProtoMessage() {}
+
+func (x *SendRequestResult) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendRequestResult.ProtoReflect.Descriptor instead.
+func (*SendRequestResult) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *SendRequestResult) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *SendRequestResult) GetRequest() *HttpRequest {
+	if x != nil {
+		return x.Request
+	}
+	return nil
+}
+
+func (x *SendRequestResult) GetResponse() *HttpResponse {
+	if x != nil {
+		return x.Response
+	}
+	return nil
+}
+
+// RawRequest sends data exactly as given to addr (host:port)
+type RawRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Addr          string                 `protobuf:"bytes,2,opt,name=addr,proto3" json:"addr,omitempty"`
+	Tls           bool                   `protobuf:"varint,3,opt,name=tls,proto3" json:"tls,omitempty"`
+	ServerName    string                 `protobuf:"bytes,4,opt,name=server_name,json=serverName,proto3" json:"server_name,omitempty"`
+	TimeoutMs     int64                  `protobuf:"varint,5,opt,name=timeout_ms,json=timeoutMs,proto3" json:"timeout_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawRequest) Reset() {
+	*x = RawRequest{}
+	mi := &file_proxy_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawRequest) ProtoMessage() {}
+
+func (x *RawRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawRequest.ProtoReflect.Descriptor instead.
+func (*RawRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *RawRequest) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *RawRequest) GetAddr() string {
+	if x != nil {
+		return x.Addr
+	}
+	return ""
+}
+
+func (x *RawRequest) GetTls() bool {
+	if x != nil {
+		return x.Tls
+	}
+	return false
+}
+
+func (x *RawRequest) GetServerName() string {
+	if x != nil {
+		return x.ServerName
+	}
+	return ""
+}
+
+func (x *RawRequest) GetTimeoutMs() int64 {
+	if x != nil {
+		return x.TimeoutMs
+	}
+	return 0
+}
+
+// RawResponse contains the bytes received and the ID of the stored flow, if
+// a database is configured
+type RawResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Data          []byte                 `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RawResponse) Reset() {
+	*x = RawResponse{}
+	mi := &file_proxy_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RawResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RawResponse) ProtoMessage() {}
+
+func (x *RawResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RawResponse.ProtoReflect.Descriptor instead.
+func (*RawResponse) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *RawResponse) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RawResponse) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+// FindingsRequest subscribes to the findings reported by the scanners. If
+// include_stored is set, the findings stored in the database are sent first.
+type FindingsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IncludeStored bool                   `protobuf:"varint,1,opt,name=include_stored,json=includeStored,proto3" json:"include_stored,omitempty"`
+	MinSeverity   string                 `protobuf:"bytes,2,opt,name=min_severity,json=minSeverity,proto3" json:"min_severity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FindingsRequest) Reset() {
+	*x = FindingsRequest{}
+	mi := &file_proxy_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FindingsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FindingsRequest) ProtoMessage() {}
+
+func (x *FindingsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FindingsRequest.ProtoReflect.Descriptor instead.
+func (*FindingsRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *FindingsRequest) GetIncludeStored() bool {
+	if x != nil {
+		return x.IncludeStored
+	}
+	return false
+}
+
+func (x *FindingsRequest) GetMinSeverity() string {
+	if x != nil {
+		return x.MinSeverity
+	}
+	return ""
+}
+
+type Finding struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	FlowId        string                 `protobuf:"bytes,2,opt,name=flow_id,json=flowId,proto3" json:"flow_id,omitempty"`
+	Source        string                 `protobuf:"bytes,3,opt,name=source,proto3" json:"source,omitempty"`
+	Type          string                 `protobuf:"bytes,4,opt,name=type,proto3" json:"type,omitempty"`
+	Severity      string                 `protobuf:"bytes,5,opt,name=severity,proto3" json:"severity,omitempty"`
+	Host          string                 `protobuf:"bytes,6,opt,name=host,proto3" json:"host,omitempty"`
+	Path          string                 `protobuf:"bytes,7,opt,name=path,proto3" json:"path,omitempty"`
+	Title         string                 `protobuf:"bytes,8,opt,name=title,proto3" json:"title,omitempty"`
+	Detail        string                 `protobuf:"bytes,9,opt,name=detail,proto3" json:"detail,omitempty"`
+	Evidence      string                 `protobuf:"bytes,10,opt,name=evidence,proto3" json:"evidence,omitempty"`
+	TimestampMs   int64                  `protobuf:"varint,11,opt,name=timestamp_ms,json=timestampMs,proto3" json:"timestamp_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Finding) Reset() {
+	*x = Finding{}
+	mi := &file_proxy_proto_msgTypes[26]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Finding) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Finding) ProtoMessage() {}
+
+func (x *Finding) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[26]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Finding.ProtoReflect.Descriptor instead.
+func (*Finding) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{26}
+}
+
+func (x *Finding) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Finding) GetFlowId() string {
+	if x != nil {
+		return x.FlowId
+	}
+	return ""
+}
+
+func (x *Finding) GetSource() string {
+	if x != nil {
+		return x.Source
+	}
+	return ""
+}
+
+func (x *Finding) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *Finding) GetSeverity() string {
+	if x != nil {
+		return x.Severity
+	}
+	return ""
+}
+
+func (x *Finding) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *Finding) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *Finding) GetTitle() string {
+	if x != nil {
+		return x.Title
+	}
+	return ""
+}
+
+func (x *Finding) GetDetail() string {
+	if x != nil {
+		return x.Detail
+	}
+	return ""
+}
+
+func (x *Finding) GetEvidence() string {
+	if x != nil {
+		return x.Evidence
+	}
+	return ""
+}
+
+func (x *Finding) GetTimestampMs() int64 {
+	if x != nil {
+		return x.TimestampMs
+	}
+	return 0
+}
+
+// ActiveScanRequest scans the in scope stored flows selected by the ID range
+// and regexes, and streams the findings until the scan finishes. Empty
+// checks runs all of them; zero concurrency and time delay use the defaults.
+type ActiveScanRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	FromId        uint64                 `protobuf:"varint,1,opt,name=from_id,json=fromId,proto3" json:"from_id,omitempty"`
+	ToId          uint64                 `protobuf:"varint,2,opt,name=to_id,json=toId,proto3" json:"to_id,omitempty"`
+	HostRe        string                 `protobuf:"bytes,3,opt,name=host_re,json=hostRe,proto3" json:"host_re,omitempty"`
+	UrlRe         string                 `protobuf:"bytes,4,opt,name=url_re,json=urlRe,proto3" json:"url_re,omitempty"`
+	Checks        []string               `protobuf:"bytes,5,rep,name=checks,proto3" json:"checks,omitempty"`
+	Concurrency   int32                  `protobuf:"varint,6,opt,name=concurrency,proto3" json:"concurrency,omitempty"`
+	TimeDelayMs   int64                  `protobuf:"varint,7,opt,name=time_delay_ms,json=timeDelayMs,proto3" json:"time_delay_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ActiveScanRequest) Reset() {
+	*x = ActiveScanRequest{}
+	mi := &file_proxy_proto_msgTypes[27]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ActiveScanRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ActiveScanRequest) ProtoMessage() {}
+
+func (x *ActiveScanRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[27]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ActiveScanRequest.ProtoReflect.Descriptor instead.
+func (*ActiveScanRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{27}
+}
+
+func (x *ActiveScanRequest) GetFromId() uint64 {
+	if x != nil {
+		return x.FromId
+	}
+	return 0
+}
+
+func (x *ActiveScanRequest) GetToId() uint64 {
+	if x != nil {
+		return x.ToId
+	}
+	return 0
+}
+
+func (x *ActiveScanRequest) GetHostRe() string {
+	if x != nil {
+		return x.HostRe
+	}
+	return ""
+}
+
+func (x *ActiveScanRequest) GetUrlRe() string {
+	if x != nil {
+		return x.UrlRe
+	}
+	return ""
+}
+
+func (x *ActiveScanRequest) GetChecks() []string {
+	if x != nil {
+		return x.Checks
+	}
+	return nil
+}
+
+func (x *ActiveScanRequest) GetConcurrency() int32 {
+	if x != nil {
+		return x.Concurrency
+	}
+	return 0
+}
+
+func (x *ActiveScanRequest) GetTimeDelayMs() int64 {
+	if x != nil {
+		return x.TimeDelayMs
+	}
+	return 0
+}
+
+// SiteMapRequest builds the site map of the stored flows whose host and URL
+// match the regexes. If format is "json" or "openapi", the site map is also
+// exported in that format; "openapi" requires flows of exactly one host.
+type SiteMapRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	HostRe        string                 `protobuf:"bytes,1,opt,name=host_re,json=hostRe,proto3" json:"host_re,omitempty"`
+	UrlRe         string                 `protobuf:"bytes,2,opt,name=url_re,json=urlRe,proto3" json:"url_re,omitempty"`
+	Format        string                 `protobuf:"bytes,3,opt,name=format,proto3" json:"format,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SiteMapRequest) Reset() {
+	*x = SiteMapRequest{}
+	mi := &file_proxy_proto_msgTypes[28]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SiteMapRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SiteMapRequest) ProtoMessage() {}
+
+func (x *SiteMapRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[28]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SiteMapRequest.ProtoReflect.Descriptor instead.
+func (*SiteMapRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{28}
+}
+
+func (x *SiteMapRequest) GetHostRe() string {
+	if x != nil {
+		return x.HostRe
+	}
+	return ""
+}
+
+func (x *SiteMapRequest) GetUrlRe() string {
+	if x != nil {
+		return x.UrlRe
+	}
+	return ""
+}
+
+func (x *SiteMapRequest) GetFormat() string {
+	if x != nil {
+		return x.Format
+	}
+	return ""
+}
+
+type SiteMap struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hosts         []*SiteMapNode         `protobuf:"bytes,1,rep,name=hosts,proto3" json:"hosts,omitempty"`
+	Export        []byte                 `protobuf:"bytes,2,opt,name=export,proto3" json:"export,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SiteMap) Reset() {
+	*x = SiteMap{}
+	mi := &file_proxy_proto_msgTypes[29]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SiteMap) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SiteMap) ProtoMessage() {}
+
+func (x *SiteMap) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[29]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SiteMap.ProtoReflect.Descriptor instead.
+func (*SiteMap) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{29}
+}
+
+func (x *SiteMap) GetHosts() []*SiteMapNode {
+	if x != nil {
+		return x.Hosts
+	}
+	return nil
+}
+
+func (x *SiteMap) GetExport() []byte {
+	if x != nil {
+		return x.Export
+	}
+	return nil
+}
+
+type SiteMapNode struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Path          string                 `protobuf:"bytes,2,opt,name=path,proto3" json:"path,omitempty"`
+	Schemes       []string               `protobuf:"bytes,3,rep,name=schemes,proto3" json:"schemes,omitempty"`
+	Endpoints     []*SiteMapEndpoint     `protobuf:"bytes,4,rep,name=endpoints,proto3" json:"endpoints,omitempty"`
+	Children      []*SiteMapNode         `protobuf:"bytes,5,rep,name=children,proto3" json:"children,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SiteMapNode) Reset() {
+	*x = SiteMapNode{}
+	mi := &file_proxy_proto_msgTypes[30]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SiteMapNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SiteMapNode) ProtoMessage() {}
+
+func (x *SiteMapNode) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[30]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SiteMapNode.ProtoReflect.Descriptor instead.
+func (*SiteMapNode) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{30}
+}
+
+func (x *SiteMapNode) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *SiteMapNode) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *SiteMapNode) GetSchemes() []string {
+	if x != nil {
+		return x.Schemes
+	}
+	return nil
+}
+
+func (x *SiteMapNode) GetEndpoints() []*SiteMapEndpoint {
+	if x != nil {
+		return x.Endpoints
+	}
+	return nil
+}
+
+func (x *SiteMapNode) GetChildren() []*SiteMapNode {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+type SiteMapEndpoint struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Method        string                 `protobuf:"bytes,1,opt,name=method,proto3" json:"method,omitempty"`
+	Count         int64                  `protobuf:"varint,2,opt,name=count,proto3" json:"count,omitempty"`
+	StatusCodes   map[int32]int64        `protobuf:"bytes,3,rep,name=status_codes,json=statusCodes,proto3" json:"status_codes,omitempty" protobuf_key:"varint,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	QueryParams   []string               `protobuf:"bytes,4,rep,name=query_params,json=queryParams,proto3" json:"query_params,omitempty"`
+	BodyParams    []string               `protobuf:"bytes,5,rep,name=body_params,json=bodyParams,proto3" json:"body_params,omitempty"`
+	ContentTypes  []string               `protobuf:"bytes,6,rep,name=content_types,json=contentTypes,proto3" json:"content_types,omitempty"`
+	FirstFlowId   string                 `protobuf:"bytes,7,opt,name=first_flow_id,json=firstFlowId,proto3" json:"first_flow_id,omitempty"`
+	LastFlowId    string                 `protobuf:"bytes,8,opt,name=last_flow_id,json=lastFlowId,proto3" json:"last_flow_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SiteMapEndpoint) Reset() {
+	*x = SiteMapEndpoint{}
+	mi := &file_proxy_proto_msgTypes[31]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SiteMapEndpoint) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SiteMapEndpoint) ProtoMessage() {}
+
+func (x *SiteMapEndpoint) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[31]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SiteMapEndpoint.ProtoReflect.Descriptor instead.
+func (*SiteMapEndpoint) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{31}
+}
+
+func (x *SiteMapEndpoint) GetMethod() string {
+	if x != nil {
+		return x.Method
+	}
+	return ""
+}
+
+func (x *SiteMapEndpoint) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *SiteMapEndpoint) GetStatusCodes() map[int32]int64 {
+	if x != nil {
+		return x.StatusCodes
+	}
+	return nil
+}
+
+func (x *SiteMapEndpoint) GetQueryParams() []string {
+	if x != nil {
+		return x.QueryParams
+	}
+	return nil
+}
+
+func (x *SiteMapEndpoint) GetBodyParams() []string {
+	if x != nil {
+		return x.BodyParams
+	}
+	return nil
+}
+
+func (x *SiteMapEndpoint) GetContentTypes() []string {
+	if x != nil {
+		return x.ContentTypes
+	}
+	return nil
+}
+
+func (x *SiteMapEndpoint) GetFirstFlowId() string {
+	if x != nil {
+		return x.FirstFlowId
+	}
+	return ""
+}
+
+func (x *SiteMapEndpoint) GetLastFlowId() string {
+	if x != nil {
+		return x.LastFlowId
+	}
+	return ""
+}
+
+// DiffRequest compares the responses of two stored flows. If replay is set,
+// new_id is ignored and the request of old_id is sent again, stored, and its
+// response compared with the stored one.
+type DiffRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	OldId         string                 `protobuf:"bytes,1,opt,name=old_id,json=oldId,proto3" json:"old_id,omitempty"`
+	NewId         string                 `protobuf:"bytes,2,opt,name=new_id,json=newId,proto3" json:"new_id,omitempty"`
+	Replay        bool                   `protobuf:"varint,3,opt,name=replay,proto3" json:"replay,omitempty"`
+	IgnoreHeaders []string               `protobuf:"bytes,4,rep,name=ignore_headers,json=ignoreHeaders,proto3" json:"ignore_headers,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Register) Reset() {
-	*x = Register{}
-	mi := &file_proxy_proto_msgTypes[3]
+func (x *DiffRequest) Reset() {
+	*x = DiffRequest{}
+	mi := &file_proxy_proto_msgTypes[32]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Register) String() string {
+func (x *DiffRequest) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Register) ProtoMessage() {}
+func (*DiffRequest) ProtoMessage() {}
 
-func (x *Register) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_proto_msgTypes[3]
+func (x *DiffRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[32]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -269,45 +2769,74 @@ func (x *Register) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Register.ProtoReflect.Descriptor instead.
-func (*Register) Descriptor() ([]byte, []int) {
-	return file_proxy_proto_rawDescGZIP(), []int{3}
+// Deprecated: Use DiffRequest.ProtoReflect.Descriptor instead.
+func (*DiffRequest) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{32}
 }
 
-func (x *Register) GetName() string {
+func (x *DiffRequest) GetOldId() string {
 	if x != nil {
-		return x.Name
+		return x.OldId
 	}
 	return ""
 }
 
-// HttpRequest represents an HTTP request.
-type HttpRequest struct {
+func (x *DiffRequest) GetNewId() string {
+	if x != nil {
+		return x.NewId
+	}
+	return ""
+}
+
+func (x *DiffRequest) GetReplay() bool {
+	if x != nil {
+		return x.Replay
+	}
+	return false
+}
+
+func (x *DiffRequest) GetIgnoreHeaders() []string {
+	if x != nil {
+		return x.IgnoreHeaders
+	}
+	return nil
+}
+
+// FlowDiff is the difference between two responses. Text bodies are compared
+// line by line and JSON bodies by key path; values of JSON changes are JSON
+// encoded.
+type FlowDiff struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Method        string                 `protobuf:"bytes,2,opt,name=method,proto3" json:"method,omitempty"`
-	Url           string                 `protobuf:"bytes,3,opt,name=url,proto3" json:"url,omitempty"`
-	Headers       []*Header              `protobuf:"bytes,4,rep,name=headers,proto3" json:"headers,omitempty"`
-	Body          []byte                 `protobuf:"bytes,5,opt,name=body,proto3" json:"body,omitempty"`
+	OldId         string                 `protobuf:"bytes,1,opt,name=old_id,json=oldId,proto3" json:"old_id,omitempty"`
+	NewId         string                 `protobuf:"bytes,2,opt,name=new_id,json=newId,proto3" json:"new_id,omitempty"`
+	OldStatus     int32                  `protobuf:"varint,3,opt,name=old_status,json=oldStatus,proto3" json:"old_status,omitempty"`
+	NewStatus     int32                  `protobuf:"varint,4,opt,name=new_status,json=newStatus,proto3" json:"new_status,omitempty"`
+	Headers       []*HeaderDiff          `protobuf:"bytes,5,rep,name=headers,proto3" json:"headers,omitempty"`
+	BodyKind      string                 `protobuf:"bytes,6,opt,name=body_kind,json=bodyKind,proto3" json:"body_kind,omitempty"`
+	BodyChanged   bool                   `protobuf:"varint,7,opt,name=body_changed,json=bodyChanged,proto3" json:"body_changed,omitempty"`
+	OldSize       int64                  `protobuf:"varint,8,opt,name=old_size,json=oldSize,proto3" json:"old_size,omitempty"`
+	NewSize       int64                  `protobuf:"varint,9,opt,name=new_size,json=newSize,proto3" json:"new_size,omitempty"`
+	Lines         []*LineDiff            `protobuf:"bytes,10,rep,name=lines,proto3" json:"lines,omitempty"`
+	JsonChanges   []*JSONDiff            `protobuf:"bytes,11,rep,name=json_changes,json=jsonChanges,proto3" json:"json_changes,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *HttpRequest) Reset() {
-	*x = HttpRequest{}
-	mi := &file_proxy_proto_msgTypes[4]
+func (x *FlowDiff) Reset() {
+	*x = FlowDiff{}
+	mi := &file_proxy_proto_msgTypes[33]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HttpRequest) String() string {
+func (x *FlowDiff) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HttpRequest) ProtoMessage() {}
+func (*FlowDiff) ProtoMessage() {}
 
-func (x *HttpRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_proto_msgTypes[4]
+func (x *FlowDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[33]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -318,72 +2847,113 @@ func (x *HttpRequest) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HttpRequest.ProtoReflect.Descriptor instead.
-func (*HttpRequest) Descriptor() ([]byte, []int) {
-	return file_proxy_proto_rawDescGZIP(), []int{4}
+// Deprecated: Use FlowDiff.ProtoReflect.Descriptor instead.
+func (*FlowDiff) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{33}
 }
 
-func (x *HttpRequest) GetId() string {
+func (x *FlowDiff) GetOldId() string {
 	if x != nil {
-		return x.Id
+		return x.OldId
 	}
 	return ""
 }
 
-func (x *HttpRequest) GetMethod() string {
+func (x *FlowDiff) GetNewId() string {
 	if x != nil {
-		return x.Method
+		return x.NewId
 	}
 	return ""
 }
 
-func (x *HttpRequest) GetUrl() string {
+func (x *FlowDiff) GetOldStatus() int32 {
 	if x != nil {
-		return x.Url
+		return x.OldStatus
 	}
-	return ""
+	return 0
 }
 
-func (x *HttpRequest) GetHeaders() []*Header {
+func (x *FlowDiff) GetNewStatus() int32 {
+	if x != nil {
+		return x.NewStatus
+	}
+	return 0
+}
+
+func (x *FlowDiff) GetHeaders() []*HeaderDiff {
 	if x != nil {
 		return x.Headers
 	}
 	return nil
 }
 
-func (x *HttpRequest) GetBody() []byte {
+func (x *FlowDiff) GetBodyKind() string {
 	if x != nil {
-		return x.Body
+		return x.BodyKind
+	}
+	return ""
+}
+
+func (x *FlowDiff) GetBodyChanged() bool {
+	if x != nil {
+		return x.BodyChanged
+	}
+	return false
+}
+
+func (x *FlowDiff) GetOldSize() int64 {
+	if x != nil {
+		return x.OldSize
+	}
+	return 0
+}
+
+func (x *FlowDiff) GetNewSize() int64 {
+	if x != nil {
+		return x.NewSize
+	}
+	return 0
+}
+
+func (x *FlowDiff) GetLines() []*LineDiff {
+	if x != nil {
+		return x.Lines
 	}
 	return nil
 }
 
-// HttpResponse represents an HTTP response.
-type HttpResponse struct {
+func (x *FlowDiff) GetJsonChanges() []*JSONDiff {
+	if x != nil {
+		return x.JsonChanges
+	}
+	return nil
+}
+
+type HeaderDiff struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	StatusCode    int32                  `protobuf:"varint,2,opt,name=status_code,json=statusCode,proto3" json:"status_code,omitempty"`
-	Headers       []*Header              `protobuf:"bytes,3,rep,name=headers,proto3" json:"headers,omitempty"`
-	Body          []byte                 `protobuf:"bytes,4,opt,name=body,proto3" json:"body,omitempty"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Op            string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`
+	Old           []string               `protobuf:"bytes,3,rep,name=old,proto3" json:"old,omitempty"`
+	New           []string               `protobuf:"bytes,4,rep,name=new,proto3" json:"new,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *HttpResponse) Reset() {
-	*x = HttpResponse{}
-	mi := &file_proxy_proto_msgTypes[5]
+func (x *HeaderDiff) Reset() {
+	*x = HeaderDiff{}
+	mi := &file_proxy_proto_msgTypes[34]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *HttpResponse) String() string {
+func (x *HeaderDiff) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*HttpResponse) ProtoMessage() {}
+func (*HeaderDiff) ProtoMessage() {}
 
-func (x *HttpResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_proto_msgTypes[5]
+func (x *HeaderDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[34]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -394,65 +2964,64 @@ func (x *HttpResponse) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use HttpResponse.ProtoReflect.Descriptor instead.
-func (*HttpResponse) Descriptor() ([]byte, []int) {
-	return file_proxy_proto_rawDescGZIP(), []int{5}
+// Deprecated: Use HeaderDiff.ProtoReflect.Descriptor instead.
+func (*HeaderDiff) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{34}
 }
 
-func (x *HttpResponse) GetId() string {
+func (x *HeaderDiff) GetName() string {
 	if x != nil {
-		return x.Id
+		return x.Name
 	}
 	return ""
 }
 
-func (x *HttpResponse) GetStatusCode() int32 {
+func (x *HeaderDiff) GetOp() string {
 	if x != nil {
-		return x.StatusCode
+		return x.Op
 	}
-	return 0
+	return ""
 }
 
-func (x *HttpResponse) GetHeaders() []*Header {
+func (x *HeaderDiff) GetOld() []string {
 	if x != nil {
-		return x.Headers
+		return x.Old
 	}
 	return nil
 }
 
-func (x *HttpResponse) GetBody() []byte {
+func (x *HeaderDiff) GetNew() []string {
 	if x != nil {
-		return x.Body
+		return x.New
 	}
 	return nil
 }
 
-type Config struct {
-	state                   protoimpl.MessageState `protogen:"open.v1"`
-	DbFile                  string                 `protobuf:"bytes,1,opt,name=db_file,json=dbFile,proto3" json:"db_file,omitempty"`
-	PrintLogs               bool                   `protobuf:"varint,2,opt,name=print_logs,json=printLogs,proto3" json:"print_logs,omitempty"`
-	SaveDir                 string                 `protobuf:"bytes,3,opt,name=save_dir,json=saveDir,proto3" json:"save_dir,omitempty"`
-	ScopeDomainRe           string                 `protobuf:"bytes,4,opt,name=scopeDomainRe,proto3" json:"scopeDomainRe,omitempty"`
-	ScopeExcludedExtensions []string               `protobuf:"bytes,5,rep,name=scopeExcludedExtensions,proto3" json:"scopeExcludedExtensions,omitempty"`
-	unknownFields           protoimpl.UnknownFields
-	sizeCache               protoimpl.SizeCache
+type LineDiff struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Op            string                 `protobuf:"bytes,1,opt,name=op,proto3" json:"op,omitempty"`
+	OldLine       int32                  `protobuf:"varint,2,opt,name=old_line,json=oldLine,proto3" json:"old_line,omitempty"`
+	NewLine       int32                  `protobuf:"varint,3,opt,name=new_line,json=newLine,proto3" json:"new_line,omitempty"`
+	Text          string                 `protobuf:"bytes,4,opt,name=text,proto3" json:"text,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Config) Reset() {
-	*x = Config{}
-	mi := &file_proxy_proto_msgTypes[6]
+func (x *LineDiff) Reset() {
+	*x = LineDiff{}
+	mi := &file_proxy_proto_msgTypes[35]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Config) String() string {
+func (x *LineDiff) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Config) ProtoMessage() {}
+func (*LineDiff) ProtoMessage() {}
 
-func (x *Config) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_proto_msgTypes[6]
+func (x *LineDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[35]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -463,67 +3032,64 @@ func (x *Config) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Config.ProtoReflect.Descriptor instead.
-func (*Config) Descriptor() ([]byte, []int) {
-	return file_proxy_proto_rawDescGZIP(), []int{6}
+// Deprecated: Use LineDiff.ProtoReflect.Descriptor instead.
+func (*LineDiff) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{35}
 }
 
-func (x *Config) GetDbFile() string {
+func (x *LineDiff) GetOp() string {
 	if x != nil {
-		return x.DbFile
+		return x.Op
 	}
 	return ""
 }
 
-func (x *Config) GetPrintLogs() bool {
+func (x *LineDiff) GetOldLine() int32 {
 	if x != nil {
-		return x.PrintLogs
+		return x.OldLine
 	}
-	return false
+	return 0
 }
 
-func (x *Config) GetSaveDir() string {
+func (x *LineDiff) GetNewLine() int32 {
 	if x != nil {
-		return x.SaveDir
+		return x.NewLine
 	}
-	return ""
+	return 0
 }
 
-func (x *Config) GetScopeDomainRe() string {
+func (x *LineDiff) GetText() string {
 	if x != nil {
-		return x.ScopeDomainRe
+		return x.Text
 	}
 	return ""
 }
 
-func (x *Config) GetScopeExcludedExtensions() []string {
-	if x != nil {
-		return x.ScopeExcludedExtensions
-	}
-	return nil
-}
-
-type Null struct {
+type JSONDiff struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
+	Path          string                 `protobuf:"bytes,1,opt,name=path,proto3" json:"path,omitempty"`
+	Op            string                 `protobuf:"bytes,2,opt,name=op,proto3" json:"op,omitempty"`
+	Old           string                 `protobuf:"bytes,3,opt,name=old,proto3" json:"old,omitempty"`
+	New           string                 `protobuf:"bytes,4,opt,name=new,proto3" json:"new,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
-func (x *Null) Reset() {
-	*x = Null{}
-	mi := &file_proxy_proto_msgTypes[7]
+func (x *JSONDiff) Reset() {
+	*x = JSONDiff{}
+	mi := &file_proxy_proto_msgTypes[36]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
 
-func (x *Null) String() string {
+func (x *JSONDiff) String() string {
 	return protoimpl.X.MessageStringOf(x)
 }
 
-func (*Null) ProtoMessage() {}
+func (*JSONDiff) ProtoMessage() {}
 
-func (x *Null) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_proto_msgTypes[7]
+func (x *JSONDiff) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_proto_msgTypes[36]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -534,9 +3100,37 @@ func (x *Null) ProtoReflect() protoreflect.Message {
 	return mi.MessageOf(x)
 }
 
-// Deprecated: Use Null.ProtoReflect.Descriptor instead.
-func (*Null) Descriptor() ([]byte, []int) {
-	return file_proxy_proto_rawDescGZIP(), []int{7}
+// Deprecated: Use JSONDiff.ProtoReflect.Descriptor instead.
+func (*JSONDiff) Descriptor() ([]byte, []int) {
+	return file_proxy_proto_rawDescGZIP(), []int{36}
+}
+
+func (x *JSONDiff) GetPath() string {
+	if x != nil {
+		return x.Path
+	}
+	return ""
+}
+
+func (x *JSONDiff) GetOp() string {
+	if x != nil {
+		return x.Op
+	}
+	return ""
+}
+
+func (x *JSONDiff) GetOld() string {
+	if x != nil {
+		return x.Old
+	}
+	return ""
+}
+
+func (x *JSONDiff) GetNew() string {
+	if x != nil {
+		return x.New
+	}
+	return ""
 }
 
 var File_proxy_proto protoreflect.FileDescriptor
@@ -554,29 +3148,293 @@ const file_proxy_proto_rawDesc = "" +
 	"\x18ResponseModClientMessage\x12-\n" +
 	"\bregister\x18\x01 \x01(\v2\x0f.proxy.RegisterH\x00R\bregister\x12A\n" +
 	"\x10modifiedResponse\x18\x02 \x01(\v2\x13.proxy.HttpResponseH\x00R\x10modifiedResponseB\x05\n" +
-	"\x03msg\"\x1e\n" +
+	"\x03msg\"\xbe\x02\n" +
 	"\bRegister\x12\x12\n" +
-	"\x04name\x18\x01 \x01(\tR\x04name\"\x84\x01\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\x05R\bpriority\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x03 \x01(\x03R\ttimeoutMs\x12 \n" +
+	"\tfail_open\x18\x04 \x01(\bH\x00R\bfailOpen\x88\x01\x01\x12!\n" +
+	"\fmax_failures\x18\x05 \x01(\x05R\vmaxFailures\x12\x1f\n" +
+	"\vcooldown_ms\x18\x06 \x01(\x03R\n" +
+	"cooldownMs\x12)\n" +
+	"\x06filter\x18\a \x01(\v2\x11.proxy.HookFilterR\x06filter\x12\x1a\n" +
+	"\boverflow\x18\b \x01(\tR\boverflow\x12(\n" +
+	"\x10overflow_wait_ms\x18\t \x01(\x03R\x0eoverflowWaitMsB\f\n" +
+	"\n" +
+	"_fail_open\"\xc2\x01\n" +
+	"\n" +
+	"HookFilter\x12\x17\n" +
+	"\ahost_re\x18\x01 \x01(\tR\x06hostRe\x12\x17\n" +
+	"\apath_re\x18\x02 \x01(\tR\x06pathRe\x12\x18\n" +
+	"\amethods\x18\x03 \x03(\tR\amethods\x12#\n" +
+	"\rcontent_types\x18\x04 \x03(\tR\fcontentTypes\x12\"\n" +
+	"\rmax_body_size\x18\x05 \x01(\x03R\vmaxBodySize\x12\x1f\n" +
+	"\vomit_bodies\x18\x06 \x01(\bR\n" +
+	"omitBodies\"\xa6\x01\n" +
+	"\bHookInfo\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x1a\n" +
+	"\bpriority\x18\x02 \x01(\x05R\bpriority\x12\x1a\n" +
+	"\bdisabled\x18\x03 \x01(\bR\bdisabled\x12\x1a\n" +
+	"\bfailures\x18\x04 \x01(\x05R\bfailures\x12\x18\n" +
+	"\adropped\x18\x05 \x01(\x04R\adropped\x12\x18\n" +
+	"\aspooled\x18\x06 \x01(\x03R\aspooled\"W\n" +
+	"\rPipelineStats\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x18\n" +
+	"\adropped\x18\x02 \x01(\x04R\adropped\x12\x18\n" +
+	"\aspooled\x18\x03 \x01(\x03R\aspooled\"\xce\x03\n" +
+	"\n" +
+	"HookChains\x12.\n" +
+	"\n" +
+	"request_in\x18\x01 \x03(\v2\x0f.proxy.HookInfoR\trequestIn\x120\n" +
+	"\vrequest_mod\x18\x02 \x03(\v2\x0f.proxy.HookInfoR\n" +
+	"requestMod\x120\n" +
+	"\vrequest_out\x18\x03 \x03(\v2\x0f.proxy.HookInfoR\n" +
+	"requestOut\x120\n" +
+	"\vresponse_in\x18\x04 \x03(\v2\x0f.proxy.HookInfoR\n" +
+	"responseIn\x122\n" +
+	"\fresponse_mod\x18\x05 \x03(\v2\x0f.proxy.HookInfoR\vresponseMod\x122\n" +
+	"\fresponse_out\x18\x06 \x03(\v2\x0f.proxy.HookInfoR\vresponseOut\x12*\n" +
+	"\bflow_out\x18\a \x03(\v2\x0f.proxy.HookInfoR\aflowOut\x122\n" +
+	"\tpipelines\x18\b \x03(\v2\x14.proxy.PipelineStatsR\tpipelines\x122\n" +
+	"\fresponse_log\x18\t \x03(\v2\x0f.proxy.HookInfoR\vresponseLog\"\x98\x02\n" +
 	"\vHttpRequest\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x16\n" +
 	"\x06method\x18\x02 \x01(\tR\x06method\x12\x10\n" +
 	"\x03url\x18\x03 \x01(\tR\x03url\x12'\n" +
 	"\aheaders\x18\x04 \x03(\v2\r.proxy.HeaderR\aheaders\x12\x12\n" +
-	"\x04body\x18\x05 \x01(\fR\x04body\"|\n" +
+	"\x04body\x18\x05 \x01(\fR\x04body\x12\x14\n" +
+	"\x05proto\x18\x06 \x01(\tR\x05proto\x12!\n" +
+	"\frequest_line\x18\a \x01(\tR\vrequestLine\x12#\n" +
+	"\x04meta\x18\b \x01(\v2\x0f.proxy.FlowMetaR\x04meta\x124\n" +
+	"\vannotations\x18\t \x01(\v2\x12.proxy.AnnotationsR\vannotations\"\x8e\x02\n" +
 	"\fHttpResponse\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1f\n" +
 	"\vstatus_code\x18\x02 \x01(\x05R\n" +
 	"statusCode\x12'\n" +
 	"\aheaders\x18\x03 \x03(\v2\r.proxy.HeaderR\aheaders\x12\x12\n" +
-	"\x04body\x18\x04 \x01(\fR\x04body\"\xbb\x01\n" +
+	"\x04body\x18\x04 \x01(\fR\x04body\x12\x14\n" +
+	"\x05proto\x18\x05 \x01(\tR\x05proto\x12\x1f\n" +
+	"\vstatus_line\x18\x06 \x01(\tR\n" +
+	"statusLine\x12#\n" +
+	"\x04meta\x18\a \x01(\v2\x0f.proxy.FlowMetaR\x04meta\x124\n" +
+	"\vannotations\x18\b \x01(\v2\x12.proxy.AnnotationsR\vannotations\"\xb4\x02\n" +
+	"\bFlowMeta\x12\x1f\n" +
+	"\vclient_addr\x18\x01 \x01(\tR\n" +
+	"clientAddr\x12\x15\n" +
+	"\x06dns_ms\x18\x02 \x01(\x01R\x05dnsMs\x12\x1d\n" +
+	"\n" +
+	"connect_ms\x18\x03 \x01(\x01R\tconnectMs\x12(\n" +
+	"\x10tls_handshake_ms\x18\x04 \x01(\x01R\x0etlsHandshakeMs\x12\x17\n" +
+	"\attfb_ms\x18\x05 \x01(\x01R\x06ttfbMs\x12\x19\n" +
+	"\btotal_ms\x18\x06 \x01(\x01R\atotalMs\x12\x1f\n" +
+	"\vupstream_ip\x18\a \x01(\tR\n" +
+	"upstreamIp\x12\x1f\n" +
+	"\vtls_version\x18\b \x01(\tR\n" +
+	"tlsVersion\x12\x1d\n" +
+	"\n" +
+	"tls_cipher\x18\t \x01(\tR\ttlsCipher\x12\x12\n" +
+	"\x04alpn\x18\n" +
+	" \x01(\tR\x04alpn\"\x8a\x03\n" +
+	"\x04Flow\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12!\n" +
+	"\ftimestamp_ms\x18\x02 \x01(\x03R\vtimestampMs\x12=\n" +
+	"\x10original_request\x18\x03 \x01(\v2\x12.proxy.HttpRequestR\x0foriginalRequest\x12,\n" +
+	"\arequest\x18\x04 \x01(\v2\x12.proxy.HttpRequestR\arequest\x12@\n" +
+	"\x11original_response\x18\x05 \x01(\v2\x13.proxy.HttpResponseR\x10originalResponse\x12/\n" +
+	"\bresponse\x18\x06 \x01(\v2\x13.proxy.HttpResponseR\bresponse\x12\x14\n" +
+	"\x05error\x18\a \x01(\tR\x05error\x12#\n" +
+	"\x04meta\x18\b \x01(\v2\x0f.proxy.FlowMetaR\x04meta\x124\n" +
+	"\vannotations\x18\t \x01(\v2\x12.proxy.AnnotationsR\vannotations\"\xc4\x01\n" +
+	"\vAnnotations\x12\x12\n" +
+	"\x04tags\x18\x01 \x03(\tR\x04tags\x12\x14\n" +
+	"\x05color\x18\x02 \x01(\tR\x05color\x12\x18\n" +
+	"\acomment\x18\x03 \x01(\tR\acomment\x126\n" +
+	"\x06values\x18\x04 \x03(\v2\x1e.proxy.Annotations.ValuesEntryR\x06values\x1a9\n" +
+	"\vValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xf4\x02\n" +
+	"\x0fAnnotateRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x19\n" +
+	"\badd_tags\x18\x02 \x03(\tR\aaddTags\x12\x1f\n" +
+	"\vremove_tags\x18\x03 \x03(\tR\n" +
+	"removeTags\x12\x14\n" +
+	"\x05color\x18\x04 \x01(\tR\x05color\x12\x1b\n" +
+	"\tset_color\x18\x05 \x01(\bR\bsetColor\x12\x18\n" +
+	"\acomment\x18\x06 \x01(\tR\acomment\x12\x1f\n" +
+	"\vset_comment\x18\a \x01(\bR\n" +
+	"setComment\x12D\n" +
+	"\n" +
+	"set_values\x18\b \x03(\v2%.proxy.AnnotateRequest.SetValuesEntryR\tsetValues\x12#\n" +
+	"\rdelete_values\x18\t \x03(\tR\fdeleteValues\x1a<\n" +
+	"\x0eSetValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xed\x02\n" +
+	"\tFlowQuery\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\x04R\x06fromId\x12\x13\n" +
+	"\x05to_id\x18\x02 \x01(\x04R\x04toId\x12\x16\n" +
+	"\x06method\x18\x03 \x01(\tR\x06method\x12\x1f\n" +
+	"\vstatus_code\x18\x04 \x01(\x05R\n" +
+	"statusCode\x12\x17\n" +
+	"\ahost_re\x18\x05 \x01(\tR\x06hostRe\x12\x15\n" +
+	"\x06url_re\x18\x06 \x01(\tR\x05urlRe\x12\x12\n" +
+	"\x04tags\x18\a \x03(\tR\x04tags\x12\x14\n" +
+	"\x05color\x18\b \x01(\tR\x05color\x12\x18\n" +
+	"\acomment\x18\t \x01(\tR\acomment\x124\n" +
+	"\x06values\x18\n" +
+	" \x03(\v2\x1c.proxy.FlowQuery.ValuesEntryR\x06values\x12\x14\n" +
+	"\x05limit\x18\v \x01(\x05R\x05limit\x1a9\n" +
+	"\vValuesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xf4\x04\n" +
 	"\x06Config\x12\x17\n" +
 	"\adb_file\x18\x01 \x01(\tR\x06dbFile\x12\x1d\n" +
 	"\n" +
 	"print_logs\x18\x02 \x01(\bR\tprintLogs\x12\x19\n" +
 	"\bsave_dir\x18\x03 \x01(\tR\asaveDir\x12$\n" +
 	"\rscopeDomainRe\x18\x04 \x01(\tR\rscopeDomainRe\x128\n" +
-	"\x17scopeExcludedExtensions\x18\x05 \x03(\tR\x17scopeExcludedExtensions\"\x06\n" +
-	"\x04Null2\xd5\x03\n" +
+	"\x17scopeExcludedExtensions\x18\x05 \x03(\tR\x17scopeExcludedExtensions\x12\x18\n" +
+	"\aproject\x18\x06 \x01(\tR\aproject\x12#\n" +
+	"\rproject_notes\x18\a \x01(\tR\fprojectNotes\x12G\n" +
+	"\x13match_replace_rules\x18\b \x03(\v2\x17.proxy.MatchReplaceRuleR\x11matchReplaceRules\x12!\n" +
+	"\fpassive_scan\x18\t \x01(\bR\vpassiveScan\x12%\n" +
+	"\x0edetect_secrets\x18\n" +
+	" \x01(\bR\rdetectSecrets\x12%\n" +
+	"\x0eredact_secrets\x18\v \x01(\bR\rredactSecrets\x12*\n" +
+	"\x11secret_rules_file\x18\f \x01(\tR\x0fsecretRulesFile\x12*\n" +
+	"\x11authz_config_file\x18\r \x01(\tR\x0fauthzConfigFile\x12,\n" +
+	"\x12session_rules_file\x18\x0e \x01(\tR\x10sessionRulesFile\x128\n" +
+	"\x0fhook_priorities\x18\x0f \x03(\v2\x0f.proxy.HookInfoR\x0ehookPriorities\"\x8e\x01\n" +
+	"\x10MatchReplaceRule\x12\x16\n" +
+	"\x06target\x18\x01 \x01(\tR\x06target\x12\x14\n" +
+	"\x05match\x18\x02 \x01(\tR\x05match\x12\x18\n" +
+	"\areplace\x18\x03 \x01(\tR\areplace\x12\x18\n" +
+	"\acomment\x18\x04 \x01(\tR\acomment\x12\x18\n" +
+	"\aenabled\x18\x05 \x01(\bR\aenabled\"T\n" +
+	"\x11HostRetentionRule\x12\x17\n" +
+	"\ahost_re\x18\x01 \x01(\tR\x06hostRe\x12&\n" +
+	"\x0fmax_age_seconds\x18\x02 \x01(\x03R\rmaxAgeSeconds\"\xa5\x01\n" +
+	"\fPruneRequest\x12&\n" +
+	"\x0fmax_age_seconds\x18\x01 \x01(\x03R\rmaxAgeSeconds\x12\x19\n" +
+	"\bmax_rows\x18\x02 \x01(\x03R\amaxRows\x12\x19\n" +
+	"\bmax_size\x18\x03 \x01(\x03R\amaxSize\x127\n" +
+	"\n" +
+	"host_rules\x18\x04 \x03(\v2\x18.proxy.HostRetentionRuleR\thostRules\"r\n" +
+	"\vPruneResult\x12#\n" +
+	"\rdeleted_flows\x18\x01 \x01(\x03R\fdeletedFlows\x12\x1f\n" +
+	"\vsize_before\x18\x02 \x01(\x03R\n" +
+	"sizeBefore\x12\x1d\n" +
+	"\n" +
+	"size_after\x18\x03 \x01(\x03R\tsizeAfter\"\x06\n" +
+	"\x04Null\"\x88\x01\n" +
+	"\x12SendRequestMessage\x12\x1f\n" +
+	"\voriginal_id\x18\x01 \x01(\tR\n" +
+	"originalId\x12,\n" +
+	"\arequest\x18\x02 \x01(\v2\x12.proxy.HttpRequestR\arequest\x12#\n" +
+	"\rrun_pipelines\x18\x03 \x01(\bR\frunPipelines\"\x82\x01\n" +
+	"\x11SendRequestResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12,\n" +
+	"\arequest\x18\x02 \x01(\v2\x12.proxy.HttpRequestR\arequest\x12/\n" +
+	"\bresponse\x18\x03 \x01(\v2\x13.proxy.HttpResponseR\bresponse\"\x86\x01\n" +
+	"\n" +
+	"RawRequest\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x12\n" +
+	"\x04addr\x18\x02 \x01(\tR\x04addr\x12\x10\n" +
+	"\x03tls\x18\x03 \x01(\bR\x03tls\x12\x1f\n" +
+	"\vserver_name\x18\x04 \x01(\tR\n" +
+	"serverName\x12\x1d\n" +
+	"\n" +
+	"timeout_ms\x18\x05 \x01(\x03R\ttimeoutMs\"1\n" +
+	"\vRawResponse\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x12\n" +
+	"\x04data\x18\x02 \x01(\fR\x04data\"[\n" +
+	"\x0fFindingsRequest\x12%\n" +
+	"\x0einclude_stored\x18\x01 \x01(\bR\rincludeStored\x12!\n" +
+	"\fmin_severity\x18\x02 \x01(\tR\vminSeverity\"\x8f\x02\n" +
+	"\aFinding\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x17\n" +
+	"\aflow_id\x18\x02 \x01(\tR\x06flowId\x12\x16\n" +
+	"\x06source\x18\x03 \x01(\tR\x06source\x12\x12\n" +
+	"\x04type\x18\x04 \x01(\tR\x04type\x12\x1a\n" +
+	"\bseverity\x18\x05 \x01(\tR\bseverity\x12\x12\n" +
+	"\x04host\x18\x06 \x01(\tR\x04host\x12\x12\n" +
+	"\x04path\x18\a \x01(\tR\x04path\x12\x14\n" +
+	"\x05title\x18\b \x01(\tR\x05title\x12\x16\n" +
+	"\x06detail\x18\t \x01(\tR\x06detail\x12\x1a\n" +
+	"\bevidence\x18\n" +
+	" \x01(\tR\bevidence\x12!\n" +
+	"\ftimestamp_ms\x18\v \x01(\x03R\vtimestampMs\"\xcf\x01\n" +
+	"\x11ActiveScanRequest\x12\x17\n" +
+	"\afrom_id\x18\x01 \x01(\x04R\x06fromId\x12\x13\n" +
+	"\x05to_id\x18\x02 \x01(\x04R\x04toId\x12\x17\n" +
+	"\ahost_re\x18\x03 \x01(\tR\x06hostRe\x12\x15\n" +
+	"\x06url_re\x18\x04 \x01(\tR\x05urlRe\x12\x16\n" +
+	"\x06checks\x18\x05 \x03(\tR\x06checks\x12 \n" +
+	"\vconcurrency\x18\x06 \x01(\x05R\vconcurrency\x12\"\n" +
+	"\rtime_delay_ms\x18\a \x01(\x03R\vtimeDelayMs\"X\n" +
+	"\x0eSiteMapRequest\x12\x17\n" +
+	"\ahost_re\x18\x01 \x01(\tR\x06hostRe\x12\x15\n" +
+	"\x06url_re\x18\x02 \x01(\tR\x05urlRe\x12\x16\n" +
+	"\x06format\x18\x03 \x01(\tR\x06format\"K\n" +
+	"\aSiteMap\x12(\n" +
+	"\x05hosts\x18\x01 \x03(\v2\x12.proxy.SiteMapNodeR\x05hosts\x12\x16\n" +
+	"\x06export\x18\x02 \x01(\fR\x06export\"\xb5\x01\n" +
+	"\vSiteMapNode\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x12\n" +
+	"\x04path\x18\x02 \x01(\tR\x04path\x12\x18\n" +
+	"\aschemes\x18\x03 \x03(\tR\aschemes\x124\n" +
+	"\tendpoints\x18\x04 \x03(\v2\x16.proxy.SiteMapEndpointR\tendpoints\x12.\n" +
+	"\bchildren\x18\x05 \x03(\v2\x12.proxy.SiteMapNodeR\bchildren\"\xfa\x02\n" +
+	"\x0fSiteMapEndpoint\x12\x16\n" +
+	"\x06method\x18\x01 \x01(\tR\x06method\x12\x14\n" +
+	"\x05count\x18\x02 \x01(\x03R\x05count\x12J\n" +
+	"\fstatus_codes\x18\x03 \x03(\v2'.proxy.SiteMapEndpoint.StatusCodesEntryR\vstatusCodes\x12!\n" +
+	"\fquery_params\x18\x04 \x03(\tR\vqueryParams\x12\x1f\n" +
+	"\vbody_params\x18\x05 \x03(\tR\n" +
+	"bodyParams\x12#\n" +
+	"\rcontent_types\x18\x06 \x03(\tR\fcontentTypes\x12\"\n" +
+	"\rfirst_flow_id\x18\a \x01(\tR\vfirstFlowId\x12 \n" +
+	"\flast_flow_id\x18\b \x01(\tR\n" +
+	"lastFlowId\x1a>\n" +
+	"\x10StatusCodesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\x05R\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\x03R\x05value:\x028\x01\"z\n" +
+	"\vDiffRequest\x12\x15\n" +
+	"\x06old_id\x18\x01 \x01(\tR\x05oldId\x12\x15\n" +
+	"\x06new_id\x18\x02 \x01(\tR\x05newId\x12\x16\n" +
+	"\x06replay\x18\x03 \x01(\bR\x06replay\x12%\n" +
+	"\x0eignore_headers\x18\x04 \x03(\tR\rignoreHeaders\"\xf4\x02\n" +
+	"\bFlowDiff\x12\x15\n" +
+	"\x06old_id\x18\x01 \x01(\tR\x05oldId\x12\x15\n" +
+	"\x06new_id\x18\x02 \x01(\tR\x05newId\x12\x1d\n" +
+	"\n" +
+	"old_status\x18\x03 \x01(\x05R\toldStatus\x12\x1d\n" +
+	"\n" +
+	"new_status\x18\x04 \x01(\x05R\tnewStatus\x12+\n" +
+	"\aheaders\x18\x05 \x03(\v2\x11.proxy.HeaderDiffR\aheaders\x12\x1b\n" +
+	"\tbody_kind\x18\x06 \x01(\tR\bbodyKind\x12!\n" +
+	"\fbody_changed\x18\a \x01(\bR\vbodyChanged\x12\x19\n" +
+	"\bold_size\x18\b \x01(\x03R\aoldSize\x12\x19\n" +
+	"\bnew_size\x18\t \x01(\x03R\anewSize\x12%\n" +
+	"\x05lines\x18\n" +
+	" \x03(\v2\x0f.proxy.LineDiffR\x05lines\x122\n" +
+	"\fjson_changes\x18\v \x03(\v2\x0f.proxy.JSONDiffR\vjsonChanges\"T\n" +
+	"\n" +
+	"HeaderDiff\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x0e\n" +
+	"\x02op\x18\x02 \x01(\tR\x02op\x12\x10\n" +
+	"\x03old\x18\x03 \x03(\tR\x03old\x12\x10\n" +
+	"\x03new\x18\x04 \x03(\tR\x03new\"d\n" +
+	"\bLineDiff\x12\x0e\n" +
+	"\x02op\x18\x01 \x01(\tR\x02op\x12\x19\n" +
+	"\bold_line\x18\x02 \x01(\x05R\aoldLine\x12\x19\n" +
+	"\bnew_line\x18\x03 \x01(\x05R\anewLine\x12\x12\n" +
+	"\x04text\x18\x04 \x01(\tR\x04text\"R\n" +
+	"\bJSONDiff\x12\x12\n" +
+	"\x04path\x18\x01 \x01(\tR\x04path\x12\x0e\n" +
+	"\x02op\x18\x02 \x01(\tR\x02op\x12\x10\n" +
+	"\x03old\x18\x03 \x01(\tR\x03old\x12\x10\n" +
+	"\x03new\x18\x04 \x01(\tR\x03new2\xe5\b\n" +
 	"\fProxyService\x124\n" +
 	"\tRequestIn\x12\x0f.proxy.Register\x1a\x12.proxy.HttpRequest\"\x000\x01\x12F\n" +
 	"\n" +
@@ -586,9 +3444,23 @@ const file_proxy_proto_rawDesc = "" +
 	"\n" +
 	"ResponseIn\x12\x0f.proxy.Register\x1a\x13.proxy.HttpResponse\"\x000\x01\x12I\n" +
 	"\vResponseMod\x12\x1f.proxy.ResponseModClientMessage\x1a\x13.proxy.HttpResponse\"\x00(\x010\x01\x127\n" +
-	"\vResponseOut\x12\x0f.proxy.Register\x1a\x13.proxy.HttpResponse\"\x000\x01\x12)\n" +
+	"\vResponseOut\x12\x0f.proxy.Register\x1a\x13.proxy.HttpResponse\"\x000\x01\x12+\n" +
+	"\aFlowOut\x12\x0f.proxy.Register\x1a\v.proxy.Flow\"\x000\x01\x12)\n" +
 	"\tSetConfig\x12\r.proxy.Config\x1a\v.proxy.Null\"\x00\x12)\n" +
-	"\tGetConfig\x12\v.proxy.Null\x1a\r.proxy.Config\"\x00B6Z4github.com/artilugio0/efin-proxy/internal/grpc/protob\x06proto3"
+	"\tGetConfig\x12\v.proxy.Null\x1a\r.proxy.Config\"\x00\x129\n" +
+	"\fPruneHistory\x12\x13.proxy.PruneRequest\x1a\x12.proxy.PruneResult\"\x00\x12+\n" +
+	"\rVacuumHistory\x12\v.proxy.Null\x1a\v.proxy.Null\"\x00\x12D\n" +
+	"\vSendRequest\x12\x19.proxy.SendRequestMessage\x1a\x18.proxy.SendRequestResult\"\x00\x129\n" +
+	"\x0eSendRawRequest\x12\x11.proxy.RawRequest\x1a\x12.proxy.RawResponse\"\x00\x126\n" +
+	"\bFindings\x12\x16.proxy.FindingsRequest\x1a\x0e.proxy.Finding\"\x000\x01\x125\n" +
+	"\n" +
+	"GetSiteMap\x12\x15.proxy.SiteMapRequest\x1a\x0e.proxy.SiteMap\"\x00\x12:\n" +
+	"\n" +
+	"ActiveScan\x12\x18.proxy.ActiveScanRequest\x1a\x0e.proxy.Finding\"\x000\x01\x122\n" +
+	"\tDiffFlows\x12\x12.proxy.DiffRequest\x1a\x0f.proxy.FlowDiff\"\x00\x12-\n" +
+	"\tListHooks\x12\v.proxy.Null\x1a\x11.proxy.HookChains\"\x00\x128\n" +
+	"\bAnnotate\x12\x16.proxy.AnnotateRequest\x1a\x12.proxy.Annotations\"\x00\x120\n" +
+	"\vSearchFlows\x12\x10.proxy.FlowQuery\x1a\v.proxy.Flow\"\x000\x01B6Z4github.com/artilugio0/efin-proxy/internal/grpc/protob\x06proto3"
 
 var (
 	file_proxy_proto_rawDescOnce sync.Once
@@ -602,45 +3474,138 @@ func file_proxy_proto_rawDescGZIP() []byte {
 	return file_proxy_proto_rawDescData
 }
 
-var file_proxy_proto_msgTypes = make([]protoimpl.MessageInfo, 8)
+var file_proxy_proto_msgTypes = make([]protoimpl.MessageInfo, 41)
 var file_proxy_proto_goTypes = []any{
 	(*Header)(nil),                   // 0: proxy.Header
 	(*RequestModClientMessage)(nil),  // 1: proxy.RequestModClientMessage
 	(*ResponseModClientMessage)(nil), // 2: proxy.ResponseModClientMessage
 	(*Register)(nil),                 // 3: proxy.Register
-	(*HttpRequest)(nil),              // 4: proxy.HttpRequest
-	(*HttpResponse)(nil),             // 5: proxy.HttpResponse
-	(*Config)(nil),                   // 6: proxy.Config
-	(*Null)(nil),                     // 7: proxy.Null
+	(*HookFilter)(nil),               // 4: proxy.HookFilter
+	(*HookInfo)(nil),                 // 5: proxy.HookInfo
+	(*PipelineStats)(nil),            // 6: proxy.PipelineStats
+	(*HookChains)(nil),               // 7: proxy.HookChains
+	(*HttpRequest)(nil),              // 8: proxy.HttpRequest
+	(*HttpResponse)(nil),             // 9: proxy.HttpResponse
+	(*FlowMeta)(nil),                 // 10: proxy.FlowMeta
+	(*Flow)(nil),                     // 11: proxy.Flow
+	(*Annotations)(nil),              // 12: proxy.Annotations
+	(*AnnotateRequest)(nil),          // 13: proxy.AnnotateRequest
+	(*FlowQuery)(nil),                // 14: proxy.FlowQuery
+	(*Config)(nil),                   // 15: proxy.Config
+	(*MatchReplaceRule)(nil),         // 16: proxy.MatchReplaceRule
+	(*HostRetentionRule)(nil),        // 17: proxy.HostRetentionRule
+	(*PruneRequest)(nil),             // 18: proxy.PruneRequest
+	(*PruneResult)(nil),              // 19: proxy.PruneResult
+	(*Null)(nil),                     // 20: proxy.Null
+	(*SendRequestMessage)(nil),       // 21: proxy.SendRequestMessage
+	(*SendRequestResult)(nil),        // 22: proxy.SendRequestResult
+	(*RawRequest)(nil),               // 23: proxy.RawRequest
+	(*RawResponse)(nil),              // 24: proxy.RawResponse
+	(*FindingsRequest)(nil),          // 25: proxy.FindingsRequest
+	(*Finding)(nil),                  // 26: proxy.Finding
+	(*ActiveScanRequest)(nil),        // 27: proxy.ActiveScanRequest
+	(*SiteMapRequest)(nil),           // 28: proxy.SiteMapRequest
+	(*SiteMap)(nil),                  // 29: proxy.SiteMap
+	(*SiteMapNode)(nil),              // 30: proxy.SiteMapNode
+	(*SiteMapEndpoint)(nil),          // 31: proxy.SiteMapEndpoint
+	(*DiffRequest)(nil),              // 32: proxy.DiffRequest
+	(*FlowDiff)(nil),                 // 33: proxy.FlowDiff
+	(*HeaderDiff)(nil),               // 34: proxy.HeaderDiff
+	(*LineDiff)(nil),                 // 35: proxy.LineDiff
+	(*JSONDiff)(nil),                 // 36: proxy.JSONDiff
+	nil,                              // 37: proxy.Annotations.ValuesEntry
+	nil,                              // 38: proxy.AnnotateRequest.SetValuesEntry
+	nil,                              // 39: proxy.FlowQuery.ValuesEntry
+	nil,                              // 40: proxy.SiteMapEndpoint.StatusCodesEntry
 }
 var file_proxy_proto_depIdxs = []int32{
 	3,  // 0: proxy.RequestModClientMessage.register:type_name -> proxy.Register
-	4,  // 1: proxy.RequestModClientMessage.modifiedRequest:type_name -> proxy.HttpRequest
+	8,  // 1: proxy.RequestModClientMessage.modifiedRequest:type_name -> proxy.HttpRequest
 	3,  // 2: proxy.ResponseModClientMessage.register:type_name -> proxy.Register
-	5,  // 3: proxy.ResponseModClientMessage.modifiedResponse:type_name -> proxy.HttpResponse
-	0,  // 4: proxy.HttpRequest.headers:type_name -> proxy.Header
-	0,  // 5: proxy.HttpResponse.headers:type_name -> proxy.Header
-	3,  // 6: proxy.ProxyService.RequestIn:input_type -> proxy.Register
-	1,  // 7: proxy.ProxyService.RequestMod:input_type -> proxy.RequestModClientMessage
-	3,  // 8: proxy.ProxyService.RequestOut:input_type -> proxy.Register
-	3,  // 9: proxy.ProxyService.ResponseIn:input_type -> proxy.Register
-	2,  // 10: proxy.ProxyService.ResponseMod:input_type -> proxy.ResponseModClientMessage
-	3,  // 11: proxy.ProxyService.ResponseOut:input_type -> proxy.Register
-	6,  // 12: proxy.ProxyService.SetConfig:input_type -> proxy.Config
-	7,  // 13: proxy.ProxyService.GetConfig:input_type -> proxy.Null
-	4,  // 14: proxy.ProxyService.RequestIn:output_type -> proxy.HttpRequest
-	4,  // 15: proxy.ProxyService.RequestMod:output_type -> proxy.HttpRequest
-	4,  // 16: proxy.ProxyService.RequestOut:output_type -> proxy.HttpRequest
-	5,  // 17: proxy.ProxyService.ResponseIn:output_type -> proxy.HttpResponse
-	5,  // 18: proxy.ProxyService.ResponseMod:output_type -> proxy.HttpResponse
-	5,  // 19: proxy.ProxyService.ResponseOut:output_type -> proxy.HttpResponse
-	7,  // 20: proxy.ProxyService.SetConfig:output_type -> proxy.Null
-	6,  // 21: proxy.ProxyService.GetConfig:output_type -> proxy.Config
-	14, // [14:22] is the sub-list for method output_type
-	6,  // [6:14] is the sub-list for method input_type
-	6,  // [6:6] is the sub-list for extension type_name
-	6,  // [6:6] is the sub-list for extension extendee
-	0,  // [0:6] is the sub-list for field type_name
+	9,  // 3: proxy.ResponseModClientMessage.modifiedResponse:type_name -> proxy.HttpResponse
+	4,  // 4: proxy.Register.filter:type_name -> proxy.HookFilter
+	5,  // 5: proxy.HookChains.request_in:type_name -> proxy.HookInfo
+	5,  // 6: proxy.HookChains.request_mod:type_name -> proxy.HookInfo
+	5,  // 7: proxy.HookChains.request_out:type_name -> proxy.HookInfo
+	5,  // 8: proxy.HookChains.response_in:type_name -> proxy.HookInfo
+	5,  // 9: proxy.HookChains.response_mod:type_name -> proxy.HookInfo
+	5,  // 10: proxy.HookChains.response_out:type_name -> proxy.HookInfo
+	5,  // 11: proxy.HookChains.flow_out:type_name -> proxy.HookInfo
+	6,  // 12: proxy.HookChains.pipelines:type_name -> proxy.PipelineStats
+	5,  // 13: proxy.HookChains.response_log:type_name -> proxy.HookInfo
+	0,  // 14: proxy.HttpRequest.headers:type_name -> proxy.Header
+	10, // 15: proxy.HttpRequest.meta:type_name -> proxy.FlowMeta
+	12, // 16: proxy.HttpRequest.annotations:type_name -> proxy.Annotations
+	0,  // 17: proxy.HttpResponse.headers:type_name -> proxy.Header
+	10, // 18: proxy.HttpResponse.meta:type_name -> proxy.FlowMeta
+	12, // 19: proxy.HttpResponse.annotations:type_name -> proxy.Annotations
+	8,  // 20: proxy.Flow.original_request:type_name -> proxy.HttpRequest
+	8,  // 21: proxy.Flow.request:type_name -> proxy.HttpRequest
+	9,  // 22: proxy.Flow.original_response:type_name -> proxy.HttpResponse
+	9,  // 23: proxy.Flow.response:type_name -> proxy.HttpResponse
+	10, // 24: proxy.Flow.meta:type_name -> proxy.FlowMeta
+	12, // 25: proxy.Flow.annotations:type_name -> proxy.Annotations
+	37, // 26: proxy.Annotations.values:type_name -> proxy.Annotations.ValuesEntry
+	38, // 27: proxy.AnnotateRequest.set_values:type_name -> proxy.AnnotateRequest.SetValuesEntry
+	39, // 28: proxy.FlowQuery.values:type_name -> proxy.FlowQuery.ValuesEntry
+	16, // 29: proxy.Config.match_replace_rules:type_name -> proxy.MatchReplaceRule
+	5,  // 30: proxy.Config.hook_priorities:type_name -> proxy.HookInfo
+	17, // 31: proxy.PruneRequest.host_rules:type_name -> proxy.HostRetentionRule
+	8,  // 32: proxy.SendRequestMessage.request:type_name -> proxy.HttpRequest
+	8,  // 33: proxy.SendRequestResult.request:type_name -> proxy.HttpRequest
+	9,  // 34: proxy.SendRequestResult.response:type_name -> proxy.HttpResponse
+	30, // 35: proxy.SiteMap.hosts:type_name -> proxy.SiteMapNode
+	31, // 36: proxy.SiteMapNode.endpoints:type_name -> proxy.SiteMapEndpoint
+	30, // 37: proxy.SiteMapNode.children:type_name -> proxy.SiteMapNode
+	40, // 38: proxy.SiteMapEndpoint.status_codes:type_name -> proxy.SiteMapEndpoint.StatusCodesEntry
+	34, // 39: proxy.FlowDiff.headers:type_name -> proxy.HeaderDiff
+	35, // 40: proxy.FlowDiff.lines:type_name -> proxy.LineDiff
+	36, // 41: proxy.FlowDiff.json_changes:type_name -> proxy.JSONDiff
+	3,  // 42: proxy.ProxyService.RequestIn:input_type -> proxy.Register
+	1,  // 43: proxy.ProxyService.RequestMod:input_type -> proxy.RequestModClientMessage
+	3,  // 44: proxy.ProxyService.RequestOut:input_type -> proxy.Register
+	3,  // 45: proxy.ProxyService.ResponseIn:input_type -> proxy.Register
+	2,  // 46: proxy.ProxyService.ResponseMod:input_type -> proxy.ResponseModClientMessage
+	3,  // 47: proxy.ProxyService.ResponseOut:input_type -> proxy.Register
+	3,  // 48: proxy.ProxyService.FlowOut:input_type -> proxy.Register
+	15, // 49: proxy.ProxyService.SetConfig:input_type -> proxy.Config
+	20, // 50: proxy.ProxyService.GetConfig:input_type -> proxy.Null
+	18, // 51: proxy.ProxyService.PruneHistory:input_type -> proxy.PruneRequest
+	20, // 52: proxy.ProxyService.VacuumHistory:input_type -> proxy.Null
+	21, // 53: proxy.ProxyService.SendRequest:input_type -> proxy.SendRequestMessage
+	23, // 54: proxy.ProxyService.SendRawRequest:input_type -> proxy.RawRequest
+	25, // 55: proxy.ProxyService.Findings:input_type -> proxy.FindingsRequest
+	28, // 56: proxy.ProxyService.GetSiteMap:input_type -> proxy.SiteMapRequest
+	27, // 57: proxy.ProxyService.ActiveScan:input_type -> proxy.ActiveScanRequest
+	32, // 58: proxy.ProxyService.DiffFlows:input_type -> proxy.DiffRequest
+	20, // 59: proxy.ProxyService.ListHooks:input_type -> proxy.Null
+	13, // 60: proxy.ProxyService.Annotate:input_type -> proxy.AnnotateRequest
+	14, // 61: proxy.ProxyService.SearchFlows:input_type -> proxy.FlowQuery
+	8,  // 62: proxy.ProxyService.RequestIn:output_type -> proxy.HttpRequest
+	8,  // 63: proxy.ProxyService.RequestMod:output_type -> proxy.HttpRequest
+	8,  // 64: proxy.ProxyService.RequestOut:output_type -> proxy.HttpRequest
+	9,  // 65: proxy.ProxyService.ResponseIn:output_type -> proxy.HttpResponse
+	9,  // 66: proxy.ProxyService.ResponseMod:output_type -> proxy.HttpResponse
+	9,  // 67: proxy.ProxyService.ResponseOut:output_type -> proxy.HttpResponse
+	11, // 68: proxy.ProxyService.FlowOut:output_type -> proxy.Flow
+	20, // 69: proxy.ProxyService.SetConfig:output_type -> proxy.Null
+	15, // 70: proxy.ProxyService.GetConfig:output_type -> proxy.Config
+	19, // 71: proxy.ProxyService.PruneHistory:output_type -> proxy.PruneResult
+	20, // 72: proxy.ProxyService.VacuumHistory:output_type -> proxy.Null
+	22, // 73: proxy.ProxyService.SendRequest:output_type -> proxy.SendRequestResult
+	24, // 74: proxy.ProxyService.SendRawRequest:output_type -> proxy.RawResponse
+	26, // 75: proxy.ProxyService.Findings:output_type -> proxy.Finding
+	29, // 76: proxy.ProxyService.GetSiteMap:output_type -> proxy.SiteMap
+	26, // 77: proxy.ProxyService.ActiveScan:output_type -> proxy.Finding
+	33, // 78: proxy.ProxyService.DiffFlows:output_type -> proxy.FlowDiff
+	7,  // 79: proxy.ProxyService.ListHooks:output_type -> proxy.HookChains
+	12, // 80: proxy.ProxyService.Annotate:output_type -> proxy.Annotations
+	11, // 81: proxy.ProxyService.SearchFlows:output_type -> proxy.Flow
+	62, // [62:82] is the sub-list for method output_type
+	42, // [42:62] is the sub-list for method input_type
+	42, // [42:42] is the sub-list for extension type_name
+	42, // [42:42] is the sub-list for extension extendee
+	0,  // [0:42] is the sub-list for field type_name
 }
 
 func init() { file_proxy_proto_init() }
@@ -656,13 +3621,14 @@ func file_proxy_proto_init() {
 		(*ResponseModClientMessage_Register)(nil),
 		(*ResponseModClientMessage_ModifiedResponse)(nil),
 	}
+	file_proxy_proto_msgTypes[3].OneofWrappers = []any{}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proxy_proto_rawDesc), len(file_proxy_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   8,
+			NumMessages:   41,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,14 +19,26 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	ProxyService_RequestIn_FullMethodName   = "/proxy.ProxyService/RequestIn"
-	ProxyService_RequestMod_FullMethodName  = "/proxy.ProxyService/RequestMod"
-	ProxyService_RequestOut_FullMethodName  = "/proxy.ProxyService/RequestOut"
-	ProxyService_ResponseIn_FullMethodName  = "/proxy.ProxyService/ResponseIn"
-	ProxyService_ResponseMod_FullMethodName = "/proxy.ProxyService/ResponseMod"
-	ProxyService_ResponseOut_FullMethodName = "/proxy.ProxyService/ResponseOut"
-	ProxyService_SetConfig_FullMethodName   = "/proxy.ProxyService/SetConfig"
-	ProxyService_GetConfig_FullMethodName   = "/proxy.ProxyService/GetConfig"
+	ProxyService_RequestIn_FullMethodName      = "/proxy.ProxyService/RequestIn"
+	ProxyService_RequestMod_FullMethodName     = "/proxy.ProxyService/RequestMod"
+	ProxyService_RequestOut_FullMethodName     = "/proxy.ProxyService/RequestOut"
+	ProxyService_ResponseIn_FullMethodName     = "/proxy.ProxyService/ResponseIn"
+	ProxyService_ResponseMod_FullMethodName    = "/proxy.ProxyService/ResponseMod"
+	ProxyService_ResponseOut_FullMethodName    = "/proxy.ProxyService/ResponseOut"
+	ProxyService_FlowOut_FullMethodName        = "/proxy.ProxyService/FlowOut"
+	ProxyService_SetConfig_FullMethodName      = "/proxy.ProxyService/SetConfig"
+	ProxyService_GetConfig_FullMethodName      = "/proxy.ProxyService/GetConfig"
+	ProxyService_PruneHistory_FullMethodName   = "/proxy.ProxyService/PruneHistory"
+	ProxyService_VacuumHistory_FullMethodName  = "/proxy.ProxyService/VacuumHistory"
+	ProxyService_SendRequest_FullMethodName    = "/proxy.ProxyService/SendRequest"
+	ProxyService_SendRawRequest_FullMethodName = "/proxy.ProxyService/SendRawRequest"
+	ProxyService_Findings_FullMethodName       = "/proxy.ProxyService/Findings"
+	ProxyService_GetSiteMap_FullMethodName     = "/proxy.ProxyService/GetSiteMap"
+	ProxyService_ActiveScan_FullMethodName     = "/proxy.ProxyService/ActiveScan"
+	ProxyService_DiffFlows_FullMethodName      = "/proxy.ProxyService/DiffFlows"
+	ProxyService_ListHooks_FullMethodName      = "/proxy.ProxyService/ListHooks"
+	ProxyService_Annotate_FullMethodName       = "/proxy.ProxyService/Annotate"
+	ProxyService_SearchFlows_FullMethodName    = "/proxy.ProxyService/SearchFlows"
 )
 
 // ProxyServiceClient is the client API for ProxyService service.
@@ -41,8 +53,20 @@ type ProxyServiceClient interface {
 	ResponseIn(ctx context.Context, in *Register, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HttpResponse], error)
 	ResponseMod(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[ResponseModClientMessage, HttpResponse], error)
 	ResponseOut(ctx context.Context, in *Register, opts ...grpc.CallOption) (grpc.ServerStreamingClient[HttpResponse], error)
+	FlowOut(ctx context.Context, in *Register, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Flow], error)
 	SetConfig(ctx context.Context, in *Config, opts ...grpc.CallOption) (*Null, error)
 	GetConfig(ctx context.Context, in *Null, opts ...grpc.CallOption) (*Config, error)
+	PruneHistory(ctx context.Context, in *PruneRequest, opts ...grpc.CallOption) (*PruneResult, error)
+	VacuumHistory(ctx context.Context, in *Null, opts ...grpc.CallOption) (*Null, error)
+	SendRequest(ctx context.Context, in *SendRequestMessage, opts ...grpc.CallOption) (*SendRequestResult, error)
+	SendRawRequest(ctx context.Context, in *RawRequest, opts ...grpc.CallOption) (*RawResponse, error)
+	Findings(ctx context.Context, in *FindingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Finding], error)
+	GetSiteMap(ctx context.Context, in *SiteMapRequest, opts ...grpc.CallOption) (*SiteMap, error)
+	ActiveScan(ctx context.Context, in *ActiveScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Finding], error)
+	DiffFlows(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*FlowDiff, error)
+	ListHooks(ctx context.Context, in *Null, opts ...grpc.CallOption) (*HookChains, error)
+	Annotate(ctx context.Context, in *AnnotateRequest, opts ...grpc.CallOption) (*Annotations, error)
+	SearchFlows(ctx context.Context, in *FlowQuery, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Flow], error)
 }
 
 type proxyServiceClient struct {
@@ -155,6 +179,25 @@ func (c *proxyServiceClient) ResponseOut(ctx context.Context, in *Register, opts
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ProxyService_ResponseOutClient = grpc.ServerStreamingClient[HttpResponse]
 
+func (c *proxyServiceClient) FlowOut(ctx context.Context, in *Register, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Flow], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProxyService_ServiceDesc.Streams[6], ProxyService_FlowOut_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Register, Flow]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_FlowOutClient = grpc.ServerStreamingClient[Flow]
+
 func (c *proxyServiceClient) SetConfig(ctx context.Context, in *Config, opts ...grpc.CallOption) (*Null, error) {
 	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
 	out := new(Null)
@@ -175,6 +218,143 @@ func (c *proxyServiceClient) GetConfig(ctx context.Context, in *Null, opts ...gr
 	return out, nil
 }
 
+func (c *proxyServiceClient) PruneHistory(ctx context.Context, in *PruneRequest, opts ...grpc.CallOption) (*PruneResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PruneResult)
+	err := c.cc.Invoke(ctx, ProxyService_PruneHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) VacuumHistory(ctx context.Context, in *Null, opts ...grpc.CallOption) (*Null, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Null)
+	err := c.cc.Invoke(ctx, ProxyService_VacuumHistory_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) SendRequest(ctx context.Context, in *SendRequestMessage, opts ...grpc.CallOption) (*SendRequestResult, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SendRequestResult)
+	err := c.cc.Invoke(ctx, ProxyService_SendRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) SendRawRequest(ctx context.Context, in *RawRequest, opts ...grpc.CallOption) (*RawResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(RawResponse)
+	err := c.cc.Invoke(ctx, ProxyService_SendRawRequest_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) Findings(ctx context.Context, in *FindingsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Finding], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProxyService_ServiceDesc.Streams[7], ProxyService_Findings_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FindingsRequest, Finding]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_FindingsClient = grpc.ServerStreamingClient[Finding]
+
+func (c *proxyServiceClient) GetSiteMap(ctx context.Context, in *SiteMapRequest, opts ...grpc.CallOption) (*SiteMap, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(SiteMap)
+	err := c.cc.Invoke(ctx, ProxyService_GetSiteMap_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) ActiveScan(ctx context.Context, in *ActiveScanRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Finding], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProxyService_ServiceDesc.Streams[8], ProxyService_ActiveScan_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[ActiveScanRequest, Finding]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_ActiveScanClient = grpc.ServerStreamingClient[Finding]
+
+func (c *proxyServiceClient) DiffFlows(ctx context.Context, in *DiffRequest, opts ...grpc.CallOption) (*FlowDiff, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FlowDiff)
+	err := c.cc.Invoke(ctx, ProxyService_DiffFlows_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) ListHooks(ctx context.Context, in *Null, opts ...grpc.CallOption) (*HookChains, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(HookChains)
+	err := c.cc.Invoke(ctx, ProxyService_ListHooks_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) Annotate(ctx context.Context, in *AnnotateRequest, opts ...grpc.CallOption) (*Annotations, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Annotations)
+	err := c.cc.Invoke(ctx, ProxyService_Annotate_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *proxyServiceClient) SearchFlows(ctx context.Context, in *FlowQuery, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Flow], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ProxyService_ServiceDesc.Streams[9], ProxyService_SearchFlows_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[FlowQuery, Flow]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_SearchFlowsClient = grpc.ServerStreamingClient[Flow]
+
 // ProxyServiceServer is the server API for ProxyService service.
 // All implementations must embed UnimplementedProxyServiceServer
 // for forward compatibility.
@@ -187,8 +367,20 @@ type ProxyServiceServer interface {
 	ResponseIn(*Register, grpc.ServerStreamingServer[HttpResponse]) error
 	ResponseMod(grpc.BidiStreamingServer[ResponseModClientMessage, HttpResponse]) error
 	ResponseOut(*Register, grpc.ServerStreamingServer[HttpResponse]) error
+	FlowOut(*Register, grpc.ServerStreamingServer[Flow]) error
 	SetConfig(context.Context, *Config) (*Null, error)
 	GetConfig(context.Context, *Null) (*Config, error)
+	PruneHistory(context.Context, *PruneRequest) (*PruneResult, error)
+	VacuumHistory(context.Context, *Null) (*Null, error)
+	SendRequest(context.Context, *SendRequestMessage) (*SendRequestResult, error)
+	SendRawRequest(context.Context, *RawRequest) (*RawResponse, error)
+	Findings(*FindingsRequest, grpc.ServerStreamingServer[Finding]) error
+	GetSiteMap(context.Context, *SiteMapRequest) (*SiteMap, error)
+	ActiveScan(*ActiveScanRequest, grpc.ServerStreamingServer[Finding]) error
+	DiffFlows(context.Context, *DiffRequest) (*FlowDiff, error)
+	ListHooks(context.Context, *Null) (*HookChains, error)
+	Annotate(context.Context, *AnnotateRequest) (*Annotations, error)
+	SearchFlows(*FlowQuery, grpc.ServerStreamingServer[Flow]) error
 	mustEmbedUnimplementedProxyServiceServer()
 }
 
@@ -217,12 +409,48 @@ func (UnimplementedProxyServiceServer) ResponseMod(grpc.BidiStreamingServer[Resp
 func (UnimplementedProxyServiceServer) ResponseOut(*Register, grpc.ServerStreamingServer[HttpResponse]) error {
 	return status.Errorf(codes.Unimplemented, "method ResponseOut not implemented")
 }
+func (UnimplementedProxyServiceServer) FlowOut(*Register, grpc.ServerStreamingServer[Flow]) error {
+	return status.Errorf(codes.Unimplemented, "method FlowOut not implemented")
+}
 func (UnimplementedProxyServiceServer) SetConfig(context.Context, *Config) (*Null, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SetConfig not implemented")
 }
 func (UnimplementedProxyServiceServer) GetConfig(context.Context, *Null) (*Config, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method GetConfig not implemented")
 }
+func (UnimplementedProxyServiceServer) PruneHistory(context.Context, *PruneRequest) (*PruneResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method PruneHistory not implemented")
+}
+func (UnimplementedProxyServiceServer) VacuumHistory(context.Context, *Null) (*Null, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method VacuumHistory not implemented")
+}
+func (UnimplementedProxyServiceServer) SendRequest(context.Context, *SendRequestMessage) (*SendRequestResult, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendRequest not implemented")
+}
+func (UnimplementedProxyServiceServer) SendRawRequest(context.Context, *RawRequest) (*RawResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SendRawRequest not implemented")
+}
+func (UnimplementedProxyServiceServer) Findings(*FindingsRequest, grpc.ServerStreamingServer[Finding]) error {
+	return status.Errorf(codes.Unimplemented, "method Findings not implemented")
+}
+func (UnimplementedProxyServiceServer) GetSiteMap(context.Context, *SiteMapRequest) (*SiteMap, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetSiteMap not implemented")
+}
+func (UnimplementedProxyServiceServer) ActiveScan(*ActiveScanRequest, grpc.ServerStreamingServer[Finding]) error {
+	return status.Errorf(codes.Unimplemented, "method ActiveScan not implemented")
+}
+func (UnimplementedProxyServiceServer) DiffFlows(context.Context, *DiffRequest) (*FlowDiff, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DiffFlows not implemented")
+}
+func (UnimplementedProxyServiceServer) ListHooks(context.Context, *Null) (*HookChains, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListHooks not implemented")
+}
+func (UnimplementedProxyServiceServer) Annotate(context.Context, *AnnotateRequest) (*Annotations, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Annotate not implemented")
+}
+func (UnimplementedProxyServiceServer) SearchFlows(*FlowQuery, grpc.ServerStreamingServer[Flow]) error {
+	return status.Errorf(codes.Unimplemented, "method SearchFlows not implemented")
+}
 func (UnimplementedProxyServiceServer) mustEmbedUnimplementedProxyServiceServer() {}
 func (UnimplementedProxyServiceServer) testEmbeddedByValue()                      {}
 
@@ -302,6 +530,17 @@ func _ProxyService_ResponseOut_Handler(srv interface{}, stream grpc.ServerStream
 // This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
 type ProxyService_ResponseOutServer = grpc.ServerStreamingServer[HttpResponse]
 
+func _ProxyService_FlowOut_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(Register)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProxyServiceServer).FlowOut(m, &grpc.GenericServerStream[Register, Flow]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_FlowOutServer = grpc.ServerStreamingServer[Flow]
+
 func _ProxyService_SetConfig_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
 	in := new(Config)
 	if err := dec(in); err != nil {
@@ -338,6 +577,183 @@ func _ProxyService_GetConfig_Handler(srv interface{}, ctx context.Context, dec f
 	return interceptor(ctx, in, info, handler)
 }
 
+func _ProxyService_PruneHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PruneRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).PruneHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_PruneHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).PruneHistory(ctx, req.(*PruneRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_VacuumHistory_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Null)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).VacuumHistory(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_VacuumHistory_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).VacuumHistory(ctx, req.(*Null))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_SendRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SendRequestMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).SendRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_SendRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).SendRequest(ctx, req.(*SendRequestMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_SendRawRequest_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RawRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).SendRawRequest(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_SendRawRequest_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).SendRawRequest(ctx, req.(*RawRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_Findings_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FindingsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProxyServiceServer).Findings(m, &grpc.GenericServerStream[FindingsRequest, Finding]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_FindingsServer = grpc.ServerStreamingServer[Finding]
+
+func _ProxyService_GetSiteMap_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SiteMapRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).GetSiteMap(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_GetSiteMap_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).GetSiteMap(ctx, req.(*SiteMapRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_ActiveScan_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(ActiveScanRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProxyServiceServer).ActiveScan(m, &grpc.GenericServerStream[ActiveScanRequest, Finding]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_ActiveScanServer = grpc.ServerStreamingServer[Finding]
+
+func _ProxyService_DiffFlows_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiffRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).DiffFlows(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_DiffFlows_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).DiffFlows(ctx, req.(*DiffRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_ListHooks_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(Null)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).ListHooks(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_ListHooks_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).ListHooks(ctx, req.(*Null))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_Annotate_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(AnnotateRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ProxyServiceServer).Annotate(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ProxyService_Annotate_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ProxyServiceServer).Annotate(ctx, req.(*AnnotateRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ProxyService_SearchFlows_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(FlowQuery)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ProxyServiceServer).SearchFlows(m, &grpc.GenericServerStream[FlowQuery, Flow]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ProxyService_SearchFlowsServer = grpc.ServerStreamingServer[Flow]
+
 // ProxyService_ServiceDesc is the grpc.ServiceDesc for ProxyService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -353,6 +769,38 @@ var ProxyService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "GetConfig",
 			Handler:    _ProxyService_GetConfig_Handler,
 		},
+		{
+			MethodName: "PruneHistory",
+			Handler:    _ProxyService_PruneHistory_Handler,
+		},
+		{
+			MethodName: "VacuumHistory",
+			Handler:    _ProxyService_VacuumHistory_Handler,
+		},
+		{
+			MethodName: "SendRequest",
+			Handler:    _ProxyService_SendRequest_Handler,
+		},
+		{
+			MethodName: "SendRawRequest",
+			Handler:    _ProxyService_SendRawRequest_Handler,
+		},
+		{
+			MethodName: "GetSiteMap",
+			Handler:    _ProxyService_GetSiteMap_Handler,
+		},
+		{
+			MethodName: "DiffFlows",
+			Handler:    _ProxyService_DiffFlows_Handler,
+		},
+		{
+			MethodName: "ListHooks",
+			Handler:    _ProxyService_ListHooks_Handler,
+		},
+		{
+			MethodName: "Annotate",
+			Handler:    _ProxyService_Annotate_Handler,
+		},
 	},
 	Streams: []grpc.StreamDesc{
 		{
@@ -387,6 +835,26 @@ var ProxyService_ServiceDesc = grpc.ServiceDesc{
 			Handler:       _ProxyService_ResponseOut_Handler,
 			ServerStreams: true,
 		},
+		{
+			StreamName:    "FlowOut",
+			Handler:       _ProxyService_FlowOut_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Findings",
+			Handler:       _ProxyService_Findings_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ActiveScan",
+			Handler:       _ProxyService_ActiveScan_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "SearchFlows",
+			Handler:       _ProxyService_SearchFlows_Handler,
+			ServerStreams: true,
+		},
 	},
 	Metadata: "proxy.proto",
 }
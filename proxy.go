@@ -5,15 +5,28 @@ import (
 	"crypto/x509"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"time"
 
 	"github.com/artilugio0/efin-proxy/internal/certs"
+	"github.com/artilugio0/efin-proxy/internal/findings"
+	"github.com/artilugio0/efin-proxy/internal/flow"
 	"github.com/artilugio0/efin-proxy/internal/grpc"
+	"github.com/artilugio0/efin-proxy/internal/hooks"
+	"github.com/artilugio0/efin-proxy/internal/metrics"
 	"github.com/artilugio0/efin-proxy/internal/pipeline"
+	"github.com/artilugio0/efin-proxy/internal/project"
 	"github.com/artilugio0/efin-proxy/internal/proxy"
 )
 
 type ProxyBuilder struct {
+	// Project is the directory of a project. When set, the database, scope,
+	// match and replace rules and CA of the project are used instead of the
+	// corresponding fields, which are only used as the initial settings of
+	// new projects.
+	Project string
+
 	CertificateFile string
 	KeyFile         string
 
@@ -21,12 +34,50 @@ type ProxyBuilder struct {
 	PrintLogs bool
 	SaveDir   string
 
+	Retention         hooks.RetentionPolicy
+	RetentionInterval time.Duration
+
+	SaveLayout       string
+	SaveBodyFiles    bool
+	SaveMetadata     bool
+	SaveMaxSize      int64
+	SaveGzipSessions bool
+
+	JSONLFile       string
+	JSONLMaxSize    int64
+	JSONLMaxBackups int
+
 	Addr     string
 	GRPCAddr string
 
+	// MetricsAddr is the address of the HTTP server of the Prometheus
+	// metrics, served in /metrics. The server is disabled if it is empty.
+	MetricsAddr string
+
 	DomainRe           string
 	ExcludedExtensions []string
 
+	MatchReplaceRules []hooks.MatchReplaceRule
+
+	// PassiveScan runs the passive scanner on in scope responses
+	PassiveScan bool
+
+	// DetectSecrets reports the secrets found in in scope flows, using the
+	// rules in SecretRulesFile in addition to the default ones
+	DetectSecrets   bool
+	SecretRulesFile string
+
+	// RedactSecrets replaces secrets in the flows written to disk
+	RedactSecrets bool
+
+	// AuthzConfigFile enables the authorization tester with the sessions
+	// of the file
+	AuthzConfigFile string
+
+	// SessionRulesFile enables session handling with the rules and macros
+	// of the file
+	SessionRulesFile string
+
 	RequestInHooks  []func(*http.Request) error
 	RequestModHooks []func(*http.Request) (*http.Request, error)
 	RequestOutHooks []func(*http.Request) error
@@ -34,13 +85,58 @@ type ProxyBuilder struct {
 	ResponseInHooks  []func(*http.Response) error
 	ResponseModHooks []func(*http.Response) (*http.Response, error)
 	ResponseOutHooks []func(*http.Response) error
+
+	// FlowOutHooks run once for each completed exchange of an in scope
+	// request
+	FlowOutHooks []func(*flow.Flow) error
+
+	// HookPriorities overrides the priority of hooks by name. Hooks run in
+	// increasing order of priority, 0 by default. The hooks above are named
+	// by their pipeline and position, e.g. request-mod-0, and the built-in
+	// ones by their feature, e.g. match-replace.
+	HookPriorities map[string]int
+
+	// HookOptions overrides the timeout, error policy and circuit breaker
+	// settings of hooks by name. By default hooks have no timeout and their
+	// errors reject the request.
+	HookOptions map[string]pipeline.Options
+
+	// Overflow sets the overflow policies of the read-only pipelines by
+	// name: request-in, request-out, response-in, response-out and
+	// flow-out. SpoolDir is the directory of the disk queues of the spool
+	// policy, for the pipelines and gRPC clients.
+	Overflow map[string]pipeline.OverflowPolicy
+	SpoolDir string
 }
 
 func (pb *ProxyBuilder) GetProxy() (*Proxy, error) {
 	var rootCA *x509.Certificate
 	var rootKey *rsa.PrivateKey
 
-	if pb.CertificateFile != "" && pb.KeyFile != "" {
+	excludedExtensions := DefaultExcludedExtensions
+	if pb.ExcludedExtensions != nil {
+		excludedExtensions = append([]string{}, pb.ExcludedExtensions...)
+	}
+
+	var proj *project.Project
+	if pb.Project != "" {
+		var err error
+		proj, err = project.Open(pb.Project, project.Settings{
+			DomainRe:           pb.DomainRe,
+			ExcludedExtensions: excludedExtensions,
+			MatchReplaceRules:  pb.MatchReplaceRules,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("Error opening project %s: %v", pb.Project, err)
+		}
+		log.Printf("Opened project %s", pb.Project)
+	}
+
+	if proj != nil {
+		rootCA = proj.RootCA
+		rootKey = proj.RootKey
+		log.Printf("Using Root CA of project %s: %s", pb.Project, proj.CertificateFile())
+	} else if pb.CertificateFile != "" && pb.KeyFile != "" {
 		rca, rk, err := certs.LoadRootCA(pb.CertificateFile, pb.KeyFile)
 		if err != nil {
 			return nil, fmt.Errorf("Error loading Root CA from %s and %s: %v",
@@ -67,44 +163,67 @@ func (pb *ProxyBuilder) GetProxy() (*Proxy, error) {
 
 	p := proxy.NewProxy(rootCA, rootKey)
 
-	requestInHooks := []pipeline.ReadOnlyHook[*http.Request]{}
-	for _, h := range pb.RequestInHooks {
-		requestInHooks = append(requestInHooks, h)
+	requestInHooks := []pipeline.NamedReadOnlyHook[*http.Request]{}
+	for i, h := range pb.RequestInHooks {
+		requestInHooks = append(requestInHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: fmt.Sprintf("request-in-%d", i), Hook: h})
 	}
-	requestModHooks := []pipeline.ModHook[*http.Request]{}
-	for _, h := range pb.RequestModHooks {
-		requestModHooks = append(requestModHooks, h)
+	requestModHooks := []pipeline.NamedModHook[*http.Request]{}
+	for i, h := range pb.RequestModHooks {
+		requestModHooks = append(requestModHooks, pipeline.NamedModHook[*http.Request]{Name: fmt.Sprintf("request-mod-%d", i), Hook: h})
 	}
-	requestOutHooks := []pipeline.ReadOnlyHook[*http.Request]{}
-	for _, h := range pb.RequestOutHooks {
-		requestOutHooks = append(requestOutHooks, h)
+	requestOutHooks := []pipeline.NamedReadOnlyHook[*http.Request]{}
+	for i, h := range pb.RequestOutHooks {
+		requestOutHooks = append(requestOutHooks, pipeline.NamedReadOnlyHook[*http.Request]{Name: fmt.Sprintf("request-out-%d", i), Hook: h})
 	}
-	responseInHooks := []pipeline.ReadOnlyHook[*http.Response]{}
-	for _, h := range pb.ResponseInHooks {
-		responseInHooks = append(responseInHooks, h)
+	responseInHooks := []pipeline.NamedReadOnlyHook[*http.Response]{}
+	for i, h := range pb.ResponseInHooks {
+		responseInHooks = append(responseInHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: fmt.Sprintf("response-in-%d", i), Hook: h})
 	}
-	responseModHooks := []pipeline.ModHook[*http.Response]{}
-	for _, h := range pb.ResponseModHooks {
-		responseModHooks = append(responseModHooks, h)
+	responseModHooks := []pipeline.NamedModHook[*http.Response]{}
+	for i, h := range pb.ResponseModHooks {
+		responseModHooks = append(responseModHooks, pipeline.NamedModHook[*http.Response]{Name: fmt.Sprintf("response-mod-%d", i), Hook: h})
 	}
-	responseOutHooks := []pipeline.ReadOnlyHook[*http.Response]{}
-	for _, h := range pb.ResponseOutHooks {
-		responseOutHooks = append(responseOutHooks, h)
+	responseOutHooks := []pipeline.NamedReadOnlyHook[*http.Response]{}
+	for i, h := range pb.ResponseOutHooks {
+		responseOutHooks = append(responseOutHooks, pipeline.NamedReadOnlyHook[*http.Response]{Name: fmt.Sprintf("response-out-%d", i), Hook: h})
 	}
-
-	excludedExtensions := DefaultExcludedExtensions
-	if pb.ExcludedExtensions != nil {
-		excludedExtensions = append([]string{}, pb.ExcludedExtensions...)
+	flowOutHooks := []pipeline.NamedReadOnlyHook[*flow.Flow]{}
+	for i, h := range pb.FlowOutHooks {
+		flowOutHooks = append(flowOutHooks, pipeline.NamedReadOnlyHook[*flow.Flow]{Name: fmt.Sprintf("flow-out-%d", i), Hook: h})
 	}
+
 	// Initialize gRPC client manager and start the server and define gRPC hooks
 	config := &proxy.Config{
 		DBFile:    pb.DBFile,
 		PrintLogs: pb.PrintLogs,
 		SaveDir:   pb.SaveDir,
 
+		Retention:         pb.Retention,
+		RetentionInterval: pb.RetentionInterval,
+
+		SaveLayout:       pb.SaveLayout,
+		SaveBodyFiles:    pb.SaveBodyFiles,
+		SaveMetadata:     pb.SaveMetadata,
+		SaveMaxSize:      pb.SaveMaxSize,
+		SaveGzipSessions: pb.SaveGzipSessions,
+
+		JSONLFile:       pb.JSONLFile,
+		JSONLMaxSize:    pb.JSONLMaxSize,
+		JSONLMaxBackups: pb.JSONLMaxBackups,
+
 		DomainRe:           pb.DomainRe,
 		ExcludedExtensions: excludedExtensions,
 
+		MatchReplaceRules: pb.MatchReplaceRules,
+
+		PassiveScan:      pb.PassiveScan,
+		DetectSecrets:    pb.DetectSecrets,
+		SecretRulesFile:  pb.SecretRulesFile,
+		RedactSecrets:    pb.RedactSecrets,
+		AuthzConfigFile:  pb.AuthzConfigFile,
+		SessionRulesFile: pb.SessionRulesFile,
+		Findings:         findings.NewBroker(),
+
 		RequestInHooks:  requestInHooks,
 		RequestModHooks: requestModHooks,
 		RequestOutHooks: requestOutHooks,
@@ -112,21 +231,35 @@ func (pb *ProxyBuilder) GetProxy() (*Proxy, error) {
 		ResponseInHooks:  responseInHooks,
 		ResponseModHooks: responseModHooks,
 		ResponseOutHooks: responseOutHooks,
+
+		FlowOutHooks: flowOutHooks,
+
+		HookPriorities: pb.HookPriorities,
+		HookOptions:    pb.HookOptions,
+
+		Overflow: pb.Overflow,
+		SpoolDir: pb.SpoolDir,
+	}
+
+	if proj != nil {
+		proj.Configure(config)
 	}
 
 	if pb.GRPCAddr != "" {
+		// the clients of the server add their hooks to the proxy when they
+		// register
 		grpcServer := grpc.NewServer(pb.GRPCAddr, p, config)
-
-		config.RequestInHooks = append(config.RequestInHooks, grpcServer.RequestInHook)
-		config.RequestModHooks = append(config.RequestModHooks, grpcServer.RequestModHook)
-		config.RequestOutHooks = append(config.RequestOutHooks, grpcServer.RequestOutHook)
-		config.ResponseInHooks = append(config.ResponseInHooks, grpcServer.ResponseInHook)
-		config.ResponseModHooks = append(config.ResponseModHooks, grpcServer.ResponseModHook)
-		config.ResponseOutHooks = append(config.ResponseOutHooks, grpcServer.ResponseOutHook)
-
+		if pb.MetricsAddr != "" {
+			grpcServer.RegisterMetrics(metrics.Default)
+		}
 		go grpcServer.Run()
 	}
 
+	if pb.MetricsAddr != "" {
+		p.RegisterMetrics(metrics.Default)
+		go serveMetrics(pb.MetricsAddr)
+	}
+
 	if err := config.Apply(p); err != nil {
 		return nil, err
 	}
@@ -134,6 +267,17 @@ func (pb *ProxyBuilder) GetProxy() (*Proxy, error) {
 	return &Proxy{Addr: pb.Addr, Proxy: p}, nil
 }
 
+// serveMetrics serves the metrics of the default registry in /metrics
+func serveMetrics(addr string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default.Handler())
+
+	log.Printf("Starting metrics server on %s", addr)
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Printf("Metrics server error: %v", err)
+	}
+}
+
 type Proxy struct {
 	Addr string
 	*proxy.Proxy
@@ -149,9 +293,21 @@ func (p *Proxy) ListenAndServe() error {
 				p.ServeHTTP(w, r)
 			}
 		}),
+		ConnContext: proxy.ConnContext,
+	}
+
+	addr := p.Addr
+	if addr == "" {
+		addr = ":http"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
 	}
 
-	return server.ListenAndServe()
+	// the connections record the requests as received, e.g. their header
+	// order, which net/http does not keep
+	return server.Serve(proxy.NewWireListener(ln))
 }
 
 var DefaultExcludedExtensions []string = []string{